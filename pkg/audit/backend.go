@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/natefinch/lumberjack"
+)
+
+const (
+	// LogPathStdout log path writing audit events to standard out
+	LogPathStdout = "-"
+)
+
+// Backend records audit events to a sink, e.g. a file or a webhook.
+// Backends are used through a BufferedBackend, thus Write is never called concurrently
+type Backend interface {
+	// Name of the backend used in logs and metrics
+	Name() string
+	// Write records a batch of events
+	Write(events []*Event) error
+	// Close flushes and releases the resources of the backend,
+	// Write is not called after Close
+	Close() error
+}
+
+// WriterBackend writes audit events to a writer as JSON lines
+type WriterBackend struct {
+	name    string
+	writer  io.Writer
+	encoder *json.Encoder
+	lock    sync.Mutex
+}
+
+var _ Backend = &WriterBackend{}
+
+// NewWriterBackend creates a backend writing JSON lines to the writer,
+// the writer is closed together with the backend if it is an io.Closer
+func NewWriterBackend(name string, writer io.Writer) *WriterBackend {
+	return &WriterBackend{
+		name:    name,
+		writer:  writer,
+		encoder: json.NewEncoder(writer),
+	}
+}
+
+// NewFileBackend creates a backend writing to a log file rotated after maxSize megabytes,
+// at most maxBackups old files are kept
+func NewFileBackend(path string, maxSize, maxBackups int) *WriterBackend {
+	return NewWriterBackend("log", &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+	})
+}
+
+// NewStdoutBackend creates a backend writing to standard out
+func NewStdoutBackend() *WriterBackend {
+	// standard out must not be closed with the backend
+	return NewWriterBackend("stdout", struct{ io.Writer }{os.Stdout})
+}
+
+// Name returns the name of the backend
+func (b *WriterBackend) Name() string {
+	return b.name
+}
+
+// Write encodes the events as JSON lines
+func (b *WriterBackend) Write(events []*Event) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, ev := range events {
+		if err := b.encoder.Encode(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the writer if it is an io.Closer
+func (b *WriterBackend) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if closer, ok := b.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
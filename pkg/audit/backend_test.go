@@ -0,0 +1,284 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// closeBuffer a writer recording whether it was closed
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func decodeLines(t *testing.T, data []byte) []string {
+	t.Helper()
+	ids := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		ev := &Event{}
+		if err := json.Unmarshal(scanner.Bytes(), ev); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		ids = append(ids, string(ev.AuditID))
+	}
+	return ids
+}
+
+func TestWriterBackend(t *testing.T) {
+	buf := &closeBuffer{}
+	backend := NewWriterBackend("test", buf)
+	if err := backend.Write([]*Event{eventWithID("1"), eventWithID("2")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := backend.Write([]*Event{eventWithID("3")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := decodeLines(t, buf.Bytes()), []string{"1", "2", "3"}; !equalStrings(got, want) {
+		t.Errorf("got events %v, want %v", got, want)
+	}
+	if err := backend.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !buf.closed {
+		t.Errorf("expected the writer to be closed")
+	}
+}
+
+func TestWebhookBackend(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxRetries   int
+		wantRequests int
+		wantErr      bool
+	}{
+		{name: "success", statuses: []int{http.StatusOK}, wantRequests: 1},
+		{name: "retry server error", statuses: []int{http.StatusBadGateway, http.StatusAccepted}, maxRetries: 2, wantRequests: 2},
+		{name: "retry too many requests", statuses: []int{http.StatusTooManyRequests, http.StatusOK}, maxRetries: 1, wantRequests: 2},
+		{name: "no retries", statuses: []int{http.StatusInternalServerError}, wantRequests: 1, wantErr: true},
+		{name: "retries exceeded", statuses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable}, maxRetries: 2, wantRequests: 3, wantErr: true},
+		{name: "client error is not retried", statuses: []int{http.StatusBadRequest, http.StatusOK}, maxRetries: 2, wantRequests: 1, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				lock     sync.Mutex
+				requests int
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				lock.Lock()
+				status := test.statuses[requests]
+				requests++
+				lock.Unlock()
+
+				if r.Method != http.MethodPost {
+					t.Errorf("got method %s, want POST", r.Method)
+				}
+				if got := r.Header.Get("Content-Type"); got != "application/json" {
+					t.Errorf("got content type %q, want application/json", got)
+				}
+				if got := r.Header.Get("Authorization"); got != "Bearer token" {
+					t.Errorf("got authorization %q, want %q", got, "Bearer token")
+				}
+				list := &EventList{}
+				if err := json.NewDecoder(r.Body).Decode(list); err != nil {
+					t.Errorf("invalid body: %v", err)
+				}
+				ids := []string{}
+				for _, ev := range list.Items {
+					ids = append(ids, string(ev.AuditID))
+				}
+				if want := []string{"1", "2"}; !equalStrings(ids, want) {
+					t.Errorf("got events %v, want %v", ids, want)
+				}
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			backend, err := NewWebhookBackend(WebhookConfig{
+				URL:            server.URL,
+				Headers:        map[string]string{"Authorization": "Bearer token"},
+				MaxRetries:     test.maxRetries,
+				InitialBackoff: time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err = backend.Write([]*Event{eventWithID("1"), eventWithID("2")})
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %v", err, test.wantErr)
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			if requests != test.wantRequests {
+				t.Errorf("got %d requests, want %d", requests, test.wantRequests)
+			}
+		})
+	}
+
+	t.Run("retry connection error", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		url := server.URL
+		server.Close()
+
+		start := time.Now()
+		backend, err := NewWebhookBackend(WebhookConfig{URL: url, MaxRetries: 2, InitialBackoff: 20 * time.Millisecond})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := backend.Write([]*Event{eventWithID("1")}); err == nil {
+			t.Fatalf("expected an error")
+		}
+		// the backoff is doubled after each retry
+		if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+			t.Errorf("got %v until giving up, want at least 60ms of backoff", elapsed)
+		}
+	})
+
+	t.Run("url required", func(t *testing.T) {
+		if _, err := NewWebhookBackend(WebhookConfig{}); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+}
+
+// fakeProducer records the sent messages
+type fakeProducer struct {
+	messages []Message
+	err      error
+	closed   bool
+}
+
+func (p *fakeProducer) SendMessages(messages []Message) error {
+	p.messages = append(p.messages, messages...)
+	return p.err
+}
+
+func (p *fakeProducer) Close() error {
+	p.closed = true
+	return nil
+}
+
+func TestStreamBackend(t *testing.T) {
+	producer := &fakeProducer{}
+	backend := NewStreamBackend("kafka", producer)
+	if got := backend.Name(); got != "kafka" {
+		t.Errorf("got name %q, want kafka", got)
+	}
+	if err := backend.Write([]*Event{eventWithID("1"), eventWithID("2")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(producer.messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(producer.messages))
+	}
+	for i, want := range []string{"1", "2"} {
+		msg := producer.messages[i]
+		if string(msg.Key) != want {
+			t.Errorf("got key %q, want %q", msg.Key, want)
+		}
+		ev := &Event{}
+		if err := json.Unmarshal(msg.Value, ev); err != nil {
+			t.Fatalf("invalid value %q: %v", msg.Value, err)
+		}
+		if string(ev.AuditID) != want {
+			t.Errorf("got event %q, want %q", ev.AuditID, want)
+		}
+	}
+
+	producer.err = fmt.Errorf("broker unavailable")
+	if err := backend.Write([]*Event{eventWithID("3")}); err == nil {
+		t.Errorf("expected the error of the producer")
+	}
+	if err := backend.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !producer.closed {
+		t.Errorf("expected the producer to be closed")
+	}
+}
+
+func TestManagerBackends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "audit.log")
+
+	tests := []struct {
+		name         string
+		logPath      string
+		wantBackends []string
+	}{
+		{name: "no log", wantBackends: []string{"fake", "fake"}},
+		{name: "stdout", logPath: LogPathStdout, wantBackends: []string{"stdout", "fake", "fake"}},
+		{name: "file", logPath: logPath, wantBackends: []string{"log", "fake", "fake"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plain := newFakeBackend(false)
+			buffered := NewBufferedBackend(newFakeBackend(false), BufferConfig{BufferSize: 1, DropPolicy: DropPolicyDropNewest})
+			mgr := NewManager(&Config{LogPath: test.logPath, Backends: []Backend{plain, buffered}})
+
+			names := []string{}
+			for _, backend := range mgr.backends {
+				names = append(names, backend.Name())
+			}
+			if !equalStrings(names, test.wantBackends) {
+				t.Fatalf("got backends %v, want %v", names, test.wantBackends)
+			}
+			// buffered backends are used as they are, others are buffered
+			if mgr.backends[len(mgr.backends)-1] != buffered {
+				t.Errorf("expected the buffered backend to be used as it is")
+			}
+
+			if err := mgr.Record(eventWithID("1")); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := mgr.Shutdown(ctx); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, backend := range []*fakeBackend{plain, buffered.backend.(*fakeBackend)} {
+				if got := backend.written(); !equalStrings(got, []string{"1"}) {
+					t.Errorf("got events %v, want [1]", got)
+				}
+				if !backend.closed {
+					t.Errorf("expected the backend to be closed")
+				}
+			}
+			if test.logPath == logPath {
+				data, err := ioutil.ReadFile(logPath)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got := decodeLines(t, data); !equalStrings(got, []string{"1"}) {
+					t.Errorf("got logged events %v, want [1]", got)
+				}
+			}
+
+			// closed backends drop the event, the errors of all backends are returned
+			if err := mgr.Record(eventWithID("2")); err == nil {
+				t.Errorf("expected errors of the closed backends")
+			}
+		})
+	}
+}
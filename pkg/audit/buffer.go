@@ -0,0 +1,251 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"gomod.alauda.cn/log"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// DropPolicy decides what happens to an event when the buffer of a backend is full
+type DropPolicy string
+
+const (
+	// DropPolicyBlock waits until the buffer has room for the event or the backend is shut down
+	DropPolicyBlock DropPolicy = "block"
+	// DropPolicyDropNewest drops the event being recorded
+	DropPolicyDropNewest DropPolicy = "drop-newest"
+	// DropPolicyDropOldest drops the oldest buffered event to make room for the event being recorded
+	DropPolicyDropOldest DropPolicy = "drop-oldest"
+)
+
+const (
+	// DefaultBufferSize default number of events buffered for a backend
+	DefaultBufferSize = 1000
+	// DefaultMaxBatchSize default maximum number of events written to a backend at once
+	DefaultMaxBatchSize = 100
+)
+
+// Valid returns true if the drop policy is known
+func (p DropPolicy) Valid() bool {
+	switch p {
+	case DropPolicyBlock, DropPolicyDropNewest, DropPolicyDropOldest:
+		return true
+	}
+	return false
+}
+
+// BufferConfig buffer and batching of events sent to a backend
+type BufferConfig struct {
+	// BufferSize number of events buffered before the drop policy applies
+	BufferSize int
+	// MaxBatchSize maximum number of events written to the backend at once
+	MaxBatchSize int
+	// MaxBatchWait time waited for a batch to fill up, zero writes the buffered events immediately
+	MaxBatchWait time.Duration
+	// DropPolicy policy applied when the buffer is full, block by default
+	DropPolicy DropPolicy
+}
+
+// BufferedBackend buffers events in memory and writes them in batches to a backend
+// from a single goroutine, thus slow backends do not block each other
+type BufferedBackend struct {
+	backend Backend
+	config  BufferConfig
+	buffer  chan *Event
+
+	lock   sync.Mutex
+	closed bool
+	// closing is closed by Shutdown, events blocked on a full buffer are dropped then
+	closing chan struct{}
+	// sending events being added to the buffer, the buffer is closed once they returned
+	sending sync.WaitGroup
+	done    chan struct{}
+}
+
+var _ Backend = &BufferedBackend{}
+
+// NewBufferedBackend starts writing the events buffered for the backend,
+// zero values of the config use the defaults
+func NewBufferedBackend(backend Backend, config BufferConfig) *BufferedBackend {
+	if config.BufferSize <= 0 {
+		config.BufferSize = DefaultBufferSize
+	}
+	if config.MaxBatchSize <= 0 {
+		config.MaxBatchSize = DefaultMaxBatchSize
+	}
+	if !config.DropPolicy.Valid() {
+		config.DropPolicy = DropPolicyBlock
+	}
+	b := &BufferedBackend{
+		backend: backend,
+		config:  config,
+		buffer:  make(chan *Event, config.BufferSize),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	backendBufferCapacity.WithLabelValues(backend.Name()).Set(float64(config.BufferSize))
+	go b.run()
+	return b
+}
+
+// Name returns the name of the underlying backend
+func (b *BufferedBackend) Name() string {
+	return b.backend.Name()
+}
+
+// Process adds an event to the buffer according to the drop policy,
+// an error is returned if the event was dropped
+func (b *BufferedBackend) Process(ev *Event) error {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		b.dropped(1)
+		return fmt.Errorf("audit backend %s is closed", b.Name())
+	}
+	b.sending.Add(1)
+	b.lock.Unlock()
+	defer b.sending.Done()
+
+	switch b.config.DropPolicy {
+	case DropPolicyDropNewest:
+		select {
+		case b.buffer <- ev:
+		default:
+			b.dropped(1)
+			return fmt.Errorf("audit backend %s buffer is full", b.Name())
+		}
+	case DropPolicyDropOldest:
+		for sent := false; !sent; {
+			select {
+			case b.buffer <- ev:
+				sent = true
+			default:
+				select {
+				case <-b.buffer:
+					b.dropped(1)
+				default:
+				}
+			}
+		}
+	default:
+		select {
+		case b.buffer <- ev:
+		case <-b.closing:
+			b.dropped(1)
+			return fmt.Errorf("audit backend %s is closed", b.Name())
+		}
+	}
+	backendBufferLength.WithLabelValues(b.Name()).Set(float64(len(b.buffer)))
+	return nil
+}
+
+// Write adds the events to the buffer, the BufferedBackend itself is a Backend
+// thus it can be passed to Config.Backends with its own buffer config
+func (b *BufferedBackend) Write(events []*Event) error {
+	var errs []error
+	for _, ev := range events {
+		if err := b.Process(ev); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Close writes all buffered events and closes the backend, waiting as long as it takes
+func (b *BufferedBackend) Close() error {
+	return b.Shutdown(context.Background())
+}
+
+// Shutdown stops accepting events, writes the buffered events and closes the backend.
+// Events blocked on a full buffer are dropped.
+// An error is returned if the context is done before all events were written
+func (b *BufferedBackend) Shutdown(ctx context.Context) error {
+	b.lock.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.closing)
+		go func() {
+			b.sending.Wait()
+			close(b.buffer)
+		}()
+	}
+	b.lock.Unlock()
+
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return fmt.Errorf("audit backend %s did not write buffered events: %v", b.Name(), ctx.Err())
+	}
+	return b.backend.Close()
+}
+
+func (b *BufferedBackend) run() {
+	defer close(b.done)
+	for {
+		ev, ok := <-b.buffer
+		if !ok {
+			return
+		}
+		batch, open := b.collect([]*Event{ev})
+		b.write(batch)
+		if !open {
+			return
+		}
+	}
+}
+
+// collect adds buffered events to the batch until it is full or MaxBatchWait passed,
+// returns false if the buffer was closed
+func (b *BufferedBackend) collect(batch []*Event) ([]*Event, bool) {
+	var timeout <-chan time.Time
+	if b.config.MaxBatchWait > 0 {
+		timer := time.NewTimer(b.config.MaxBatchWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for len(batch) < b.config.MaxBatchSize {
+		if timeout == nil {
+			select {
+			case ev, ok := <-b.buffer:
+				if !ok {
+					return batch, false
+				}
+				batch = append(batch, ev)
+			default:
+				return batch, true
+			}
+			continue
+		}
+		select {
+		case ev, ok := <-b.buffer:
+			if !ok {
+				return batch, false
+			}
+			batch = append(batch, ev)
+		case <-timeout:
+			return batch, true
+		}
+	}
+	return batch, true
+}
+
+func (b *BufferedBackend) write(batch []*Event) {
+	name := b.Name()
+	backendBufferLength.WithLabelValues(name).Set(float64(len(b.buffer)))
+	if err := b.backend.Write(batch); err != nil {
+		log.Error("failed to write audit events", log.String("backend", name), log.Int("events", len(batch)), log.Err(err))
+		backendBatches.WithLabelValues(name, resultError).Inc()
+		backendEvents.WithLabelValues(name, resultError).Add(float64(len(batch)))
+		return
+	}
+	backendBatches.WithLabelValues(name, resultSuccess).Inc()
+	backendEvents.WithLabelValues(name, resultSuccess).Add(float64(len(batch)))
+}
+
+func (b *BufferedBackend) dropped(count int) {
+	backendEvents.WithLabelValues(b.Name(), resultDropped).Add(float64(count))
+}
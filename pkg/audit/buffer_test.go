@@ -0,0 +1,190 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// fakeBackend records the written events, writes block until release is closed
+type fakeBackend struct {
+	lock    sync.Mutex
+	events  []*Event
+	release chan struct{}
+	closed  bool
+}
+
+func newFakeBackend(blocked bool) *fakeBackend {
+	b := &fakeBackend{release: make(chan struct{})}
+	if !blocked {
+		close(b.release)
+	}
+	return b
+}
+
+func (b *fakeBackend) Name() string {
+	return "fake"
+}
+
+func (b *fakeBackend) Write(events []*Event) error {
+	<-b.release
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.events = append(b.events, events...)
+	return nil
+}
+
+func (b *fakeBackend) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.closed = true
+	return nil
+}
+
+func (b *fakeBackend) written() []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	ids := make([]string, 0, len(b.events))
+	for _, ev := range b.events {
+		ids = append(ids, string(ev.AuditID))
+	}
+	return ids
+}
+
+func eventWithID(id string) *Event {
+	return &Event{AuditID: types.UID(id)}
+}
+
+func TestBufferedBackendProcess(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     DropPolicy
+		events     []string
+		wantErrs   int
+		wantEvents []string
+	}{
+		{
+			name:       "drop newest keeps the buffered events",
+			policy:     DropPolicyDropNewest,
+			events:     []string{"a", "b", "c", "d"},
+			wantErrs:   2,
+			wantEvents: []string{"a", "b"},
+		},
+		{
+			name:       "drop oldest keeps the latest events",
+			policy:     DropPolicyDropOldest,
+			events:     []string{"a", "b", "c", "d"},
+			wantEvents: []string{"c", "d"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend := newFakeBackend(true)
+			b := &BufferedBackend{
+				backend: backend,
+				config:  BufferConfig{BufferSize: 2, MaxBatchSize: 10, DropPolicy: test.policy},
+				buffer:  make(chan *Event, 2),
+				closing: make(chan struct{}),
+				done:    make(chan struct{}),
+			}
+			errs := 0
+			for _, id := range test.events {
+				if err := b.Process(eventWithID(id)); err != nil {
+					errs++
+				}
+			}
+			if errs != test.wantErrs {
+				t.Errorf("got %d errors, want %d", errs, test.wantErrs)
+			}
+			// the writer is started after processing so that no event leaves the buffer early
+			go b.run()
+			close(backend.release)
+			if err := b.Shutdown(context.Background()); err != nil {
+				t.Fatalf("unexpected shutdown error: %v", err)
+			}
+			if got := backend.written(); !equalStrings(got, test.wantEvents) {
+				t.Errorf("got events %v, want %v", got, test.wantEvents)
+			}
+			if !backend.closed {
+				t.Errorf("backend was not closed")
+			}
+		})
+	}
+}
+
+func TestBufferedBackendShutdownWritesBufferedEvents(t *testing.T) {
+	backend := newFakeBackend(false)
+	b := NewBufferedBackend(backend, BufferConfig{BufferSize: 10, MaxBatchSize: 3})
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		if err := b.Process(eventWithID(id)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := b.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected shutdown error: %v", err)
+	}
+	if got, want := backend.written(), []string{"a", "b", "c", "d", "e"}; !equalStrings(got, want) {
+		t.Errorf("got events %v, want %v", got, want)
+	}
+	if err := b.Process(eventWithID("f")); err == nil {
+		t.Errorf("expected an error processing events after shutdown")
+	}
+}
+
+// TestBufferedBackendShutdownBlocked checks Shutdown honors its context
+// while events are blocked on the full buffer of a stuck backend
+func TestBufferedBackendShutdownBlocked(t *testing.T) {
+	backend := newFakeBackend(true)
+	defer close(backend.release)
+	b := NewBufferedBackend(backend, BufferConfig{BufferSize: 1, MaxBatchSize: 1, DropPolicy: DropPolicyBlock})
+
+	var senders sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		senders.Add(1)
+		go func() {
+			defer senders.Done()
+			errs <- b.Process(eventWithID("blocked"))
+		}()
+	}
+	// wait for the senders to fill the buffer and block
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := b.Shutdown(ctx); err == nil {
+		t.Errorf("expected an error as the backend is stuck")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("shutdown took %v, the context was ignored", elapsed)
+	}
+
+	// blocked senders return once the backend is shutting down
+	senders.Wait()
+	close(errs)
+	dropped := 0
+	for err := range errs {
+		if err != nil {
+			dropped++
+		}
+	}
+	if dropped == 0 {
+		t.Errorf("expected blocked events to be dropped")
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package audit
 
 import (
 	"bytes"
+	"context"
 	"net/http"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -10,8 +11,27 @@ import (
 // Manager can be used to create, process and record audit events
 type Manager interface {
 	CheckIfRequestMatch(req *http.Request) (matched bool, rule PolicyRule)
+	MatchRequest(req *http.Request, statusCode int) (matched bool, rule PolicyRule)
 	NewAuditEvent(requestRecievedTimestamp metav1.MicroTime, req *http.Request, statusCode int, responseBody *bytes.Buffer) *Event
 	ProcessUserInfo(*Event, *http.Request)
 	ExecutePolicyRule(*Event, PolicyRule, *http.Request)
 	Record(*Event) error
 }
+
+// PolicySetter replaces the audit policy of a Manager at runtime
+type PolicySetter interface {
+	SetPolicy(*Policy)
+}
+
+// Redactor masks sensitive fields of audit events before they leave the process,
+// e.g. before they are spilled to disk
+type Redactor interface {
+	Redact(*Event)
+}
+
+// BackendManager a Manager recording events to backends asynchronously,
+// Shutdown must be called to write the buffered events before exiting
+type BackendManager interface {
+	Manager
+	Shutdown(ctx context.Context) error
+}
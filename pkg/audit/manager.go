@@ -3,14 +3,16 @@ package audit
 import (
 	"bytes"
 	"context"
-	"encoding/json"
-	"io"
 	"net/http"
+	"sync"
 
-	"github.com/natefinch/lumberjack"
+	"gomod.alauda.cn/alauda-backend/pkg/auth/request"
+	abcontext "gomod.alauda.cn/alauda-backend/pkg/context"
 	authnv1 "k8s.io/api/authentication/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
 )
 
 const (
@@ -21,34 +23,57 @@ const (
 
 // DefaultManager default audit manager
 type DefaultManager struct {
-	recorder    io.Writer
+	backends    []*BufferedBackend
 	policy      *Policy
-	encoder     *json.Encoder
+	policyLock  sync.RWMutex
 	tokenParser authenticator.Token
+
+	requestInfoResolver request.RequestInfoResolver
 }
 
+var _ BackendManager = &DefaultManager{}
+
 // Config is used to generate a DefaultManager
 type Config struct {
-	PolicyPath    string
+	PolicyPath string
+	// LogPath file events are logged to, "-" logs to standard out, empty disables the log
 	LogPath       string
 	LogMaxSize    int
 	LogMaxBackups int
+	// LogBuffer buffer and drop policy of the log backend
+	LogBuffer BufferConfig
+	// Backends events are sent to besides the log, e.g. a WebhookBackend.
+	// Backends which are not a BufferedBackend are buffered with the default config
+	Backends []Backend
+	// RequestInfoResolver resolves the request info matched by policy rules,
+	// DefaultRequestInfoResolver if nil
+	RequestInfoResolver request.RequestInfoResolver
 }
 
-// NewManager creates a DefaultManager instance
+// NewManager creates a DefaultManager instance sending each event to all backends
 func NewManager(config *Config) *DefaultManager {
 	policy, _ := LoadPolicyFromFile(config.PolicyPath)
-	recorder := &lumberjack.Logger{
-		Filename:   config.LogPath,
-		MaxSize:    config.LogMaxSize,
-		MaxBackups: config.LogMaxBackups,
-	}
-	return &DefaultManager{
-		recorder:    recorder,
+	mgr := &DefaultManager{
 		policy:      policy,
-		encoder:     json.NewEncoder(recorder),
 		tokenParser: NewOIDCTokenParser(),
+
+		requestInfoResolver: config.RequestInfoResolver,
+	}
+	switch config.LogPath {
+	case "":
+	case LogPathStdout:
+		mgr.backends = append(mgr.backends, NewBufferedBackend(NewStdoutBackend(), config.LogBuffer))
+	default:
+		mgr.backends = append(mgr.backends, NewBufferedBackend(NewFileBackend(config.LogPath, config.LogMaxSize, config.LogMaxBackups), config.LogBuffer))
 	}
+	for _, backend := range config.Backends {
+		buffered, ok := backend.(*BufferedBackend)
+		if !ok {
+			buffered = NewBufferedBackend(backend, BufferConfig{})
+		}
+		mgr.backends = append(mgr.backends, buffered)
+	}
+	return mgr
 }
 
 // NewAuditEvent create and initialize a audit event object
@@ -62,25 +87,70 @@ func (mgr *DefaultManager) ProcessUserInfo(ae *Event, req *http.Request) {
 		Username: anonymousUser,
 	}
 
-	token := GetToken(req)
-	if token == "" {
+	info := mgr.userInfo(req)
+	if info == nil {
 		return
 	}
+	ae.User = authnv1.UserInfo{
+		Username: info.GetName(),
+		UID:      info.GetUID(),
+		Groups:   info.GetGroups(),
+	}
+	if len(info.GetExtra()) > 0 {
+		ae.User.Extra = make(map[string]authnv1.ExtraValue, len(info.GetExtra()))
+		for k, v := range info.GetExtra() {
+			ae.User.Extra[k] = authnv1.ExtraValue(v)
+		}
+	}
+}
 
+// userInfo returns the user resolved by the authentication filter,
+// the user of the token if the request was not authenticated yet or nil
+func (mgr *DefaultManager) userInfo(req *http.Request) user.Info {
+	if info := abcontext.User(req.Context()); info != nil {
+		return info
+	}
+	token := GetToken(req)
+	if token == "" {
+		return nil
+	}
 	userResp, _, err := mgr.tokenParser.AuthenticateToken(context.TODO(), token)
 	if err != nil {
-		return
-	}
-	ae.User = authnv1.UserInfo{
-		Username: userResp.User.GetName(),
-		UID:      userResp.User.GetUID(),
-		Groups:   userResp.User.GetGroups(),
+		return nil
 	}
+	return userResp.User
 }
 
-// CheckIfRequestMatch checks if request match the policy rules
+// CheckIfRequestMatch checks if request match the policy rules,
+// rules matching status codes do not match as the response status is unknown
 func (mgr *DefaultManager) CheckIfRequestMatch(req *http.Request) (matched bool, rule PolicyRule) {
-	return CheckPolicyMatch(req, mgr.policy)
+	return mgr.MatchRequest(req, 0)
+}
+
+// MatchRequest checks if the request with the response status code matches the policy rules,
+// a zero status code means the response was not written yet
+func (mgr *DefaultManager) MatchRequest(req *http.Request, statusCode int) (matched bool, rule PolicyRule) {
+	return MatchPolicy(mgr.Policy(), &RequestAttributes{
+		Request:             req,
+		StatusCode:          statusCode,
+		RequestInfoResolver: mgr.requestInfoResolver,
+		userResolver:        mgr.userInfo,
+	})
+}
+
+// SetPolicy replaces the current audit policy,
+// requests being processed keep using the policy they matched
+func (mgr *DefaultManager) SetPolicy(policy *Policy) {
+	mgr.policyLock.Lock()
+	defer mgr.policyLock.Unlock()
+	mgr.policy = policy
+}
+
+// Policy returns the current audit policy
+func (mgr *DefaultManager) Policy() *Policy {
+	mgr.policyLock.RLock()
+	defer mgr.policyLock.RUnlock()
+	return mgr.policy
 }
 
 // ExecutePolicyRule will fullfill audit event's Verb and ObjectRef fields according to policy rules
@@ -88,7 +158,37 @@ func (mgr *DefaultManager) ExecutePolicyRule(e *Event, r PolicyRule, req *http.R
 	ExecutePolicyProcess(e, r, req)
 }
 
-// Record will log audit event to specified audit log file
+// Redact masks the sensitive fields of the event according to the redaction of the policy
+// the request matched, thus replacing the policy does not affect requests being processed.
+// Events which did not match a policy rule, e.g. of custom handlers, use the current policy
+func (mgr *DefaultManager) Redact(ae *Event) {
+	if ae != nil && ae.redaction != nil {
+		ae.redaction.redact(ae)
+		return
+	}
+	mgr.Policy().Redact(ae)
+}
+
+// Record redacts the audit event and sends it to the buffers of all backends,
+// returns the errors of the backends which dropped the event
 func (mgr *DefaultManager) Record(ae *Event) error {
-	return mgr.encoder.Encode(ae)
+	mgr.Redact(ae)
+	var errs []error
+	for _, backend := range mgr.backends {
+		if err := backend.Process(ae); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Shutdown writes the buffered events and closes all backends
+func (mgr *DefaultManager) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, backend := range mgr.backends {
+		if err := backend.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
 }
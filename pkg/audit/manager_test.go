@@ -0,0 +1,52 @@
+package audit
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	abcontext "gomod.alauda.cn/alauda-backend/pkg/context"
+	authnv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func TestProcessUserInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		user user.Info
+		want authnv1.UserInfo
+	}{
+		{
+			name: "authenticated user",
+			user: &user.DefaultInfo{
+				Name:   "alice@example.com",
+				UID:    "alice-id",
+				Groups: []string{"devs"},
+				Extra:  map[string][]string{"is_admin": {"true"}},
+			},
+			want: authnv1.UserInfo{
+				Username: "alice@example.com",
+				UID:      "alice-id",
+				Groups:   []string{"devs"},
+				Extra:    map[string]authnv1.ExtraValue{"is_admin": {"true"}},
+			},
+		},
+		{
+			name: "anonymous",
+			want: authnv1.UserInfo{Username: anonymousUser},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/apis/v1/users", nil)
+			if test.user != nil {
+				req = req.WithContext(abcontext.WithUser(req.Context(), test.user))
+			}
+			ev := &Event{}
+			(&DefaultManager{}).ProcessUserInfo(ev, req)
+			if !reflect.DeepEqual(ev.User, test.want) {
+				t.Errorf("got user %+v, want %+v", ev.User, test.want)
+			}
+		})
+	}
+}
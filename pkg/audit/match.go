@@ -0,0 +1,280 @@
+package audit
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gomod.alauda.cn/alauda-backend/pkg/auth/request"
+	abcontext "gomod.alauda.cn/alauda-backend/pkg/context"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// DefaultRequestInfoResolver resolves the RequestInfo matched by policy rules if none is configured,
+// it uses the default api prefix of the authorization
+var DefaultRequestInfoResolver request.RequestInfoResolver = &request.RequestInfoFactory{
+	APIPrefixes: sets.NewString("platform"),
+}
+
+// RequestAttributes attributes of a request policy rules are matched against
+type RequestAttributes struct {
+	Request *http.Request
+	// StatusCode status code of the response, zero if the response was not written yet.
+	// Rules matching status codes never match if it is zero
+	StatusCode int
+	// User authenticated user, the user of the request context is used if nil
+	User user.Info
+	// RequestInfoResolver resolves the request info matched by verbs, resources and scopes,
+	// DefaultRequestInfoResolver is used if nil
+	RequestInfoResolver request.RequestInfoResolver
+
+	// userResolver resolves the user if the request context has none, e.g. from the token
+	userResolver func(*http.Request) user.Info
+	info         *request.RequestInfo
+	infoResolved bool
+}
+
+// compiledMatch a RequestMatch compiled when the policy is loaded
+type compiledMatch struct {
+	err        error
+	path       *regexp.Regexp
+	methods    sets.String
+	users      sets.String
+	groups     sets.String
+	userAgent  *regexp.Regexp
+	headers    map[string]*regexp.Regexp
+	statuses   []statusRange
+	verbs      sets.String
+	apiGroups  sets.String
+	resources  sets.String
+	namespaces sets.String
+	clusters   sets.String
+	projects   sets.String
+}
+
+// statusRange inclusive range of status codes
+type statusRange struct {
+	min, max int
+}
+
+// Compile compiles the regular expressions and status code ranges of all rules
+// and the redaction paths, rules which are invalid never match. Policies loaded from files are compiled while loading,
+// other policies are compiled the first time they are matched
+func (p *Policy) Compile() error {
+	p.compileOnce.Do(func() {
+		var errs []error
+		for i := range p.Rules {
+			p.Rules[i].compiled = compileMatch(p.Rules[i].Match)
+			p.Rules[i].redaction = &p.Redaction
+			if err := p.Rules[i].compiled.err; err != nil {
+				errs = append(errs, fmt.Errorf("invalid match of rule %d: %v", i, err))
+			}
+			if len(p.OmitStages) > 0 {
+				p.Rules[i].OmitStages = append(append([]auditinternal.Stage{}, p.OmitStages...), p.Rules[i].OmitStages...)
+			}
+		}
+		if err := p.Redaction.compile(); err != nil {
+			errs = append(errs, err)
+		}
+		p.compileErr = utilerrors.NewAggregate(errs)
+	})
+	return p.compileErr
+}
+
+// MatchPolicy returns the first rule of the policy matching the request.
+// A matching rule with level None stops matching without a match, thus requests can be excluded
+// from auditing by rules preceding the others
+func MatchPolicy(policy *Policy, attrs *RequestAttributes) (matched bool, rule PolicyRule) {
+	if policy == nil || attrs == nil || attrs.Request == nil {
+		return
+	}
+	policy.Compile()
+	for _, r := range policy.Rules {
+		if !r.compiled.matches(attrs) {
+			continue
+		}
+		if r.Level == auditinternal.LevelNone {
+			return false, r
+		}
+		return true, r
+	}
+	return
+}
+
+func compileMatch(m RequestMatch) *compiledMatch {
+	c := &compiledMatch{
+		methods:    sets.NewString(m.Methods...),
+		users:      sets.NewString(m.Users...),
+		groups:     sets.NewString(m.Groups...),
+		verbs:      sets.NewString(m.Verbs...),
+		apiGroups:  sets.NewString(m.APIGroups...),
+		resources:  sets.NewString(m.Resources...),
+		namespaces: sets.NewString(m.Namespaces...),
+		clusters:   sets.NewString(m.Clusters...),
+		projects:   sets.NewString(m.Projects...),
+	}
+	var err error
+	if c.path, err = regexp.Compile(m.Path); err != nil {
+		c.err = fmt.Errorf("path: %v", err)
+		return c
+	}
+	if m.UserAgent != "" {
+		if c.userAgent, err = regexp.Compile(m.UserAgent); err != nil {
+			c.err = fmt.Errorf("userAgent: %v", err)
+			return c
+		}
+	}
+	if len(m.Headers) > 0 {
+		c.headers = make(map[string]*regexp.Regexp, len(m.Headers))
+		for name, expr := range m.Headers {
+			if c.headers[http.CanonicalHeaderKey(name)], err = regexp.Compile(expr); err != nil {
+				c.err = fmt.Errorf("header %s: %v", name, err)
+				return c
+			}
+		}
+	}
+	for _, val := range m.StatusCodes {
+		status, err := parseStatusRange(val)
+		if err != nil {
+			c.err = err
+			return c
+		}
+		c.statuses = append(c.statuses, status)
+	}
+	return c
+}
+
+// parseStatusRange parses a status code "404", a class "4xx" or a range "500-503"
+func parseStatusRange(val string) (statusRange, error) {
+	if len(val) == 3 && strings.HasSuffix(val, "xx") && val[0] >= '1' && val[0] <= '5' {
+		class := int(val[0]-'0') * 100
+		return statusRange{min: class, max: class + 99}, nil
+	}
+	parts := strings.SplitN(val, "-", 2)
+	min, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return statusRange{}, fmt.Errorf("invalid status code %q", val)
+	}
+	max := min
+	if len(parts) == 2 {
+		if max, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil || max < min {
+			return statusRange{}, fmt.Errorf("invalid status code range %q", val)
+		}
+	}
+	return statusRange{min: min, max: max}, nil
+}
+
+// matches returns true if the request matches all the criteria of the rule,
+// empty criteria match any request except methods which are required
+func (c *compiledMatch) matches(attrs *RequestAttributes) bool {
+	if c == nil || c.err != nil {
+		return false
+	}
+	req := attrs.Request
+	if !c.path.MatchString(req.URL.Path) || !c.methods.Has(strings.ToLower(req.Method)) {
+		return false
+	}
+	if c.userAgent != nil && !c.userAgent.MatchString(req.UserAgent()) {
+		return false
+	}
+	for name, expr := range c.headers {
+		if !expr.MatchString(req.Header.Get(name)) {
+			return false
+		}
+	}
+	if len(c.statuses) > 0 && !c.matchesStatus(attrs.StatusCode) {
+		return false
+	}
+	if c.users.Len() > 0 || c.groups.Len() > 0 {
+		if !c.matchesUser(attrs.user()) {
+			return false
+		}
+	}
+	if c.verbs.Len() > 0 || c.apiGroups.Len() > 0 || c.resources.Len() > 0 ||
+		c.namespaces.Len() > 0 || c.clusters.Len() > 0 || c.projects.Len() > 0 {
+		if !c.matchesRequestInfo(attrs.requestInfo()) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *compiledMatch) matchesStatus(code int) bool {
+	if code == 0 {
+		return false
+	}
+	for _, status := range c.statuses {
+		if code >= status.min && code <= status.max {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesUser returns true if the user has one of the names or is in one of the groups
+func (c *compiledMatch) matchesUser(info user.Info) bool {
+	if info == nil {
+		return false
+	}
+	if c.users.Has(info.GetName()) {
+		return true
+	}
+	for _, group := range info.GetGroups() {
+		if c.groups.Has(group) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compiledMatch) matchesRequestInfo(info *request.RequestInfo) bool {
+	if info == nil {
+		return false
+	}
+	resource := info.Resource
+	if info.Subresource != "" {
+		resource += "/" + info.Subresource
+	}
+	return matchesAny(c.verbs, info.Verb) &&
+		matchesAny(c.apiGroups, info.APIGroup) &&
+		matchesAny(c.resources, resource) &&
+		matchesAny(c.namespaces, info.Namespace) &&
+		matchesAny(c.clusters, info.Cluster) &&
+		matchesAny(c.projects, info.Project)
+}
+
+// matchesAny returns true if the set is empty, contains "*" or the value
+func matchesAny(set sets.String, val string) bool {
+	return set.Len() == 0 || set.Has("*") || set.Has(val)
+}
+
+// user resolves the user once
+func (attrs *RequestAttributes) user() user.Info {
+	if attrs.User == nil {
+		attrs.User = abcontext.User(attrs.Request.Context())
+	}
+	if attrs.User == nil && attrs.userResolver != nil {
+		attrs.User = attrs.userResolver(attrs.Request)
+		attrs.userResolver = nil
+	}
+	return attrs.User
+}
+
+// requestInfo resolves the request info once, nil if the path is invalid
+func (attrs *RequestAttributes) requestInfo() *request.RequestInfo {
+	if attrs.infoResolved {
+		return attrs.info
+	}
+	attrs.infoResolved = true
+	resolver := attrs.RequestInfoResolver
+	if resolver == nil {
+		resolver = DefaultRequestInfoResolver
+	}
+	attrs.info, _ = resolver.NewRequestInfo(attrs.Request)
+	return attrs.info
+}
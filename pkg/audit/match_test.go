@@ -0,0 +1,193 @@
+package audit
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	abcontext "gomod.alauda.cn/alauda-backend/pkg/context"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func TestMatchPolicy(t *testing.T) {
+	policy := &Policy{Rules: []PolicyRule{
+		{
+			Level: auditinternal.LevelNone,
+			Match: RequestMatch{Path: "^/healthz$", Methods: []string{"get"}},
+		},
+		{
+			Level: auditinternal.LevelMetadata,
+			Match: RequestMatch{Path: ".*", Methods: []string{"get"}, Users: []string{"alice@example.com"}, Groups: []string{"auditors"}},
+		},
+		{
+			Level: auditinternal.LevelRequest,
+			Match: RequestMatch{Path: ".*", Methods: []string{"post"}, UserAgent: "^kubectl/", Headers: map[string]string{"x-tenant": "^team-"}},
+		},
+		{
+			Level: auditinternal.LevelRequestResponse,
+			Match: RequestMatch{Path: ".*", Methods: []string{"delete"}, StatusCodes: []string{"4xx", "500-503"}},
+		},
+		{
+			Level: auditinternal.LevelRequestResponse,
+			Match: RequestMatch{
+				Path:       ".*",
+				Methods:    []string{"put"},
+				Verbs:      []string{"update"},
+				APIGroups:  []string{"apps"},
+				Resources:  []string{"deployments/scale"},
+				Namespaces: []string{"*"},
+				Clusters:   []string{"c1"},
+				Projects:   []string{"p1"},
+			},
+		},
+	}}
+	scale := "/platform/apps/v1/projects/p1/clusters/c1/namespaces/ns1/deployments/nginx/scale"
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		user      user.Info
+		userAgent string
+		headers   map[string]string
+		status    int
+		want      bool
+		wantLevel auditinternal.Level
+	}{
+		{name: "excluded by a level none rule", method: "GET", path: "/healthz", wantLevel: auditinternal.LevelNone},
+		{name: "user", method: "GET", path: "/apis/v1/users", user: &user.DefaultInfo{Name: "alice@example.com"}, want: true, wantLevel: auditinternal.LevelMetadata},
+		{name: "group", method: "GET", path: "/apis/v1/users", user: &user.DefaultInfo{Name: "bob@example.com", Groups: []string{"devs", "auditors"}}, want: true, wantLevel: auditinternal.LevelMetadata},
+		{name: "other user", method: "GET", path: "/apis/v1/users", user: &user.DefaultInfo{Name: "bob@example.com", Groups: []string{"devs"}}},
+		{name: "anonymous", method: "GET", path: "/apis/v1/users"},
+		{name: "user agent and header", method: "POST", path: "/apis/v1/users", userAgent: "kubectl/v1.20", headers: map[string]string{"X-Tenant": "team-a"}, want: true, wantLevel: auditinternal.LevelRequest},
+		{name: "other user agent", method: "POST", path: "/apis/v1/users", userAgent: "curl/7.68", headers: map[string]string{"X-Tenant": "team-a"}},
+		{name: "missing header", method: "POST", path: "/apis/v1/users", userAgent: "kubectl/v1.20"},
+		{name: "status class", method: "DELETE", path: "/apis/v1/users/bob", status: 404, want: true, wantLevel: auditinternal.LevelRequestResponse},
+		{name: "status range", method: "DELETE", path: "/apis/v1/users/bob", status: 502, want: true, wantLevel: auditinternal.LevelRequestResponse},
+		{name: "other status", method: "DELETE", path: "/apis/v1/users/bob", status: 200},
+		{name: "unknown status", method: "DELETE", path: "/apis/v1/users/bob"},
+		{name: "request info", method: "PUT", path: scale, want: true, wantLevel: auditinternal.LevelRequestResponse},
+		{name: "other cluster", method: "PUT", path: "/platform/apps/v1/projects/p1/clusters/c2/namespaces/ns1/deployments/nginx/scale"},
+		{name: "other subresource", method: "PUT", path: "/platform/apps/v1/projects/p1/clusters/c1/namespaces/ns1/deployments/nginx/status"},
+		{name: "non-resource request", method: "PUT", path: "/apis/v1/users/bob"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, nil)
+			if test.user != nil {
+				req = req.WithContext(abcontext.WithUser(req.Context(), test.user))
+			}
+			if test.userAgent != "" {
+				req.Header.Set("User-Agent", test.userAgent)
+			}
+			for name, val := range test.headers {
+				req.Header.Set(name, val)
+			}
+			matched, rule := MatchPolicy(policy, &RequestAttributes{Request: req, StatusCode: test.status})
+			if matched != test.want {
+				t.Errorf("got matched %v, want %v", matched, test.want)
+			}
+			if rule.Level != test.wantLevel {
+				t.Errorf("got level %q, want %q", rule.Level, test.wantLevel)
+			}
+		})
+	}
+}
+
+func TestParseStatusRange(t *testing.T) {
+	tests := []struct {
+		val     string
+		want    statusRange
+		wantErr bool
+	}{
+		{val: "404", want: statusRange{min: 404, max: 404}},
+		{val: "4xx", want: statusRange{min: 400, max: 499}},
+		{val: "500-503", want: statusRange{min: 500, max: 503}},
+		{val: "503-500", wantErr: true},
+		{val: "6xx", wantErr: true},
+		{val: "ok", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.val, func(t *testing.T) {
+			got, err := parseStatusRange(test.val)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadPolicyFromBytes(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         string
+		wantErr        bool
+		wantOmitStages []auditinternal.Stage
+	}{
+		{
+			name: "valid policy",
+			policy: `
+omitStages: [ResponseStarted]
+rules:
+- level: Metadata
+  stages: [RequestReceived, Panic]
+  match:
+    path: ^/apis/
+    methods: [post]
+    statusCodes: [2xx]
+`,
+			wantOmitStages: []auditinternal.Stage{auditinternal.StageResponseStarted},
+		},
+		{name: "invalid path", policy: "rules:\n- level: Metadata\n  match:\n    path: \"(\"\n    methods: [post]\n", wantErr: true},
+		{name: "invalid header", policy: "rules:\n- level: Metadata\n  match:\n    methods: [post]\n    headers:\n      x-tenant: \"[\"\n", wantErr: true},
+		{name: "invalid status code", policy: "rules:\n- level: Metadata\n  match:\n    methods: [post]\n    statusCodes: [abc]\n", wantErr: true},
+		{name: "unknown stage", policy: "rules:\n- level: Metadata\n  stages: [Started]\n", wantErr: true},
+		{name: "unknown omitted stage", policy: "omitStages: [Done]\n", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := LoadPolicyFromBytes([]byte(test.policy))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			rule := policy.Rules[0]
+			if !equalStages(rule.OmitStages, test.wantOmitStages) {
+				t.Errorf("got omitted stages %v, want %v", rule.OmitStages, test.wantOmitStages)
+			}
+			for stage, want := range map[auditinternal.Stage]bool{
+				auditinternal.StageRequestReceived:  true,
+				auditinternal.StageResponseStarted:  false,
+				auditinternal.StageResponseComplete: true,
+				auditinternal.StagePanic:            true,
+			} {
+				if got := rule.HasStage(stage); got != want {
+					t.Errorf("got stage %s %v, want %v", stage, got, want)
+				}
+			}
+		})
+	}
+
+	// rules which failed to compile never match
+	policy := &Policy{Rules: []PolicyRule{{Level: auditinternal.LevelMetadata, Match: RequestMatch{Path: "(", Methods: []string{"get"}}}}}
+	if matched, _ := MatchPolicy(policy, &RequestAttributes{Request: httptest.NewRequest("GET", "/", nil)}); matched {
+		t.Errorf("expected an invalid rule not to match")
+	}
+}
+
+func equalStages(a, b []auditinternal.Stage) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
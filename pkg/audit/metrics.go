@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+	resultDropped = "dropped"
+)
+
+var (
+	backendEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "audit_backend_events_total",
+			Help: "Counter of audit events handled by each backend broken out for each result, success, error or dropped.",
+		},
+		[]string{"backend", "result"},
+	)
+	backendBatches = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "audit_backend_batches_total",
+			Help: "Counter of audit event batches written by each backend broken out for each result, success or error.",
+		},
+		[]string{"backend", "result"},
+	)
+	backendBufferLength = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "audit_backend_buffer_length",
+			Help: "Number of audit events waiting in the buffer of each backend.",
+		},
+		[]string{"backend"},
+	)
+	backendBufferCapacity = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "audit_backend_buffer_capacity",
+			Help: "Capacity of the buffer of each backend.",
+		},
+		[]string{"backend"},
+	)
+
+	registerMetricsOnce sync.Once
+)
+
+// RegisterMetrics registers audit metrics on the default prometheus registry
+func RegisterMetrics() {
+	registerMetricsOnce.Do(func() {
+		prometheus.MustRegister(backendEvents, backendBatches, backendBufferLength, backendBufferCapacity)
+	})
+}
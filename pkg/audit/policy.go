@@ -6,7 +6,6 @@ import (
 	"html/template"
 	"io/ioutil"
 	"net/http"
-	"regexp"
 	"strings"
 
 	"github.com/Masterminds/sprig"
@@ -14,6 +13,14 @@ import (
 	auditinternal "k8s.io/apiserver/pkg/apis/audit"
 )
 
+// stages known audit stages
+var stages = map[auditinternal.Stage]bool{
+	auditinternal.StageRequestReceived:  true,
+	auditinternal.StageResponseStarted:  true,
+	auditinternal.StageResponseComplete: true,
+	auditinternal.StagePanic:            true,
+}
+
 var defaultVerbMatching = map[string]string{
 	"get":    "view",
 	"put":    "update",
@@ -29,27 +36,36 @@ type auditCtx struct {
 	Response interface{}
 }
 
-// CheckPolicyMatch checks if request matches audit policy, and return if matched and the matched rule
+// CheckPolicyMatch checks if request matches audit policy, and return if matched and the matched rule.
+// The response status is unknown, thus rules matching status codes do not match
 func CheckPolicyMatch(req *http.Request, policy *Policy) (matched bool, rule PolicyRule) {
-	for _, r := range policy.Rules {
-		reg, err := regexp.Compile(r.Match.Path)
-		if err != nil {
-			continue
-		}
-		if !reg.MatchString(req.URL.Path) {
-			continue
+	return MatchPolicy(policy, &RequestAttributes{Request: req})
+}
+
+// HasStage returns true if the rule generates an event for the stage.
+// ResponseStarted and ResponseComplete are generated unless omitted,
+// other stages only if the rule opts into them
+func (r PolicyRule) HasStage(stage auditinternal.Stage) bool {
+	for _, omitted := range r.OmitStages {
+		if omitted == stage {
+			return false
 		}
-		requestMethod := strings.ToLower(req.Method)
-		if !contains(r.Match.Methods, requestMethod) {
-			continue
+	}
+	if stage == auditinternal.StageResponseStarted || stage == auditinternal.StageResponseComplete {
+		return true
+	}
+	for _, s := range r.Stages {
+		if s == stage {
+			return true
 		}
-		return true, r
 	}
-	return
+	return false
 }
 
-// ExecutePolicyProcess will fullfill event's fieild accourding to specified rule
+// ExecutePolicyProcess will fullfill event's fieild accourding to specified rule,
+// the event is redacted according to the policy of the rule when it is recorded
 func ExecutePolicyProcess(e *Event, r PolicyRule, req *http.Request) {
+	e.redaction = r.redaction
 	requestMethod := strings.ToLower(req.Method)
 	verb, ok := r.Process.VerbMatching[requestMethod]
 	if !ok {
@@ -114,6 +130,20 @@ func LoadPolicyFromBytes(policyDef []byte) (*Policy, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed decoding: %v", err)
 	}
+	if err := validateStages(policy.OmitStages); err != nil {
+		return nil, fmt.Errorf("invalid omitStages: %v", err)
+	}
+	for i, r := range policy.Rules {
+		if err := validateStages(r.Stages); err != nil {
+			return nil, fmt.Errorf("invalid stages of rule %d: %v", i, err)
+		}
+		if err := validateStages(r.OmitStages); err != nil {
+			return nil, fmt.Errorf("invalid omitStages of rule %d: %v", i, err)
+		}
+	}
+	if err := policy.Compile(); err != nil {
+		return nil, err
+	}
 
 	return policy, nil
 }
@@ -134,13 +164,12 @@ func convertTemplate(tmplStr string, ctx auditCtx) string {
 	return raw.String()
 }
 
-// check if string slice contains a specified item
-func contains(slice []string, item string) bool {
-	set := make(map[string]struct{}, len(slice))
-	for _, s := range slice {
-		set[s] = struct{}{}
+// validateStages returns an error for unknown stages
+func validateStages(list []auditinternal.Stage) error {
+	for _, stage := range list {
+		if !stages[stage] {
+			return fmt.Errorf("unknown stage %q", stage)
+		}
 	}
-
-	_, ok := set[item]
-	return ok
+	return nil
 }
@@ -0,0 +1,311 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// DefaultRedactionMask replaces the values of masked fields
+	DefaultRedactionMask = "******"
+
+	fieldTruncateSuffix  = "...TRUNCATED"
+	objectTruncatedField = "truncated"
+)
+
+// DefaultRedactedFields names of fields masked at any depth unless the defaults are disabled,
+// besides the data and stringData of secrets
+var DefaultRedactedFields = []string{
+	"password",
+	"oldPassword",
+	"newPassword",
+	"token",
+	"accessToken",
+	"refreshToken",
+	"idToken",
+	"clientSecret",
+	"privateKey",
+}
+
+var (
+	// defaultRedaction redaction of events recorded without a policy
+	defaultRedaction     = &Redaction{}
+	defaultRedactionOnce sync.Once
+)
+
+// Redaction masks sensitive fields of request and response objects before events are recorded
+// and caps the size of the objects
+type Redaction struct {
+	// DisableDefaults disables masking DefaultRedactedFields and the data of secrets
+	DisableDefaults bool `yaml:"disableDefaults,omitempty"`
+	// Fields names of fields masked at any depth, case insensitive
+	Fields []string `yaml:"fields,omitempty"`
+	// Paths field paths masked from the root of the objects, e.g. $.spec.password or items[*].data.
+	// * matches any field and [*] any item of a list
+	Paths []string `yaml:"paths,omitempty"`
+	// Mask replaces masked values, DefaultRedactionMask if empty.
+	// Fields of masked objects are kept with masked values, e.g. the keys of secret data
+	Mask string `yaml:"mask,omitempty"`
+	// MaxFieldLength strings longer than it are truncated, 0 means unlimited
+	MaxFieldLength int `yaml:"maxFieldLength,omitempty"`
+	// MaxObjectSize objects larger than it in bytes when JSON encoded are replaced by a truncation marker,
+	// 0 means unlimited
+	MaxObjectSize int `yaml:"maxObjectSize,omitempty"`
+
+	fields sets.String
+	paths  [][]pathSegment
+}
+
+// pathSegment a field or list index of a field path
+type pathSegment struct {
+	field string
+	// index of a list item, -1 for any item
+	index   int
+	isIndex bool
+}
+
+// compile parses the paths and collects the masked fields
+func (r *Redaction) compile() error {
+	r.fields = sets.NewString()
+	if !r.DisableDefaults {
+		for _, field := range DefaultRedactedFields {
+			r.fields.Insert(strings.ToLower(field))
+		}
+	}
+	for _, field := range r.Fields {
+		r.fields.Insert(strings.ToLower(field))
+	}
+	r.paths = nil
+	for _, path := range r.Paths {
+		segments, err := parseFieldPath(path)
+		if err != nil {
+			return err
+		}
+		r.paths = append(r.paths, segments)
+	}
+	return nil
+}
+
+// parseFieldPath parses a path like $.items[*].spec.password
+func parseFieldPath(path string) ([]pathSegment, error) {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if trimmed == "" {
+		return nil, fmt.Errorf("invalid redaction path %q", path)
+	}
+	var segments []pathSegment
+	for _, part := range strings.Split(trimmed, ".") {
+		field := part
+		if i := strings.Index(part, "["); i >= 0 {
+			field = part[:i]
+		}
+		if field != "" {
+			segments = append(segments, pathSegment{field: field})
+		} else if !strings.HasPrefix(part, "[") {
+			return nil, fmt.Errorf("invalid redaction path %q", path)
+		}
+		for rest := part[len(field):]; rest != ""; {
+			end := strings.Index(rest, "]")
+			if !strings.HasPrefix(rest, "[") || end < 0 {
+				return nil, fmt.Errorf("invalid redaction path %q", path)
+			}
+			index := -1
+			if val := rest[1:end]; val != "*" {
+				var err error
+				if index, err = strconv.Atoi(val); err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid index %q in redaction path %q", val, path)
+				}
+			}
+			segments = append(segments, pathSegment{index: index, isIndex: true})
+			rest = rest[end+1:]
+		}
+	}
+	return segments, nil
+}
+
+// Redact masks the sensitive fields of the request and response objects of the event
+// according to the redaction of the policy, then truncates long strings and large objects.
+// The default redaction is used if the policy is nil. Redacting an event twice has no further effect
+func (p *Policy) Redact(ev *Event) {
+	if ev == nil {
+		return
+	}
+	r := defaultRedaction
+	if p != nil {
+		p.Compile()
+		r = &p.Redaction
+	} else {
+		defaultRedactionOnce.Do(func() { r.compile() })
+	}
+	r.redact(ev)
+}
+
+func (r *Redaction) redact(ev *Event) {
+	r.redactObject(ev.RequestObject)
+	r.redactObject(ev.ResponseObject)
+}
+
+func (r *Redaction) redactObject(obj *map[string]interface{}) {
+	if obj == nil || *obj == nil {
+		return
+	}
+	for _, path := range r.paths {
+		r.maskPath(*obj, path)
+	}
+	r.maskFields(*obj)
+	if r.MaxFieldLength > 0 {
+		r.truncateStrings(*obj)
+	}
+	if r.MaxObjectSize > 0 && !isTruncatedObject(*obj) {
+		if data, err := json.Marshal(*obj); err == nil && len(data) > r.MaxObjectSize {
+			*obj = map[string]interface{}{
+				objectTruncatedField: fmt.Sprintf("object of %d bytes exceeds the limit of %d bytes", len(data), r.MaxObjectSize),
+			}
+		}
+	}
+}
+
+// isTruncatedObject returns true if the object was replaced because of its size,
+// the marker may exceed the limit itself
+func isTruncatedObject(obj map[string]interface{}) bool {
+	_, ok := obj[objectTruncatedField]
+	return ok && len(obj) == 1
+}
+
+// maskPath masks the values at the path below the value
+func (r *Redaction) maskPath(val interface{}, path []pathSegment) {
+	if len(path) == 0 {
+		return
+	}
+	segment, last := path[0], len(path) == 1
+	switch v := val.(type) {
+	case map[string]interface{}:
+		if segment.isIndex {
+			return
+		}
+		for key, child := range v {
+			if segment.field != "*" && segment.field != key {
+				continue
+			}
+			if last {
+				v[key] = r.mask(child)
+			} else {
+				r.maskPath(child, path[1:])
+			}
+		}
+	case []interface{}:
+		if !segment.isIndex {
+			return
+		}
+		for i, child := range v {
+			if segment.index >= 0 && segment.index != i {
+				continue
+			}
+			if last {
+				v[i] = r.mask(child)
+			} else {
+				r.maskPath(child, path[1:])
+			}
+		}
+	}
+}
+
+// maskFields masks the fields with redacted names and the data of secrets at any depth
+func (r *Redaction) maskFields(val interface{}) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		secret := false
+		if !r.DisableDefaults {
+			switch v["kind"] {
+			case "Secret":
+				secret = true
+			case "SecretList":
+				// items of lists usually have no kind
+				if items, ok := v["items"].([]interface{}); ok {
+					for _, item := range items {
+						if obj, ok := item.(map[string]interface{}); ok {
+							r.maskSecret(obj)
+						}
+					}
+				}
+			}
+		}
+		if secret {
+			r.maskSecret(v)
+		}
+		for key, child := range v {
+			if r.fields.Has(strings.ToLower(key)) {
+				v[key] = r.mask(child)
+				continue
+			}
+			r.maskFields(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			r.maskFields(child)
+		}
+	}
+}
+
+func (r *Redaction) maskSecret(secret map[string]interface{}) {
+	for _, key := range []string{"data", "stringData"} {
+		if data, ok := secret[key]; ok {
+			secret[key] = r.mask(data)
+		}
+	}
+}
+
+func (r *Redaction) maskString() string {
+	if r.Mask == "" {
+		return DefaultRedactionMask
+	}
+	return r.Mask
+}
+
+// mask returns the mask for a value, objects keep their fields with masked values
+func (r *Redaction) mask(val interface{}) interface{} {
+	mask := r.maskString()
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		return mask
+	}
+	masked := make(map[string]interface{}, len(obj))
+	for key := range obj {
+		masked[key] = mask
+	}
+	return masked
+}
+
+// truncateStrings truncates strings longer than MaxFieldLength at any depth, masks are kept
+func (r *Redaction) truncateStrings(val interface{}) {
+	mask := r.maskString()
+	truncate := func(child interface{}) (interface{}, bool) {
+		s, ok := child.(string)
+		if !ok || len(s) <= r.MaxFieldLength || s == mask {
+			return child, false
+		}
+		return s[:r.MaxFieldLength] + fieldTruncateSuffix, true
+	}
+	switch v := val.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if truncated, ok := truncate(child); ok {
+				v[key] = truncated
+				continue
+			}
+			r.truncateStrings(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			if truncated, ok := truncate(child); ok {
+				v[i] = truncated
+				continue
+			}
+			r.truncateStrings(child)
+		}
+	}
+}
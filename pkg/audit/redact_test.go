@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+)
+
+func objectFromJSON(t *testing.T, data string) *map[string]interface{} {
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(data), &obj); err != nil {
+		t.Fatalf("invalid test object %s: %v", data, err)
+	}
+	return &obj
+}
+
+func TestPolicyRedact(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *Policy
+		object string
+		want   string
+	}{
+		{
+			name:   "nil policy masks default fields at any depth",
+			object: `{"user":"admin","password":"secret","spec":{"auth":{"Token":"abc"}}}`,
+			want:   `{"user":"admin","password":"******","spec":{"auth":{"Token":"******"}}}`,
+		},
+		{
+			name:   "secret data keeps its keys",
+			policy: &Policy{},
+			object: `{"kind":"Secret","data":{"tls.key":"a2V5"},"stringData":{"pass":"x"}}`,
+			want:   `{"kind":"Secret","data":{"tls.key":"******"},"stringData":{"pass":"******"}}`,
+		},
+		{
+			name:   "secret list items are masked",
+			policy: &Policy{},
+			object: `{"kind":"SecretList","items":[{"data":{"a":"b"}},{"metadata":{"name":"s"}}]}`,
+			want:   `{"kind":"SecretList","items":[{"data":{"a":"******"}},{"metadata":{"name":"s"}}]}`,
+		},
+		{
+			name:   "disabled defaults keep secrets and passwords",
+			policy: &Policy{Redaction: Redaction{DisableDefaults: true, Fields: []string{"apiKey"}}},
+			object: `{"kind":"Secret","data":{"a":"b"},"password":"p","apikey":"k"}`,
+			want:   `{"kind":"Secret","data":{"a":"b"},"password":"p","apikey":"******"}`,
+		},
+		{
+			name:   "paths mask list items and wildcards with a custom mask",
+			policy: &Policy{Redaction: Redaction{Paths: []string{"$.items[*].spec.value", "metadata.*", "list[1]"}, Mask: "x"}},
+			object: `{"items":[{"spec":{"value":"a","keep":"b"}},{"spec":{"value":"c"}}],"metadata":{"a":"1","b":"2"},"list":["0","1","2"]}`,
+			want:   `{"items":[{"spec":{"value":"x","keep":"b"}},{"spec":{"value":"x"}}],"metadata":{"a":"x","b":"x"},"list":["0","x","2"]}`,
+		},
+		{
+			name:   "long strings are truncated but masks are kept",
+			policy: &Policy{Redaction: Redaction{MaxFieldLength: 4}},
+			object: `{"description":"0123456789","list":["abcdef"],"token":"0123456789"}`,
+			want:   `{"description":"0123...TRUNCATED","list":["abcd...TRUNCATED"],"token":"******"}`,
+		},
+		{
+			name:   "large objects are replaced",
+			policy: &Policy{Redaction: Redaction{MaxObjectSize: 10}},
+			object: `{"description":"0123456789"}`,
+			want:   `{"truncated":"object of 28 bytes exceeds the limit of 10 bytes"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ev := &Event{
+				RequestObject:  objectFromJSON(t, test.object),
+				ResponseObject: objectFromJSON(t, test.object),
+			}
+			test.policy.Redact(ev)
+			want := objectFromJSON(t, test.want)
+			if !reflect.DeepEqual(ev.RequestObject, want) {
+				t.Errorf("got request object %v, want %v", *ev.RequestObject, *want)
+			}
+			if !reflect.DeepEqual(ev.ResponseObject, want) {
+				t.Errorf("got response object %v, want %v", *ev.ResponseObject, *want)
+			}
+
+			// redacting twice has no further effect
+			test.policy.Redact(ev)
+			if !reflect.DeepEqual(ev.RequestObject, want) {
+				t.Errorf("got request object %v after redacting twice, want %v", *ev.RequestObject, *want)
+			}
+		})
+	}
+}
+
+func TestParseFieldPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []pathSegment
+		wantErr bool
+	}{
+		{path: "$.spec.password", want: []pathSegment{{field: "spec"}, {field: "password"}}},
+		{path: "items[*].data", want: []pathSegment{{field: "items"}, {index: -1, isIndex: true}, {field: "data"}}},
+		{path: "list[2][*]", want: []pathSegment{{field: "list"}, {index: 2, isIndex: true}, {index: -1, isIndex: true}}},
+		{path: "$", wantErr: true},
+		{path: "spec..password", wantErr: true},
+		{path: "items[-1]", wantErr: true},
+		{path: "items[a]", wantErr: true},
+		{path: "items[0", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			got, err := parseFieldPath(test.path)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestManagerRedactMatchedPolicy checks events are redacted according to the policy the request matched
+// even if the policy was replaced while the request was processed
+func TestManagerRedactMatchedPolicy(t *testing.T) {
+	matched := &Policy{
+		Rules: []PolicyRule{{
+			Level: auditinternal.LevelRequestResponse,
+			Match: RequestMatch{Path: ".*", Methods: []string{"post"}},
+		}},
+		Redaction: Redaction{Fields: []string{"apiKey"}},
+	}
+	replaced := &Policy{Redaction: Redaction{DisableDefaults: true}}
+
+	mgr := &DefaultManager{}
+	mgr.SetPolicy(matched)
+	req := httptest.NewRequest("POST", "/apis/v1/keys", nil)
+	ok, rule := mgr.MatchRequest(req, 0)
+	if !ok {
+		t.Fatalf("request did not match the policy")
+	}
+	ev := &Event{
+		RequestObject:  objectFromJSON(t, `{"apiKey":"k","password":"p"}`),
+		ResponseObject: objectFromJSON(t, `{}`),
+	}
+	mgr.ExecutePolicyRule(ev, rule, req)
+	mgr.SetPolicy(replaced)
+	if err := mgr.Record(ev); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := objectFromJSON(t, `{"apiKey":"******","password":"******"}`); !reflect.DeepEqual(ev.RequestObject, want) {
+		t.Errorf("got request object %v, want %v", *ev.RequestObject, *want)
+	}
+
+	// events which did not match a rule use the current policy
+	ev = &Event{RequestObject: objectFromJSON(t, `{"password":"p"}`)}
+	mgr.Redact(ev)
+	if want := objectFromJSON(t, `{"password":"p"}`); !reflect.DeepEqual(ev.RequestObject, want) {
+		t.Errorf("got request object %v, want %v", *ev.RequestObject, *want)
+	}
+}
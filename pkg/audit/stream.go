@@ -0,0 +1,57 @@
+package audit
+
+import (
+	"encoding/json"
+)
+
+// Message a message sent to a streaming platform, e.g. a Kafka record
+type Message struct {
+	// Key of the message, the audit ID of the event
+	Key []byte
+	// Value of the message, the JSON encoded event
+	Value []byte
+}
+
+// Producer sends messages to a streaming platform, e.g. an adapter of a Kafka producer to a topic.
+// Retries and acknowledgements are handled by the producer
+type Producer interface {
+	SendMessages(messages []Message) error
+	Close() error
+}
+
+// StreamBackend sends each event as a message to a streaming platform
+type StreamBackend struct {
+	name     string
+	producer Producer
+}
+
+var _ Backend = &StreamBackend{}
+
+// NewStreamBackend creates a backend sending events to the producer,
+// the producer is closed together with the backend
+func NewStreamBackend(name string, producer Producer) *StreamBackend {
+	return &StreamBackend{name: name, producer: producer}
+}
+
+// Name returns the name of the backend
+func (b *StreamBackend) Name() string {
+	return b.name
+}
+
+// Write sends the batch of events as messages keyed by audit ID
+func (b *StreamBackend) Write(events []*Event) error {
+	messages := make([]Message, 0, len(events))
+	for _, ev := range events {
+		value, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, Message{Key: []byte(ev.AuditID), Value: value})
+	}
+	return b.producer.SendMessages(messages)
+}
+
+// Close closes the producer
+func (b *StreamBackend) Close() error {
+	return b.producer.Close()
+}
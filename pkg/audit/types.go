@@ -1,6 +1,8 @@
 package audit
 
 import (
+	"sync"
+
 	authnv1 "k8s.io/api/authentication/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -51,28 +53,77 @@ type Event struct {
 	RequestReceivedTimestamp metav1.MicroTime
 	// Time the request reached current audit stage.
 	StageTimestamp metav1.MicroTime
+
+	// redaction of the policy the request matched
+	redaction *Redaction
 }
 
 // Policy defines the configuration of audit logging
 type Policy struct {
 	metav1.TypeMeta
 
+	// OmitStages stages no event is generated for by any rule
+	OmitStages []auditinternal.Stage `yaml:"omitStages,omitempty"`
+
 	// Rules is a list of PolicyRule, each request will only be processed by the first matched rule
 	Rules []PolicyRule
+
+	// Redaction masks sensitive fields of request and response objects,
+	// DefaultRedactedFields and the data of secrets are masked unless disabled
+	Redaction Redaction `yaml:"redaction,omitempty"`
+
+	compileOnce sync.Once
+	compileErr  error
 }
 
 // PolicyRule specify the request matching and processing methods
 type PolicyRule struct {
-	Level   auditinternal.Level `yaml:"level"`
-	Match   RequestMatch        `yaml:"match,omitempty"`
-	Process Process             `yaml:"process,omitempty"`
+	Level auditinternal.Level `yaml:"level"`
+	// Stages opts into stages generating events besides the default ResponseStarted and ResponseComplete,
+	// i.e. RequestReceived and Panic
+	Stages []auditinternal.Stage `yaml:"stages,omitempty"`
+	// OmitStages stages no event is generated for, including the default ones
+	OmitStages []auditinternal.Stage `yaml:"omitStages,omitempty"`
+	Match      RequestMatch          `yaml:"match,omitempty"`
+	Process    Process               `yaml:"process,omitempty"`
+
+	compiled *compiledMatch
+	// redaction of the policy of the rule
+	redaction *Redaction
 }
 
 // RequestMatch defines rules used to match request
-// only matched request will be processed
+// only matched request will be processed. A request matches if it matches all the criteria,
+// empty criteria except methods match any request
 type RequestMatch struct {
-	Path    string   `yaml:"path"`
+	// Path regular expression of the request path
+	Path string `yaml:"path"`
+	// Methods lowercase http methods, required
 	Methods []string `yaml:"methods"`
+	// Users names of the authenticated user
+	Users []string `yaml:"users,omitempty"`
+	// Groups groups of the authenticated user, a request matches if the user is in any of them.
+	// Users and groups match if either of them matches
+	Groups []string `yaml:"groups,omitempty"`
+	// UserAgent regular expression of the user agent
+	UserAgent string `yaml:"userAgent,omitempty"`
+	// Headers regular expressions of request header values by header name, all of them must match
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// StatusCodes response status codes "404", classes "4xx" or ranges "500-503".
+	// Only known once the response started, thus never match RequestReceived events
+	StatusCodes []string `yaml:"statusCodes,omitempty"`
+	// Verbs kube verbs of the request info, e.g. list, watch or create
+	Verbs []string `yaml:"verbs,omitempty"`
+	// APIGroups api groups of the request info, "" is the core group
+	APIGroups []string `yaml:"apiGroups,omitempty"`
+	// Resources resources of the request info, subresources are matched as "resource/subresource"
+	Resources []string `yaml:"resources,omitempty"`
+	// Namespaces namespaces of the request info
+	Namespaces []string `yaml:"namespaces,omitempty"`
+	// Clusters clusters of the request info
+	Clusters []string `yaml:"clusters,omitempty"`
+	// Projects projects of the request info
+	Projects []string `yaml:"projects,omitempty"`
 }
 
 // Process defines rules to fullfill audit event object
@@ -0,0 +1,127 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultWebhookTimeout default timeout of a webhook request
+	DefaultWebhookTimeout = 10 * time.Second
+	// DefaultWebhookInitialBackoff default time waited before retrying a failed webhook request,
+	// the time is doubled after each retry
+	DefaultWebhookInitialBackoff = time.Second
+)
+
+// EventList a batch of events sent to a webhook
+type EventList struct {
+	Items []*Event `json:"items"`
+}
+
+// WebhookConfig configuration of a webhook backend
+type WebhookConfig struct {
+	// URL events are posted to as an EventList
+	URL string
+	// Headers added to each request, e.g. Authorization
+	Headers map[string]string
+	// Timeout of a request, DefaultWebhookTimeout if zero
+	Timeout time.Duration
+	// MaxRetries number of retries of a failed request,
+	// requests are retried for connection errors, 429 and 5xx responses
+	MaxRetries int
+	// InitialBackoff time waited before the first retry, DefaultWebhookInitialBackoff if zero
+	InitialBackoff time.Duration
+	// Client used to send requests, e.g. with custom TLS configuration, http.DefaultClient's transport if nil
+	Client *http.Client
+}
+
+// WebhookBackend posts batches of events to a HTTP endpoint
+type WebhookBackend struct {
+	config WebhookConfig
+	client *http.Client
+}
+
+var _ Backend = &WebhookBackend{}
+
+// NewWebhookBackend creates a backend posting events to the URL of the config
+func NewWebhookBackend(config WebhookConfig) (*WebhookBackend, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("audit webhook url is required")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultWebhookTimeout
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = DefaultWebhookInitialBackoff
+	}
+	client := config.Client
+	if client == nil {
+		client = &http.Client{}
+	}
+	if client.Timeout == 0 {
+		copied := *client
+		copied.Timeout = config.Timeout
+		client = &copied
+	}
+	return &WebhookBackend{config: config, client: client}, nil
+}
+
+// Name returns the name of the backend
+func (b *WebhookBackend) Name() string {
+	return "webhook"
+}
+
+// Write posts the events as one EventList, failed requests are retried with an exponential backoff
+func (b *WebhookBackend) Write(events []*Event) error {
+	body, err := json.Marshal(EventList{Items: events})
+	if err != nil {
+		return err
+	}
+	backoff := b.config.InitialBackoff
+	for retry := 0; ; retry++ {
+		retriable, err := b.post(body)
+		if err == nil {
+			return nil
+		}
+		if !retriable || retry >= b.config.MaxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Close does nothing, pending requests are finished by Write
+func (b *WebhookBackend) Close() error {
+	return nil
+}
+
+// post sends the body once, returns true if a failed request may be retried
+func (b *WebhookBackend) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, b.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, val := range b.config.Headers {
+		req.Header.Set(key, val)
+	}
+	res, err := b.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	// drain the body so that the connection is reused
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("audit webhook %s responded with status %d", b.config.URL, res.StatusCode)
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500, err
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 
 	authv1 "gomod.alauda.cn/alauda-backend/pkg/auth/apis/v1"
@@ -13,12 +14,15 @@ import (
 	"gomod.alauda.cn/alauda-backend/pkg/auth/request"
 	"gomod.alauda.cn/alauda-backend/pkg/auth/user"
 	"gomod.alauda.cn/alauda-backend/pkg/auth/userbinding"
+	abcontext "gomod.alauda.cn/alauda-backend/pkg/context"
+	"gomod.alauda.cn/alauda-backend/pkg/dataselect"
 	"gomod.alauda.cn/alauda-backend/pkg/util/token"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/rest"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	authuser "k8s.io/apiserver/pkg/authentication/user"
 )
 
 const (
@@ -26,16 +30,35 @@ const (
 	ResNamespace    = "res:ns"
 	ResResourceName = "res:name"
 	ResCluster      = "res:cluster"
+
+	serviceAccountUsernamePrefix = "system:serviceaccount:"
+	serviceAccountGroup          = "system:serviceaccounts"
+	serviceAccountGroupPrefix    = "system:serviceaccounts:"
 )
 
 type Permission struct {
-	RoleName    string
-	Actions     []string
-	Constraints map[string]string
-	Resource    schema.GroupResource
+	RoleName    string               `json:"roleName"`
+	Actions     []string             `json:"actions"`
+	Constraints map[string]string    `json:"constraints,omitempty"`
+	Resource    schema.GroupResource `json:"resource"`
+	// Deny denies the actions instead of allowing them, deny permissions override allow permissions
+	Deny bool `json:"deny,omitempty"`
+	// NonResourceURL non-resource URL the permission applies to instead of a resource,
+	// a trailing "*" matches all URLs with the prefix
+	NonResourceURL string `json:"nonResourceURL,omitempty"`
+	// LabelSelector limits the permission to the objects matching the selector,
+	// only list and watch requests are allowed with their items limited to the matching objects
+	LabelSelector string `json:"labelSelector,omitempty"`
+
+	// UserBinding namespace/name of the userbinding granting the permission
+	UserBinding string `json:"userBinding,omitempty"`
+	// ClusterRole name of the clusterrole the permission comes from
+	ClusterRole string `json:"clusterRole,omitempty"`
+	// Rule clusterrole rule or deny rule the permission comes from
+	Rule rbacv1.PolicyRule `json:"rule"`
 }
 
-// IsInConstraint returns true if the permission constrains is equal or broader than the given
+// IsInConstraint returns true if the permission constraints are equal or broader than the given
 func (p *Permission) IsInConstraint(constraints map[string]string) bool {
 	// no constrains, allows all
 	if len(p.Constraints) == 0 {
@@ -48,274 +71,625 @@ func (p *Permission) IsInConstraint(constraints map[string]string) bool {
 	return false
 }
 
+// matchAllConstraints returns true if the constraints are within the scope of the permission.
+// Scopes form the hierarchy platform → project → cluster → namespace: project permissions apply
+// to the project, its clusters and namespaces, limited to the listed clusters if any,
+// cluster permissions apply to all namespaces of the listed clusters
+// and namespace permissions to the namespace of the cluster
 func (p *Permission) matchAllConstraints(constraints map[string]string) bool {
-	//log.Printf("************p.Constraints: %+v, constraints: %+v", p.Constraints, constraints)
-
 	for k, v := range p.Constraints {
-		if val, ok := constraints[k]; !ok || v != val {
-			//log.Printf(">>>>>>>constraints, k: %+v , val: %+v, v: %+v", k, val, v)
-
-			clusters := []string{}
-			if k == ResCluster {
-				clusters = strings.Split(v, ",")
+		val, ok := constraints[k]
+		switch {
+		case k == ResCluster && !ok:
+			// clusters only limit project permissions for requests within a cluster
+			if !p.isProjectScope() {
+				return false
 			}
-			if StringInSlice(val, clusters) {
-				return true
+		case k == ResCluster:
+			if !StringInSlice(val, strings.Split(v, ",")) {
+				return false
 			}
-
+		case k == ResProject && !ok:
+			// the namespace of a cluster identifies the scope, the project is optional
+			if _, ok := p.Constraints[ResNamespace]; !ok {
+				return false
+			}
+			if _, ok := p.Constraints[ResCluster]; !ok {
+				return false
+			}
+		case !ok || v != val:
 			return false
 		}
 	}
 	return true
 }
 
+// isProjectScope returns true if the permission is granted for a project
+func (p *Permission) isProjectScope() bool {
+	_, project := p.Constraints[ResProject]
+	_, namespace := p.Constraints[ResNamespace]
+	return project && !namespace
+}
+
 type AuthManager struct {
-	erebusService       string
+	authenticator       authenticator.Request
 	cache               Cache
 	userBindingResolver *userbinding.Resolver
 	userResolver        *user.Manager
 	clusterRoleResolver *clusterrole.Resolver
 	requestInfoResolver *request.RequestInfoFactory
+	permissionIndex     *PermissionIndex
+	authorizer          Authorizer
+	projectResolver     ProjectResolver
+	// synced functions returning true once the caches of the resolvers are synced
+	synced []func() bool
 }
 
-func NewManager(cache Cache, erebusService string, userBinding *userbinding.Resolver, clusterRole *clusterrole.Resolver, requestInfoResolver *request.RequestInfoFactory, userResolver *user.Manager) Manager {
+func NewManager(cache Cache, authn authenticator.Request, userBinding *userbinding.Resolver, clusterRole *clusterrole.Resolver, requestInfoResolver *request.RequestInfoFactory, userResolver *user.Manager) *AuthManager {
 	mgr := &AuthManager{
-		erebusService:       erebusService,
+		authenticator:       authn,
 		cache:               cache,
 		userBindingResolver: userBinding,
 		clusterRoleResolver: clusterRole,
 		requestInfoResolver: requestInfoResolver,
 		userResolver:        userResolver,
+		permissionIndex:     NewPermissionIndex(userBinding, clusterRole),
+	}
+	if userBinding != nil {
+		mgr.synced = append(mgr.synced, userBinding.HasSynced)
+	}
+	if clusterRole != nil {
+		mgr.synced = append(mgr.synced, clusterRole.HasSynced)
+	}
+	if userResolver != nil {
+		mgr.synced = append(mgr.synced, userResolver.HasSynced)
+	}
+	if cache != nil {
+		// cached decisions are dropped whenever bindings, roles or users change
+		mgr.permissionIndex.AddChangeHandler(cache.Invalidate)
+		if userResolver != nil {
+			userResolver.AddChangeHandler(cache.Invalidate)
+		}
 	}
 	return mgr
 }
 
-func (m *AuthManager) Authenticate(ctx context.Context, req *http.Request) error {
-	// validate the format and existence of token
-	_, err := token.ParseJWTFromHeader(req)
-	if err != nil {
-		return err
+var _ ReasonAuthorizer = &AuthManager{}
+var _ FilteringAuthorizer = &AuthManager{}
+
+// WithAuthorizer sets the authorizer deciding on requests,
+// UserBindingAuthorizer is used if not set
+func (m *AuthManager) WithAuthorizer(authorizer Authorizer) *AuthManager {
+	m.authorizer = authorizer
+	return m
+}
+
+// WithProjectResolver sets the resolver used to find the project of namespaces,
+// project permissions apply to requests for namespaces of the project without the project in the route.
+// Cached decisions are dropped when the resolver supports change handlers and notifies a change,
+// requests are not authorized until the resolver is synced if it supports HasSynced
+func (m *AuthManager) WithProjectResolver(resolver ProjectResolver) *AuthManager {
+	m.projectResolver = resolver
+	if synced, ok := resolver.(interface{ HasSynced() bool }); ok {
+		m.synced = append(m.synced, synced.HasSynced)
+	}
+	if notifier, ok := resolver.(interface{ AddChangeHandler(func()) }); ok && m.cache != nil {
+		notifier.AddChangeHandler(m.cache.Invalidate)
 	}
+	return m
+}
 
-	var cfg *rest.Config
-	var client *rest.RESTClient
-	cfg, err = rest.InClusterConfig()
-	if err != nil {
-		return err
+// scopeConstraints returns the constraints with the project of the namespace if the project resolver knows it.
+// The project of the route is replaced, thus permissions of a project never apply to namespaces of other projects
+func (m *AuthManager) scopeConstraints(constraints map[string]string) map[string]string {
+	if m.projectResolver == nil || constraints[ResCluster] == "" || constraints[ResNamespace] == "" {
+		return constraints
+	}
+	project, ok := m.projectResolver.NamespaceProject(constraints[ResCluster], constraints[ResNamespace])
+	if !ok || project == constraints[ResProject] {
+		return constraints
 	}
-	rawToken, _ := token.ParseRawToken(req)
-	fmt.Printf("m.erebusService: %s\n", m.erebusService)
-	m.erebusService = "erebus.cpaas-system"
-	cfg.Host = "https://" + strings.TrimRight(m.erebusService, "/") + "/kubernetes/global"
-	// update in cluster config
-	cfg.BearerToken = rawToken
-	cfg.BearerTokenFile = ""
-	cfg.TLSClientConfig = rest.TLSClientConfig{Insecure: true}
+	scoped := make(map[string]string, len(constraints)+1)
+	for k, v := range constraints {
+		scoped[k] = v
+	}
+	scoped[ResProject] = project
+	return scoped
+}
 
-	if cfg.NegotiatedSerializer == nil {
-		cfg.NegotiatedSerializer = scheme.Codecs.WithoutConversion()
+// HasSynced returns true once the caches of all resolvers are synced
+func (m *AuthManager) HasSynced() bool {
+	for _, synced := range m.synced {
+		if !synced() {
+			return false
+		}
 	}
+	return true
+}
 
-	client, err = rest.UnversionedRESTClientFor(cfg)
+// Authenticate authenticates the request using the authenticator chain
+func (m *AuthManager) Authenticate(ctx context.Context, req *http.Request) (authuser.Info, error) {
+	// validate the existence of token
+	if _, err := token.ParseRawToken(req); err != nil {
+		return nil, err
+	}
+	if m.authenticator == nil {
+		return nil, errors.NewUnauthorized("no authenticator configured")
+	}
+	resp, ok, err := m.authenticator.AuthenticateRequest(req)
 	if err != nil {
-		return err
+		return nil, errors.NewUnauthorized(err.Error())
 	}
-	_, err = client.Get().AbsPath("/api").DoRaw(context.TODO())
-	return nil
+	if !ok || resp == nil || resp.User == nil {
+		return nil, errors.NewUnauthorized("invalid bearer token")
+	}
+	return resp.User, nil
 }
 
+// Authorize asks the authorizer chain if the request is allowed,
+// the request is denied if no authorizer has an opinion
 func (m *AuthManager) Authorize(ctx context.Context, req *http.Request, opt *FilterOption) (bool, error) {
-	jwtToken, err := token.ParseJWTFromHeader(req)
-	if err != nil {
-		return false, err
+	allowed, _, err := m.AuthorizeWithReason(ctx, req, opt)
+	return allowed, err
+}
+
+// AuthorizeWithReason asks the authorizer chain if the request is allowed and returns the reason of the decision
+func (m *AuthManager) AuthorizeWithReason(ctx context.Context, req *http.Request, opt *FilterOption) (bool, string, error) {
+	allowed, reason, _, err := m.AuthorizeWithFilter(ctx, req, opt)
+	return allowed, reason, err
+}
+
+// AuthorizeWithFilter asks the authorizer chain if the request is allowed and returns the reason of the decision
+// and the items allowed list requests are limited to, nil if not limited.
+// Requests without an authenticated user in their context are unauthorized,
+// requests are unavailable until the caches are synced instead of being denied by empty caches
+func (m *AuthManager) AuthorizeWithFilter(ctx context.Context, req *http.Request, opt *FilterOption) (bool, string, *dataselect.ResourceFilter, error) {
+	if _, err := RequestUser(req); err != nil {
+		return false, "", nil, err
+	}
+	if !m.HasSynced() {
+		return false, "", nil, errors.NewServiceUnavailable("authorization caches are not synced yet")
+	}
+	authz := m.authorizer
+	if authz == nil {
+		authz = m.UserBindingAuthorizer(DecisionDeny)
+	}
+	holder := &resourceFilterHolder{}
+	decision, reason, err := authz.Authorize(context.WithValue(ctx, resourceFilterKey{}, holder), req, opt)
+	if decision == DecisionAllow {
+		return true, reason, holder.filter, nil
+	}
+	return false, reason, nil, err
+}
+
+type resourceFilterKey struct{}
+
+// resourceFilterHolder receives the resource filter of the authorizer allowing a request
+type resourceFilterHolder struct {
+	filter *dataselect.ResourceFilter
+}
+
+// setResourceFilter records the items an allowed list request is limited to
+func setResourceFilter(ctx context.Context, filter *dataselect.ResourceFilter) {
+	if holder, ok := ctx.Value(resourceFilterKey{}).(*resourceFilterHolder); ok {
+		holder.filter = filter
+	}
+}
+
+// UserBindingAuthorizer returns an authorizer using UserBindings and ClusterRoles.
+// Bindings apply to the user, the groups of the request user and of its User object,
+// and to the system:authenticated group.
+// Requests not allowed by any binding result in the noMatch decision.
+// Service accounts are usually authorized by kubernetes RBAC,
+// the authorizer has no opinion on service accounts not matched by any binding
+func (m *AuthManager) UserBindingAuthorizer(noMatch Decision) Authorizer {
+	return AuthorizerFunc(func(ctx context.Context, req *http.Request, opt *FilterOption) (Decision, string, error) {
+		info, err := RequestUser(req)
+		if err != nil {
+			return DecisionNoOpinion, "", err
+		}
+		unmatched := noMatch
+		if IsServiceAccount(info) {
+			unmatched = DecisionNoOpinion
+		}
+
+		userEmailName := EmailToName(info.GetName())
+		groups := info.GetGroups()
+		requestInfo, err := m.requestInfoResolver.NewRequestInfo(req)
+		if err != nil {
+			return DecisionNoOpinion, "", err
+		}
+		if requestInfo.Resource == "" {
+			// non-resource requests use the lowercase http method as verb
+			result, err := m.VerifyNonResource(userEmailName, groups, strings.ToLower(req.Method), requestInfo.Path)
+			if err != nil {
+				return DecisionNoOpinion, "", err
+			}
+			return userBindingDecision(info, result, unmatched)
+		}
+
+		// 资源映射
+		applyResourceMap(requestInfo, opt)
+
+		resource := schema.GroupResource{
+			Group:    requestInfo.APIGroup,
+			Resource: requestInfo.Resource,
+		}
+
+		constraints := map[string]string{}
+		if len(requestInfo.Project) > 0 {
+			constraints[ResProject] = requestInfo.Project
+		}
+		if len(requestInfo.Namespace) > 0 {
+			constraints[ResNamespace] = requestInfo.Namespace
+		}
+		if len(requestInfo.Cluster) > 0 {
+			constraints[ResCluster] = requestInfo.Cluster
+		}
+		if len(requestInfo.Name) > 0 {
+			constraints[ResResourceName] = requestInfo.Name
+		}
+
+		result, err := m.Verify(userEmailName, groups, requestInfo.Verb, resource, constraints)
+		if err != nil {
+			return DecisionNoOpinion, "", err
+		}
+		if result.Allowed && !result.Denied && result.Filter != nil {
+			if opt == nil || !opt.FilteredList {
+				// the handler could return objects the user may not see
+				limited := *result
+				limited.Allowed = false
+				limited.Reason += ", the route does not limit list results"
+				return userBindingDecision(info, &limited, unmatched)
+			}
+			setResourceFilter(ctx, result.Filter)
+		}
+		return userBindingDecision(info, result, unmatched)
+	})
+}
+
+func userBindingDecision(info authuser.Info, result *VerifyResult, noMatch Decision) (Decision, string, error) {
+	reason := fmt.Sprintf("userbinding: user %s: %s", info.GetName(), result.Reason)
+	switch {
+	case result.Denied:
+		return DecisionDeny, reason, nil
+	case result.Allowed:
+		return DecisionAllow, reason, nil
 	}
-	fmt.Printf("req jwtToken: %+v", *jwtToken)
+	return noMatch, reason, nil
+}
 
-	if jwtToken.IsServiceAccount() {
-		// TODO sa authz
-		fmt.Printf("skip serviceaccount authz: %s", jwtToken.Subject)
-		return true, nil
+// Verify checks if the user and its groups may perform the action on the resource within the constraints,
+// the groups of the User object and system:authenticated are added to groups.
+// The result is cached until permissions change
+//
+// GetActionsForResourceFast.permission: {RoleName:namespace-admin-system Actions:[get list watch] Constraints:map[res:cluster:global res:ns:proj01 res:project:proj01] Resource:userbindings.auth.alauda.io}
+// GetActionsForResourceFast.permission: {RoleName:namespace-admin-system Actions:[*] Constraints:map[res:cluster:global res:ns:proj01 res:project:proj01] Resource:userbindings.auth.alauda.io}
+// rbac.Verify	{"user": "8bd108c8a01a892d129c52484ef97a0d", "resource": "userbindings.auth.alauda.io", "constraints": {"res:project":"proj01"}, "action": "create", "actions": []}
+func (m *AuthManager) Verify(user string, groups []string, action string, resource schema.GroupResource, constraints map[string]string) (*VerifyResult, error) {
+	verify := func() (*VerifyResult, error) {
+		return m.verify(user, groups, action, resource, constraints)
+	}
+	if m.cache == nil {
+		return verify()
 	}
+	return m.cache.GetAuthorize(DecisionKey(user, groups, action, resource, constraints), verify)
+}
 
-	userEmailName := EmailToName(jwtToken.Email)
-	requestInfo, err := m.requestInfoResolver.NewRequestInfo(req)
-	fmt.Printf("user: %s requestInfo: %+v\n", userEmailName, *requestInfo)
+// verify checks the permissions of the user, deny permissions override allow permissions
+func (m *AuthManager) verify(user string, groups []string, action string, resource schema.GroupResource, constraints map[string]string) (*VerifyResult, error) {
+	if constraints == nil {
+		constraints = map[string]string{}
+	}
+	if user == "" {
+		return nil, errors.NewBadRequest("user is empty")
+	}
+	if resource.Resource == "" {
+		return nil, errors.NewBadRequest("resource is empty")
+	}
+	constraints = m.scopeConstraints(constraints)
+
+	userPerms, err := m.GetSubjectPermissions(user, groups, resource)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	// 资源映射
-	if opt != nil && len(opt.ResourceMap) > 0 {
-		gr := requestInfo.Resource + "." + requestInfo.APIGroup
-		val, ok := opt.ResourceMap[gr]
-		if ok {
-			items := strings.Split(val, ".")
-			requestInfo.Resource = items[0]
-			requestInfo.APIGroup = strings.Join(items[1:], ".")
+	var (
+		allowed, denied []*Permission
+		inConstraint    int
+		actions         = sets.NewString()
+	)
+	for _, p := range userPerms {
+		if p.LabelSelector != "" || !p.IsInConstraint(constraints) {
+			continue
+		}
+		inConstraint++
+		if !p.Deny {
+			actions.Insert(p.Actions...)
+		}
+		if !hasAction(action, p.Actions) {
+			continue
+		}
+		if p.Deny {
+			denied = append(denied, p)
+		} else {
+			allowed = append(allowed, p)
 		}
 	}
 
-	resource := schema.GroupResource{
-		Group:    requestInfo.APIGroup,
-		Resource: requestInfo.Resource,
+	switch {
+	case len(denied) > 0:
+		return &VerifyResult{
+			Denied:  true,
+			Reason:  fmt.Sprintf("%s %s denied by roles %s", action, resource, strings.Join(permissionRoles(denied), ", ")),
+			Matched: append(denied, allowed...),
+		}, nil
+	case len(allowed) > 0:
+		return &VerifyResult{
+			Allowed: true,
+			Reason:  fmt.Sprintf("%s %s allowed by roles %s", action, resource, strings.Join(permissionRoles(allowed), ", ")),
+			Matched: allowed,
+		}, nil
+	}
+	if filter, matched := listFilter(userPerms, action, constraints); filter != nil {
+		return &VerifyResult{
+			Allowed: true,
+			Reason: fmt.Sprintf("%s %s limited to %d names and %d label selectors by roles %s",
+				action, resource, len(filter.Names), len(filter.LabelSelectors), strings.Join(permissionRoles(matched), ", ")),
+			Matched: matched,
+			Filter:  filter,
+		}, nil
+	}
+	switch {
+	case len(userPerms) == 0:
+		return &VerifyResult{
+			Reason: fmt.Sprintf("no userbinding grants any permission on %s", resource),
+		}, nil
+	case inConstraint == 0:
+		return &VerifyResult{
+			Reason: fmt.Sprintf("none of the %d permissions on %s applies to %s", len(userPerms), resource, formatConstraints(constraints)),
+		}, nil
+	}
+	return &VerifyResult{
+		Reason: fmt.Sprintf("permissions on %s within %s do not allow %s, allowed: %s", resource, formatConstraints(constraints), action, strings.Join(actions.List(), ", ")),
+	}, nil
+}
+
+// listFilter returns the names and label selectors a list or watch request is limited to
+// by the permissions granted for single objects or label selectors within the constraints,
+// nil if the request is not a collection request or no permission applies.
+// Names denied explicitly are removed
+func listFilter(permissions []*Permission, action string, constraints map[string]string) (*dataselect.ResourceFilter, []*Permission) {
+	if (action != "list" && action != "watch") || constraints[ResResourceName] != "" {
+		return nil, nil
 	}
+	var (
+		names, selectors, denied = sets.NewString(), sets.NewString(), sets.NewString()
+		matched                  []*Permission
+	)
+	for _, p := range permissions {
+		name := p.Constraints[ResResourceName]
+		if (name == "" && p.LabelSelector == "") || !hasAction(action, p.Actions) {
+			continue
+		}
+		// the permission applies if the request was for its object
+		scoped := make(map[string]string, len(constraints)+1)
+		for k, v := range constraints {
+			scoped[k] = v
+		}
+		if name != "" {
+			scoped[ResResourceName] = name
+		}
+		if !p.IsInConstraint(scoped) {
+			continue
+		}
+		switch {
+		case p.Deny:
+			denied.Insert(name)
+		case p.LabelSelector != "":
+			selectors.Insert(p.LabelSelector)
+			matched = append(matched, p)
+		default:
+			names.Insert(name)
+			matched = append(matched, p)
+		}
+	}
+	names = names.Difference(denied)
+	if names.Len() == 0 && selectors.Len() == 0 {
+		return nil, nil
+	}
+	return &dataselect.ResourceFilter{Names: names.List(), LabelSelectors: selectors.List()}, matched
+}
+
+// permissionRoles returns the sorted role names of permissions
+func permissionRoles(permissions []*Permission) []string {
+	roles := sets.NewString()
+	for _, p := range permissions {
+		roles.Insert(p.RoleName)
+	}
+	return roles.List()
+}
 
-	constraints := map[string]string{}
-	if len(requestInfo.Project) > 0 {
-		constraints[ResProject] = requestInfo.Project
+// formatConstraints formats constraints sorted by key
+func formatConstraints(constraints map[string]string) string {
+	if len(constraints) == 0 {
+		return "the platform"
+	}
+	keys := make([]string, 0, len(constraints))
+	for k := range constraints {
+		keys = append(keys, k)
 	}
-	if len(requestInfo.Namespace) > 0 {
-		constraints[ResNamespace] = requestInfo.Namespace
+	sort.Strings(keys)
+	items := make([]string, 0, len(keys))
+	for _, k := range keys {
+		items = append(items, k+"="+constraints[k])
 	}
-	if len(requestInfo.Cluster) > 0 {
-		constraints[ResCluster] = requestInfo.Cluster
+	return "{" + strings.Join(items, ", ") + "}"
+}
+
+// VerifyNonResource checks if the user and its groups may use the http verb on a non-resource URL,
+// groups are completed like in Verify. The result is cached until permissions change
+func (m *AuthManager) VerifyNonResource(user string, groups []string, verb string, url string) (*VerifyResult, error) {
+	verify := func() (*VerifyResult, error) {
+		return m.verifyNonResource(user, groups, verb, url)
 	}
-	if len(requestInfo.Name) > 0 {
-		constraints[ResResourceName] = requestInfo.Name
+	if m.cache == nil {
+		return verify()
 	}
+	return m.cache.GetAuthorize(NonResourceDecisionKey(user, groups, verb, url), verify)
+}
 
-	// fmt.Printf("---->>>resource: %+v, constraints: %+v \n", resource, constraints)
+// verifyNonResource checks the non-resource URL permissions of the user, deny permissions override allow permissions
+func (m *AuthManager) verifyNonResource(user string, groups []string, verb string, url string) (*VerifyResult, error) {
+	if user == "" {
+		return nil, errors.NewBadRequest("user is empty")
+	}
 
-	verify, err := m.Verify(userEmailName, requestInfo.Verb, resource, constraints)
-	if err != nil {
-		return false, err
+	var allowed, denied []*Permission
+	for _, p := range m.permissionIndex.NonResourcePermissions(user, m.subjectGroups(user, groups)) {
+		if !nonResourceURLMatches(p.NonResourceURL, url) || !hasAction(verb, p.Actions) {
+			continue
+		}
+		if p.Deny {
+			denied = append(denied, p)
+		} else {
+			allowed = append(allowed, p)
+		}
 	}
 
-	return verify, nil
+	switch {
+	case len(denied) > 0:
+		return &VerifyResult{
+			Denied:  true,
+			Reason:  fmt.Sprintf("%s %s denied by roles %s", verb, url, strings.Join(permissionRoles(denied), ", ")),
+			Matched: append(denied, allowed...),
+		}, nil
+	case len(allowed) > 0:
+		return &VerifyResult{
+			Allowed: true,
+			Reason:  fmt.Sprintf("%s %s allowed by roles %s", verb, url, strings.Join(permissionRoles(allowed), ", ")),
+			Matched: allowed,
+		}, nil
+	}
+	return &VerifyResult{
+		Reason: fmt.Sprintf("no platform role allows %s %s", verb, url),
+	}, nil
 }
 
-// GetActionsForResourceFast.permission: {RoleName:namespace-admin-system Actions:[get list watch] Constraints:map[res:cluster:global res:ns:proj01 res:project:proj01] Resource:userbindings.auth.alauda.io}
-// GetActionsForResourceFast.permission: {RoleName:namespace-admin-system Actions:[*] Constraints:map[res:cluster:global res:ns:proj01 res:project:proj01] Resource:userbindings.auth.alauda.io}
-// rbac.Verify	{"user": "8bd108c8a01a892d129c52484ef97a0d", "resource": "userbindings.auth.alauda.io", "constraints": {"res:project":"proj01"}, "action": "create", "actions": []}
-func (m *AuthManager) Verify(user string, action string, resource schema.GroupResource, constraints map[string]string) (bool, error) {
-	actions, err := m.GetActions(user, resource, constraints, true)
-	//logger.Info("rbac.Verify", zap.Any("user", user), zap.Any("resource", resource), zap.Any("constraints", constraints), zap.Any("action", action), zap.Any("actions", actions))
-	if err != nil {
-		return false, err
+// nonResourceURLMatches returns true if the url matches the rule url,
+// like kubernetes RBAC a trailing "*" matches all URLs with the prefix
+func nonResourceURLMatches(ruleURL, url string) bool {
+	if ruleURL == "*" || ruleURL == url {
+		return true
 	}
-	return hasAction(action, actions), nil
+	return strings.HasSuffix(ruleURL, "*") && strings.HasPrefix(url, strings.TrimSuffix(ruleURL, "*"))
+}
+
+// GetActions returns the actions allowed on a resource, actions denied explicitly are removed.
+// Actions denied by deny permissions are not removed from an allowed "*", use GetSubjectActionsExcept
+// to get them or Verify to check an action
+func (m *AuthManager) GetActions(user string, resource schema.GroupResource, constraints map[string]string) ([]string, error) {
+	return m.GetSubjectActions(user, nil, resource, constraints)
+}
+
+// GetSubjectActions returns the actions allowed to a user and its groups on a resource like GetActions,
+// groups are completed like in Verify
+func (m *AuthManager) GetSubjectActions(user string, groups []string, resource schema.GroupResource, constraints map[string]string) ([]string, error) {
+	actions, _, err := m.GetSubjectActionsExcept(user, groups, resource, constraints)
+	return actions, err
 }
 
-func (m *AuthManager) GetActions(user string, resource schema.GroupResource, constraints map[string]string, useCache bool) ([]string, error) {
+// GetSubjectActionsExcept returns the actions allowed to a user and its groups on a resource like GetSubjectActions
+// and the actions denied by deny permissions if "*" is allowed
+func (m *AuthManager) GetSubjectActionsExcept(user string, groups []string, resource schema.GroupResource, constraints map[string]string) (actions []string, except []string, err error) {
 	if constraints == nil {
 		constraints = map[string]string{}
 	}
 
 	if user == "" {
-		return nil, errors.NewBadRequest("user is empty")
+		return nil, nil, errors.NewBadRequest("user is empty")
 	}
 
 	if resource.Resource == "" {
-		return nil, errors.NewBadRequest("resource is empty")
+		return nil, nil, errors.NewBadRequest("resource is empty")
 	}
 
-	// use cache
-	if useCache {
-
-	}
-
-	userPerms, err := m.GetUserPermissions(user, resource)
+	userPerms, err := m.GetSubjectPermissions(user, groups, resource)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	actions := m.GetActionsForResourceFast(userPerms, constraints)
-
-	// fmt.Printf("-------> actions: %+v\n", actions)
-	return actions, nil
+	actions, except = m.GetActionsExceptForResource(userPerms, m.scopeConstraints(constraints))
+	return actions, except, nil
 }
 
-func (m *AuthManager) GetUserPermissions(user string, resource schema.GroupResource) ([]*Permission, error) {
-	userbindings := m.userBindingResolver.GetUserBindings(user)
-	if u, err := m.userResolver.Get(user); err == nil {
-		if u.Spec.Groups != nil && len(u.Spec.Groups) > 0 {
-			groupUserbindings := m.userBindingResolver.GetUserBindingsByGroups(u.Spec.Groups)
-			if len(groupUserbindings) > 0 {
-				userbindings = append(userbindings, groupUserbindings...)
-			}
+// WhoCan returns the users and groups allowed to perform the action on the resource within the constraints.
+// Subjects are checked separately: users allowed by their own bindings but denied
+// by a binding of one of their groups are still returned
+func (m *AuthManager) WhoCan(action string, resource schema.GroupResource, constraints map[string]string) (users []string, groups []string, err error) {
+	if resource.Resource == "" {
+		return nil, nil, errors.NewBadRequest("resource is empty")
+	}
+	if constraints == nil {
+		constraints = map[string]string{}
+	}
+	constraints = m.scopeConstraints(constraints)
+
+	userPerms, groupPerms := m.permissionIndex.SubjectPermissions(resource)
+	users, groups = []string{}, []string{}
+	for user, perms := range userPerms {
+		if permissionsAllow(perms, action, constraints) {
+			users = append(users, user)
 		}
 	}
+	for group, perms := range groupPerms {
+		if permissionsAllow(perms, action, constraints) {
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(users)
+	sort.Strings(groups)
+	return users, groups, nil
+}
 
-	permissions := make([]*Permission, 0)
-	if userbindings == nil {
-		return permissions, nil
+// permissionsAllow returns true if a permission allows the action within the constraints and none denies it
+func permissionsAllow(permissions []*Permission, action string, constraints map[string]string) bool {
+	allowed := false
+	for _, p := range permissions {
+		if p.LabelSelector != "" || !p.IsInConstraint(constraints) || !hasAction(action, p.Actions) {
+			continue
+		}
+		if p.Deny {
+			return false
+		}
+		allowed = true
 	}
+	return allowed
+}
 
-	for _, binding := range userbindings {
-		ch := make(chan []*Permission)
-		go func(chnl chan []*Permission) {
-			perms, err := m.GetUserBindingPermissions(&binding, resource)
-			if err != nil {
-				//logger.Error("GetUserBindingPermissions", zap.Any("resource", resource), zap.Any("userbinding", binding))
-			}
-			chnl <- perms
-			close(chnl)
-		}(ch)
-		for perms := range ch {
-			permissions = append(permissions, perms...)
-		}
-	}
-	// fmt.Printf("-------> permissions: %+v\n", permissions)
-
-	return permissions, nil
-}
-
-func (m *AuthManager) GetUserBindingPermissions(userbinding *authv1.UserBinding, resource schema.GroupResource) ([]*Permission, error) {
-	//k8sClient, err := apiHandler.cManager.Client(request)
-	//if err != nil {
-	//	return nil, err
-	//}
-	//labelSelector := fmt.Sprintf("%s,%s=%s", constant.LabelRoleRelative, constant.LabelRoleRelative, userbinding.RoleName())
-	//opts := metav1.ListOptions{
-	//	LabelSelector: labelSelector,
-	//}
-	//clusterRoleList, err := k8sClient.RbacV1().ClusterRoles().List(context.TODO(), opts)
-	//if err != nil {
-	//	return nil, err
-	//}
-	clusterRoles := m.clusterRoleResolver.GetClusterRoles(userbinding.RoleName())
-	permissions := make([]*Permission, 0)
-	for _, clusterRole := range clusterRoles {
-		ch := make(chan *Permission)
-		go func(clusterRole *rbacv1.ClusterRole, userbinding *authv1.UserBinding, resource schema.GroupResource, chnl chan *Permission) {
-			for _, rule := range clusterRole.Rules {
-				// loop apigroup
-				for _, group := range rule.APIGroups {
-
-					if resource.Group != group && group != "*" {
-						continue
-					}
-
-					// loop resources
-					for _, res := range rule.Resources {
-
-						if resource.Resource != res && res != "*" {
-							continue
-						}
-
-						// loop resourceNames
-						if len(rule.ResourceNames) > 0 {
-							for _, resourceName := range rule.ResourceNames {
-
-								chnl <- NewPermission(userbinding, resource, rule.Verbs, resourceName)
-							}
-						} else {
-							chnl <- NewPermission(userbinding, resource, rule.Verbs, "")
-						}
-
-					} // end resources
-
-				} // end apigroup
-			}
-			close(chnl)
+// GetUserPermissions returns the permissions of a user and the groups of its User object for a resource
+func (m *AuthManager) GetUserPermissions(user string, resource schema.GroupResource) ([]*Permission, error) {
+	return m.GetSubjectPermissions(user, nil, resource)
+}
 
-		}(&clusterRole, userbinding, resource, ch)
+// GetSubjectPermissions returns the permissions of a user and its groups for a resource,
+// groups are completed like in Verify
+func (m *AuthManager) GetSubjectPermissions(user string, groups []string, resource schema.GroupResource) ([]*Permission, error) {
+	return m.permissionIndex.Permissions(user, m.subjectGroups(user, groups), resource), nil
+}
 
-		for perm := range ch {
-			permissions = append(permissions, perm)
-		}
+// subjectGroups returns the groups, the groups of the User object if it exists
+// and system:authenticated. Groups of the token are used even without a User object
+func (m *AuthManager) subjectGroups(user string, groups []string) []string {
+	all := sets.NewString(groups...)
+	all.Insert(authuser.AllAuthenticated)
+	if m.userResolver == nil {
+		return all.List()
 	}
-	return permissions, nil
+	if u, err := m.userResolver.Get(user); err == nil {
+		all.Insert(u.Spec.Groups...)
+	}
+	return all.List()
 }
 
 func NewPermission(userbinding *authv1.UserBinding, resource schema.GroupResource, actions []string, resourceName string) *Permission {
@@ -339,6 +713,18 @@ func NewPermission(userbinding *authv1.UserBinding, resource schema.GroupResourc
 		}
 		constraints[ResCluster] = strings.Join(clusters, ",")
 	}
+	if userbinding.Spec.Scope == authv1.UserBindingScopeProject {
+		// project bindings may be limited to some clusters of the project
+		clusters := []string{}
+		for _, c := range userbinding.Spec.Constraint {
+			if c.Cluster != "" {
+				clusters = append(clusters, c.Cluster)
+			}
+		}
+		if len(clusters) > 0 {
+			constraints[ResCluster] = strings.Join(clusters, ",")
+		}
+	}
 
 	return &Permission{
 		RoleName:    userbinding.RoleName(),
@@ -348,31 +734,55 @@ func NewPermission(userbinding *authv1.UserBinding, resource schema.GroupResourc
 	}
 }
 
+// GetActionsForResourceFast returns the actions the permissions allow within the constraints,
+// actions denied explicitly are removed unless "*" is allowed
 func (m *AuthManager) GetActionsForResourceFast(permissions []*Permission, constraints map[string]string) []string {
+	actions, _ := m.GetActionsExceptForResource(permissions, constraints)
+	return actions
+}
+
+// GetActionsExceptForResource returns the actions the permissions allow within the constraints like
+// GetActionsForResourceFast. If "*" is allowed, the actions denied by deny permissions are returned
+// as except, "*" still allows all other verbs including custom ones like bind or impersonate
+func (m *AuthManager) GetActionsExceptForResource(permissions []*Permission, constraints map[string]string) (actions []string, except []string) {
 	var (
 		actionsMap = make(map[string]struct{})
+		deniedMap  = make(map[string]struct{})
 		place      = struct{}{}
-		actions    []string
 	)
 
 	for _, p := range permissions {
-		//log.Printf("GetActionsForResourceFast.permission: %+v", *p)
-		if p.IsInConstraint(constraints) {
+		// label selector permissions only allow list requests limited to some objects
+		if p.LabelSelector == "" && p.IsInConstraint(constraints) {
+			target := actionsMap
+			if p.Deny {
+				target = deniedMap
+			}
 			for _, a := range p.Actions {
-				actionsMap[a] = place
+				target[a] = place
 			}
 		}
 	}
 
 	actions = make([]string, 0)
+	if _, ok := deniedMap["*"]; ok {
+		return actions, nil
+	}
+	if _, ok := actionsMap["*"]; ok {
+		for k := range deniedMap {
+			except = append(except, k)
+		}
+		sort.Strings(except)
+		return []string{"*"}, except
+	}
 	for k := range actionsMap {
-		if k == "*" {
-			actions = []string{"*"}
-			break
+		if _, ok := deniedMap[k]; ok {
+			continue
 		}
 		actions = append(actions, k)
 	}
-	return actions
+	sort.Strings(actions)
+	return actions, nil
 }
 
 // hasAction - verifies if the string is in the slice
@@ -390,6 +800,31 @@ func hasAction(action string, allowed []string) bool {
 	return false
 }
 
+// RequestUser returns the authenticated user stored in the request context,
+// i.e. by decorator.Auth AuthenticationFilter which must run before authorization.
+// Requests which were not authenticated are unauthorized, unverified token claims are never trusted
+func RequestUser(req *http.Request) (authuser.Info, error) {
+	if info := abcontext.User(req.Context()); info != nil {
+		return info, nil
+	}
+	return nil, errors.NewUnauthorized("request is not authenticated")
+}
+
+// IsAdmin returns true if the user is a platform administrator according to its token
+func IsAdmin(info authuser.Info) bool {
+	for _, val := range info.GetExtra()[token.ExtraIsAdmin] {
+		if val == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// IsServiceAccount returns true if the user is a kubernetes service account
+func IsServiceAccount(info authuser.Info) bool {
+	return strings.HasPrefix(info.GetName(), serviceAccountUsernamePrefix)
+}
+
 func EmailToName(email string) string {
 	if len(email) == 0 {
 		return ""
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	authv1 "gomod.alauda.cn/alauda-backend/pkg/auth/apis/v1"
+	"gomod.alauda.cn/alauda-backend/pkg/auth/clusterrole"
+	"gomod.alauda.cn/alauda-backend/pkg/auth/request"
+	"gomod.alauda.cn/alauda-backend/pkg/auth/user"
+	"gomod.alauda.cn/alauda-backend/pkg/auth/userbinding"
+	abcontext "gomod.alauda.cn/alauda-backend/pkg/context"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	authuser "k8s.io/apiserver/pkg/authentication/user"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newTestManager returns an AuthManager with synced resolvers caching the objects
+func newTestManager(t *testing.T, objects ...runtime.Object) *AuthManager {
+	t.Helper()
+	mgr, _ := newTestManagerWithClient(t, objects...)
+	return mgr
+}
+
+// newTestManagerWithClient returns an AuthManager with synced resolvers caching the objects
+// and the fake client the resolvers watch
+func newTestManagerWithClient(t *testing.T, objects ...runtime.Object) (*AuthManager, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	unstructuredObjects := make([]runtime.Object, 0, len(objects))
+	for _, obj := range objects {
+		unstructuredObjects = append(unstructuredObjects, toUnstructured(t, obj))
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		authv1.SchemeGroupVersion.WithResource("userbindings"): "UserBindingList",
+		authv1.SchemeGroupVersion.WithResource("users"):        "UserList",
+		rbacv1.SchemeGroupVersion.WithResource("clusterroles"): "ClusterRoleList",
+	}, unstructuredObjects...)
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	bindings := userbinding.NewResolver(client, 0, stopCh)
+	roles := clusterrole.NewResolver(client, 0, stopCh)
+	users := user.NewResolver(client, 0, stopCh)
+	if !cache.WaitForCacheSync(stopCh, bindings.HasSynced, roles.HasSynced, users.HasSynced) {
+		t.Fatalf("caches did not sync")
+	}
+	return NewManager(NewCache(time.Hour, 0), nil, bindings, roles, testRequestInfoFactory(), users), client
+}
+
+// testRequestInfoFactory returns a RequestInfoFactory for /apis and the groupless /api prefix
+func testRequestInfoFactory() *request.RequestInfoFactory {
+	return &request.RequestInfoFactory{
+		APIPrefixes:          sets.NewString("apis", "api"),
+		GrouplessAPIPrefixes: sets.NewString("api"),
+	}
+}
+
+// toUnstructured converts a typed object for the fake client
+func toUnstructured(t *testing.T, obj runtime.Object) *unstructured.Unstructured {
+	t.Helper()
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		t.Fatalf("failed to convert %T: %v", obj, err)
+	}
+	return &unstructured.Unstructured{Object: data}
+}
+
+// eventually fails the test if cond does not return true within a few seconds,
+// i.e. until informers received the changes of the fake client
+func eventually(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for !cond() {
+		select {
+		case <-timeout:
+			t.Fatal(msg)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// testBinding returns a userbinding of the email to the role with the labels
+func testBinding(name, email, role string, labels map[string]string, subjects ...authv1.Subject) *authv1.UserBinding {
+	binding := &authv1.UserBinding{
+		TypeMeta: metav1.TypeMeta{APIVersion: authv1.SchemeGroupVersion.String(), Kind: "UserBinding"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{"auth.cpaas.io/role.name": role},
+			Annotations: map[string]string{},
+		},
+		Spec: authv1.UserBindingSpec{Subjects: subjects, RoleRef: role},
+	}
+	if email != "" {
+		binding.Labels["auth.cpaas.io/user.email"] = EmailToName(email)
+		binding.Annotations["auth.cpaas.io/user.email"] = email
+	}
+	for k, v := range labels {
+		binding.Labels[k] = v
+	}
+	return binding
+}
+
+// testClusterRole returns a clusterrole for the role relative name with the rules
+func testClusterRole(name, role string, annotations map[string]string, rules ...rbacv1.PolicyRule) *rbacv1.ClusterRole {
+	return &rbacv1.ClusterRole{
+		TypeMeta: metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{clusterrole.LabelRoleRelative: role},
+			Annotations: annotations,
+		},
+		Rules: rules,
+	}
+}
+
+// authenticated returns the request with the user in its context
+func authenticated(req *http.Request, name string, groups ...string) *http.Request {
+	info := &authuser.DefaultInfo{Name: name, Groups: groups}
+	return req.WithContext(abcontext.WithUser(req.Context(), info))
+}
+
+func TestAuthorizeUnavailableUntilSynced(t *testing.T) {
+	mgr := newTestManager(t,
+		testClusterRole("viewer", "viewer", nil, rbacv1.PolicyRule{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"get"}}),
+		testBinding("admin-viewer", "admin@example.com", "viewer", nil),
+	)
+	req := authenticated(httptest.NewRequest("GET", "/apis/apps/v1/deployments/nginx", nil), "admin@example.com")
+
+	synced := false
+	mgr.synced = append(mgr.synced, func() bool { return synced })
+	allowed, _, _, err := mgr.AuthorizeWithFilter(context.Background(), req, nil)
+	if allowed || !errors.IsServiceUnavailable(err) {
+		t.Errorf("got allowed %v and error %v before the caches synced, want service unavailable", allowed, err)
+	}
+
+	synced = true
+	allowed, reason, _, err := mgr.AuthorizeWithFilter(context.Background(), req, nil)
+	if !allowed || err != nil {
+		t.Errorf("got allowed %v, reason %q and error %v after the caches synced, want allowed", allowed, reason, err)
+	}
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gomod.alauda.cn/alauda-backend/pkg/util/token"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+)
+
+// unionAuthenticator authenticates requests trying each authenticator in order
+type unionAuthenticator []authenticator.Request
+
+// NewAuthenticatorChain creates an authenticator trying all authenticators in order.
+// The first authenticator able to authenticate the request wins, errors are only
+// returned when no authenticator succeeded
+func NewAuthenticatorChain(authenticators ...authenticator.Request) authenticator.Request {
+	return unionAuthenticator(authenticators)
+}
+
+// AuthenticateRequest authenticates the request using the chain of authenticators
+func (u unionAuthenticator) AuthenticateRequest(req *http.Request) (*authenticator.Response, bool, error) {
+	var errs []error
+	for _, authn := range u {
+		resp, ok, err := authn.AuthenticateRequest(req)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			return resp, true, nil
+		}
+	}
+	return nil, false, utilerrors.NewAggregate(errs)
+}
+
+// bearerToken returns the bearer token of the request if any
+func bearerToken(req *http.Request) string {
+	raw, err := token.ParseRawToken(req)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(raw)
+}
+
+// tokenIssuer returns the unverified issuer of a JWT token
+func tokenIssuer(raw string) (string, error) {
+	jwt, err := token.ParseJWT(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid bearer token: %v", err)
+	}
+	return jwt.Issuer, nil
+}
@@ -0,0 +1,443 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	authnv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// authenticatorFunc adapts a function to authenticator.Request
+type authenticatorFunc func(req *http.Request) (*authenticator.Response, bool, error)
+
+func (f authenticatorFunc) AuthenticateRequest(req *http.Request) (*authenticator.Response, bool, error) {
+	return f(req)
+}
+
+// fixedAuthenticator returns an authenticator authenticating all requests as name,
+// an empty name means no opinion
+func fixedAuthenticator(name string, err error) authenticator.Request {
+	return authenticatorFunc(func(*http.Request) (*authenticator.Response, bool, error) {
+		if err != nil || name == "" {
+			return nil, false, err
+		}
+		return &authenticator.Response{User: &user.DefaultInfo{Name: name}}, true, nil
+	})
+}
+
+// bearerRequest returns a request with the bearer token
+func bearerRequest(token string) *http.Request {
+	req := httptest.NewRequest("GET", "/apis/v1/users", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// unsignedToken returns a JWT with the claims which is not signed
+func unsignedToken(t *testing.T, claims map[string]interface{}) string {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("invalid claims: %v", err)
+	}
+	return "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString(data) + ".sig"
+}
+
+func TestAuthenticatorChain(t *testing.T) {
+	tests := []struct {
+		name           string
+		authenticators []authenticator.Request
+		wantUser       string
+		wantErr        bool
+	}{
+		{
+			name:           "first authenticator wins",
+			authenticators: []authenticator.Request{fixedAuthenticator("a", nil), fixedAuthenticator("b", nil)},
+			wantUser:       "a",
+		},
+		{
+			name:           "authenticators without opinion are skipped",
+			authenticators: []authenticator.Request{fixedAuthenticator("", nil), fixedAuthenticator("b", nil)},
+			wantUser:       "b",
+		},
+		{
+			name:           "errors are ignored if another authenticator succeeds",
+			authenticators: []authenticator.Request{fixedAuthenticator("", fmt.Errorf("failed")), fixedAuthenticator("b", nil)},
+			wantUser:       "b",
+		},
+		{
+			name:           "errors are returned if no authenticator succeeds",
+			authenticators: []authenticator.Request{fixedAuthenticator("", fmt.Errorf("failed")), fixedAuthenticator("", nil)},
+			wantErr:        true,
+		},
+		{
+			name:           "no opinion",
+			authenticators: []authenticator.Request{fixedAuthenticator("", nil)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, ok, err := NewAuthenticatorChain(test.authenticators...).AuthenticateRequest(bearerRequest("token"))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if ok != (test.wantUser != "") {
+				t.Fatalf("got authenticated %v, want user %q", ok, test.wantUser)
+			}
+			if ok && resp.User.GetName() != test.wantUser {
+				t.Errorf("got user %q, want %q", resp.User.GetName(), test.wantUser)
+			}
+		})
+	}
+}
+
+func TestManagerAuthenticate(t *testing.T) {
+	tests := []struct {
+		name          string
+		authenticator authenticator.Request
+		token         string
+		wantUser      string
+	}{
+		{name: "authenticated", authenticator: fixedAuthenticator("a", nil), token: "token", wantUser: "a"},
+		{name: "missing token", authenticator: fixedAuthenticator("a", nil)},
+		{name: "no authenticator", token: "token"},
+		{name: "authenticator error", authenticator: fixedAuthenticator("", fmt.Errorf("failed")), token: "token"},
+		{name: "no opinion", authenticator: fixedAuthenticator("", nil), token: "token"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mgr := &AuthManager{authenticator: test.authenticator}
+			info, err := mgr.Authenticate(context.Background(), bearerRequest(test.token))
+			if test.wantUser == "" {
+				if !errors.IsUnauthorized(err) {
+					t.Errorf("got user %v and error %v, want unauthorized", info, err)
+				}
+				return
+			}
+			if err != nil || info.GetName() != test.wantUser {
+				t.Errorf("got user %v and error %v, want %q", info, err, test.wantUser)
+			}
+		})
+	}
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	const (
+		issuer   = "https://issuer.example.com"
+		clientID = "backend"
+	)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	keys := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: key.Public(), KeyID: "key", Algorithm: "RS256", Use: "sig"}}}
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(keys)
+	}))
+	defer jwks.Close()
+
+	sign := func(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, (&jose.SignerOptions{}).WithHeader("kid", "key"))
+		if err != nil {
+			t.Fatalf("failed to create signer: %v", err)
+		}
+		payload, _ := json.Marshal(claims)
+		sig, err := signer.Sign(payload)
+		if err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		raw, err := sig.CompactSerialize()
+		if err != nil {
+			t.Fatalf("failed to serialize: %v", err)
+		}
+		return raw
+	}
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":    issuer,
+			"aud":    clientID,
+			"sub":    "alice-id",
+			"exp":    time.Now().Add(time.Hour).Unix(),
+			"email":  "alice@example.com",
+			"groups": []string{"devs"},
+			"ext":    map[string]interface{}{"is_admin": true, "conn_id": "ldap"},
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantUser *user.DefaultInfo
+		wantErr  bool
+	}{
+		{
+			name:  "valid token",
+			token: sign(t, key, claims(nil)),
+			wantUser: &user.DefaultInfo{
+				Name:   "alice@example.com",
+				UID:    "alice-id",
+				Groups: []string{"devs"},
+				Extra:  map[string][]string{"is_admin": {"true"}, "conn_id": {"ldap"}},
+			},
+		},
+		{
+			name:  "other issuer",
+			token: sign(t, key, claims(map[string]interface{}{"iss": "kubernetes/serviceaccount"})),
+		},
+		{
+			name:    "expired",
+			token:   sign(t, key, claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})),
+			wantErr: true,
+		},
+		{
+			name:    "other audience",
+			token:   sign(t, key, claims(map[string]interface{}{"aud": "other"})),
+			wantErr: true,
+		},
+		{
+			name:    "invalid signature",
+			token:   sign(t, otherKey, claims(nil)),
+			wantErr: true,
+		},
+		{
+			name:    "unsigned",
+			token:   unsignedToken(t, claims(nil)),
+			wantErr: true,
+		},
+		{
+			name:    "missing username claim",
+			token:   sign(t, key, claims(map[string]interface{}{"email": nil})),
+			wantErr: true,
+		},
+		{
+			name: "missing token",
+		},
+	}
+	authn, err := NewOIDCAuthenticator(OIDCConfig{IssuerURL: issuer, ClientID: clientID, JWKSURL: jwks.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, ok, err := authn.AuthenticateRequest(bearerRequest(test.token))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if ok != (test.wantUser != nil) {
+				t.Fatalf("got authenticated %v, want user %v", ok, test.wantUser)
+			}
+			if ok && !reflect.DeepEqual(resp.User, test.wantUser) {
+				t.Errorf("got user %+v, want %+v", resp.User, test.wantUser)
+			}
+		})
+	}
+}
+
+func TestNewOIDCAuthenticatorValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		config OIDCConfig
+	}{
+		{name: "missing issuer", config: OIDCConfig{ClientID: "backend"}},
+		{name: "missing client id", config: OIDCConfig{IssuerURL: "https://issuer.example.com"}},
+		{name: "missing ca file", config: OIDCConfig{IssuerURL: "https://issuer.example.com", ClientID: "backend", CAFile: "/missing/ca.crt"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewOIDCAuthenticator(test.config); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestTokenReviewAuthenticator(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   authnv1.TokenReviewStatus
+		err      error
+		wantUser string
+		wantErr  bool
+	}{
+		{
+			name: "authenticated",
+			status: authnv1.TokenReviewStatus{
+				Authenticated: true,
+				User:          authnv1.UserInfo{Username: "system:serviceaccount:default:app", Groups: []string{"system:serviceaccounts"}},
+				Audiences:     []string{"backend"},
+			},
+			wantUser: "system:serviceaccount:default:app",
+		},
+		{
+			name:   "not authenticated",
+			status: authnv1.TokenReviewStatus{},
+		},
+		{
+			name:    "review error",
+			status:  authnv1.TokenReviewStatus{Error: "invalid token"},
+			wantErr: true,
+		},
+		{
+			name:    "request error",
+			err:     fmt.Errorf("connection refused"),
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			var reviewed *authnv1.TokenReview
+			client.PrependReactor("create", "tokenreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				reviewed = action.(clienttesting.CreateAction).GetObject().(*authnv1.TokenReview)
+				return true, &authnv1.TokenReview{Status: test.status}, test.err
+			})
+
+			resp, ok, err := NewTokenReviewAuthenticator(client, []string{"backend"}).AuthenticateRequest(bearerRequest("token"))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if ok != (test.wantUser != "") {
+				t.Fatalf("got authenticated %v, want user %q", ok, test.wantUser)
+			}
+			if ok && resp.User.GetName() != test.wantUser {
+				t.Errorf("got user %q, want %q", resp.User.GetName(), test.wantUser)
+			}
+			if reviewed.Spec.Token != "token" || !reflect.DeepEqual(reviewed.Spec.Audiences, []string{"backend"}) {
+				t.Errorf("got review %+v, want the token and audiences", reviewed.Spec)
+			}
+		})
+	}
+}
+
+func TestErebusAuthenticator(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		wantUser string
+		wantErr  bool
+	}{
+		{name: "accepted", status: http.StatusOK, wantUser: "alice@example.com"},
+		{name: "forbidden is accepted", status: http.StatusForbidden, wantUser: "alice@example.com"},
+		{name: "unauthorized", status: http.StatusUnauthorized},
+		{name: "unavailable", status: http.StatusServiceUnavailable, wantErr: true},
+	}
+	raw := unsignedToken(t, map[string]interface{}{"email": "alice@example.com"})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var gotAuth string
+			srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAuth = r.Header.Get("Authorization")
+				w.WriteHeader(test.status)
+			}))
+			defer srv.Close()
+
+			authn, err := NewErebusAuthenticator(srv.URL)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp, ok, err := authn.AuthenticateRequest(bearerRequest(raw))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if ok != (test.wantUser != "") {
+				t.Fatalf("got authenticated %v, want user %q", ok, test.wantUser)
+			}
+			if ok && resp.User.GetName() != test.wantUser {
+				t.Errorf("got user %q, want %q", resp.User.GetName(), test.wantUser)
+			}
+			if gotAuth != "Bearer "+raw {
+				t.Errorf("got authorization %q, want the bearer token of the request", gotAuth)
+			}
+		})
+	}
+}
+
+func TestCachedTokenAuthenticator(t *testing.T) {
+	valid := unsignedToken(t, map[string]interface{}{"email": "alice@example.com", "exp": time.Now().Add(time.Hour).Unix()})
+	expired := unsignedToken(t, map[string]interface{}{"email": "alice@example.com", "exp": time.Now().Add(-time.Minute).Unix()})
+
+	tests := []struct {
+		name      string
+		token     string
+		user      string
+		err       error
+		ttl       time.Duration
+		wantCalls int
+	}{
+		{name: "authenticated", token: valid, user: "alice@example.com", ttl: time.Minute, wantCalls: 1},
+		{name: "not authenticated", token: "opaque", ttl: time.Minute, wantCalls: 1},
+		{name: "errors are not cached", token: valid, err: fmt.Errorf("connection refused"), ttl: time.Minute, wantCalls: 2},
+		{name: "expired token", token: expired, user: "alice@example.com", ttl: time.Minute, wantCalls: 2},
+		{name: "without token", user: "anonymous", ttl: time.Minute, wantCalls: 2},
+		{name: "disabled", token: valid, user: "alice@example.com", wantCalls: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls int
+			authn := NewCachedTokenAuthenticator(authenticatorFunc(func(req *http.Request) (*authenticator.Response, bool, error) {
+				calls++
+				return fixedAuthenticator(test.user, test.err).AuthenticateRequest(req)
+			}), test.ttl)
+
+			for i := 0; i < 2; i++ {
+				resp, ok, err := authn.AuthenticateRequest(bearerRequest(test.token))
+				if (err != nil) != (test.err != nil) {
+					t.Fatalf("got error %v, want %v", err, test.err)
+				}
+				if ok != (test.user != "") {
+					t.Fatalf("got authenticated %v, want user %q", ok, test.user)
+				}
+				if ok && resp.User.GetName() != test.user {
+					t.Errorf("got user %q, want %q", resp.User.GetName(), test.user)
+				}
+			}
+			if calls != test.wantCalls {
+				t.Errorf("got %d authentications, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+
+	// tokens are cached separately
+	var calls int
+	authn := NewCachedTokenAuthenticator(authenticatorFunc(func(req *http.Request) (*authenticator.Response, bool, error) {
+		calls++
+		return &authenticator.Response{User: &user.DefaultInfo{Name: bearerToken(req)}}, true, nil
+	}), time.Minute)
+	for _, token := range []string{"first", "second", "first"} {
+		resp, _, _ := authn.AuthenticateRequest(bearerRequest(token))
+		if resp.User.GetName() != token {
+			t.Errorf("got user %q, want %q", resp.User.GetName(), token)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("got %d authentications, want 2", calls)
+	}
+}
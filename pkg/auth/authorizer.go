@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gomod.alauda.cn/alauda-backend/pkg/auth/request"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// Decision result of an authorizer
+type Decision int
+
+const (
+	// DecisionDeny means that an authorizer decided to deny the request
+	DecisionDeny Decision = iota
+	// DecisionAllow means that an authorizer decided to allow the request
+	DecisionAllow
+	// DecisionNoOpinion means that an authorizer has no opinion on whether
+	// to allow or deny the request, the next authorizer decides
+	DecisionNoOpinion
+)
+
+// String returns the decision name
+func (d Decision) String() string {
+	switch d {
+	case DecisionAllow:
+		return "allow"
+	case DecisionDeny:
+		return "deny"
+	case DecisionNoOpinion:
+		return "no-opinion"
+	}
+	return fmt.Sprintf("unknown(%d)", int(d))
+}
+
+// ParseDecision parses a decision name
+func ParseDecision(name string) (Decision, error) {
+	switch name {
+	case DecisionAllow.String():
+		return DecisionAllow, nil
+	case DecisionDeny.String():
+		return DecisionDeny, nil
+	case DecisionNoOpinion.String():
+		return DecisionNoOpinion, nil
+	}
+	return DecisionNoOpinion, fmt.Errorf("unknown decision %q, supported: allow, deny, no-opinion", name)
+}
+
+// Authorizer decides if a request is allowed
+type Authorizer interface {
+	Authorize(ctx context.Context, req *http.Request, opt *FilterOption) (decision Decision, reason string, err error)
+}
+
+// AuthorizerFunc function implementing Authorizer
+type AuthorizerFunc func(ctx context.Context, req *http.Request, opt *FilterOption) (Decision, string, error)
+
+// Authorize calls f(ctx, req, opt)
+func (f AuthorizerFunc) Authorize(ctx context.Context, req *http.Request, opt *FilterOption) (Decision, string, error) {
+	return f(ctx, req, opt)
+}
+
+// unionAuthorizer asks each authorizer in order until one allows or denies the request
+type unionAuthorizer []Authorizer
+
+// NewAuthorizerChain creates an authorizer asking all authorizers in order.
+// The first authorizer allowing or denying the request decides,
+// the request has no opinion if all authorizers have no opinion
+func NewAuthorizerChain(authorizers ...Authorizer) Authorizer {
+	return unionAuthorizer(authorizers)
+}
+
+// Authorize asks all authorizers in order
+func (u unionAuthorizer) Authorize(ctx context.Context, req *http.Request, opt *FilterOption) (Decision, string, error) {
+	var (
+		errs    []error
+		reasons []string
+	)
+	for _, authz := range u {
+		decision, reason, err := authz.Authorize(ctx, req, opt)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if reason != "" {
+			reasons = append(reasons, reason)
+		}
+		switch decision {
+		case DecisionAllow, DecisionDeny:
+			return decision, reason, err
+		}
+	}
+	return DecisionNoOpinion, strings.Join(reasons, "\n"), utilerrors.NewAggregate(errs)
+}
+
+// applyResourceMap maps the requested resource according to the filter option
+func applyResourceMap(requestInfo *request.RequestInfo, opt *FilterOption) {
+	if opt == nil || len(opt.ResourceMap) == 0 {
+		return
+	}
+	gr := requestInfo.Resource + "." + requestInfo.APIGroup
+	if val, ok := opt.ResourceMap[gr]; ok {
+		items := strings.Split(val, ".")
+		requestInfo.Resource = items[0]
+		requestInfo.APIGroup = strings.Join(items[1:], ".")
+	}
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	authzv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// fixedAuthorizer returns an authorizer always returning the decision
+func fixedAuthorizer(decision Decision, reason string, err error) Authorizer {
+	return AuthorizerFunc(func(context.Context, *http.Request, *FilterOption) (Decision, string, error) {
+		return decision, reason, err
+	})
+}
+
+func TestAuthorizerChain(t *testing.T) {
+	tests := []struct {
+		name         string
+		authorizers  []Authorizer
+		wantDecision Decision
+		wantReason   string
+		wantErr      bool
+	}{
+		{
+			name:         "first allow wins",
+			authorizers:  []Authorizer{fixedAuthorizer(DecisionAllow, "a", nil), fixedAuthorizer(DecisionDeny, "b", nil)},
+			wantDecision: DecisionAllow,
+			wantReason:   "a",
+		},
+		{
+			name:         "first deny wins",
+			authorizers:  []Authorizer{fixedAuthorizer(DecisionDeny, "a", nil), fixedAuthorizer(DecisionAllow, "b", nil)},
+			wantDecision: DecisionDeny,
+			wantReason:   "a",
+		},
+		{
+			name:         "no opinion asks the next authorizer",
+			authorizers:  []Authorizer{fixedAuthorizer(DecisionNoOpinion, "a", nil), fixedAuthorizer(DecisionAllow, "b", nil)},
+			wantDecision: DecisionAllow,
+			wantReason:   "b",
+		},
+		{
+			name:         "errors of authorizers without opinion do not prevent decisions",
+			authorizers:  []Authorizer{fixedAuthorizer(DecisionNoOpinion, "", fmt.Errorf("failed")), fixedAuthorizer(DecisionDeny, "b", nil)},
+			wantDecision: DecisionDeny,
+			wantReason:   "b",
+		},
+		{
+			name:         "no opinion at all",
+			authorizers:  []Authorizer{fixedAuthorizer(DecisionNoOpinion, "a", fmt.Errorf("failed")), fixedAuthorizer(DecisionNoOpinion, "b", nil)},
+			wantDecision: DecisionNoOpinion,
+			wantReason:   "a\nb",
+			wantErr:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decision, reason, err := NewAuthorizerChain(test.authorizers...).Authorize(context.Background(), nil, nil)
+			if decision != test.wantDecision || reason != test.wantReason || (err != nil) != test.wantErr {
+				t.Errorf("got %v, %q and error %v, want %v, %q and error %v", decision, reason, err, test.wantDecision, test.wantReason, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseDecision(t *testing.T) {
+	for _, decision := range []Decision{DecisionAllow, DecisionDeny, DecisionNoOpinion} {
+		if got, err := ParseDecision(decision.String()); got != decision || err != nil {
+			t.Errorf("got %v and error %v parsing %q", got, err, decision)
+		}
+	}
+	if _, err := ParseDecision("maybe"); err == nil {
+		t.Errorf("expected an error for an unknown decision")
+	}
+}
+
+func TestApplyResourceMap(t *testing.T) {
+	mgr := &AuthManager{requestInfoResolver: testRequestInfoFactory()}
+	req := httptest.NewRequest("GET", "/apis/abc.alauda.io/v1/metrics", nil)
+	info, err := mgr.requestInfoResolver.NewRequestInfo(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	applyResourceMap(info, &FilterOption{ResourceMap: map[string]string{"metrics.abc.alauda.io": "pods.metrics.k8s.io"}})
+	if info.Resource != "pods" || info.APIGroup != "metrics.k8s.io" {
+		t.Errorf("got resource %q of group %q, want pods of metrics.k8s.io", info.Resource, info.APIGroup)
+	}
+}
+
+func TestSubjectAccessReviewAuthorizer(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          *http.Request
+		status       authzv1.SubjectAccessReviewStatus
+		err          error
+		wantDecision Decision
+		wantErr      bool
+		wantSpec     *authzv1.SubjectAccessReviewSpec
+		wantNoReview bool
+	}{
+		{
+			name:         "allowed resource request",
+			req:          authenticated(httptest.NewRequest("GET", "/apis/apps/v1/clusters/global/namespaces/default/deployments/nginx/scale", nil), "alice", "devs"),
+			status:       authzv1.SubjectAccessReviewStatus{Allowed: true},
+			wantDecision: DecisionAllow,
+			wantSpec: &authzv1.SubjectAccessReviewSpec{
+				User:   "alice",
+				Groups: []string{"devs"},
+				Extra:  map[string]authzv1.ExtraValue{},
+				ResourceAttributes: &authzv1.ResourceAttributes{
+					Namespace: "default", Verb: "get", Group: "apps", Version: "v1",
+					Resource: "deployments", Subresource: "scale", Name: "nginx",
+				},
+			},
+		},
+		{
+			name:         "other cluster",
+			req:          authenticated(httptest.NewRequest("GET", "/apis/apps/v1/clusters/business/namespaces/default/deployments/nginx", nil), "alice"),
+			status:       authzv1.SubjectAccessReviewStatus{Allowed: true},
+			wantDecision: DecisionNoOpinion,
+			wantNoReview: true,
+		},
+		{
+			name:         "denied non-resource request",
+			req:          authenticated(httptest.NewRequest("POST", "/metrics", nil), "alice"),
+			status:       authzv1.SubjectAccessReviewStatus{Denied: true},
+			wantDecision: DecisionDeny,
+			wantSpec: &authzv1.SubjectAccessReviewSpec{
+				User:                  "alice",
+				Extra:                 map[string]authzv1.ExtraValue{},
+				NonResourceAttributes: &authzv1.NonResourceAttributes{Path: "/metrics", Verb: "post"},
+			},
+		},
+		{
+			name:         "no match",
+			req:          authenticated(httptest.NewRequest("GET", "/api/v1/pods", nil), "alice"),
+			wantDecision: DecisionNoOpinion,
+		},
+		{
+			name:         "evaluation error",
+			req:          authenticated(httptest.NewRequest("GET", "/api/v1/pods", nil), "alice"),
+			status:       authzv1.SubjectAccessReviewStatus{EvaluationError: "failed"},
+			wantDecision: DecisionNoOpinion,
+			wantErr:      true,
+		},
+		{
+			name:         "request error",
+			req:          authenticated(httptest.NewRequest("GET", "/api/v1/pods", nil), "alice"),
+			err:          fmt.Errorf("connection refused"),
+			wantDecision: DecisionNoOpinion,
+			wantErr:      true,
+		},
+		{
+			name:         "unauthenticated",
+			req:          httptest.NewRequest("GET", "/api/v1/pods", nil),
+			wantDecision: DecisionNoOpinion,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			var reviewed *authzv1.SubjectAccessReview
+			client.PrependReactor("create", "subjectaccessreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				reviewed = action.(clienttesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+				return true, &authzv1.SubjectAccessReview{Status: test.status}, test.err
+			})
+
+			authz := NewSubjectAccessReviewAuthorizer(client, testRequestInfoFactory(), "global", DecisionNoOpinion)
+			decision, _, err := authz.Authorize(context.Background(), test.req, nil)
+			if decision != test.wantDecision || (err != nil) != test.wantErr {
+				t.Errorf("got %v and error %v, want %v and error %v", decision, err, test.wantDecision, test.wantErr)
+			}
+			if test.wantNoReview && reviewed != nil {
+				t.Errorf("expected no review, got %+v", reviewed)
+			}
+			if test.wantSpec != nil && (reviewed == nil || !reflect.DeepEqual(reviewed.Spec, *test.wantSpec)) {
+				t.Errorf("got review %+v, want %+v", reviewed, *test.wantSpec)
+			}
+		})
+	}
+}
+
+// TestUserBindingAuthorizerServiceAccounts checks service accounts without bindings
+// are left to the next authorizer while users without bindings are denied
+func TestUserBindingAuthorizerServiceAccounts(t *testing.T) {
+	mgr := newTestManager(t,
+		testClusterRole("viewer", "viewer", nil, rbacv1.PolicyRule{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"get"}}),
+	)
+	mgr.WithAuthorizer(NewAuthorizerChain(mgr.UserBindingAuthorizer(DecisionDeny), fixedAuthorizer(DecisionAllow, "rbac", nil)))
+
+	tests := []struct {
+		name        string
+		user        string
+		wantAllowed bool
+	}{
+		{name: "service account", user: "system:serviceaccount:default:app", wantAllowed: true},
+		{name: "user", user: "alice@example.com", wantAllowed: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := authenticated(httptest.NewRequest("GET", "/api/v1/pods", nil), test.user)
+			allowed, _, _, err := mgr.AuthorizeWithFilter(context.Background(), req, nil)
+			if allowed != test.wantAllowed {
+				t.Errorf("got allowed %v and error %v, want allowed %v", allowed, err, test.wantAllowed)
+			}
+		})
+	}
+}
@@ -1,28 +1,123 @@
 package auth
 
 import (
-	//cache "github.com/patrickmn/go-cache"
-	"k8s.io/client-go/dynamic"
+	"encoding/json"
+	"sort"
+	"sync"
 	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/cache"
+)
+
+const (
+	// DefaultCacheSize default maximum number of cached authorization decisions
+	DefaultCacheSize = 4096
 )
 
 type cacheManger struct {
 	expiration time.Duration
-	clientset  dynamic.Interface
-	//authzCache *cache.Cache
+	size       int
+
+	lock       sync.RWMutex
+	generation uint64
+	authzCache *cache.LRUExpireCache
 }
 
-func NewCache(expiration time.Duration) Cache {
+// NewCache creates a bounded authorization decision cache. Decisions expire after expiration
+// and the least recently used decisions are evicted when more than size decisions are cached.
+// A size lower or equal to zero uses DefaultCacheSize
+func NewCache(expiration time.Duration, size int) Cache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
 	return &cacheManger{
 		expiration: expiration,
-		//authzCache: cache.New(expiration, 3*time.Minute),
+		size:       size,
+		authzCache: cache.NewLRUExpireCache(size),
+	}
+}
+
+// GetAuthorize returns the cached decision for key. On a miss the decision is computed
+// using authorize and cached unless it failed or the cache was invalidated meanwhile
+func (m *cacheManger) GetAuthorize(key string, authorize AuthorizeFunc) (*VerifyResult, error) {
+	m.lock.RLock()
+	generation, authzCache := m.generation, m.authzCache
+	m.lock.RUnlock()
+
+	if val, ok := authzCache.Get(key); ok {
+		cacheRequests.WithLabelValues(cacheHit).Inc()
+		return val.(*VerifyResult), nil
+	}
+	cacheRequests.WithLabelValues(cacheMiss).Inc()
+
+	result, err := authorize()
+	if err != nil {
+		return result, err
 	}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	// permissions changed while authorizing, the decision may be stale
+	if generation == m.generation {
+		m.authzCache.Add(key, result, m.expiration)
+	}
+	return result, nil
+}
+
+// Invalidate drops all cached decisions
+func (m *cacheManger) Invalidate() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.generation++
+	m.authzCache = cache.NewLRUExpireCache(m.size)
+	cacheInvalidations.Inc()
+}
+
+// decisionKey fields identifying an authorization decision, encoded as JSON
+// thus values containing separators do not collide. Map keys are sorted by encoding/json
+type decisionKey struct {
+	User        string            `json:"user"`
+	Groups      []string          `json:"groups,omitempty"`
+	Verb        string            `json:"verb"`
+	Resource    string            `json:"resource,omitempty"`
+	URL         string            `json:"url,omitempty"`
+	Constraints map[string]string `json:"constraints,omitempty"`
 }
 
-func (m *cacheManger) GetAuthorize(key string) (bool, error) {
-	return false, nil
+// DecisionKey returns the cache key of an authorization decision
+func DecisionKey(user string, groups []string, verb string, resource schema.GroupResource, constraints map[string]string) string {
+	return decisionKey{
+		User:        user,
+		Groups:      sortedGroups(groups),
+		Verb:        verb,
+		Resource:    resource.String(),
+		Constraints: constraints,
+	}.String()
 }
 
-func (m *cacheManger) SetAuthorize(key string, val interface{}, d time.Duration) error {
-	return nil
+// NonResourceDecisionKey returns the cache key of an authorization decision for a non-resource URL
+func NonResourceDecisionKey(user string, groups []string, verb, url string) string {
+	return decisionKey{
+		User:   user,
+		Groups: sortedGroups(groups),
+		Verb:   verb,
+		URL:    url,
+	}.String()
+}
+
+// String returns the key encoded as JSON
+func (k decisionKey) String() string {
+	data, _ := json.Marshal(k)
+	return string(data)
+}
+
+// sortedGroups returns a sorted copy of the groups
+func sortedGroups(groups []string) []string {
+	if len(groups) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), groups...)
+	sort.Strings(sorted)
+	return sorted
 }
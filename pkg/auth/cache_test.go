@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	authv1 "gomod.alauda.cn/alauda-backend/pkg/auth/apis/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestDecisionKey(t *testing.T) {
+	deployments := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	tests := []struct {
+		name      string
+		key       string
+		other     string
+		wantEqual bool
+	}{
+		{
+			name:      "group order",
+			key:       DecisionKey("user", []string{"a", "b"}, "get", deployments, nil),
+			other:     DecisionKey("user", []string{"b", "a"}, "get", deployments, nil),
+			wantEqual: true,
+		},
+		{
+			name:  "separators in the user",
+			key:   DecisionKey("user|get", nil, "list", deployments, nil),
+			other: DecisionKey("user", nil, "get|list", deployments, nil),
+		},
+		{
+			name:  "separators in groups",
+			key:   DecisionKey("user", []string{"a,b"}, "get", deployments, nil),
+			other: DecisionKey("user", []string{"a", "b"}, "get", deployments, nil),
+		},
+		{
+			name:  "separators in constraints",
+			key:   DecisionKey("user", nil, "get", deployments, map[string]string{ResProject: "a=b", ResNamespace: "c"}),
+			other: DecisionKey("user", nil, "get", deployments, map[string]string{ResProject: "a", ResNamespace: "b=c"}),
+		},
+		{
+			name:  "missing constraints",
+			key:   DecisionKey("user", nil, "get", deployments, map[string]string{ResProject: "a"}),
+			other: DecisionKey("user", nil, "get", deployments, nil),
+		},
+		{
+			name:  "resource and non-resource",
+			key:   DecisionKey("user", nil, "get", schema.GroupResource{Resource: "/healthz"}, nil),
+			other: NonResourceDecisionKey("user", nil, "get", "/healthz"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.key == test.other; got != test.wantEqual {
+				t.Errorf("got equal %v for keys %s and %s, want %v", got, test.key, test.other, test.wantEqual)
+			}
+		})
+	}
+}
+
+// countingAuthorize returns an AuthorizeFunc counting its calls
+func countingAuthorize(calls *int, result *VerifyResult, err error) AuthorizeFunc {
+	return func() (*VerifyResult, error) {
+		*calls++
+		return result, err
+	}
+}
+
+func TestCacheGetAuthorize(t *testing.T) {
+	allowed := &VerifyResult{Allowed: true}
+	tests := []struct {
+		name      string
+		size      int
+		ttl       time.Duration
+		run       func(c Cache, calls *int)
+		wantCalls int
+	}{
+		{
+			name: "decisions are cached",
+			run: func(c Cache, calls *int) {
+				c.GetAuthorize("a", countingAuthorize(calls, allowed, nil))
+				c.GetAuthorize("a", countingAuthorize(calls, allowed, nil))
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "failures are not cached",
+			run: func(c Cache, calls *int) {
+				c.GetAuthorize("a", countingAuthorize(calls, nil, fmt.Errorf("failed")))
+				c.GetAuthorize("a", countingAuthorize(calls, allowed, nil))
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "invalidation drops decisions",
+			run: func(c Cache, calls *int) {
+				c.GetAuthorize("a", countingAuthorize(calls, allowed, nil))
+				c.Invalidate()
+				c.GetAuthorize("a", countingAuthorize(calls, allowed, nil))
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "decisions computed during an invalidation are not cached",
+			run: func(c Cache, calls *int) {
+				c.GetAuthorize("a", func() (*VerifyResult, error) {
+					*calls++
+					c.Invalidate()
+					return allowed, nil
+				})
+				c.GetAuthorize("a", countingAuthorize(calls, allowed, nil))
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "least recently used decisions are evicted",
+			size: 1,
+			run: func(c Cache, calls *int) {
+				c.GetAuthorize("a", countingAuthorize(calls, allowed, nil))
+				c.GetAuthorize("b", countingAuthorize(calls, allowed, nil))
+				c.GetAuthorize("a", countingAuthorize(calls, allowed, nil))
+			},
+			wantCalls: 3,
+		},
+		{
+			name: "decisions expire",
+			ttl:  time.Millisecond,
+			run: func(c Cache, calls *int) {
+				c.GetAuthorize("a", countingAuthorize(calls, allowed, nil))
+				time.Sleep(5 * time.Millisecond)
+				c.GetAuthorize("a", countingAuthorize(calls, allowed, nil))
+			},
+			wantCalls: 2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ttl := test.ttl
+			if ttl == 0 {
+				ttl = time.Minute
+			}
+			calls := 0
+			test.run(NewCache(ttl, test.size), &calls)
+			if calls != test.wantCalls {
+				t.Errorf("got %d authorizations, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+// TestCacheInvalidatedByInformers checks cached denials are dropped once a userbinding is added
+func TestCacheInvalidatedByInformers(t *testing.T) {
+	mgr, client := newTestManagerWithClient(t,
+		testClusterRole("viewer", "viewer", nil, rbacv1.PolicyRule{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"get"}}),
+	)
+	req := authenticated(httptest.NewRequest("GET", "/apis/apps/v1/deployments/nginx", nil), "user@example.com")
+
+	if allowed, _, _, _ := mgr.AuthorizeWithFilter(context.Background(), req, nil); allowed {
+		t.Fatalf("expected the request to be denied without bindings")
+	}
+
+	binding := toUnstructured(t, testBinding("user-viewer", "user@example.com", "viewer", nil))
+	_, err := client.Resource(authv1.SchemeGroupVersion.WithResource("userbindings")).
+		Create(context.Background(), binding, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("failed to create the userbinding: %v", err)
+	}
+	eventually(t, func() bool {
+		allowed, _, _, _ := mgr.AuthorizeWithFilter(context.Background(), req, nil)
+		return allowed
+	}, "the request was still denied after the userbinding was added")
+}
+
+// TestManagerWithoutUserResolver checks the user resolver is optional even if decisions are cached
+func TestManagerWithoutUserResolver(t *testing.T) {
+	resolvers := newTestManager(t,
+		testClusterRole("viewer", "viewer", nil,
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}),
+		testBinding("alice-viewer", "alice@example.com", "viewer", nil),
+	)
+	mgr := NewManager(NewCache(time.Hour, 0), nil, resolvers.userBindingResolver, resolvers.clusterRoleResolver, testRequestInfoFactory(), nil)
+	result, err := mgr.Verify(EmailToName("alice@example.com"), nil, "get", schema.GroupResource{Resource: "pods"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Allowed {
+		t.Errorf("expected alice to get pods: %s", result.Reason)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"sync"
 	"time"
 
+	utilinformer "gomod.alauda.cn/alauda-backend/pkg/util/informer"
 	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -15,19 +16,38 @@ import (
 	"k8s.io/client-go/tools/cache"
 )
 
+const (
+	// LabelRoleRelative label of clusterroles with the name of the role referred by userbindings
+	LabelRoleRelative = "auth.cpaas.io/role.relative"
+
+	// DefaultResyncPeriod default resync period of the clusterroles informer
+	DefaultResyncPeriod = 10 * time.Minute
+)
+
+// ChangeHandler is called after a clusterrole was added, updated or deleted
+type ChangeHandler func(clusterRole *rbacv1.ClusterRole, deleted bool)
+
 type Resolver struct {
+	utilinformer.ChangeNotifier
+
 	cache         map[string]rbacv1.ClusterRole
 	lock          sync.RWMutex
 	dynamicClient dynamic.Interface
+	hasSynced     cache.InformerSynced
 }
 
-func NewResolver(dynamicClient dynamic.Interface, stopCh <-chan struct{}) *Resolver {
+// NewResolver creates a resolver caching clusterroles referred by userbindings using an informer,
+// a resync period lower or equal to zero uses DefaultResyncPeriod
+func NewResolver(dynamicClient dynamic.Interface, resync time.Duration, stopCh <-chan struct{}) *Resolver {
+	if resync <= 0 {
+		resync = DefaultResyncPeriod
+	}
 	r := &Resolver{
 		dynamicClient: dynamicClient,
 		cache:         make(map[string]rbacv1.ClusterRole),
 	}
-	requirement, _ := labels.NewRequirement("auth.cpaas.io/role.relative", selection.Exists, nil)
-	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, 10*time.Minute, metav1.NamespaceAll, func(options *metav1.ListOptions) {
+	requirement, _ := labels.NewRequirement(LabelRoleRelative, selection.Exists, nil)
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, resync, metav1.NamespaceAll, func(options *metav1.ListOptions) {
 		options.LabelSelector = labels.NewSelector().Add(*requirement).String()
 	})
 	informer := factory.ForResource(rbacv1.SchemeGroupVersion.WithResource("clusterroles"))
@@ -38,6 +58,9 @@ func NewResolver(dynamicClient dynamic.Interface, stopCh <-chan struct{}) *Resol
 			}
 		},
 		UpdateFunc: func(old, new interface{}) {
+			if utilinformer.IsResync(old, new) {
+				return
+			}
 			if cluster, err := r.toClusterRole(new); err == nil && cluster != nil {
 				r.updateClusterRole(cluster)
 			}
@@ -49,16 +72,24 @@ func NewResolver(dynamicClient dynamic.Interface, stopCh <-chan struct{}) *Resol
 		},
 	})
 
+	r.hasSynced = informer.Informer().HasSynced
+
 	factory.Start(stopCh)
-	// Wait for informer to sync
-	for _, r := range factory.WaitForCacheSync(stopCh) {
-		if !r {
-			panic("faild to start clusterrole informer")
-		}
-	}
 	return r
 }
 
+// HasSynced returns true once the clusterrole informer has synced
+func (r *Resolver) HasSynced() bool {
+	return r.hasSynced()
+}
+
+// AddChangeHandler adds a handler called with the changed clusterrole after the cache changed
+func (r *Resolver) AddChangeHandler(handler ChangeHandler) {
+	r.AddObjectChangeHandler(func(obj interface{}, deleted bool) {
+		handler(obj.(*rbacv1.ClusterRole), deleted)
+	})
+}
+
 func (r *Resolver) toClusterRole(obj interface{}) (*rbacv1.ClusterRole, error) {
 	if obj == nil {
 		return nil, nil
@@ -74,6 +105,7 @@ func (r *Resolver) updateClusterRole(cr *rbacv1.ClusterRole) {
 	if cr == nil {
 		return
 	}
+	defer r.Notify(cr, false)
 	r.lock.Lock()
 	defer r.lock.Unlock()
 	r.cache[cr.Name] = *cr
@@ -83,17 +115,29 @@ func (r *Resolver) removeClusterRole(cr *rbacv1.ClusterRole) {
 	if cr == nil {
 		return
 	}
+	defer r.Notify(cr, true)
 	r.lock.Lock()
 	defer r.lock.Unlock()
 	delete(r.cache, cr.Name)
 }
 
+// List returns all cached clusterroles
+func (r *Resolver) List() []rbacv1.ClusterRole {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	ret := make([]rbacv1.ClusterRole, 0, len(r.cache))
+	for _, v := range r.cache {
+		ret = append(ret, v)
+	}
+	return ret
+}
+
 func (r *Resolver) GetClusterRoles(roleRelativeName string) []rbacv1.ClusterRole {
 	r.lock.RLock()
 	defer r.lock.RUnlock()
 	ret := []rbacv1.ClusterRole{}
 	for _, v := range r.cache {
-		relativeName, ok := v.Labels["auth.cpaas.io/role.relative"]
+		relativeName, ok := v.Labels[LabelRoleRelative]
 		if !ok {
 			continue
 		}
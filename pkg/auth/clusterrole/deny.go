@@ -0,0 +1,54 @@
+package clusterrole
+
+import (
+	"encoding/json"
+	"fmt"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+const (
+	// AnnotationDenyRules annotation of clusterroles with a JSON list of DenyRule.
+	// Deny rules override the permissions granted by any role within their scope
+	AnnotationDenyRules = "auth.cpaas.io/deny-rules"
+)
+
+// DenyRule denies verbs on resources to the subjects bound to a clusterrole,
+// e.g. deleting namespaces in the prod cluster for project admins
+type DenyRule struct {
+	// APIGroups api groups of the denied resources, "*" denies all groups
+	APIGroups []string `json:"apiGroups,omitempty"`
+	// Resources denied resources, "*" denies all resources
+	Resources []string `json:"resources,omitempty"`
+	// ResourceNames denies only the named resources if set
+	ResourceNames []string `json:"resourceNames,omitempty"`
+	// NonResourceURLs denied non-resource URLs, a trailing "*" denies all URLs with the prefix
+	NonResourceURLs []string `json:"nonResourceURLs,omitempty"`
+	// Verbs denied verbs, "*" denies all verbs
+	Verbs []string `json:"verbs"`
+	// Clusters restricts the rule to these clusters if set
+	Clusters []string `json:"clusters,omitempty"`
+	// Namespaces restricts the rule to these namespaces if set
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// DenyRules returns the deny rules of a clusterrole
+func DenyRules(clusterRole *rbacv1.ClusterRole) ([]DenyRule, error) {
+	val, ok := clusterRole.Annotations[AnnotationDenyRules]
+	if !ok || val == "" {
+		return nil, nil
+	}
+	var rules []DenyRule
+	if err := json.Unmarshal([]byte(val), &rules); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation of clusterrole %s: %v", AnnotationDenyRules, clusterRole.Name, err)
+	}
+	for i, rule := range rules {
+		if len(rule.Verbs) == 0 {
+			return nil, fmt.Errorf("invalid %s annotation of clusterrole %s: rule %d requires verbs", AnnotationDenyRules, clusterRole.Name, i)
+		}
+		if (len(rule.APIGroups) == 0 || len(rule.Resources) == 0) && len(rule.NonResourceURLs) == 0 {
+			return nil, fmt.Errorf("invalid %s annotation of clusterrole %s: rule %d requires apiGroups and resources or nonResourceURLs", AnnotationDenyRules, clusterRole.Name, i)
+		}
+	}
+	return rules, nil
+}
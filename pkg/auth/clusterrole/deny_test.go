@@ -0,0 +1,60 @@
+package clusterrole
+
+import (
+	"reflect"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDenyRules(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation string
+		want       []DenyRule
+		wantErr    bool
+	}{
+		{
+			name: "no annotation",
+		},
+		{
+			name:       "resource and non-resource rules",
+			annotation: `[{"apiGroups":[""],"resources":["namespaces"],"verbs":["delete"],"clusters":["prod"]},{"nonResourceURLs":["/debug/*"],"verbs":["get"]}]`,
+			want: []DenyRule{
+				{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"delete"}, Clusters: []string{"prod"}},
+				{NonResourceURLs: []string{"/debug/*"}, Verbs: []string{"get"}},
+			},
+		},
+		{
+			name:       "invalid json",
+			annotation: `{"verbs":["get"]}`,
+			wantErr:    true,
+		},
+		{
+			name:       "missing verbs",
+			annotation: `[{"apiGroups":[""],"resources":["pods"]}]`,
+			wantErr:    true,
+		},
+		{
+			name:       "missing resources",
+			annotation: `[{"apiGroups":[""],"verbs":["get"]}]`,
+			wantErr:    true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cr := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "role", Annotations: map[string]string{}}}
+			if test.annotation != "" {
+				cr.Annotations[AnnotationDenyRules] = test.annotation
+			}
+			got, err := DenyRules(cr)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package clusterrole
+
+import (
+	"encoding/json"
+	"fmt"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// AnnotationSelectorRules annotation of clusterroles with a JSON list of SelectorRule.
+	// Selector rules grant verbs only on the objects matching a label selector
+	AnnotationSelectorRules = "auth.cpaas.io/selector-rules"
+)
+
+// SelectorRule grants verbs on the resources matching a label selector to the subjects bound to a clusterrole,
+// e.g. listing the applications labelled with team=a. Only list and watch requests are allowed by selector rules,
+// the items of the response are limited to the matching objects
+type SelectorRule struct {
+	// APIGroups api groups of the resources, "*" matches all groups
+	APIGroups []string `json:"apiGroups"`
+	// Resources resources, "*" matches all resources
+	Resources []string `json:"resources"`
+	// Verbs granted verbs
+	Verbs []string `json:"verbs"`
+	// LabelSelector selector of the objects, e.g. team=a,env in (dev,test)
+	LabelSelector string `json:"labelSelector"`
+}
+
+// SelectorRules returns the selector rules of a clusterrole
+func SelectorRules(clusterRole *rbacv1.ClusterRole) ([]SelectorRule, error) {
+	val, ok := clusterRole.Annotations[AnnotationSelectorRules]
+	if !ok || val == "" {
+		return nil, nil
+	}
+	var rules []SelectorRule
+	if err := json.Unmarshal([]byte(val), &rules); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation of clusterrole %s: %v", AnnotationSelectorRules, clusterRole.Name, err)
+	}
+	for i, rule := range rules {
+		if len(rule.Verbs) == 0 || len(rule.APIGroups) == 0 || len(rule.Resources) == 0 {
+			return nil, fmt.Errorf("invalid %s annotation of clusterrole %s: rule %d requires apiGroups, resources and verbs", AnnotationSelectorRules, clusterRole.Name, i)
+		}
+		selector, err := labels.Parse(rule.LabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation of clusterrole %s: rule %d: %v", AnnotationSelectorRules, clusterRole.Name, i, err)
+		}
+		if selector.Empty() {
+			return nil, fmt.Errorf("invalid %s annotation of clusterrole %s: rule %d requires a labelSelector", AnnotationSelectorRules, clusterRole.Name, i)
+		}
+	}
+	return rules, nil
+}
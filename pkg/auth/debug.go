@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DebugAuthorizationResponse explanation of an authorization decision
+type DebugAuthorizationResponse struct {
+	User        string            `json:"user"`
+	Groups      []string          `json:"groups,omitempty"`
+	Verb        string            `json:"verb"`
+	Resource    string            `json:"resource,omitempty"`
+	Path        string            `json:"path,omitempty"`
+	Constraints map[string]string `json:"constraints,omitempty"`
+	VerifyResult
+}
+
+// DebugHandler returns a handler explaining authorization decisions of the UserBinding model, i.e.
+// /debug/authz?user=&group=&verb=&resource=&name=&project=&cluster=&namespace=
+// or /debug/authz?user=&group=&verb=&path= for non-resource URLs.
+// resource is given as resource.group, e.g. deployments.apps. group may be repeated,
+// the groups of the caller are used when explaining its own decisions without groups.
+// Platform administrators may explain the decisions of any user and groups, the user and group parameters
+// of other callers are ignored, they always explain their own decisions with their own groups
+func (m *AuthManager) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		caller, err := m.Authenticate(req.Context(), req)
+		if err != nil {
+			writeDebugError(w, err)
+			return
+		}
+
+		query := req.URL.Query()
+		username, verb, resource, urlPath := query.Get("user"), query.Get("verb"), query.Get("resource"), query.Get("path")
+		groups := query["group"]
+		if !IsAdmin(caller) {
+			username, groups = caller.GetName(), nil
+		}
+		if username == "" {
+			username = caller.GetName()
+		}
+		if len(groups) == 0 && username == caller.GetName() {
+			groups = caller.GetGroups()
+		}
+		if verb == "" || (resource == "") == (urlPath == "") {
+			writeDebugError(w, errors.NewBadRequest("verb and either resource or path are required"))
+			return
+		}
+
+		if urlPath != "" {
+			result, err := m.verifyNonResource(EmailToName(username), groups, verb, urlPath)
+			if err != nil {
+				writeDebugError(w, err)
+				return
+			}
+			writeDebugResponse(w, DebugAuthorizationResponse{User: username, Groups: groups, Verb: verb, Path: urlPath, VerifyResult: *result})
+			return
+		}
+
+		constraints := map[string]string{}
+		for param, key := range map[string]string{
+			"project":   ResProject,
+			"cluster":   ResCluster,
+			"namespace": ResNamespace,
+			"name":      ResResourceName,
+		} {
+			if val := query.Get(param); val != "" {
+				constraints[key] = val
+			}
+		}
+
+		// decisions are computed again to explain the current permissions
+		result, err := m.verify(EmailToName(username), groups, verb, schema.ParseGroupResource(resource), constraints)
+		if err != nil {
+			writeDebugError(w, err)
+			return
+		}
+		writeDebugResponse(w, DebugAuthorizationResponse{
+			User:         username,
+			Groups:       groups,
+			Verb:         verb,
+			Resource:     resource,
+			Constraints:  constraints,
+			VerifyResult: *result,
+		})
+	})
+}
+
+func writeDebugResponse(w http.ResponseWriter, resp DebugAuthorizationResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func writeDebugError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if status, ok := err.(errors.APIStatus); ok && status.Status().Code != 0 {
+		code = int(status.Status().Code)
+	}
+	http.Error(w, err.Error(), code)
+}
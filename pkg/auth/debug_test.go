@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"gomod.alauda.cn/alauda-backend/pkg/util/token"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func TestDebugHandler(t *testing.T) {
+	mgr := newTestManager(t,
+		testClusterRole("viewer", "viewer", nil,
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}},
+			rbacv1.PolicyRule{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}}),
+		testBinding("alice-viewer", "alice@example.com", "viewer", nil),
+		testBinding("viewers", "", "viewer", map[string]string{"auth.cpaas.io/group.name": "viewers"}),
+	)
+	callers := map[string]user.Info{
+		"alice": &user.DefaultInfo{Name: "alice@example.com", Groups: []string{"devs"}},
+		"bob":   &user.DefaultInfo{Name: "bob@example.com"},
+		"admin": &user.DefaultInfo{Name: "admin@example.com", Extra: map[string][]string{token.ExtraIsAdmin: {"true"}}},
+	}
+	mgr.authenticator = authenticatorFunc(func(req *http.Request) (*authenticator.Response, bool, error) {
+		info, ok := callers[bearerToken(req)]
+		if !ok {
+			return nil, false, nil
+		}
+		return &authenticator.Response{User: info}, true, nil
+	})
+
+	tests := []struct {
+		name        string
+		caller      string
+		query       string
+		wantCode    int
+		wantUser    string
+		wantGroups  []string
+		wantAllowed bool
+		wantMatched []string
+	}{
+		{
+			name:        "own decision",
+			caller:      "alice",
+			query:       "verb=get&resource=pods",
+			wantCode:    http.StatusOK,
+			wantUser:    "alice@example.com",
+			wantGroups:  []string{"devs"},
+			wantAllowed: true,
+			wantMatched: []string{"alice-viewer"},
+		},
+		{
+			name:       "other users are ignored for non-admins",
+			caller:     "bob",
+			query:      "user=alice@example.com&group=viewers&verb=get&resource=pods",
+			wantCode:   http.StatusOK,
+			wantUser:   "bob@example.com",
+			wantGroups: nil,
+		},
+		{
+			name:        "admins explain other users",
+			caller:      "admin",
+			query:       "user=alice@example.com&verb=get&resource=pods",
+			wantCode:    http.StatusOK,
+			wantUser:    "alice@example.com",
+			wantAllowed: true,
+			wantMatched: []string{"alice-viewer"},
+		},
+		{
+			name:        "admins explain other groups",
+			caller:      "admin",
+			query:       "user=bob@example.com&group=viewers&verb=get&resource=pods",
+			wantCode:    http.StatusOK,
+			wantUser:    "bob@example.com",
+			wantGroups:  []string{"viewers"},
+			wantAllowed: true,
+			wantMatched: []string{"viewers"},
+		},
+		{
+			name:        "non-resource url",
+			caller:      "alice",
+			query:       "verb=get&path=/metrics",
+			wantCode:    http.StatusOK,
+			wantUser:    "alice@example.com",
+			wantGroups:  []string{"devs"},
+			wantAllowed: true,
+			wantMatched: []string{"alice-viewer"},
+		},
+		{
+			name:     "missing verb",
+			caller:   "alice",
+			query:    "resource=pods",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "resource and path",
+			caller:   "alice",
+			query:    "verb=get&resource=pods&path=/metrics",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "unauthenticated",
+			caller:   "mallory",
+			query:    "verb=get&resource=pods",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/debug/authz?"+test.query, nil)
+			req.Header.Set("Authorization", "Bearer "+test.caller)
+			rec := httptest.NewRecorder()
+			mgr.DebugHandler().ServeHTTP(rec, req)
+			if rec.Code != test.wantCode {
+				t.Fatalf("got status %d with body %q, want %d", rec.Code, rec.Body.String(), test.wantCode)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			resp := DebugAuthorizationResponse{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid response %s: %v", rec.Body.String(), err)
+			}
+			if resp.User != test.wantUser || !reflect.DeepEqual(resp.Groups, test.wantGroups) {
+				t.Errorf("got user %q with groups %v, want %q with %v", resp.User, resp.Groups, test.wantUser, test.wantGroups)
+			}
+			if resp.Allowed != test.wantAllowed {
+				t.Errorf("got allowed %v (%s), want %v", resp.Allowed, resp.Reason, test.wantAllowed)
+			}
+			if !test.wantAllowed && resp.Reason == "" {
+				t.Errorf("expected a reason why no permission matched")
+			}
+			matched := []string{}
+			for _, p := range resp.Matched {
+				matched = append(matched, p.UserBinding)
+			}
+			if len(test.wantMatched) > 0 && !reflect.DeepEqual(matched, test.wantMatched) {
+				t.Errorf("got matched userbindings %v, want %v", matched, test.wantMatched)
+			}
+		})
+	}
+}
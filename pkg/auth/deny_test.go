@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+
+	"gomod.alauda.cn/alauda-backend/pkg/auth/clusterrole"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestVerifyDenyRules(t *testing.T) {
+	mgr := newTestManager(t,
+		testClusterRole("project-admin", "project-admin",
+			map[string]string{clusterrole.AnnotationDenyRules: `[
+				{"apiGroups":[""],"resources":["namespaces"],"verbs":["delete"],"clusters":["prod"]},
+				{"apiGroups":["*"],"resources":["secrets"],"verbs":["*"],"namespaces":["kube-system"]},
+				{"nonResourceURLs":["/debug/*"],"verbs":["get"]}
+			]`},
+			rbacv1.PolicyRule{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}},
+			rbacv1.PolicyRule{NonResourceURLs: []string{"*"}, Verbs: []string{"get"}}),
+		testClusterRole("broken", "broken", map[string]string{clusterrole.AnnotationDenyRules: `not json`},
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}),
+		testBinding("alice-admin", "alice@example.com", "project-admin", nil),
+		testBinding("bob-broken", "bob@example.com", "broken", nil),
+	)
+	namespaces := schema.GroupResource{Resource: "namespaces"}
+	secrets := schema.GroupResource{Resource: "secrets"}
+
+	tests := []struct {
+		name        string
+		user        string
+		verb        string
+		resource    schema.GroupResource
+		constraints map[string]string
+		wantAllowed bool
+		wantDenied  bool
+	}{
+		{
+			name:        "deny rule in its cluster",
+			user:        "alice@example.com",
+			verb:        "delete",
+			resource:    namespaces,
+			constraints: map[string]string{ResCluster: "prod", ResResourceName: "team-a"},
+			wantDenied:  true,
+		},
+		{
+			name:        "custom verb allowed by * besides a deny rule",
+			user:        "alice@example.com",
+			verb:        "impersonate",
+			resource:    namespaces,
+			constraints: map[string]string{ResCluster: "prod", ResResourceName: "team-a"},
+			wantAllowed: true,
+		},
+		{
+			name:        "deny rule in another cluster",
+			user:        "alice@example.com",
+			verb:        "delete",
+			resource:    namespaces,
+			constraints: map[string]string{ResCluster: "dev", ResResourceName: "team-a"},
+			wantAllowed: true,
+		},
+		{
+			name:        "verb not denied",
+			user:        "alice@example.com",
+			verb:        "get",
+			resource:    namespaces,
+			constraints: map[string]string{ResCluster: "prod"},
+			wantAllowed: true,
+		},
+		{
+			name:        "deny rule in its namespace",
+			user:        "alice@example.com",
+			verb:        "get",
+			resource:    secrets,
+			constraints: map[string]string{ResCluster: "prod", ResNamespace: "kube-system"},
+			wantDenied:  true,
+		},
+		{
+			name:        "deny rule in another namespace",
+			user:        "alice@example.com",
+			verb:        "get",
+			resource:    secrets,
+			constraints: map[string]string{ResCluster: "prod", ResNamespace: "default"},
+			wantAllowed: true,
+		},
+		{
+			name:     "invalid deny rules grant nothing",
+			user:     "bob@example.com",
+			verb:     "get",
+			resource: schema.GroupResource{Resource: "pods"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := mgr.Verify(EmailToName(test.user), nil, test.verb, test.resource, test.constraints)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Allowed != test.wantAllowed || result.Denied != test.wantDenied {
+				t.Errorf("got allowed %v and denied %v (%s), want %v and %v", result.Allowed, result.Denied, result.Reason, test.wantAllowed, test.wantDenied)
+			}
+		})
+	}
+
+	// "*" stays allowed if some verbs are denied, the denied verbs are returned separately
+	actionTests := []struct {
+		name        string
+		resource    schema.GroupResource
+		constraints map[string]string
+		want        []string
+		wantExcept  []string
+	}{
+		{
+			name:        "denied verb",
+			resource:    namespaces,
+			constraints: map[string]string{ResCluster: "prod"},
+			want:        []string{"*"},
+			wantExcept:  []string{"delete"},
+		},
+		{
+			name:        "all verbs denied",
+			resource:    secrets,
+			constraints: map[string]string{ResCluster: "prod", ResNamespace: "kube-system"},
+			want:        []string{},
+		},
+		{
+			name:        "nothing denied",
+			resource:    namespaces,
+			constraints: map[string]string{ResCluster: "dev"},
+			want:        []string{"*"},
+		},
+	}
+	for _, test := range actionTests {
+		t.Run(test.name, func(t *testing.T) {
+			got, except, err := mgr.GetSubjectActionsExcept(EmailToName("alice@example.com"), nil, test.resource, test.constraints)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got actions %v, want %v", got, test.want)
+			}
+			if !reflect.DeepEqual(except, test.wantExcept) {
+				t.Errorf("got except %v, want %v", except, test.wantExcept)
+			}
+		})
+	}
+
+	urls := []struct {
+		url        string
+		wantDenied bool
+	}{
+		{url: "/debug/pprof/heap", wantDenied: true},
+		{url: "/metrics"},
+	}
+	for _, test := range urls {
+		t.Run(test.url, func(t *testing.T) {
+			result, err := mgr.VerifyNonResource(EmailToName("alice@example.com"), nil, "get", test.url)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Allowed == test.wantDenied || result.Denied != test.wantDenied {
+				t.Errorf("got allowed %v and denied %v (%s), want denied %v", result.Allowed, result.Denied, result.Reason, test.wantDenied)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gomod.alauda.cn/alauda-backend/pkg/util/token"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// DefaultErebusURL address of the erebus proxy for the global cluster
+	DefaultErebusURL = "https://erebus.cpaas-system/kubernetes/global"
+)
+
+type erebusAuthenticator struct {
+	client rest.Interface
+}
+
+// NewErebusAuthenticator creates an authenticator probing the erebus proxy
+// with the bearer token of the request. The token is valid if the proxy accepts it.
+// User information is taken from the token claims
+func NewErebusAuthenticator(url string) (authenticator.Request, error) {
+	if url == "" {
+		url = DefaultErebusURL
+	}
+	// the bearer token is set on each probe, the client is shared by all requests
+	cfg := &rest.Config{
+		Host:            strings.TrimRight(url, "/"),
+		TLSClientConfig: rest.TLSClientConfig{Insecure: true},
+		ContentConfig:   rest.ContentConfig{NegotiatedSerializer: scheme.Codecs.WithoutConversion()},
+	}
+	client, err := rest.UnversionedRESTClientFor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid erebus url %q: %v", url, err)
+	}
+	return &erebusAuthenticator{client: client}, nil
+}
+
+// AuthenticateRequest probes the erebus proxy with the bearer token of the request
+func (a *erebusAuthenticator) AuthenticateRequest(req *http.Request) (*authenticator.Response, bool, error) {
+	raw := bearerToken(req)
+	if raw == "" {
+		return nil, false, nil
+	}
+	jwt, err := token.ParseJWT(raw)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// forbidden still means the token was accepted
+	_, err = a.client.Get().AbsPath("/api").SetHeader("Authorization", "Bearer "+raw).DoRaw(req.Context())
+	if err != nil && !errors.IsForbidden(err) {
+		if errors.IsUnauthorized(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("erebus probe failed: %v", err)
+	}
+
+	return &authenticator.Response{User: jwt.UserInfo()}, true, nil
+}
@@ -0,0 +1,519 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+
+	authv1 "gomod.alauda.cn/alauda-backend/pkg/auth/apis/v1"
+	"gomod.alauda.cn/alauda-backend/pkg/auth/clusterrole"
+	"gomod.alauda.cn/alauda-backend/pkg/auth/userbinding"
+	utilinformer "gomod.alauda.cn/alauda-backend/pkg/util/informer"
+	"gomod.alauda.cn/log"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	authuser "k8s.io/apiserver/pkg/authentication/user"
+)
+
+// subjectPermissions permissions of a user or group indexed by GroupResource,
+// rules using wildcards are indexed using "*" as group or resource
+type subjectPermissions map[schema.GroupResource][]*Permission
+
+// nonResourceKey key of non-resource URL permissions in subjectPermissions
+var nonResourceKey = schema.GroupResource{}
+
+// indexedBinding permissions granted by a userbinding
+type indexedBinding struct {
+	binding     authv1.UserBinding
+	users       []string
+	groups      []string
+	role        string
+	permissions subjectPermissions
+}
+
+// PermissionIndex keeps the permissions of all users and groups up to date
+// using the userbinding and clusterrole informers. Permissions for a resource
+// are found with a few map lookups instead of evaluating every binding and role
+type PermissionIndex struct {
+	lock sync.RWMutex
+
+	clusterRoleResolver *clusterrole.Resolver
+
+	// bindings userbinding key to its indexed permissions
+	bindings map[string]*indexedBinding
+	// roleBindings role relative name to userbinding keys
+	roleBindings map[string]sets.String
+	// roles clusterrole name to its role relative name
+	roles map[string]string
+
+	userBindings  map[string]sets.String
+	groupBindings map[string]sets.String
+	users         map[string]subjectPermissions
+	groups        map[string]subjectPermissions
+	// userNames hashed user name to the name used in userbindings
+	userNames map[string]string
+
+	utilinformer.ChangeNotifier
+}
+
+// NewPermissionIndex creates an index of all permissions granted by userbindings
+// and updates it on every userbinding and clusterrole change
+func NewPermissionIndex(userBinding *userbinding.Resolver, clusterRole *clusterrole.Resolver) *PermissionIndex {
+	idx := &PermissionIndex{
+		clusterRoleResolver: clusterRole,
+		bindings:            make(map[string]*indexedBinding),
+		roleBindings:        make(map[string]sets.String),
+		roles:               make(map[string]string),
+		userBindings:        make(map[string]sets.String),
+		groupBindings:       make(map[string]sets.String),
+		users:               make(map[string]subjectPermissions),
+		groups:              make(map[string]subjectPermissions),
+		userNames:           make(map[string]string),
+	}
+	userBinding.AddChangeHandler(idx.onUserBindingChange)
+	clusterRole.AddChangeHandler(idx.onClusterRoleChange)
+
+	// informers may already be running, index what they have cached so far.
+	// Holding the lock while listing makes sure later events are applied afterwards
+	idx.lock.Lock()
+	for _, cr := range clusterRole.List() {
+		idx.roles[cr.Name] = cr.Labels[clusterrole.LabelRoleRelative]
+	}
+	bindings := userBinding.List()
+	for i := range bindings {
+		idx.indexBinding(&bindings[i])
+	}
+	idx.lock.Unlock()
+	return idx
+}
+
+// Permissions returns all permissions of a user and its groups for a resource,
+// including permissions granted using wildcards
+func (idx *PermissionIndex) Permissions(user string, groups []string, resource schema.GroupResource) []*Permission {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+	permissions := make([]*Permission, 0)
+	for _, perms := range idx.subjects(user, groups) {
+		permissions = append(permissions, perms.resourcePermissions(resource)...)
+	}
+	return permissions
+}
+
+// SubjectPermissions returns the permissions for a resource of every user and group having any,
+// users are returned by their display names, i.e. the email or the service account user name
+func (idx *PermissionIndex) SubjectPermissions(resource schema.GroupResource) (users map[string][]*Permission, groups map[string][]*Permission) {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+	users = make(map[string][]*Permission)
+	for user, perms := range idx.users {
+		if permissions := perms.resourcePermissions(resource); len(permissions) > 0 {
+			name := idx.userNames[user]
+			if name == "" {
+				name = user
+			}
+			users[name] = permissions
+		}
+	}
+	groups = make(map[string][]*Permission)
+	for group, perms := range idx.groups {
+		if permissions := perms.resourcePermissions(resource); len(permissions) > 0 {
+			groups[group] = permissions
+		}
+	}
+	return users, groups
+}
+
+// resourcePermissions returns the permissions for a resource including permissions granted using wildcards
+func (perms subjectPermissions) resourcePermissions(resource schema.GroupResource) []*Permission {
+	keys := []schema.GroupResource{
+		resource,
+		{Group: resource.Group, Resource: "*"},
+		{Group: "*", Resource: resource.Resource},
+		{Group: "*", Resource: "*"},
+	}
+	permissions := make([]*Permission, 0)
+	seen := make(map[schema.GroupResource]struct{}, len(keys))
+	for _, key := range keys {
+		// resource itself may contain wildcards
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		permissions = append(permissions, perms[key]...)
+	}
+	return permissions
+}
+
+// NonResourcePermissions returns all non-resource URL permissions of a user and its groups
+func (idx *PermissionIndex) NonResourcePermissions(user string, groups []string) []*Permission {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+	permissions := make([]*Permission, 0)
+	for _, perms := range idx.subjects(user, groups) {
+		permissions = append(permissions, perms[nonResourceKey]...)
+	}
+	return permissions
+}
+
+// subjects returns the permissions of a user and its groups, the lock must be held
+func (idx *PermissionIndex) subjects(user string, groups []string) []subjectPermissions {
+	subjects := make([]subjectPermissions, 0, len(groups)+1)
+	if perms, ok := idx.users[user]; ok {
+		subjects = append(subjects, perms)
+	}
+	for _, group := range groups {
+		if perms, ok := idx.groups[group]; ok {
+			subjects = append(subjects, perms)
+		}
+	}
+	return subjects
+}
+
+func (idx *PermissionIndex) onUserBindingChange(binding *authv1.UserBinding, deleted bool) {
+	idx.lock.Lock()
+	if deleted {
+		idx.removeBinding(bindingKey(binding))
+	} else {
+		idx.indexBinding(binding)
+	}
+	idx.lock.Unlock()
+	idx.Notify(nil, false)
+}
+
+func (idx *PermissionIndex) onClusterRoleChange(cr *rbacv1.ClusterRole, deleted bool) {
+	idx.lock.Lock()
+	// the role relative label may have changed, bindings of both roles are indexed again
+	roles := sets.NewString(cr.Labels[clusterrole.LabelRoleRelative])
+	if previous, ok := idx.roles[cr.Name]; ok {
+		roles.Insert(previous)
+	}
+	if deleted {
+		delete(idx.roles, cr.Name)
+	} else {
+		idx.roles[cr.Name] = cr.Labels[clusterrole.LabelRoleRelative]
+	}
+	for _, role := range roles.List() {
+		if role == "" {
+			continue
+		}
+		for _, key := range idx.roleBindings[role].List() {
+			idx.reindexBinding(key)
+		}
+	}
+	idx.lock.Unlock()
+	idx.Notify(nil, false)
+}
+
+// indexBinding computes the permissions granted by a userbinding
+// and updates the permissions of its user and group
+func (idx *PermissionIndex) indexBinding(binding *authv1.UserBinding) {
+	key := bindingKey(binding)
+	idx.removeBinding(key)
+
+	users, groups := bindingSubjects(binding)
+	userKeys := make([]string, 0, len(users))
+	for user, name := range users {
+		userKeys = append(userKeys, user)
+		if name != "" {
+			idx.userNames[user] = name
+		}
+	}
+	ib := &indexedBinding{
+		binding:     *binding,
+		users:       userKeys,
+		groups:      groups,
+		role:        binding.RoleName(),
+		permissions: bindingPermissions(binding, idx.clusterRoleResolver.GetClusterRoles(binding.RoleName())),
+	}
+	idx.bindings[key] = ib
+	addToSet(idx.roleBindings, ib.role, key)
+	for _, user := range ib.users {
+		addToSet(idx.userBindings, user, key)
+		idx.users[user] = idx.mergeBindings(idx.userBindings[user])
+	}
+	for _, group := range ib.groups {
+		addToSet(idx.groupBindings, group, key)
+		idx.groups[group] = idx.mergeBindings(idx.groupBindings[group])
+	}
+}
+
+// reindexBinding computes the permissions of an already indexed userbinding again,
+// i.e. when its clusterroles changed
+func (idx *PermissionIndex) reindexBinding(key string) {
+	ib, ok := idx.bindings[key]
+	if !ok {
+		return
+	}
+	ib.permissions = bindingPermissions(&ib.binding, idx.clusterRoleResolver.GetClusterRoles(ib.role))
+	for _, user := range ib.users {
+		idx.users[user] = idx.mergeBindings(idx.userBindings[user])
+	}
+	for _, group := range ib.groups {
+		idx.groups[group] = idx.mergeBindings(idx.groupBindings[group])
+	}
+}
+
+func (idx *PermissionIndex) removeBinding(key string) {
+	ib, ok := idx.bindings[key]
+	if !ok {
+		return
+	}
+	delete(idx.bindings, key)
+	removeFromSet(idx.roleBindings, ib.role, key)
+	for _, user := range ib.users {
+		removeFromSet(idx.userBindings, user, key)
+		idx.users[user] = idx.mergeBindings(idx.userBindings[user])
+		if len(idx.users[user]) == 0 {
+			delete(idx.users, user)
+			delete(idx.userNames, user)
+		}
+	}
+	for _, group := range ib.groups {
+		removeFromSet(idx.groupBindings, group, key)
+		idx.groups[group] = idx.mergeBindings(idx.groupBindings[group])
+		if len(idx.groups[group]) == 0 {
+			delete(idx.groups, group)
+		}
+	}
+}
+
+// bindingSubjects returns the users and groups a userbinding applies to.
+// Users and service accounts are returned by their user names hashed by EmailToName, as used for lookups,
+// mapped to the user name, i.e. the email. The name is empty if only the hashed name is known.
+// Subjects named "*" apply to all authenticated users for the User and Group kinds
+// and to all service accounts for the ServiceAccount kind using the corresponding system groups.
+// ServiceAccount subjects are named namespace:name, names without namespace use the namespace
+// of the binding and namespace:* applies to all service accounts of the namespace.
+// The labels of bindings without subjects are used as well
+func bindingSubjects(binding *authv1.UserBinding) (users map[string]string, groups []string) {
+	users = make(map[string]string)
+	groupSet := sets.NewString()
+	if name := binding.UserEmailName(); name != "" {
+		users[name] = binding.Email()
+	}
+	if name := binding.GroupName(); name != "" {
+		groupSet.Insert(name)
+	}
+	for _, subject := range binding.Spec.Subjects {
+		if subject.Name == "" {
+			continue
+		}
+		switch subject.Kind {
+		case authv1.SubjectKindUser:
+			if subject.Name == "*" {
+				groupSet.Insert(authuser.AllAuthenticated)
+			} else {
+				users[EmailToName(subject.Name)] = subject.Name
+			}
+		case authv1.SubjectKindGroup:
+			if subject.Name == "*" {
+				groupSet.Insert(authuser.AllAuthenticated)
+			} else {
+				groupSet.Insert(subject.Name)
+			}
+		case authv1.SubjectKindServiceAccount:
+			if subject.Name == "*" {
+				groupSet.Insert(serviceAccountGroup)
+				continue
+			}
+			namespace, name := binding.Namespace, strings.TrimPrefix(subject.Name, serviceAccountUsernamePrefix)
+			if i := strings.Index(name, ":"); i >= 0 {
+				namespace, name = name[:i], name[i+1:]
+			}
+			switch {
+			case namespace == "" || name == "":
+				log.Error("ignoring service account subject without namespace", log.String("userbinding", bindingKey(binding)), log.String("subject", subject.Name))
+			case name == "*":
+				groupSet.Insert(serviceAccountGroupPrefix + namespace)
+			default:
+				username := serviceAccountUsernamePrefix + namespace + ":" + name
+				users[EmailToName(username)] = username
+			}
+		}
+	}
+	return users, groupSet.List()
+}
+
+// mergeBindings merges the permissions of the given userbindings
+func (idx *PermissionIndex) mergeBindings(keys sets.String) subjectPermissions {
+	merged := make(subjectPermissions)
+	for key := range keys {
+		ib, ok := idx.bindings[key]
+		if !ok {
+			continue
+		}
+		for gr, perms := range ib.permissions {
+			merged[gr] = append(merged[gr], perms...)
+		}
+	}
+	return merged
+}
+
+// bindingPermissions returns the permissions granted and denied by the rules, selector rules and deny rules
+// of the clusterroles of a userbinding. Clusterroles with invalid deny rules grant nothing
+func bindingPermissions(binding *authv1.UserBinding, clusterRoles []rbacv1.ClusterRole) subjectPermissions {
+	permissions := make(subjectPermissions)
+	for i := range clusterRoles {
+		clusterRole := &clusterRoles[i]
+		denyRules, err := clusterrole.DenyRules(clusterRole)
+		if err != nil {
+			log.Error("ignoring clusterrole with invalid deny rules", log.String("userbinding", bindingKey(binding)), log.Err(err))
+			continue
+		}
+		for _, rule := range clusterRole.Rules {
+			for _, group := range rule.APIGroups {
+				for _, res := range rule.Resources {
+					gr := schema.GroupResource{Group: group, Resource: res}
+					resourceNames := rule.ResourceNames
+					if len(resourceNames) == 0 {
+						resourceNames = []string{""}
+					}
+					for _, resourceName := range resourceNames {
+						p := NewPermission(binding, gr, rule.Verbs, resourceName)
+						setPermissionSource(p, binding, clusterRole, rule)
+						permissions[gr] = append(permissions[gr], p)
+					}
+				}
+			}
+			for _, url := range rule.NonResourceURLs {
+				if p := newNonResourcePermission(binding, url, rule.Verbs); p != nil {
+					setPermissionSource(p, binding, clusterRole, rule)
+					permissions[nonResourceKey] = append(permissions[nonResourceKey], p)
+				}
+			}
+		}
+		selectorRules, err := clusterrole.SelectorRules(clusterRole)
+		if err != nil {
+			// selector rules only grant permissions, the other rules still apply
+			log.Error("ignoring invalid selector rules of clusterrole", log.String("userbinding", bindingKey(binding)), log.Err(err))
+		}
+		for _, rule := range selectorRules {
+			for _, group := range rule.APIGroups {
+				for _, res := range rule.Resources {
+					gr := schema.GroupResource{Group: group, Resource: res}
+					p := NewPermission(binding, gr, rule.Verbs, "")
+					p.LabelSelector = rule.LabelSelector
+					setPermissionSource(p, binding, clusterRole, rbacv1.PolicyRule{
+						APIGroups: rule.APIGroups,
+						Resources: rule.Resources,
+						Verbs:     rule.Verbs,
+					})
+					permissions[gr] = append(permissions[gr], p)
+				}
+			}
+		}
+		for _, rule := range denyRules {
+			for _, group := range rule.APIGroups {
+				for _, res := range rule.Resources {
+					gr := schema.GroupResource{Group: group, Resource: res}
+					for _, p := range newDenyPermissions(binding, gr, rule) {
+						setPermissionSource(p, binding, clusterRole, rbacv1.PolicyRule{
+							APIGroups:     rule.APIGroups,
+							Resources:     rule.Resources,
+							ResourceNames: rule.ResourceNames,
+							Verbs:         rule.Verbs,
+						})
+						permissions[gr] = append(permissions[gr], p)
+					}
+				}
+			}
+			for _, url := range rule.NonResourceURLs {
+				if p := newNonResourcePermission(binding, url, rule.Verbs); p != nil {
+					p.Deny = true
+					setPermissionSource(p, binding, clusterRole, rbacv1.PolicyRule{
+						NonResourceURLs: rule.NonResourceURLs,
+						Verbs:           rule.Verbs,
+					})
+					permissions[nonResourceKey] = append(permissions[nonResourceKey], p)
+				}
+			}
+		}
+	}
+	return permissions
+}
+
+// newNonResourcePermission returns the permission for a non-resource URL.
+// Like kubernetes RoleBindings, bindings scoped to a project, cluster or namespace
+// do not grant non-resource URLs, nil is returned for them
+func newNonResourcePermission(binding *authv1.UserBinding, url string, verbs []string) *Permission {
+	p := NewPermission(binding, nonResourceKey, verbs, "")
+	if len(p.Constraints) > 0 {
+		return nil
+	}
+	p.NonResourceURL = url
+	return p
+}
+
+// newDenyPermissions returns the deny permissions of a deny rule for a resource.
+// The rule applies within the scope of the binding, narrowed down to the clusters and namespaces of the rule
+func newDenyPermissions(binding *authv1.UserBinding, resource schema.GroupResource, rule clusterrole.DenyRule) []*Permission {
+	resourceNames := rule.ResourceNames
+	if len(resourceNames) == 0 {
+		resourceNames = []string{""}
+	}
+	namespaces := rule.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+
+	permissions := make([]*Permission, 0, len(resourceNames)*len(namespaces))
+	for _, resourceName := range resourceNames {
+		for _, namespace := range namespaces {
+			p := NewPermission(binding, resource, rule.Verbs, resourceName)
+			p.Deny = true
+			if len(rule.Clusters) > 0 {
+				clusters := sets.NewString(rule.Clusters...)
+				if val, ok := p.Constraints[ResCluster]; ok {
+					clusters = clusters.Intersection(sets.NewString(strings.Split(val, ",")...))
+				}
+				if clusters.Len() == 0 {
+					// the rule does not apply to any cluster of the binding
+					continue
+				}
+				p.Constraints[ResCluster] = strings.Join(clusters.List(), ",")
+			}
+			if namespace != "" {
+				if val, ok := p.Constraints[ResNamespace]; ok && val != namespace {
+					continue
+				}
+				p.Constraints[ResNamespace] = namespace
+			}
+			permissions = append(permissions, p)
+		}
+	}
+	return permissions
+}
+
+// setPermissionSource records where a permission comes from
+func setPermissionSource(p *Permission, binding *authv1.UserBinding, clusterRole *rbacv1.ClusterRole, rule rbacv1.PolicyRule) {
+	p.UserBinding = bindingKey(binding)
+	p.ClusterRole = clusterRole.Name
+	p.Rule = rule
+}
+
+func bindingKey(binding *authv1.UserBinding) string {
+	if binding.Namespace == "" {
+		return binding.Name
+	}
+	return binding.Namespace + "/" + binding.Name
+}
+
+func addToSet(m map[string]sets.String, key, value string) {
+	set, ok := m[key]
+	if !ok {
+		set = sets.NewString()
+		m[key] = set
+	}
+	set.Insert(value)
+}
+
+func removeFromSet(m map[string]sets.String, key, value string) {
+	set, ok := m[key]
+	if !ok {
+		return
+	}
+	set.Delete(value)
+	if set.Len() == 0 {
+		delete(m, key)
+	}
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	authv1 "gomod.alauda.cn/alauda-backend/pkg/auth/apis/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// permissionSources returns the sorted userbinding, clusterrole and resource of the permissions
+func permissionSources(perms []*Permission) []string {
+	sources := make([]string, 0, len(perms))
+	for _, p := range perms {
+		source := p.UserBinding + " " + p.ClusterRole + " " + p.Resource.String()
+		if name := p.Constraints[ResResourceName]; name != "" {
+			source += "/" + name
+		}
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+func TestPermissionIndex(t *testing.T) {
+	mgr := newTestManager(t,
+		testClusterRole("viewer", "viewer", nil,
+			rbacv1.PolicyRule{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"get"}}),
+		testClusterRole("deployer", "deployer", nil,
+			rbacv1.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"deployments", "statefulsets"}, Verbs: []string{"update"}}),
+		testClusterRole("configurer", "configurer", nil,
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"a", "b"}, Verbs: []string{"update"}}),
+		testBinding("alice-viewer", "alice@example.com", "viewer", nil),
+		testBinding("alice-deployer", "alice@example.com", "deployer", nil),
+		testBinding("devs-configurer", "", "configurer", map[string]string{"auth.cpaas.io/group.name": "devs"}),
+		testBinding("bob-deployer", "", "deployer", nil, authv1.Subject{Kind: authv1.SubjectKindUser, Name: "bob@example.com"}),
+	)
+
+	tests := []struct {
+		name     string
+		user     string
+		groups   []string
+		resource schema.GroupResource
+		want     []string
+	}{
+		{
+			name:     "direct and wildcard rules",
+			user:     "alice@example.com",
+			resource: schema.GroupResource{Group: "apps", Resource: "deployments"},
+			want:     []string{"alice-deployer deployer deployments.apps", "alice-viewer viewer *.*"},
+		},
+		{
+			name:     "only wildcard rules",
+			user:     "alice@example.com",
+			resource: schema.GroupResource{Resource: "pods"},
+			want:     []string{"alice-viewer viewer *.*"},
+		},
+		{
+			name:     "group bindings with resource names",
+			user:     "carol@example.com",
+			groups:   []string{"devs"},
+			resource: schema.GroupResource{Resource: "configmaps"},
+			want:     []string{"devs-configurer configurer configmaps/a", "devs-configurer configurer configmaps/b"},
+		},
+		{
+			name:     "user subjects",
+			user:     "bob@example.com",
+			resource: schema.GroupResource{Group: "apps", Resource: "statefulsets"},
+			want:     []string{"bob-deployer deployer statefulsets.apps"},
+		},
+		{
+			name:     "no bindings",
+			user:     "mallory@example.com",
+			groups:   []string{"others"},
+			resource: schema.GroupResource{Resource: "pods"},
+			want:     []string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := permissionSources(mgr.permissionIndex.Permissions(EmailToName(test.user), test.groups, test.resource))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got permissions %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPermissionIndexUpdates(t *testing.T) {
+	mgr, client := newTestManagerWithClient(t,
+		testClusterRole("viewer", "viewer", nil,
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}),
+		testBinding("alice-viewer", "alice@example.com", "viewer", nil),
+		testBinding("alice-viewer-2", "alice@example.com", "viewer", nil),
+	)
+	user := EmailToName("alice@example.com")
+	permissions := func(resource schema.GroupResource) []string {
+		return permissionSources(mgr.permissionIndex.Permissions(user, nil, resource))
+	}
+	pods := schema.GroupResource{Resource: "pods"}
+	services := schema.GroupResource{Resource: "services"}
+
+	// changing the clusterrole indexes its bindings again
+	role := toUnstructured(t, testClusterRole("viewer", "viewer", nil,
+		rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"services"}, Verbs: []string{"get"}}))
+	role.SetResourceVersion("2")
+	_, err := client.Resource(rbacv1.SchemeGroupVersion.WithResource("clusterroles")).
+		Update(context.Background(), role, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("failed to update the clusterrole: %v", err)
+	}
+	eventually(t, func() bool {
+		return len(permissions(pods)) == 0 &&
+			reflect.DeepEqual(permissions(services), []string{"alice-viewer viewer services", "alice-viewer-2 viewer services"})
+	}, "the permissions were not updated after the clusterrole changed")
+
+	// deleting a binding keeps the permissions of the other bindings
+	err = client.Resource(authv1.SchemeGroupVersion.WithResource("userbindings")).
+		Delete(context.Background(), "alice-viewer", metav1.DeleteOptions{})
+	if err != nil {
+		t.Fatalf("failed to delete the userbinding: %v", err)
+	}
+	eventually(t, func() bool {
+		return reflect.DeepEqual(permissions(services), []string{"alice-viewer-2 viewer services"})
+	}, "the permissions were not updated after the userbinding was deleted")
+
+	err = client.Resource(authv1.SchemeGroupVersion.WithResource("userbindings")).
+		Delete(context.Background(), "alice-viewer-2", metav1.DeleteOptions{})
+	if err != nil {
+		t.Fatalf("failed to delete the userbinding: %v", err)
+	}
+	eventually(t, func() bool {
+		return len(permissions(services)) == 0
+	}, "the permissions were not removed after all userbindings were deleted")
+
+	mgr.permissionIndex.lock.RLock()
+	defer mgr.permissionIndex.lock.RUnlock()
+	if _, ok := mgr.permissionIndex.users[user]; ok {
+		t.Errorf("expected the user to be removed from the index")
+	}
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gomod.alauda.cn/alauda-backend/pkg/auth/clusterrole"
+	"gomod.alauda.cn/alauda-backend/pkg/dataselect"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestAuthorizeListFilter(t *testing.T) {
+	mgr := newTestManager(t,
+		testClusterRole("configurer", "configurer",
+			map[string]string{clusterrole.AnnotationDenyRules: `[{"apiGroups":[""],"resources":["configmaps"],"resourceNames":["b"],"verbs":["list"],"namespaces":["kube-system"]}]`},
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"a", "b"}, Verbs: []string{"get", "list"}}),
+		testClusterRole("team-apps", "team-apps",
+			map[string]string{clusterrole.AnnotationSelectorRules: `[{"apiGroups":["apps"],"resources":["deployments"],"verbs":["list"],"labelSelector":"team=a"}]`}),
+		testClusterRole("viewer", "viewer", nil,
+			rbacv1.PolicyRule{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"get", "list"}}),
+		testBinding("alice-configurer", "alice@example.com", "configurer", nil),
+		testBinding("alice-team-apps", "alice@example.com", "team-apps", nil),
+		testBinding("bob-viewer", "bob@example.com", "viewer", nil),
+	)
+	tests := []struct {
+		name         string
+		user         string
+		url          string
+		filteredList bool
+		wantAllowed  bool
+		wantFilter   *dataselect.ResourceFilter
+		wantReason   string
+	}{
+		{
+			name:         "list limited to names",
+			user:         "alice@example.com",
+			url:          "/api/v1/clusters/c1/namespaces/default/configmaps",
+			filteredList: true,
+			wantAllowed:  true,
+			wantFilter:   &dataselect.ResourceFilter{Names: []string{"a", "b"}, LabelSelectors: []string{}},
+		},
+		{
+			name:         "denied names are removed",
+			user:         "alice@example.com",
+			url:          "/api/v1/clusters/c1/namespaces/kube-system/configmaps",
+			filteredList: true,
+			wantAllowed:  true,
+			wantFilter:   &dataselect.ResourceFilter{Names: []string{"a"}, LabelSelectors: []string{}},
+		},
+		{
+			name:       "route without filtered lists",
+			user:       "alice@example.com",
+			url:        "/api/v1/clusters/c1/namespaces/default/configmaps",
+			wantReason: "the route does not limit list results",
+		},
+		{
+			name:         "list by name of a permitted object",
+			user:         "alice@example.com",
+			url:          "/api/v1/clusters/c1/namespaces/default/configmaps?fieldSelector=metadata.name%3Da",
+			filteredList: true,
+			wantAllowed:  true,
+		},
+		{
+			name:        "get a permitted object",
+			user:        "alice@example.com",
+			url:         "/api/v1/clusters/c1/namespaces/default/configmaps/a",
+			wantAllowed: true,
+		},
+		{
+			name: "get another object",
+			user: "alice@example.com",
+			url:  "/api/v1/clusters/c1/namespaces/default/configmaps/c",
+		},
+		{
+			name:         "list limited to a label selector",
+			user:         "alice@example.com",
+			url:          "/apis/apps/v1/clusters/c1/namespaces/default/deployments",
+			filteredList: true,
+			wantAllowed:  true,
+			wantFilter:   &dataselect.ResourceFilter{Names: []string{}, LabelSelectors: []string{"team=a"}},
+		},
+		{
+			name:         "selector rules only allow lists",
+			user:         "alice@example.com",
+			url:          "/apis/apps/v1/clusters/c1/namespaces/default/deployments/nginx",
+			filteredList: true,
+		},
+		{
+			name:         "unlimited list",
+			user:         "bob@example.com",
+			url:          "/api/v1/clusters/c1/namespaces/default/configmaps",
+			filteredList: true,
+			wantAllowed:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := authenticated(httptest.NewRequest("GET", test.url, nil), test.user)
+			allowed, reason, filter, err := mgr.AuthorizeWithFilter(context.Background(), req, &FilterOption{FilteredList: test.filteredList})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if allowed != test.wantAllowed {
+				t.Errorf("got allowed %v (%s), want %v", allowed, reason, test.wantAllowed)
+			}
+			if !reflect.DeepEqual(filter, test.wantFilter) {
+				t.Errorf("got filter %+v, want %+v", filter, test.wantFilter)
+			}
+			if !strings.Contains(reason, test.wantReason) {
+				t.Errorf("got reason %q, want it to contain %q", reason, test.wantReason)
+			}
+		})
+	}
+}
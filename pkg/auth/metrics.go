@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	cacheHit  = "hit"
+	cacheMiss = "miss"
+)
+
+var (
+	cacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "authorization_cache_requests_total",
+			Help: "Counter of authorization decision cache lookups broken out for each result, hit or miss.",
+		},
+		[]string{"result"},
+	)
+	cacheInvalidations = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "authorization_cache_invalidations_total",
+			Help: "Counter of authorization decision cache invalidations caused by permission changes.",
+		},
+	)
+
+	registerMetricsOnce sync.Once
+)
+
+// RegisterMetrics registers authorization metrics on the default prometheus registry
+func RegisterMetrics() {
+	registerMetricsOnce.Do(func() {
+		prometheus.MustRegister(cacheRequests, cacheInvalidations)
+	})
+}
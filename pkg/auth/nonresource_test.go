@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestNonResourceURLMatches(t *testing.T) {
+	tests := []struct {
+		rule string
+		url  string
+		want bool
+	}{
+		{rule: "*", url: "/metrics", want: true},
+		{rule: "/metrics", url: "/metrics", want: true},
+		{rule: "/metrics", url: "/metrics/cadvisor", want: false},
+		{rule: "/debug/pprof/*", url: "/debug/pprof/heap", want: true},
+		{rule: "/debug/pprof/*", url: "/debug/pprof/", want: true},
+		{rule: "/debug/pprof/*", url: "/debug/vars", want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.rule+" "+test.url, func(t *testing.T) {
+			if got := nonResourceURLMatches(test.rule, test.url); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeNonResourceURLs(t *testing.T) {
+	mgr := newTestManager(t,
+		testClusterRole("ops", "ops", nil,
+			rbacv1.PolicyRule{NonResourceURLs: []string{"/metrics", "/debug/pprof/*"}, Verbs: []string{"get"}}),
+		testBinding("alice-ops", "alice@example.com", "ops", nil),
+		testBinding("bob-ops", "bob@example.com", "ops", map[string]string{"cpaas.io/project": "p1"}),
+	)
+	tests := []struct {
+		name        string
+		user        string
+		method      string
+		url         string
+		wantAllowed bool
+	}{
+		{name: "allowed url", user: "alice@example.com", method: "GET", url: "/metrics", wantAllowed: true},
+		{name: "allowed prefix", user: "alice@example.com", method: "GET", url: "/debug/pprof/heap", wantAllowed: true},
+		{name: "other verb", user: "alice@example.com", method: "POST", url: "/metrics"},
+		{name: "other url", user: "alice@example.com", method: "GET", url: "/swagger.json"},
+		{name: "scoped bindings grant no urls", user: "bob@example.com", method: "GET", url: "/metrics"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := authenticated(httptest.NewRequest(test.method, test.url, nil), test.user)
+			allowed, reason, _, err := mgr.AuthorizeWithFilter(context.Background(), req, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if allowed != test.wantAllowed {
+				t.Errorf("got allowed %v (%s), want %v", allowed, reason, test.wantAllowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	oidc "github.com/coreos/go-oidc"
+	"gomod.alauda.cn/alauda-backend/pkg/util/token"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+const (
+	// DefaultOIDCUsernameClaim claim used as user name by default
+	DefaultOIDCUsernameClaim = "email"
+	// DefaultOIDCGroupsClaim claim used as user groups by default
+	DefaultOIDCGroupsClaim = "groups"
+)
+
+// OIDCConfig configuration for the OIDC authenticator
+type OIDCConfig struct {
+	// IssuerURL URL of the OIDC issuer, must match the iss claim of tokens
+	IssuerURL string
+	// ClientID client id tokens are issued for, must be in the aud claim of tokens
+	ClientID string
+	// JWKSURL URL of the issuer's JSON Web Key Set.
+	// If not set the issuer's discovery document is used
+	JWKSURL string
+	// CAFile certificate authority used to connect to the issuer,
+	// system certificates are used if not set
+	CAFile string
+	// UsernameClaim claim used as user name, defaults to email
+	UsernameClaim string
+	// GroupsClaim claim used as user groups, defaults to groups
+	GroupsClaim string
+}
+
+type oidcAuthenticator struct {
+	config OIDCConfig
+	client *http.Client
+
+	lock     sync.Mutex
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCAuthenticator creates an authenticator verifying OIDC JWT tokens signatures
+// using the issuer's JSON Web Key Set, as well as issuer, audience and expiry claims.
+// Tokens of other issuers are ignored
+func NewOIDCAuthenticator(config OIDCConfig) (authenticator.Request, error) {
+	if config.IssuerURL == "" {
+		return nil, fmt.Errorf("oidc issuer url is required")
+	}
+	if config.ClientID == "" {
+		return nil, fmt.Errorf("oidc client id is required")
+	}
+	if config.UsernameClaim == "" {
+		config.UsernameClaim = DefaultOIDCUsernameClaim
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = DefaultOIDCGroupsClaim
+	}
+
+	tlsConfig := &tls.Config{}
+	if config.CAFile != "" {
+		data, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read oidc ca file %q: %v", config.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in oidc ca file %q", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &oidcAuthenticator{
+		config: config,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// AuthenticateRequest verifies the bearer token of the request
+func (a *oidcAuthenticator) AuthenticateRequest(req *http.Request) (*authenticator.Response, bool, error) {
+	raw := bearerToken(req)
+	if raw == "" {
+		return nil, false, nil
+	}
+	issuer, err := tokenIssuer(raw)
+	if err != nil {
+		return nil, false, err
+	}
+	if issuer != a.config.IssuerURL {
+		// token issued by someone else, i.e. a service account token
+		return nil, false, nil
+	}
+
+	verifier, err := a.getVerifier(req.Context())
+	if err != nil {
+		return nil, false, err
+	}
+	idToken, err := verifier.Verify(oidc.ClientContext(req.Context(), a.client), raw)
+	if err != nil {
+		return nil, false, fmt.Errorf("oidc: verify token: %v", err)
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, false, fmt.Errorf("oidc: parse claims: %v", err)
+	}
+	username, ok := claims[a.config.UsernameClaim].(string)
+	if !ok || username == "" {
+		return nil, false, fmt.Errorf("oidc: claim %q not present", a.config.UsernameClaim)
+	}
+	info := &user.DefaultInfo{
+		Name:  username,
+		UID:   idToken.Subject,
+		Extra: map[string][]string{},
+	}
+	if groups, ok := claims[a.config.GroupsClaim].([]interface{}); ok {
+		for _, g := range groups {
+			if group, ok := g.(string); ok {
+				info.Groups = append(info.Groups, group)
+			}
+		}
+	}
+	if ext, ok := claims["ext"].(map[string]interface{}); ok {
+		if isAdmin, ok := ext[token.ExtraIsAdmin].(bool); ok && isAdmin {
+			info.Extra[token.ExtraIsAdmin] = []string{"true"}
+		}
+		if connID, ok := ext[token.ExtraConnID].(string); ok && connID != "" {
+			info.Extra[token.ExtraConnID] = []string{connID}
+		}
+	}
+	return &authenticator.Response{User: info, Audiences: authenticator.Audiences(idToken.Audience)}, true, nil
+}
+
+// getVerifier initializes the verifier on first use,
+// the issuer may not be reachable yet when starting
+func (a *oidcAuthenticator) getVerifier(ctx context.Context) (*oidc.IDTokenVerifier, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.verifier != nil {
+		return a.verifier, nil
+	}
+
+	// the key set keeps using the context for fetching keys, it must not be request scoped
+	clientCtx := oidc.ClientContext(context.Background(), a.client)
+	config := &oidc.Config{ClientID: a.config.ClientID}
+	if a.config.JWKSURL != "" {
+		a.verifier = oidc.NewVerifier(a.config.IssuerURL, oidc.NewRemoteKeySet(clientCtx, a.config.JWKSURL), config)
+		return a.verifier, nil
+	}
+
+	discoveryCtx, cancel := context.WithTimeout(oidc.ClientContext(ctx, a.client), 30*time.Second)
+	defer cancel()
+	provider, err := oidc.NewProvider(discoveryCtx, a.config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: discover issuer %q: %v", a.config.IssuerURL, err)
+	}
+	// provider.Verifier would keep using the discovery context for fetching keys
+	a.verifier = oidc.NewVerifier(a.config.IssuerURL, oidc.NewRemoteKeySet(clientCtx, jwksURL(provider)), config)
+	return a.verifier, nil
+}
+
+// jwksURL returns the JSON Web Key Set URL of a discovered provider
+func jwksURL(provider *oidc.Provider) string {
+	var claims struct {
+		JWKSURL string `json:"jwks_uri"`
+	}
+	_ = provider.Claims(&claims)
+	return claims.JWKSURL
+}
@@ -0,0 +1,134 @@
+package project
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	utilinformer "gomod.alauda.cn/alauda-backend/pkg/util/informer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// LabelProject label of namespaces with the name of the project they belong to
+	LabelProject = "cpaas.io/project"
+
+	// DefaultResyncPeriod default resync period of the namespaces informer
+	DefaultResyncPeriod = 10 * time.Minute
+)
+
+// Resolver caches the project membership of the namespaces of a cluster using an informer
+// on namespaces labelled with the project. Namespaces of other clusters are unknown
+type Resolver struct {
+	utilinformer.ChangeNotifier
+
+	cluster string
+	// projects namespace name to project name
+	projects map[string]string
+
+	lock      sync.RWMutex
+	hasSynced cache.InformerSynced
+}
+
+// NewResolver creates a resolver for the namespaces of the cluster the client connects to,
+// cluster is the name of this cluster used in routes and userbindings.
+// A resync period lower or equal to zero uses DefaultResyncPeriod
+func NewResolver(dynamicClient dynamic.Interface, cluster string, resync time.Duration, stopCh <-chan struct{}) *Resolver {
+	if resync <= 0 {
+		resync = DefaultResyncPeriod
+	}
+	r := &Resolver{
+		cluster:  cluster,
+		projects: make(map[string]string),
+	}
+	requirement, _ := labels.NewRequirement(LabelProject, selection.Exists, nil)
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, resync, metav1.NamespaceAll, func(options *metav1.ListOptions) {
+		options.LabelSelector = labels.NewSelector().Add(*requirement).String()
+	})
+	informer := factory.ForResource(corev1.SchemeGroupVersion.WithResource("namespaces"))
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if ns, ok := obj.(*unstructured.Unstructured); ok {
+				r.updateNamespace(ns.GetName(), ns.GetLabels()[LabelProject])
+			}
+		},
+		UpdateFunc: func(old, new interface{}) {
+			if utilinformer.IsResync(old, new) {
+				return
+			}
+			if ns, ok := new.(*unstructured.Unstructured); ok {
+				r.updateNamespace(ns.GetName(), ns.GetLabels()[LabelProject])
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if ns, ok := obj.(*unstructured.Unstructured); ok {
+				r.updateNamespace(ns.GetName(), "")
+			}
+		},
+	})
+
+	r.hasSynced = informer.Informer().HasSynced
+
+	factory.Start(stopCh)
+	return r
+}
+
+// HasSynced returns true once the namespaces informer has synced
+func (r *Resolver) HasSynced() bool {
+	return r.hasSynced()
+}
+
+// updateNamespace sets the project of a namespace, an empty project removes the namespace
+func (r *Resolver) updateNamespace(namespace, project string) {
+	r.lock.Lock()
+	if r.projects[namespace] == project {
+		r.lock.Unlock()
+		return
+	}
+	if project == "" {
+		delete(r.projects, namespace)
+	} else {
+		r.projects[namespace] = project
+	}
+	r.lock.Unlock()
+	r.Notify(namespace, project == "")
+}
+
+// NamespaceProject returns the project of a namespace in the cluster,
+// false if the namespace does not belong to a project or the cluster is not watched
+func (r *Resolver) NamespaceProject(cluster, namespace string) (string, bool) {
+	if cluster != r.cluster {
+		return "", false
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	project, ok := r.projects[namespace]
+	return project, ok
+}
+
+// ProjectNamespaces returns the sorted namespaces of a project in the cluster
+func (r *Resolver) ProjectNamespaces(cluster, project string) []string {
+	if cluster != r.cluster {
+		return nil
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	namespaces := []string{}
+	for namespace, p := range r.projects {
+		if p == project {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
@@ -0,0 +1,105 @@
+package project
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newNamespace(name, project string) *unstructured.Unstructured {
+	ns := &unstructured.Unstructured{}
+	ns.SetAPIVersion("v1")
+	ns.SetKind("Namespace")
+	ns.SetName(name)
+	ns.SetResourceVersion("1")
+	if project != "" {
+		ns.SetLabels(map[string]string{LabelProject: project})
+	}
+	return ns
+}
+
+// eventually polls the condition until it is true or fails after a timeout
+func eventually(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for !cond() {
+		select {
+		case <-timeout:
+			t.Fatal(msg)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestResolver(t *testing.T) {
+	namespaces := corev1.SchemeGroupVersion.WithResource("namespaces")
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		namespaces: "NamespaceList",
+	}, newNamespace("n1", "p1"), newNamespace("n2", "p1"), newNamespace("n3", "p2"))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	r := NewResolver(client, "c1", 0, stopCh)
+	eventually(t, func() bool {
+		return r.HasSynced() && len(r.ProjectNamespaces("c1", "p1")) == 2 && len(r.ProjectNamespaces("c1", "p2")) == 1
+	}, "the resolver never synced")
+	changes := make(chan struct{}, 10)
+	r.AddChangeHandler(func() { changes <- struct{}{} })
+
+	tests := []struct {
+		name      string
+		cluster   string
+		namespace string
+		want      string
+		wantOK    bool
+	}{
+		{name: "namespace of a project", cluster: "c1", namespace: "n1", want: "p1", wantOK: true},
+		{name: "unknown namespace", cluster: "c1", namespace: "n4"},
+		{name: "other cluster", cluster: "c2", namespace: "n1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := r.NamespaceProject(test.cluster, test.namespace)
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("got project %q and %v, want %q and %v", got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+	if got, want := r.ProjectNamespaces("c1", "p1"), []string{"n1", "n2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got namespaces %v, want %v", got, want)
+	}
+	if got := r.ProjectNamespaces("c2", "p1"); len(got) != 0 {
+		t.Errorf("got namespaces %v of another cluster, want none", got)
+	}
+
+	// moving a namespace to another project notifies the change
+	ns := newNamespace("n2", "p2")
+	ns.SetResourceVersion("2")
+	if _, err := client.Resource(namespaces).Update(context.Background(), ns, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update the namespace: %v", err)
+	}
+	eventually(t, func() bool {
+		return reflect.DeepEqual(r.ProjectNamespaces("c1", "p2"), []string{"n2", "n3"})
+	}, "the namespace was not moved to the other project")
+	select {
+	case <-changes:
+	default:
+		t.Errorf("no change was notified")
+	}
+
+	if err := client.Resource(namespaces).Delete(context.Background(), "n1", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("failed to delete the namespace: %v", err)
+	}
+	eventually(t, func() bool {
+		_, ok := r.NamespaceProject("c1", "n1")
+		return !ok
+	}, "the deleted namespace is still known")
+}
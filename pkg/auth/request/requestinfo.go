@@ -1,11 +1,14 @@
 package request
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/validation/path"
 	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metainternalversionscheme "k8s.io/apimachinery/pkg/apis/meta/internalversion/scheme"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 )
@@ -40,20 +43,118 @@ type RequestInfo struct {
 	Parts []string
 }
 
+const (
+	// LevelPlatform requests not scoped to a project or cluster
+	LevelPlatform = "platform"
+	// LevelProject requests scoped to a project
+	LevelProject = "project"
+	// LevelCluster requests scoped to a cluster
+	LevelCluster = "cluster"
+	// LevelNamespace requests scoped to a namespace
+	LevelNamespace = "namespace"
+)
+
+const (
+	routeVarProject   = "project"
+	routeVarCluster   = "cluster"
+	routeVarNamespace = "namespace"
+)
+
+// RouteTemplate path layout scoping resources below /{product-prefix}/{api-group}/{version},
+// e.g. projects/{project}/clusters/{cluster}/namespaces/{namespace}.
+// Supported variables are {project}, {cluster} and {namespace}
+type RouteTemplate struct {
+	// Level of the requests matching the template
+	Level    string
+	segments []string
+}
+
+// NewRouteTemplate parses a route template
+func NewRouteTemplate(level, template string) (RouteTemplate, error) {
+	segments := splitPath(template)
+	for _, segment := range segments {
+		if !strings.HasPrefix(segment, "{") {
+			continue
+		}
+		switch segment {
+		case "{" + routeVarProject + "}", "{" + routeVarCluster + "}", "{" + routeVarNamespace + "}":
+		default:
+			return RouteTemplate{}, fmt.Errorf("unknown variable %s in route template %q", segment, template)
+		}
+	}
+	return RouteTemplate{Level: level, segments: segments}, nil
+}
+
+// MustRouteTemplate parses a route template and panics if it is invalid
+func MustRouteTemplate(level, template string) RouteTemplate {
+	t, err := NewRouteTemplate(level, template)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// String returns the template path
+func (t RouteTemplate) String() string {
+	return strings.Join(t.segments, "/")
+}
+
+// match returns the values of the template variables if parts start with the template
+func (t RouteTemplate) match(parts []string) (map[string]string, bool) {
+	if len(parts) < len(t.segments) {
+		return nil, false
+	}
+	vars := make(map[string]string)
+	for i, segment := range t.segments {
+		if strings.HasPrefix(segment, "{") {
+			if parts[i] == "" {
+				return nil, false
+			}
+			vars[strings.Trim(segment, "{}")] = parts[i]
+			continue
+		}
+		if segment != parts[i] {
+			return nil, false
+		}
+	}
+	return vars, true
+}
+
+// DefaultRouteTemplates route templates used if none are configured, most specific first
+var DefaultRouteTemplates = []RouteTemplate{
+	MustRouteTemplate(LevelNamespace, "projects/{project}/clusters/{cluster}/namespaces/{namespace}"),
+	MustRouteTemplate(LevelCluster, "projects/{project}/clusters/{cluster}"),
+	MustRouteTemplate(LevelProject, "projects/{project}"),
+	MustRouteTemplate(LevelNamespace, "clusters/{cluster}/namespaces/{namespace}"),
+	MustRouteTemplate(LevelCluster, "clusters/{cluster}"),
+}
+
 type RequestInfoFactory struct {
 	APIPrefixes          sets.String // without leading and trailing slashes
 	GrouplessAPIPrefixes sets.String // without leading and trailing slashes
+	// RouteTemplates tried in order to find the scope of a request,
+	// DefaultRouteTemplates are used if not set
+	RouteTemplates []RouteTemplate
 }
 
 // Resource paths
+// /{product-prefix}/{api-group}/{version}/{route-template}/{resource}
+// /{product-prefix}/{api-group}/{version}/{route-template}/{resource}/{resourceName}
+// /{product-prefix}/{api-group}/{version}/{route-template}/{resource}/{resourceName}/{subresource}
+// /{product-prefix}/{api-group}/{version}/{resource}
+// /{product-prefix}/{api-group}/{version}/{resource}/{resourceName}
+// /{groupless-prefix}/{version}/... for the core group
+//
+// With the default route templates
 // /{product-prefix}/{api-group}/{version}/projects/{project}/{resource}
-// /{product-prefix}/{api-group}/{version}/projects/{project}/{resource}/{resourceName}
+// /{product-prefix}/{api-group}/{version}/projects/{project}/clusters/{cluster}/{resource}
 // /{product-prefix}/{api-group}/{version}/projects/{project}/clusters/{cluster}/namespaces/{namespace}/{resource}
-// /{product-prefix}/{api-group}/{version}/projects/{project}/clusters/{cluster}/namespaces/{namespace}/{resource}/{resourceName}
+// /{product-prefix}/{api-group}/{version}/clusters/{cluster}/namespaces/{namespace}/{resource}
 // /{product-prefix}/{api-group}/{version}/clusters/{cluster}/{resource}
-// /{product-prefix}/{api-group}/{version}/clusters/{cluster}/{resource}/{resourceName}
-// /{product-prefix}/{api-group}/{version}/{resource}
-// /{product-prefix}/{api-group}/{version}/{resource}/{resourceName}
+// If nothing follows a route template, the last scope is the requested resource,
+// e.g. /{product-prefix}/{api-group}/{version}/projects/{project} gets the project
+//
+// Paths not starting with an API prefix are non-resource requests
 
 func (r *RequestInfoFactory) NewRequestInfo(req *http.Request) (*RequestInfo, error) {
 	requestInfo := RequestInfo{
@@ -77,76 +178,51 @@ func (r *RequestInfoFactory) NewRequestInfo(req *http.Request) (*RequestInfo, er
 	}
 
 	currentParts := splitPath(req.URL.Path)
-	if !r.APIPrefixes.Has(currentParts[0]) {
+	if len(currentParts) == 0 || !r.isAPIPrefix(currentParts[0]) {
+		// non-resource request, the verb is the lowercase http method
+		requestInfo.Verb = strings.ToLower(req.Method)
 		return &requestInfo, nil
 	}
 	// find product-prefix
 	requestInfo.APIPrefix = currentParts[0]
 	currentParts = currentParts[1:]
 
-	// find api-group
-	// TODO core group is empty
-	requestInfo.APIGroup = currentParts[0]
-	currentParts = currentParts[1:]
+	// find api-group, groupless prefixes serve the core group
+	if !r.GrouplessAPIPrefixes.Has(requestInfo.APIPrefix) {
+		if len(currentParts) == 0 {
+			return nil, errors.NewBadRequest(fmt.Sprintf("api group missing in path %q", req.URL.Path))
+		}
+		requestInfo.APIGroup = currentParts[0]
+		currentParts = currentParts[1:]
+	}
 
 	// find version
+	if len(currentParts) == 0 {
+		return nil, errors.NewBadRequest(fmt.Sprintf("api version missing in path %q", req.URL.Path))
+	}
 	requestInfo.APIVersion = currentParts[0]
 	currentParts = currentParts[1:]
 
 	// find project, cluster, namespace
-	// case1: /projects/{project}/{resource}
-	// case2: /projects/{project}/clusters/{cluster}/namespaces/{namespace}/{resource}
-	if currentParts[0] == "projects" {
-		if len(currentParts) > 1 {
-			requestInfo.Project = currentParts[1]
-			requestInfo.Level = "project"
-
-			if len(currentParts) > 2 {
-				currentParts = currentParts[2:]
-
-				// case1: /{resource}
-				// case2: /clusters/{cluster}/namespaces/{namespace}/{resource}
-				if currentParts[0] == "clusters" {
-					if len(currentParts) > 1 {
-						requestInfo.Cluster = currentParts[1]
-
-						if len(currentParts) > 2 {
-							currentParts = currentParts[2:]
-
-							// case1: /namespaces/{namespace}/{resource}
-							if currentParts[0] == "namespaces" {
-								requestInfo.Namespace = currentParts[1]
-								requestInfo.Level = "namespace"
-
-								if len(currentParts) > 2 {
-									currentParts = currentParts[2:]
-								}
-							}
-						}
-					}
-				}
-			}
-		}
-		// URL forms: /clusters/{cluster}/{resource}
-	} else if currentParts[0] == "clusters" {
-		// cluster
-		if len(currentParts) > 1 {
-			requestInfo.Cluster = currentParts[1]
-			requestInfo.Project = ""
-			requestInfo.Namespace = ""
-			requestInfo.Level = "cluster"
-
-			if len(currentParts) > 2 {
-				currentParts = currentParts[2:]
-			}
+	requestInfo.Namespace = metav1.NamespaceNone
+	requestInfo.Level = LevelPlatform
+	for _, template := range r.routeTemplates() {
+		vars, ok := template.match(currentParts)
+		if !ok {
+			continue
 		}
+		requestInfo.Project = vars[routeVarProject]
+		requestInfo.Cluster = vars[routeVarCluster]
+		requestInfo.Namespace = vars[routeVarNamespace]
+		requestInfo.Level = template.Level
 
-	} else {
-		// platform
-		requestInfo.Namespace = metav1.NamespaceNone
-		requestInfo.Project = ""
-		requestInfo.Cluster = ""
-		requestInfo.Level = "platform"
+		if len(currentParts) > len(template.segments) {
+			currentParts = currentParts[len(template.segments):]
+		} else if len(template.segments) >= 2 {
+			// nothing follows the template, the last scope is the requested resource
+			currentParts = currentParts[len(template.segments)-2:]
+		}
+		break
 	}
 
 	// parsing successful, so we now know the proper value for .Parts
@@ -167,6 +243,9 @@ func (r *RequestInfoFactory) NewRequestInfo(req *http.Request) (*RequestInfo, er
 	// if there's no name on the request and we thought it was a get before, then the actual verb is a list or a watch
 	if len(requestInfo.Name) == 0 && requestInfo.Verb == "get" {
 		opts := metainternalversion.ListOptions{}
+		if err := metainternalversionscheme.ParameterCodec.DecodeParameters(req.URL.Query(), metav1.SchemeGroupVersion, &opts); err != nil {
+			return nil, errors.NewBadRequest(fmt.Sprintf("invalid list options: %v", err))
+		}
 		if opts.Watch {
 			requestInfo.Verb = "watch"
 		} else {
@@ -189,6 +268,17 @@ func (r *RequestInfoFactory) NewRequestInfo(req *http.Request) (*RequestInfo, er
 	return &requestInfo, nil
 }
 
+func (r *RequestInfoFactory) isAPIPrefix(prefix string) bool {
+	return r.APIPrefixes.Has(prefix) || r.GrouplessAPIPrefixes.Has(prefix)
+}
+
+func (r *RequestInfoFactory) routeTemplates() []RouteTemplate {
+	if r.RouteTemplates != nil {
+		return r.RouteTemplates
+	}
+	return DefaultRouteTemplates
+}
+
 // splitPath returns the segments for a URL path.
 func splitPath(path string) []string {
 	path = strings.Trim(path, "/")
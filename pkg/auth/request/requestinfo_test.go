@@ -0,0 +1,174 @@
+package request
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestNewRequestInfo(t *testing.T) {
+	factory := &RequestInfoFactory{
+		APIPrefixes:          sets.NewString("apis", "platform"),
+		GrouplessAPIPrefixes: sets.NewString("api"),
+	}
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		factory *RequestInfoFactory
+		want    *RequestInfo
+		wantErr bool
+	}{
+		{
+			name:   "root is a non-resource request",
+			method: "GET",
+			url:    "/",
+			want:   &RequestInfo{Path: "/", Verb: "get"},
+		},
+		{
+			name:   "unknown prefix is a non-resource request",
+			method: "POST",
+			url:    "/metrics",
+			want:   &RequestInfo{Path: "/metrics", Verb: "post"},
+		},
+		{
+			name:    "missing api group",
+			method:  "GET",
+			url:     "/platform",
+			wantErr: true,
+		},
+		{
+			name:    "missing version",
+			method:  "GET",
+			url:     "/apis/apps",
+			wantErr: true,
+		},
+		{
+			name:   "list",
+			method: "GET",
+			url:    "/apis/apps/v1/deployments",
+			want: &RequestInfo{
+				Path: "/apis/apps/v1/deployments", Verb: "list", APIPrefix: "apis", APIGroup: "apps", APIVersion: "v1",
+				Level: LevelPlatform, Resource: "deployments", Parts: []string{"deployments"},
+			},
+		},
+		{
+			name:   "watch",
+			method: "GET",
+			url:    "/apis/apps/v1/deployments?watch=true",
+			want: &RequestInfo{
+				Path: "/apis/apps/v1/deployments", Verb: "watch", APIPrefix: "apis", APIGroup: "apps", APIVersion: "v1",
+				Level: LevelPlatform, Resource: "deployments", Parts: []string{"deployments"},
+			},
+		},
+		{
+			name:   "list by name field selector",
+			method: "GET",
+			url:    "/apis/apps/v1/deployments?fieldSelector=metadata.name%3Dnginx",
+			want: &RequestInfo{
+				Path: "/apis/apps/v1/deployments", Verb: "list", APIPrefix: "apis", APIGroup: "apps", APIVersion: "v1",
+				Level: LevelPlatform, Resource: "deployments", Name: "nginx", Parts: []string{"deployments"},
+			},
+		},
+		{
+			name:   "invalid name in field selector",
+			method: "GET",
+			url:    "/apis/apps/v1/deployments?fieldSelector=metadata.name%3D..",
+			want: &RequestInfo{
+				Path: "/apis/apps/v1/deployments", Verb: "list", APIPrefix: "apis", APIGroup: "apps", APIVersion: "v1",
+				Level: LevelPlatform, Resource: "deployments", Parts: []string{"deployments"},
+			},
+		},
+		{
+			name:    "invalid list options",
+			method:  "GET",
+			url:     "/apis/apps/v1/deployments?limit=many",
+			wantErr: true,
+		},
+		{
+			name:   "core group subresource in a namespace",
+			method: "GET",
+			url:    "/api/v1/clusters/global/namespaces/default/pods/nginx/log",
+			want: &RequestInfo{
+				Path: "/api/v1/clusters/global/namespaces/default/pods/nginx/log", Verb: "get", APIPrefix: "api", APIVersion: "v1",
+				Cluster: "global", Namespace: "default", Level: LevelNamespace,
+				Resource: "pods", Name: "nginx", Subresource: "log", Parts: []string{"pods", "nginx", "log"},
+			},
+		},
+		{
+			name:   "scope as the requested resource",
+			method: "GET",
+			url:    "/apis/auth.alauda.io/v1/projects/p1",
+			want: &RequestInfo{
+				Path: "/apis/auth.alauda.io/v1/projects/p1", Verb: "get", APIPrefix: "apis", APIGroup: "auth.alauda.io", APIVersion: "v1",
+				Project: "p1", Level: LevelProject, Resource: "projects", Name: "p1", Parts: []string{"projects", "p1"},
+			},
+		},
+		{
+			name:   "delete collection in a project cluster",
+			method: "DELETE",
+			url:    "/apis/apps/v1/projects/p1/clusters/c1/deployments",
+			want: &RequestInfo{
+				Path: "/apis/apps/v1/projects/p1/clusters/c1/deployments", Verb: "deletecollection", APIPrefix: "apis", APIGroup: "apps", APIVersion: "v1",
+				Project: "p1", Cluster: "c1", Level: LevelCluster, Resource: "deployments", Parts: []string{"deployments"},
+			},
+		},
+		{
+			name:   "create",
+			method: "POST",
+			url:    "/platform/apps/v1/clusters/c1/namespaces/ns/deployments",
+			want: &RequestInfo{
+				Path: "/platform/apps/v1/clusters/c1/namespaces/ns/deployments", Verb: "create", APIPrefix: "platform", APIGroup: "apps", APIVersion: "v1",
+				Cluster: "c1", Namespace: "ns", Level: LevelNamespace, Resource: "deployments", Parts: []string{"deployments"},
+			},
+		},
+		{
+			name:   "custom route templates",
+			method: "PUT",
+			url:    "/apis/apps/v1/ns/default/deployments/nginx",
+			factory: &RequestInfoFactory{
+				APIPrefixes:    sets.NewString("apis"),
+				RouteTemplates: []RouteTemplate{MustRouteTemplate(LevelNamespace, "ns/{namespace}")},
+			},
+			want: &RequestInfo{
+				Path: "/apis/apps/v1/ns/default/deployments/nginx", Verb: "update", APIPrefix: "apis", APIGroup: "apps", APIVersion: "v1",
+				Namespace: "default", Level: LevelNamespace, Resource: "deployments", Name: "nginx", Parts: []string{"deployments", "nginx"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := test.factory
+			if f == nil {
+				f = factory
+			}
+			got, err := f.NewRequestInfo(httptest.NewRequest(test.method, test.url, nil))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewRouteTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		wantErr  bool
+	}{
+		{template: "projects/{project}/clusters/{cluster}/namespaces/{namespace}"},
+		{template: "/ns/{namespace}/"},
+		{template: "tenants/{tenant}", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.template, func(t *testing.T) {
+			if _, err := NewRouteTemplate(LevelNamespace, test.template); (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package review
+
+import (
+	"fmt"
+	"net/http"
+
+	restful "github.com/emicklei/go-restful/v3"
+	"gomod.alauda.cn/alauda-backend/pkg/auth"
+	abcontext "gomod.alauda.cn/alauda-backend/pkg/context"
+	"gomod.alauda.cn/alauda-backend/pkg/decorator"
+	"gomod.alauda.cn/alauda-backend/pkg/server"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// MaxReviewItems maximum number of resources reviewed by a single SelfSubjectAccessReview
+	MaxReviewItems = 100
+)
+
+// ResourceAttributes resource and scope of an access review
+type ResourceAttributes struct {
+	// Verb to check, optional for SelfSubjectAccessReview items
+	Verb string `json:"verb,omitempty"`
+	// Group api group of the resource, empty for the core group
+	Group string `json:"group,omitempty"`
+	// Resource resource, e.g. deployments
+	Resource string `json:"resource"`
+	// Name of the resource, empty for all resources
+	Name      string `json:"name,omitempty"`
+	Project   string `json:"project,omitempty"`
+	Cluster   string `json:"cluster,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// SelfSubjectAccessReview asks which verbs the caller may perform on several resources at once,
+// e.g. to show or hide buttons in the UI
+type SelfSubjectAccessReview struct {
+	Spec   SelfSubjectAccessReviewSpec   `json:"spec"`
+	Status SelfSubjectAccessReviewStatus `json:"status,omitempty"`
+}
+
+// SelfSubjectAccessReviewSpec resources to review
+type SelfSubjectAccessReviewSpec struct {
+	Items []ResourceAttributes `json:"items"`
+}
+
+// SelfSubjectAccessReviewStatus reviewed resources in the order of the spec
+type SelfSubjectAccessReviewStatus struct {
+	Items []ResourceAccess `json:"items,omitempty"`
+}
+
+// ResourceAccess access of the caller to a resource
+type ResourceAccess struct {
+	ResourceAttributes
+	// Verbs allowed on the resource, "*" allows all verbs
+	Verbs []string `json:"verbs"`
+	// ExceptVerbs verbs denied although "*" is allowed
+	ExceptVerbs []string `json:"exceptVerbs,omitempty"`
+	// Allowed the verb of the item is allowed, only set if the item has a verb
+	Allowed bool `json:"allowed,omitempty"`
+	// Reason explanation of the decision for the verb of the item
+	Reason string `json:"reason,omitempty"`
+}
+
+// ResourceAccessReview asks which users and groups may perform a verb on a resource,
+// only platform administrators may review the access of others
+type ResourceAccessReview struct {
+	Spec   ResourceAttributes         `json:"spec"`
+	Status ResourceAccessReviewStatus `json:"status,omitempty"`
+}
+
+// ResourceAccessReviewStatus users and groups allowed to perform the verb
+type ResourceAccessReviewStatus struct {
+	Users  []string `json:"users"`
+	Groups []string `json:"groups"`
+}
+
+type handler struct {
+	server.Server
+	manager *auth.AuthManager
+}
+
+// NewWebService returns the access review webservice using the permissions of the auth manager:
+// POST /auth/v1/selfsubjectaccessreviews and POST /auth/v1/resourceaccessreviews
+func NewWebService(srv server.Server, mgr *auth.AuthManager) *restful.WebService {
+	h := handler{Server: srv, manager: mgr}
+	authn := decorator.NewAuth(srv)
+
+	ws := decorator.NewWebService(srv)
+	ws.Path("/auth/v1")
+	ws.Route(
+		decorator.WithAuthAndBadRequest(
+			ws.POST("/selfsubjectaccessreviews").
+				Filter(authn.AuthenticationFilter).
+				Doc("Returns the verbs the caller may perform on each resource").
+				Reads(SelfSubjectAccessReview{}).
+				Returns(http.StatusOK, "OK", SelfSubjectAccessReview{}).
+				To(h.selfSubjectAccessReview),
+		),
+	)
+	ws.Route(
+		decorator.WithAuthAndBadRequest(
+			ws.POST("/resourceaccessreviews").
+				Filter(authn.AuthenticationFilter).
+				Doc("Returns the users and groups allowed to perform the verb on the resource, only for platform administrators").
+				Reads(ResourceAccessReview{}).
+				Returns(http.StatusOK, "OK", ResourceAccessReview{}).
+				Returns(http.StatusForbidden, "Forbidden", nil).
+				To(h.resourceAccessReview),
+		),
+	)
+	return ws
+}
+
+func (h handler) selfSubjectAccessReview(req *restful.Request, res *restful.Response) {
+	info := abcontext.User(req.Request.Context())
+	review := SelfSubjectAccessReview{}
+	if err := req.ReadEntity(&review); err != nil {
+		h.HandleError(errors.NewBadRequest(err.Error()), req, res)
+		return
+	}
+	if len(review.Spec.Items) > MaxReviewItems {
+		h.HandleError(errors.NewBadRequest(fmt.Sprintf("at most %d items may be reviewed at once", MaxReviewItems)), req, res)
+		return
+	}
+
+	user := auth.EmailToName(info.GetName())
+	review.Status.Items = make([]ResourceAccess, 0, len(review.Spec.Items))
+	for _, item := range review.Spec.Items {
+		if item.Resource == "" {
+			h.HandleError(errors.NewBadRequest("resource of items is required"), req, res)
+			return
+		}
+		resource, constraints := item.resource(), item.constraints()
+		access := ResourceAccess{ResourceAttributes: item}
+		verbs, except, err := h.manager.GetSubjectActionsExcept(user, info.GetGroups(), resource, constraints)
+		if err != nil {
+			h.HandleError(err, req, res)
+			return
+		}
+		access.Verbs, access.ExceptVerbs = verbs, except
+		if item.Verb != "" {
+			result, err := h.manager.Verify(user, info.GetGroups(), item.Verb, resource, constraints)
+			if err != nil {
+				h.HandleError(err, req, res)
+				return
+			}
+			access.Allowed = result.Allowed && !result.Denied
+			access.Reason = result.Reason
+		}
+		review.Status.Items = append(review.Status.Items, access)
+	}
+	res.WriteHeaderAndEntity(http.StatusOK, review)
+}
+
+func (h handler) resourceAccessReview(req *restful.Request, res *restful.Response) {
+	info := abcontext.User(req.Request.Context())
+	if !auth.IsAdmin(info) {
+		h.HandleError(errors.NewForbidden(schema.GroupResource{Resource: "resourceaccessreviews"}, "",
+			fmt.Errorf("only platform administrators may review the access of others")), req, res)
+		return
+	}
+	review := ResourceAccessReview{}
+	if err := req.ReadEntity(&review); err != nil {
+		h.HandleError(errors.NewBadRequest(err.Error()), req, res)
+		return
+	}
+	if review.Spec.Verb == "" || review.Spec.Resource == "" {
+		h.HandleError(errors.NewBadRequest("verb and resource are required"), req, res)
+		return
+	}
+
+	users, groups, err := h.manager.WhoCan(review.Spec.Verb, review.Spec.resource(), review.Spec.constraints())
+	if err != nil {
+		h.HandleError(err, req, res)
+		return
+	}
+	review.Status = ResourceAccessReviewStatus{Users: users, Groups: groups}
+	res.WriteHeaderAndEntity(http.StatusOK, review)
+}
+
+func (a ResourceAttributes) resource() schema.GroupResource {
+	return schema.GroupResource{Group: a.Group, Resource: a.Resource}
+}
+
+// constraints returns the constraints of the scope like the authorizer builds them from routes
+func (a ResourceAttributes) constraints() map[string]string {
+	constraints := map[string]string{}
+	for key, val := range map[string]string{
+		auth.ResProject:      a.Project,
+		auth.ResCluster:      a.Cluster,
+		auth.ResNamespace:    a.Namespace,
+		auth.ResResourceName: a.Name,
+	} {
+		if val != "" {
+			constraints[key] = val
+		}
+	}
+	return constraints
+}
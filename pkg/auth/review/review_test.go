@@ -0,0 +1,306 @@
+package review
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	restful "github.com/emicklei/go-restful/v3"
+	"gomod.alauda.cn/alauda-backend/pkg/auth"
+	authv1 "gomod.alauda.cn/alauda-backend/pkg/auth/apis/v1"
+	"gomod.alauda.cn/alauda-backend/pkg/auth/clusterrole"
+	"gomod.alauda.cn/alauda-backend/pkg/auth/request"
+	"gomod.alauda.cn/alauda-backend/pkg/auth/user"
+	"gomod.alauda.cn/alauda-backend/pkg/auth/userbinding"
+	"gomod.alauda.cn/alauda-backend/pkg/server"
+	"gomod.alauda.cn/alauda-backend/pkg/util/token"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	authuser "k8s.io/apiserver/pkg/authentication/user"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// callers users authenticated by their bearer token
+var callers = map[string]authuser.Info{
+	"alice": &authuser.DefaultInfo{Name: "alice@example.com", Groups: []string{"devs"}},
+	"admin": &authuser.DefaultInfo{Name: "admin@example.com", Extra: map[string][]string{token.ExtraIsAdmin: {"true"}}},
+}
+
+// tokenAuthenticator authenticates the callers by their bearer token
+type tokenAuthenticator struct{}
+
+func (tokenAuthenticator) AuthenticateRequest(req *http.Request) (*authenticator.Response, bool, error) {
+	info, ok := callers[strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")]
+	if !ok {
+		return nil, false, nil
+	}
+	return &authenticator.Response{User: info}, true, nil
+}
+
+func binding(name, email, role string, labels map[string]string, subjects ...authv1.Subject) *authv1.UserBinding {
+	b := &authv1.UserBinding{
+		TypeMeta: metav1.TypeMeta{APIVersion: authv1.SchemeGroupVersion.String(), Kind: "UserBinding"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{"auth.cpaas.io/role.name": role},
+			Annotations: map[string]string{},
+		},
+		Spec: authv1.UserBindingSpec{Subjects: subjects, RoleRef: role},
+	}
+	if email != "" {
+		b.Labels["auth.cpaas.io/user.email"] = auth.EmailToName(email)
+		b.Annotations["auth.cpaas.io/user.email"] = email
+	}
+	for k, v := range labels {
+		b.Labels[k] = v
+	}
+	return b
+}
+
+func role(name string, annotations map[string]string, rules ...rbacv1.PolicyRule) *rbacv1.ClusterRole {
+	return &rbacv1.ClusterRole{
+		TypeMeta: metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{clusterrole.LabelRoleRelative: name},
+			Annotations: annotations,
+		},
+		Rules: rules,
+	}
+}
+
+// newTestServer returns a server with the access review webservice
+// using the permissions of the userbindings and clusterroles
+func newTestServer(t *testing.T, objs ...runtime.Object) server.Server {
+	t.Helper()
+	unstructuredObjects := make([]runtime.Object, 0, len(objs))
+	for _, obj := range objs {
+		data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			t.Fatalf("failed to convert %v: %v", obj, err)
+		}
+		unstructuredObjects = append(unstructuredObjects, &unstructured.Unstructured{Object: data})
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		authv1.SchemeGroupVersion.WithResource("userbindings"): "UserBindingList",
+		authv1.SchemeGroupVersion.WithResource("users"):        "UserList",
+		rbacv1.SchemeGroupVersion.WithResource("clusterroles"): "ClusterRoleList",
+	}, unstructuredObjects...)
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	bindings := userbinding.NewResolver(client, 0, stopCh)
+	roles := clusterrole.NewResolver(client, 0, stopCh)
+	users := user.NewResolver(client, 0, stopCh)
+	deadline := time.Now().Add(5 * time.Second)
+	for !bindings.HasSynced() || !roles.HasSynced() || !users.HasSynced() {
+		if time.Now().After(deadline) {
+			t.Fatalf("the informers never synced")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	requestInfo := &request.RequestInfoFactory{APIPrefixes: sets.NewString("apis")}
+	mgr := auth.NewManager(nil, tokenAuthenticator{}, bindings, roles, requestInfo, users)
+
+	srv := server.New("test")
+	srv.SetErrorHandler(func(err error, req *restful.Request, res *restful.Response) {
+		status := errors.APIStatus(errors.NewInternalError(err))
+		if statusErr, ok := err.(errors.APIStatus); ok {
+			status = statusErr
+		}
+		res.WriteHeaderAndEntity(int(status.Status().Code), status.Status())
+	})
+	srv.SetAuthManager(mgr)
+	srv.Container().Add(NewWebService(srv, mgr))
+	return srv
+}
+
+// post sends the review as the caller and decodes the response into out if successful
+func post(t *testing.T, srv server.Server, path, caller string, review interface{}, out interface{}) int {
+	t.Helper()
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatalf("failed to marshal the review: %v", err)
+	}
+	req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+caller)
+	rec := httptest.NewRecorder()
+	srv.Container().ServeHTTP(rec, req)
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("invalid response %s: %v", rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestSelfSubjectAccessReview(t *testing.T) {
+	srv := newTestServer(t,
+		role("viewer", nil, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}}),
+		role("deployer", map[string]string{
+			clusterrole.AnnotationDenyRules: `[{"apiGroups":["apps"],"resources":["deployments"],"verbs":["delete"],"namespaces":["kube-system"]}]`,
+		}, rbacv1.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"*"}}),
+		binding("alice-viewer", "alice@example.com", "viewer", map[string]string{"cpaas.io/project": "p1"}),
+		binding("devs-deployer", "", "deployer", nil, authv1.Subject{Kind: authv1.SubjectKindGroup, Name: "devs"}),
+	)
+	pods := ResourceAttributes{Resource: "pods", Project: "p1", Cluster: "c1", Namespace: "n1"}
+	otherProject := ResourceAttributes{Resource: "pods", Project: "p2", Cluster: "c1", Namespace: "n2"}
+	deleteDeployment := ResourceAttributes{Verb: "delete", Group: "apps", Resource: "deployments", Cluster: "c1", Namespace: "kube-system"}
+	updateDeployment := ResourceAttributes{Verb: "update", Group: "apps", Resource: "deployments", Name: "nginx", Cluster: "c1", Namespace: "n1"}
+
+	tests := []struct {
+		name        string
+		caller      string
+		items       []ResourceAttributes
+		wantCode    int
+		wantVerbs   [][]string
+		wantExcept  [][]string
+		wantAllowed []bool
+	}{
+		{
+			name:        "verbs of several resources",
+			caller:      "alice",
+			items:       []ResourceAttributes{pods, otherProject, updateDeployment, deleteDeployment},
+			wantCode:    http.StatusOK,
+			wantVerbs:   [][]string{{"get", "list"}, {}, {"*"}, {"*"}},
+			wantExcept:  [][]string{nil, nil, nil, {"delete"}},
+			wantAllowed: []bool{false, false, true, false},
+		},
+		{
+			name:     "no items",
+			caller:   "alice",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "missing resource",
+			caller:   "alice",
+			items:    []ResourceAttributes{pods, {Verb: "get"}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "too many items",
+			caller:   "alice",
+			items:    make([]ResourceAttributes, MaxReviewItems+1),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "unauthenticated",
+			caller:   "mallory",
+			items:    []ResourceAttributes{pods},
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			review := SelfSubjectAccessReview{Spec: SelfSubjectAccessReviewSpec{Items: test.items}}
+			got := SelfSubjectAccessReview{}
+			if code := post(t, srv, "/auth/v1/selfsubjectaccessreviews", test.caller, review, &got); code != test.wantCode {
+				t.Fatalf("got status %d, want %d", code, test.wantCode)
+			}
+			if test.wantCode != http.StatusOK {
+				return
+			}
+			if len(got.Status.Items) != len(test.items) {
+				t.Fatalf("got %d items, want %d", len(got.Status.Items), len(test.items))
+			}
+			for i, item := range got.Status.Items {
+				if item.ResourceAttributes != test.items[i] {
+					t.Errorf("got item %+v at %d, want %+v", item.ResourceAttributes, i, test.items[i])
+				}
+				sort.Strings(item.Verbs)
+				if !reflect.DeepEqual(item.Verbs, test.wantVerbs[i]) {
+					t.Errorf("got verbs %v for %+v, want %v", item.Verbs, item.ResourceAttributes, test.wantVerbs[i])
+				}
+				if !reflect.DeepEqual(item.ExceptVerbs, test.wantExcept[i]) {
+					t.Errorf("got except verbs %v for %+v, want %v", item.ExceptVerbs, item.ResourceAttributes, test.wantExcept[i])
+				}
+				if item.Allowed != test.wantAllowed[i] {
+					t.Errorf("got allowed %v (%s) for %+v, want %v", item.Allowed, item.Reason, item.ResourceAttributes, test.wantAllowed[i])
+				}
+			}
+		})
+	}
+}
+
+func TestResourceAccessReview(t *testing.T) {
+	srv := newTestServer(t,
+		role("viewer", nil, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}),
+		role("lister", nil, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"list"}}),
+		binding("alice-viewer", "alice@example.com", "viewer", map[string]string{"cpaas.io/project": "p1"}),
+		binding("bob-viewer", "bob@example.com", "viewer", nil),
+		binding("devs-viewer", "", "viewer", nil, authv1.Subject{Kind: authv1.SubjectKindGroup, Name: "devs"}),
+		binding("everyone-lister", "", "lister", nil, authv1.Subject{Kind: authv1.SubjectKindGroup, Name: "*"}),
+	)
+	tests := []struct {
+		name       string
+		caller     string
+		spec       ResourceAttributes
+		wantCode   int
+		wantUsers  []string
+		wantGroups []string
+	}{
+		{
+			name:       "subjects allowed in a project",
+			caller:     "admin",
+			spec:       ResourceAttributes{Verb: "get", Resource: "pods", Project: "p1"},
+			wantCode:   http.StatusOK,
+			wantUsers:  []string{"alice@example.com", "bob@example.com"},
+			wantGroups: []string{"devs"},
+		},
+		{
+			name:       "subjects allowed in another project",
+			caller:     "admin",
+			spec:       ResourceAttributes{Verb: "get", Resource: "pods", Project: "p2"},
+			wantCode:   http.StatusOK,
+			wantUsers:  []string{"bob@example.com"},
+			wantGroups: []string{"devs"},
+		},
+		{
+			name:       "all authenticated users",
+			caller:     "admin",
+			spec:       ResourceAttributes{Verb: "list", Resource: "namespaces"},
+			wantCode:   http.StatusOK,
+			wantUsers:  []string{},
+			wantGroups: []string{authuser.AllAuthenticated},
+		},
+		{
+			name:     "missing verb",
+			caller:   "admin",
+			spec:     ResourceAttributes{Resource: "pods"},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "not an administrator",
+			caller:   "alice",
+			spec:     ResourceAttributes{Verb: "get", Resource: "pods"},
+			wantCode: http.StatusForbidden,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ResourceAccessReview{}
+			if code := post(t, srv, "/auth/v1/resourceaccessreviews", test.caller, ResourceAccessReview{Spec: test.spec}, &got); code != test.wantCode {
+				t.Fatalf("got status %d, want %d", code, test.wantCode)
+			}
+			if test.wantCode != http.StatusOK {
+				return
+			}
+			if !reflect.DeepEqual(got.Status.Users, test.wantUsers) || !reflect.DeepEqual(got.Status.Groups, test.wantGroups) {
+				t.Errorf("got users %v and groups %v, want %v and %v", got.Status.Users, got.Status.Groups, test.wantUsers, test.wantGroups)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+
+	authv1 "gomod.alauda.cn/alauda-backend/pkg/auth/apis/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// fakeProjectResolver resolves projects of namespaces by cluster/namespace
+type fakeProjectResolver map[string]string
+
+func (r fakeProjectResolver) NamespaceProject(cluster, namespace string) (string, bool) {
+	project, ok := r[cluster+"/"+namespace]
+	return project, ok
+}
+
+func TestMatchAllConstraints(t *testing.T) {
+	tests := []struct {
+		name        string
+		permission  map[string]string
+		constraints map[string]string
+		want        bool
+	}{
+		{
+			name:        "platform permission",
+			constraints: map[string]string{ResProject: "p1", ResCluster: "c1", ResNamespace: "n1"},
+			want:        true,
+		},
+		{
+			name:        "project permission for the project",
+			permission:  map[string]string{ResProject: "p1"},
+			constraints: map[string]string{ResProject: "p1"},
+			want:        true,
+		},
+		{
+			name:        "project permission for namespaces of the project",
+			permission:  map[string]string{ResProject: "p1"},
+			constraints: map[string]string{ResProject: "p1", ResCluster: "c1", ResNamespace: "n1"},
+			want:        true,
+		},
+		{
+			name:        "project permission for another project",
+			permission:  map[string]string{ResProject: "p1"},
+			constraints: map[string]string{ResProject: "p2", ResCluster: "c1", ResNamespace: "n1"},
+		},
+		{
+			name:        "project permission for the platform",
+			permission:  map[string]string{ResProject: "p1"},
+			constraints: map[string]string{},
+		},
+		{
+			name:        "project permission limited to clusters for the project",
+			permission:  map[string]string{ResProject: "p1", ResCluster: "c1,c2"},
+			constraints: map[string]string{ResProject: "p1"},
+			want:        true,
+		},
+		{
+			name:        "project permission limited to clusters for a listed cluster",
+			permission:  map[string]string{ResProject: "p1", ResCluster: "c1,c2"},
+			constraints: map[string]string{ResProject: "p1", ResCluster: "c2", ResNamespace: "n1"},
+			want:        true,
+		},
+		{
+			name:        "project permission limited to clusters for another cluster",
+			permission:  map[string]string{ResProject: "p1", ResCluster: "c1,c2"},
+			constraints: map[string]string{ResProject: "p1", ResCluster: "c3", ResNamespace: "n1"},
+		},
+		{
+			name:        "cluster permission for namespaces of a listed cluster",
+			permission:  map[string]string{ResCluster: "c1,c2"},
+			constraints: map[string]string{ResProject: "p1", ResCluster: "c2", ResNamespace: "n1"},
+			want:        true,
+		},
+		{
+			name:        "cluster permission for another cluster",
+			permission:  map[string]string{ResCluster: "c1,c2"},
+			constraints: map[string]string{ResCluster: "c3"},
+		},
+		{
+			name:        "cluster permission for a project",
+			permission:  map[string]string{ResCluster: "c1"},
+			constraints: map[string]string{ResProject: "p1"},
+		},
+		{
+			name:        "namespace permission without the project in the request",
+			permission:  map[string]string{ResProject: "p1", ResCluster: "c1", ResNamespace: "n1"},
+			constraints: map[string]string{ResCluster: "c1", ResNamespace: "n1"},
+			want:        true,
+		},
+		{
+			name:        "namespace permission for another namespace",
+			permission:  map[string]string{ResProject: "p1", ResCluster: "c1", ResNamespace: "n1"},
+			constraints: map[string]string{ResProject: "p1", ResCluster: "c1", ResNamespace: "n2"},
+		},
+		{
+			name:        "namespace permission for the namespace of another project",
+			permission:  map[string]string{ResProject: "p1", ResCluster: "c1", ResNamespace: "n1"},
+			constraints: map[string]string{ResProject: "p2", ResCluster: "c1", ResNamespace: "n1"},
+		},
+		{
+			name:        "namespace permission for the namespace in another cluster",
+			permission:  map[string]string{ResProject: "p1", ResCluster: "c1", ResNamespace: "n1"},
+			constraints: map[string]string{ResCluster: "c2", ResNamespace: "n1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &Permission{Constraints: test.permission}
+			if got := p.IsInConstraint(test.constraints); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestScopeConstraints(t *testing.T) {
+	mgr := newTestManager(t).WithProjectResolver(fakeProjectResolver{"c1/n1": "p1"})
+	tests := []struct {
+		name        string
+		constraints map[string]string
+		want        map[string]string
+	}{
+		{
+			name:        "project of the namespace is added",
+			constraints: map[string]string{ResCluster: "c1", ResNamespace: "n1"},
+			want:        map[string]string{ResProject: "p1", ResCluster: "c1", ResNamespace: "n1"},
+		},
+		{
+			name:        "project of the route is replaced",
+			constraints: map[string]string{ResProject: "p2", ResCluster: "c1", ResNamespace: "n1"},
+			want:        map[string]string{ResProject: "p1", ResCluster: "c1", ResNamespace: "n1"},
+		},
+		{
+			name:        "unknown namespace",
+			constraints: map[string]string{ResProject: "p2", ResCluster: "c1", ResNamespace: "n2"},
+			want:        map[string]string{ResProject: "p2", ResCluster: "c1", ResNamespace: "n2"},
+		},
+		{
+			name:        "namespace of another cluster",
+			constraints: map[string]string{ResCluster: "c2", ResNamespace: "n1"},
+			want:        map[string]string{ResCluster: "c2", ResNamespace: "n1"},
+		},
+		{
+			name:        "without namespace",
+			constraints: map[string]string{ResProject: "p2", ResCluster: "c1"},
+			want:        map[string]string{ResProject: "p2", ResCluster: "c1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := make(map[string]string, len(test.constraints))
+			for k, v := range test.constraints {
+				original[k] = v
+			}
+			got := mgr.scopeConstraints(test.constraints)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got constraints %v, want %v", got, test.want)
+			}
+			if !reflect.DeepEqual(test.constraints, original) {
+				t.Errorf("the constraints of the request were changed to %v", test.constraints)
+			}
+		})
+	}
+}
+
+func TestVerifyScopeHierarchy(t *testing.T) {
+	project := func(name, email, project string, clusters ...string) *authv1.UserBinding {
+		b := testBinding(name, email, "viewer", map[string]string{"cpaas.io/project": project})
+		b.Spec.Scope = authv1.UserBindingScopeProject
+		for _, c := range clusters {
+			b.Spec.Constraint = append(b.Spec.Constraint, authv1.Constraint{Cluster: c})
+		}
+		return b
+	}
+	cluster := testBinding("carol-cluster", "carol@example.com", "viewer", nil)
+	cluster.Spec.Scope = authv1.UserBindingScopeCluster
+	cluster.Spec.Constraint = []authv1.Constraint{{Cluster: "c1"}}
+
+	mgr := newTestManager(t,
+		testClusterRole("viewer", "viewer", nil,
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}),
+		project("alice-p1", "alice@example.com", "p1"),
+		project("bob-p2", "bob@example.com", "p2", "c1"),
+		project("dave-p1", "dave@example.com", "p1", "c2"),
+		cluster,
+	).WithProjectResolver(fakeProjectResolver{"c1/n1": "p1", "c1/n2": "p2"})
+	pods := schema.GroupResource{Resource: "pods"}
+
+	tests := []struct {
+		name        string
+		user        string
+		constraints map[string]string
+		wantAllowed bool
+	}{
+		{
+			name:        "project binding for a namespace of the project without project in the route",
+			user:        "alice@example.com",
+			constraints: map[string]string{ResCluster: "c1", ResNamespace: "n1"},
+			wantAllowed: true,
+		},
+		{
+			name:        "project binding for a namespace of the project routed through another project",
+			user:        "alice@example.com",
+			constraints: map[string]string{ResProject: "p2", ResCluster: "c1", ResNamespace: "n1"},
+			wantAllowed: true,
+		},
+		{
+			// regression: the project of the route must not grant access to namespaces of other projects
+			name:        "project binding for a namespace of another project routed through the project",
+			user:        "bob@example.com",
+			constraints: map[string]string{ResProject: "p2", ResCluster: "c1", ResNamespace: "n1"},
+		},
+		{
+			name:        "project binding limited to clusters for a namespace of the project",
+			user:        "bob@example.com",
+			constraints: map[string]string{ResCluster: "c1", ResNamespace: "n2"},
+			wantAllowed: true,
+		},
+		{
+			name:        "project binding limited to another cluster",
+			user:        "dave@example.com",
+			constraints: map[string]string{ResCluster: "c1", ResNamespace: "n1"},
+		},
+		{
+			name:        "cluster binding for namespaces of any project",
+			user:        "carol@example.com",
+			constraints: map[string]string{ResCluster: "c1", ResNamespace: "n2"},
+			wantAllowed: true,
+		},
+		{
+			name:        "cluster binding for another cluster",
+			user:        "carol@example.com",
+			constraints: map[string]string{ResCluster: "c2", ResNamespace: "n2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := mgr.Verify(EmailToName(test.user), nil, "get", pods, test.constraints)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Allowed != test.wantAllowed {
+				t.Errorf("got allowed %v (%s), want %v", result.Allowed, result.Reason, test.wantAllowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	authv1 "gomod.alauda.cn/alauda-backend/pkg/auth/apis/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	authuser "k8s.io/apiserver/pkg/authentication/user"
+)
+
+func TestBindingSubjects(t *testing.T) {
+	tests := []struct {
+		name       string
+		binding    *authv1.UserBinding
+		wantUsers  map[string]string
+		wantGroups []string
+	}{
+		{
+			name:       "labels",
+			binding:    testBinding("b", "alice@example.com", "viewer", map[string]string{"auth.cpaas.io/group.name": "devs"}),
+			wantUsers:  map[string]string{EmailToName("alice@example.com"): "alice@example.com"},
+			wantGroups: []string{"devs"},
+		},
+		{
+			name: "user and group subjects",
+			binding: testBinding("b", "", "viewer", nil,
+				authv1.Subject{Kind: authv1.SubjectKindUser, Name: "bob@example.com"},
+				authv1.Subject{Kind: authv1.SubjectKindGroup, Name: "ops"},
+				authv1.Subject{Kind: authv1.SubjectKindGroup, Name: ""}),
+			wantUsers:  map[string]string{EmailToName("bob@example.com"): "bob@example.com"},
+			wantGroups: []string{"ops"},
+		},
+		{
+			name: "wildcard users and groups",
+			binding: testBinding("b", "", "viewer", nil,
+				authv1.Subject{Kind: authv1.SubjectKindUser, Name: "*"},
+				authv1.Subject{Kind: authv1.SubjectKindGroup, Name: "*"}),
+			wantUsers:  map[string]string{},
+			wantGroups: []string{authuser.AllAuthenticated},
+		},
+		{
+			name: "service accounts",
+			binding: func() *authv1.UserBinding {
+				b := testBinding("b", "", "viewer", nil,
+					authv1.Subject{Kind: authv1.SubjectKindServiceAccount, Name: "builder"},
+					authv1.Subject{Kind: authv1.SubjectKindServiceAccount, Name: "ci:deployer"},
+					authv1.Subject{Kind: authv1.SubjectKindServiceAccount, Name: "system:serviceaccount:ops:monitor"},
+					authv1.Subject{Kind: authv1.SubjectKindServiceAccount, Name: "jobs:*"},
+					authv1.Subject{Kind: authv1.SubjectKindServiceAccount, Name: "*"})
+				b.Namespace = "team-a"
+				return b
+			}(),
+			wantUsers: map[string]string{
+				EmailToName("system:serviceaccount:team-a:builder"): "system:serviceaccount:team-a:builder",
+				EmailToName("system:serviceaccount:ci:deployer"):    "system:serviceaccount:ci:deployer",
+				EmailToName("system:serviceaccount:ops:monitor"):    "system:serviceaccount:ops:monitor",
+			},
+			wantGroups: []string{"system:serviceaccounts", "system:serviceaccounts:jobs"},
+		},
+		{
+			name: "service account without namespace",
+			binding: testBinding("b", "", "viewer", nil,
+				authv1.Subject{Kind: authv1.SubjectKindServiceAccount, Name: "builder"}),
+			wantUsers:  map[string]string{},
+			wantGroups: []string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			users, groups := bindingSubjects(test.binding)
+			if !reflect.DeepEqual(users, test.wantUsers) {
+				t.Errorf("got users %v, want %v", users, test.wantUsers)
+			}
+			if !reflect.DeepEqual(groups, test.wantGroups) {
+				t.Errorf("got groups %v, want %v", groups, test.wantGroups)
+			}
+		})
+	}
+}
+
+func TestAuthorizeSubjects(t *testing.T) {
+	sa := func(namespace, name string) *authv1.UserBinding {
+		b := testBinding(name, "", "viewer", nil, authv1.Subject{Kind: authv1.SubjectKindServiceAccount, Name: "builder"})
+		b.Namespace = namespace
+		return b
+	}
+	mgr := newTestManager(t,
+		testClusterRole("viewer", "viewer", nil,
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}),
+		testClusterRole("lister", "lister", nil,
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"get"}}),
+		testBinding("ops-viewer", "", "viewer", nil, authv1.Subject{Kind: authv1.SubjectKindGroup, Name: "ops"}),
+		testBinding("everyone-lister", "", "lister", nil, authv1.Subject{Kind: authv1.SubjectKindGroup, Name: "*"}),
+		sa("team-a", "builder-viewer"),
+	)
+	tests := []struct {
+		name        string
+		user        string
+		groups      []string
+		url         string
+		wantAllowed bool
+	}{
+		{
+			name:        "groups of the token without a User object",
+			user:        "carol@example.com",
+			groups:      []string{"ops"},
+			url:         "/api/v1/pods/nginx",
+			wantAllowed: true,
+		},
+		{
+			name: "other groups",
+			user: "carol@example.com",
+			url:  "/api/v1/pods/nginx",
+		},
+		{
+			name:        "wildcard group applies to all authenticated users",
+			user:        "mallory@example.com",
+			url:         "/api/v1/namespaces/default",
+			wantAllowed: true,
+		},
+		{
+			name:        "service account of the binding namespace",
+			user:        "system:serviceaccount:team-a:builder",
+			groups:      []string{"system:serviceaccounts", "system:serviceaccounts:team-a"},
+			url:         "/api/v1/pods/nginx",
+			wantAllowed: true,
+		},
+		{
+			name:   "service account of another namespace",
+			user:   "system:serviceaccount:team-b:builder",
+			groups: []string{"system:serviceaccounts", "system:serviceaccounts:team-b"},
+			url:    "/api/v1/pods/nginx",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := authenticated(httptest.NewRequest("GET", test.url, nil), test.user, test.groups...)
+			allowed, reason, _, err := mgr.AuthorizeWithFilter(context.Background(), req, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if allowed != test.wantAllowed {
+				t.Errorf("got allowed %v (%s), want %v", allowed, reason, test.wantAllowed)
+			}
+		})
+	}
+}
+
+// Regression test: userbindings with the same name in different namespaces
+// are distinct bindings, deleting one must keep the permissions of the other
+func TestBindingNameCollision(t *testing.T) {
+	binding := func(namespace, email string) *authv1.UserBinding {
+		b := testBinding("viewer", email, "viewer", nil)
+		b.Namespace = namespace
+		return b
+	}
+	mgr, client := newTestManagerWithClient(t,
+		testClusterRole("viewer", "viewer", nil,
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}),
+		binding("team-a", "alice@example.com"),
+		binding("team-b", "bob@example.com"),
+	)
+	pods := schema.GroupResource{Resource: "pods"}
+	permissions := func(email string) []string {
+		return permissionSources(mgr.permissionIndex.Permissions(EmailToName(email), nil, pods))
+	}
+	if got, want := permissions("alice@example.com"), []string{"team-a/viewer viewer pods"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got permissions %v, want %v", got, want)
+	}
+	if got, want := permissions("bob@example.com"), []string{"team-b/viewer viewer pods"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got permissions %v, want %v", got, want)
+	}
+
+	err := client.Resource(authv1.SchemeGroupVersion.WithResource("userbindings")).Namespace("team-a").
+		Delete(context.Background(), "viewer", metav1.DeleteOptions{})
+	if err != nil {
+		t.Fatalf("failed to delete the userbinding: %v", err)
+	}
+	eventually(t, func() bool {
+		return len(permissions("alice@example.com")) == 0
+	}, "the permissions were not removed after the userbinding was deleted")
+	if got, want := permissions("bob@example.com"), []string{"team-b/viewer viewer pods"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got permissions %v after deleting the binding of another namespace, want %v", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gomod.alauda.cn/alauda-backend/pkg/auth/request"
+	abcontext "gomod.alauda.cn/alauda-backend/pkg/context"
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type subjectAccessReviewAuthorizer struct {
+	client              kubernetes.Interface
+	requestInfoResolver request.RequestInfoResolver
+	cluster             string
+	noMatch             Decision
+}
+
+// NewSubjectAccessReviewAuthorizer creates an authorizer asking kubernetes using a SubjectAccessReview
+// built from the request information and the authenticated user in the request context.
+// The client talks to a single cluster named cluster, requests targeting another cluster
+// and requests which are neither allowed nor denied by kubernetes result in the noMatch decision
+func NewSubjectAccessReviewAuthorizer(client kubernetes.Interface, requestInfoResolver request.RequestInfoResolver, cluster string, noMatch Decision) Authorizer {
+	return &subjectAccessReviewAuthorizer{
+		client:              client,
+		requestInfoResolver: requestInfoResolver,
+		cluster:             cluster,
+		noMatch:             noMatch,
+	}
+}
+
+// Authorize creates a SubjectAccessReview for the request
+func (a *subjectAccessReviewAuthorizer) Authorize(ctx context.Context, req *http.Request, opt *FilterOption) (Decision, string, error) {
+	info := abcontext.User(req.Context())
+	if info == nil {
+		return a.noMatch, "subjectaccessreview: request is not authenticated", nil
+	}
+	requestInfo, err := a.requestInfoResolver.NewRequestInfo(req)
+	if err != nil {
+		return DecisionNoOpinion, "", err
+	}
+	// RBAC of the cluster of the client must not grant the same names on other clusters
+	if requestInfo.Cluster != "" && requestInfo.Cluster != a.cluster {
+		return a.noMatch, fmt.Sprintf("subjectaccessreview: cluster %q is not reviewed", requestInfo.Cluster), nil
+	}
+	applyResourceMap(requestInfo, opt)
+
+	extra := make(map[string]authzv1.ExtraValue, len(info.GetExtra()))
+	for k, v := range info.GetExtra() {
+		extra[k] = authzv1.ExtraValue(v)
+	}
+	review := &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			User:   info.GetName(),
+			UID:    info.GetUID(),
+			Groups: info.GetGroups(),
+			Extra:  extra,
+		},
+	}
+	if requestInfo.Resource != "" {
+		review.Spec.ResourceAttributes = &authzv1.ResourceAttributes{
+			Namespace:   requestInfo.Namespace,
+			Verb:        requestInfo.Verb,
+			Group:       requestInfo.APIGroup,
+			Version:     requestInfo.APIVersion,
+			Resource:    requestInfo.Resource,
+			Subresource: requestInfo.Subresource,
+			Name:        requestInfo.Name,
+		}
+	} else {
+		// non-resource requests use the lowercase http method as verb
+		review.Spec.NonResourceAttributes = &authzv1.NonResourceAttributes{
+			Path: requestInfo.Path,
+			Verb: strings.ToLower(req.Method),
+		}
+	}
+
+	result, err := a.client.AuthorizationV1().SubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return DecisionNoOpinion, "", fmt.Errorf("subjectaccessreview failed: %v", err)
+	}
+	switch {
+	case result.Status.Allowed:
+		return DecisionAllow, result.Status.Reason, nil
+	case result.Status.Denied:
+		return DecisionDeny, result.Status.Reason, nil
+	}
+	if result.Status.EvaluationError != "" {
+		return a.noMatch, result.Status.Reason, fmt.Errorf("subjectaccessreview: %s", result.Status.EvaluationError)
+	}
+	return a.noMatch, result.Status.Reason, nil
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"gomod.alauda.cn/alauda-backend/pkg/util/token"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+)
+
+// cachedToken result of authenticating a token
+type cachedToken struct {
+	resp *authenticator.Response
+	ok   bool
+}
+
+type cachedTokenAuthenticator struct {
+	authn authenticator.Request
+	ttl   time.Duration
+	cache *cache.LRUExpireCache
+}
+
+// NewCachedTokenAuthenticator caches the results of authn, i.e. a remote token review,
+// by the hash of the bearer token for ttl. Tokens are never cached after their expiry and errors
+// are not cached. A ttl lower or equal to zero returns authn as it is
+func NewCachedTokenAuthenticator(authn authenticator.Request, ttl time.Duration) authenticator.Request {
+	if ttl <= 0 {
+		return authn
+	}
+	return &cachedTokenAuthenticator{
+		authn: authn,
+		ttl:   ttl,
+		cache: cache.NewLRUExpireCache(DefaultCacheSize),
+	}
+}
+
+// AuthenticateRequest returns the cached result for the bearer token of the request
+// or authenticates the request and caches the result
+func (a *cachedTokenAuthenticator) AuthenticateRequest(req *http.Request) (*authenticator.Response, bool, error) {
+	raw := bearerToken(req)
+	if raw == "" {
+		return a.authn.AuthenticateRequest(req)
+	}
+	hash := sha256.Sum256([]byte(raw))
+	key := hex.EncodeToString(hash[:])
+	if val, ok := a.cache.Get(key); ok {
+		cached := val.(*cachedToken)
+		return cached.resp, cached.ok, nil
+	}
+
+	resp, ok, err := a.authn.AuthenticateRequest(req)
+	if err != nil {
+		return resp, ok, err
+	}
+	if ttl := a.tokenTTL(raw); ttl > 0 {
+		a.cache.Add(key, &cachedToken{resp: resp, ok: ok}, ttl)
+	}
+	return resp, ok, nil
+}
+
+// tokenTTL returns the ttl shortened to the expiry of JWT tokens
+func (a *cachedTokenAuthenticator) tokenTTL(raw string) time.Duration {
+	jwt, err := token.ParseJWT(raw)
+	if err != nil || jwt.Expiry == 0 {
+		return a.ttl
+	}
+	if untilExpiry := time.Until(time.Unix(int64(jwt.Expiry), 0)); untilExpiry < a.ttl {
+		return untilExpiry
+	}
+	return a.ttl
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/kubernetes"
+)
+
+type tokenReviewAuthenticator struct {
+	client    kubernetes.Interface
+	audiences []string
+}
+
+// NewTokenReviewAuthenticator creates an authenticator verifying bearer tokens
+// using the kubernetes TokenReview API, i.e. service account tokens.
+// If audiences are given the token must be issued for one of them
+func NewTokenReviewAuthenticator(client kubernetes.Interface, audiences []string) authenticator.Request {
+	return &tokenReviewAuthenticator{
+		client:    client,
+		audiences: audiences,
+	}
+}
+
+// AuthenticateRequest reviews the bearer token of the request
+func (a *tokenReviewAuthenticator) AuthenticateRequest(req *http.Request) (*authenticator.Response, bool, error) {
+	raw := bearerToken(req)
+	if raw == "" {
+		return nil, false, nil
+	}
+
+	review := &authnv1.TokenReview{
+		Spec: authnv1.TokenReviewSpec{
+			Token:     raw,
+			Audiences: a.audiences,
+		},
+	}
+	result, err := a.client.AuthenticationV1().TokenReviews().Create(req.Context(), review, metav1.CreateOptions{})
+	if err != nil {
+		return nil, false, fmt.Errorf("token review failed: %v", err)
+	}
+	if result.Status.Error != "" {
+		return nil, false, fmt.Errorf("token review: %s", result.Status.Error)
+	}
+	if !result.Status.Authenticated {
+		return nil, false, nil
+	}
+
+	extra := make(map[string][]string, len(result.Status.User.Extra))
+	for k, v := range result.Status.User.Extra {
+		extra[k] = v
+	}
+	return &authenticator.Response{
+		User: &user.DefaultInfo{
+			Name:   result.Status.User.Username,
+			UID:    result.Status.User.UID,
+			Groups: result.Status.User.Groups,
+			Extra:  extra,
+		},
+		Audiences: authenticator.Audiences(result.Status.Audiences),
+	}, true, nil
+}
@@ -3,20 +3,69 @@ package auth
 import (
 	"context"
 	"net/http"
-	"time"
+
+	"gomod.alauda.cn/alauda-backend/pkg/dataselect"
+
+	"k8s.io/apiserver/pkg/authentication/user"
 )
 
 type Manager interface {
-	Authenticate(ctx context.Context, req *http.Request) error
+	// Authenticate verifies the request credentials and returns the authenticated user
+	Authenticate(ctx context.Context, req *http.Request) (user.Info, error)
 	Authorize(ctx context.Context, req *http.Request, opt *FilterOption) (bool, error)
 }
 
+// ReasonAuthorizer is implemented by managers able to explain their authorization decisions
+type ReasonAuthorizer interface {
+	// AuthorizeWithReason returns if the request is allowed and why
+	AuthorizeWithReason(ctx context.Context, req *http.Request, opt *FilterOption) (allowed bool, reason string, err error)
+}
+
+// FilteringAuthorizer is implemented by managers able to allow list requests limited to some items
+type FilteringAuthorizer interface {
+	// AuthorizeWithFilter returns if the request is allowed, why and the items
+	// the response must be limited to, the filter is nil if the response is not limited
+	AuthorizeWithFilter(ctx context.Context, req *http.Request, opt *FilterOption) (allowed bool, reason string, filter *dataselect.ResourceFilter, err error)
+}
+
+// Cache caches authorization decisions
 type Cache interface {
-	GetAuthorize(key string) (bool, error)
-	SetAuthorize(key string, val interface{}, d time.Duration) error
+	// GetAuthorize returns the cached decision for key or computes and caches it using authorize
+	GetAuthorize(key string, authorize AuthorizeFunc) (*VerifyResult, error)
+	// Invalidate drops all cached decisions, i.e. when permissions change
+	Invalidate()
+}
+
+// ProjectResolver resolves the project namespaces belong to
+type ProjectResolver interface {
+	// NamespaceProject returns the project of a namespace in a cluster, false if unknown
+	NamespaceProject(cluster, namespace string) (string, bool)
+}
+
+// AuthorizeFunc computes an authorization decision
+type AuthorizeFunc func() (*VerifyResult, error)
+
+// VerifyResult authorization decision of the permission model.
+// A result neither allowed nor denied means that no permission matched
+type VerifyResult struct {
+	// Allowed the action is allowed by at least one permission
+	Allowed bool `json:"allowed"`
+	// Denied the action is denied by at least one deny permission, overrides Allowed
+	Denied bool `json:"denied"`
+	// Reason human readable explanation of the decision, i.e. why no permission matched
+	Reason string `json:"reason"`
+	// Matched permissions allowing or denying the action together with
+	// the userbindings, clusterroles and rules they come from
+	Matched []*Permission `json:"matched,omitempty"`
+	// Filter items an allowed list or watch request is limited to, nil if not limited
+	Filter *dataselect.ResourceFilter `json:"filter,omitempty"`
 }
 
 type FilterOption struct {
 	// eg. abc.alauda.io:metrics.alauda.io, xyz.alauda.io:metrics.alauda.io
 	ResourceMap map[string]string
+	// FilteredList allows list and watch requests permitted only for some objects by resource names
+	// or label selectors, the handler must limit the items using the dataselect.Query of the request context,
+	// see decorator.Query. Such requests are denied on routes which do not opt in
+	FilteredList bool
 }
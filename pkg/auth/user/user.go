@@ -5,6 +5,7 @@ import (
 	"time"
 
 	authv1 "gomod.alauda.cn/alauda-backend/pkg/auth/apis/v1"
+	utilinformer "gomod.alauda.cn/alauda-backend/pkg/util/informer"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -12,49 +13,53 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
-	"k8s.io/client-go/rest"
 	kcache "k8s.io/client-go/tools/cache"
 )
 
+const (
+	// DefaultResyncPeriod default resync period of the users informer
+	DefaultResyncPeriod = 2 * time.Hour
+)
+
 type Manager struct {
-	cache map[string]*authv1.User
-	lock  sync.RWMutex
-}
+	utilinformer.ChangeNotifier
 
-func NewResolver(stopCh <-chan struct{}) *Manager {
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		panic(err)
-	}
+	cache     map[string]*authv1.User
+	lock      sync.RWMutex
+	hasSynced kcache.InformerSynced
+}
 
-	clientset, err := dynamic.NewForConfig(config)
-	if err != nil {
-		panic(err)
+// NewResolver creates a resolver caching users using an informer,
+// a resync period lower or equal to zero uses DefaultResyncPeriod
+func NewResolver(dynamicClient dynamic.Interface, resync time.Duration, stopCh <-chan struct{}) *Manager {
+	if resync <= 0 {
+		resync = DefaultResyncPeriod
 	}
 
 	m := &Manager{
 		cache: make(map[string]*authv1.User),
 	}
 
-	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(clientset, 2*time.Hour, metav1.NamespaceAll, nil)
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, resync, metav1.NamespaceAll, nil)
 
 	userInformer := factory.ForResource(authv1.SchemeGroupVersion.WithResource("users")).Informer()
 
-	go factory.Start(stopCh)
-	for _, r := range factory.WaitForCacheSync(stopCh) {
-		if !r {
-			panic("faild to start users informer")
-		}
-	}
-
 	userInformer.AddEventHandler(kcache.ResourceEventHandlerFuncs{
 		AddFunc:    m.onAdd,
 		UpdateFunc: m.onUpdate,
 		DeleteFunc: m.onDelete,
 	})
+	m.hasSynced = userInformer.HasSynced
+
+	factory.Start(stopCh)
 	return m
 }
 
+// HasSynced returns true once the users informer has synced
+func (m *Manager) HasSynced() bool {
+	return m.hasSynced()
+}
+
 func (m *Manager) onAdd(obj interface{}) {
 	if u, err := m.toUser(obj); err == nil && u != nil {
 		m.addUser(u)
@@ -62,6 +67,9 @@ func (m *Manager) onAdd(obj interface{}) {
 }
 
 func (m *Manager) onUpdate(oldObj, newObj interface{}) {
+	if utilinformer.IsResync(oldObj, newObj) {
+		return
+	}
 	if u, err := m.toUser(newObj); err == nil && u != nil {
 		m.updateUser(u)
 	}
@@ -73,6 +81,7 @@ func (m *Manager) onDelete(obj interface{}) {
 	}
 }
 
+// Get returns the cached user, users without groups are cached as well
 func (m *Manager) Get(name string) (*authv1.User, error) {
 	m.lock.RLock()
 	defer m.lock.RUnlock()
@@ -99,6 +108,7 @@ func (m *Manager) removeUser(u *authv1.User) {
 	if u == nil {
 		return
 	}
+	defer m.Notify(u, true)
 
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -109,9 +119,7 @@ func (m *Manager) addUser(u *authv1.User) {
 	if u == nil {
 		return
 	}
-	if u.Spec.Groups == nil || len(u.Spec.Groups) == 0 {
-		return
-	}
+	defer m.Notify(u, false)
 	m.lock.Lock()
 	defer m.lock.Unlock()
 	m.cache[u.Name] = u
@@ -121,12 +129,9 @@ func (m *Manager) updateUser(u *authv1.User) {
 	if u == nil {
 		return
 	}
+	defer m.Notify(u, false)
 
 	m.lock.Lock()
 	defer m.lock.Unlock()
-	if u.Spec.Groups == nil || len(u.Spec.Groups) == 0 {
-		delete(m.cache, u.Name)
-		return
-	}
 	m.cache[u.Name] = u
 }
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	authv1 "gomod.alauda.cn/alauda-backend/pkg/auth/apis/v1"
+	utilinformer "gomod.alauda.cn/alauda-backend/pkg/util/informer"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -13,21 +14,42 @@ import (
 	"k8s.io/client-go/tools/cache"
 )
 
+const (
+	// DefaultResyncPeriod default resync period of the userbindings informer
+	DefaultResyncPeriod = 10 * time.Minute
+)
+
+// ChangeHandler is called after a userbinding was added, updated or deleted
+type ChangeHandler func(binding *authv1.UserBinding, deleted bool)
+
 type Resolver struct {
-	cache  map[string]map[string]authv1.UserBinding
+	utilinformer.ChangeNotifier
+
+	// bindings all userbindings by namespace/name
+	bindings map[string]authv1.UserBinding
+	// cache userbindings by the user email label
+	cache map[string]map[string]authv1.UserBinding
+	// gcache userbindings by the group label and Group subjects
 	gcache map[string]map[string]authv1.UserBinding
 
 	lock          sync.RWMutex
 	dynamicClient dynamic.Interface
+	hasSynced     cache.InformerSynced
 }
 
-func NewResolver(dynamicClient dynamic.Interface, stopCh <-chan struct{}) *Resolver {
+// NewResolver creates a resolver caching userbindings using an informer,
+// a resync period lower or equal to zero uses DefaultResyncPeriod
+func NewResolver(dynamicClient dynamic.Interface, resync time.Duration, stopCh <-chan struct{}) *Resolver {
+	if resync <= 0 {
+		resync = DefaultResyncPeriod
+	}
 	r := &Resolver{
 		dynamicClient: dynamicClient,
+		bindings:      make(map[string]authv1.UserBinding),
 		cache:         make(map[string]map[string]authv1.UserBinding),
 		gcache:        make(map[string]map[string]authv1.UserBinding),
 	}
-	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, 10*time.Minute, metav1.NamespaceAll, nil)
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, resync, metav1.NamespaceAll, nil)
 	informer := factory.ForResource(authv1.SchemeGroupVersion.WithResource("userbindings"))
 	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -36,6 +58,9 @@ func NewResolver(dynamicClient dynamic.Interface, stopCh <-chan struct{}) *Resol
 			}
 		},
 		UpdateFunc: func(old, new interface{}) {
+			if utilinformer.IsResync(old, new) {
+				return
+			}
 			if binding, err := r.toUserBinding(new); err == nil && binding != nil {
 				r.updateUserBinding(binding)
 			}
@@ -47,16 +72,24 @@ func NewResolver(dynamicClient dynamic.Interface, stopCh <-chan struct{}) *Resol
 		},
 	})
 
+	r.hasSynced = informer.Informer().HasSynced
+
 	factory.Start(stopCh)
-	// Wait for informer to sync
-	for _, r := range factory.WaitForCacheSync(stopCh) {
-		if !r {
-			panic("faild to start clusterrole informer")
-		}
-	}
 	return r
 }
 
+// HasSynced returns true once the userbinding informer has synced
+func (r *Resolver) HasSynced() bool {
+	return r.hasSynced()
+}
+
+// AddChangeHandler adds a handler called with the changed userbinding after the cache changed
+func (r *Resolver) AddChangeHandler(handler ChangeHandler) {
+	r.AddObjectChangeHandler(func(obj interface{}, deleted bool) {
+		handler(obj.(*authv1.UserBinding), deleted)
+	})
+}
+
 func (r *Resolver) toUserBinding(obj interface{}) (*authv1.UserBinding, error) {
 	if obj == nil {
 		return nil, nil
@@ -72,24 +105,19 @@ func (r *Resolver) updateUserBinding(cr *authv1.UserBinding) {
 	if cr == nil {
 		return
 	}
+	defer r.Notify(cr, false)
 	r.lock.Lock()
 	defer r.lock.Unlock()
+	// labels and subjects may have changed, the previous version is removed first
+	if previous, ok := r.bindings[bindingKey(cr)]; ok {
+		r.unindex(&previous)
+	}
+	r.bindings[bindingKey(cr)] = *cr
 	if len(cr.UserEmailName()) > 0 {
-		data, ok := r.cache[cr.UserEmailName()]
-		if !ok {
-			data = make(map[string]authv1.UserBinding)
-		}
-		data[cr.Name] = *cr
-		r.cache[cr.UserEmailName()] = data
+		addToIndex(r.cache, cr.UserEmailName(), cr)
 	}
-
-	if len(cr.GroupName()) > 0 {
-		data, ok := r.gcache[cr.GroupName()]
-		if !ok {
-			data = make(map[string]authv1.UserBinding)
-		}
-		data[cr.Name] = *cr
-		r.gcache[cr.GroupName()] = data
+	for _, group := range bindingGroups(cr) {
+		addToIndex(r.gcache, group, cr)
 	}
 }
 
@@ -97,35 +125,72 @@ func (r *Resolver) removeUserBinding(cr *authv1.UserBinding) {
 	if cr == nil {
 		return
 	}
+	defer r.Notify(cr, true)
 	r.lock.Lock()
 	defer r.lock.Unlock()
+	if previous, ok := r.bindings[bindingKey(cr)]; ok {
+		r.unindex(&previous)
+	}
+	delete(r.bindings, bindingKey(cr))
+}
+
+// unindex removes a userbinding from the user and group indexes, the lock must be held
+func (r *Resolver) unindex(cr *authv1.UserBinding) {
 	if len(cr.UserEmailName()) > 0 {
-		if data, ok := r.cache[cr.UserEmailName()]; ok {
-			_, ok = data[cr.Name]
-			if ok {
-				delete(data, cr.Name)
-			}
-			if len(data) == 0 {
-				delete(r.cache, cr.UserEmailName())
-			} else {
-				r.cache[cr.UserEmailName()] = data
-			}
-		}
+		removeFromIndex(r.cache, cr.UserEmailName(), cr)
+	}
+	for _, group := range bindingGroups(cr) {
+		removeFromIndex(r.gcache, group, cr)
 	}
+}
 
+// bindingGroups returns the groups of the group label and the Group subjects of a userbinding
+func bindingGroups(cr *authv1.UserBinding) []string {
+	groups := []string{}
 	if len(cr.GroupName()) > 0 {
-		if data, ok := r.gcache[cr.GroupName()]; ok {
-			_, ok = data[cr.Name]
-			if ok {
-				delete(data, cr.Name)
-			}
-			if len(data) == 0 {
-				delete(r.gcache, cr.GroupName())
-			} else {
-				r.gcache[cr.GroupName()] = data
-			}
+		groups = append(groups, cr.GroupName())
+	}
+	for _, subject := range cr.Spec.Subjects {
+		if subject.Kind == authv1.SubjectKindGroup && subject.Name != "" && subject.Name != cr.GroupName() {
+			groups = append(groups, subject.Name)
 		}
 	}
+	return groups
+}
+
+func addToIndex(index map[string]map[string]authv1.UserBinding, key string, cr *authv1.UserBinding) {
+	data, ok := index[key]
+	if !ok {
+		data = make(map[string]authv1.UserBinding)
+		index[key] = data
+	}
+	data[bindingKey(cr)] = *cr
+}
+
+func removeFromIndex(index map[string]map[string]authv1.UserBinding, key string, cr *authv1.UserBinding) {
+	data, ok := index[key]
+	if !ok {
+		return
+	}
+	delete(data, bindingKey(cr))
+	if len(data) == 0 {
+		delete(index, key)
+	}
+}
+
+func bindingKey(cr *authv1.UserBinding) string {
+	return cr.Namespace + "/" + cr.Name
+}
+
+// List returns all cached userbindings, including bindings only using subjects
+func (r *Resolver) List() []authv1.UserBinding {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	ret := make([]authv1.UserBinding, 0, len(r.bindings))
+	for _, v := range r.bindings {
+		ret = append(ret, v)
+	}
+	return ret
 }
 
 func (r *Resolver) GetUserBindings(user string) []authv1.UserBinding {
@@ -146,6 +211,7 @@ func (r *Resolver) GetUserBindingsByGroups(groups []string) []authv1.UserBinding
 	r.lock.RLock()
 	defer r.lock.RUnlock()
 	ret := []authv1.UserBinding{}
+	seen := map[string]struct{}{}
 
 	for _, group := range groups {
 		data, ok := r.gcache[group]
@@ -153,6 +219,11 @@ func (r *Resolver) GetUserBindingsByGroups(groups []string) []authv1.UserBinding
 			continue
 		}
 		for _, v := range data {
+			// a binding may have several of the groups as subjects
+			if _, ok := seen[bindingKey(&v)]; ok {
+				continue
+			}
+			seen[bindingKey(&v)] = struct{}{}
 			ret = append(ret, v)
 		}
 	}
@@ -0,0 +1,85 @@
+package userbinding
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	authv1 "gomod.alauda.cn/alauda-backend/pkg/auth/apis/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newBinding(namespace, name string, labels map[string]string, subjects ...authv1.Subject) *authv1.UserBinding {
+	return &authv1.UserBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+		Spec:       authv1.UserBindingSpec{Subjects: subjects},
+	}
+}
+
+// bindingKeys returns the sorted namespace/name of the userbindings
+func bindingKeys(bindings []authv1.UserBinding) []string {
+	keys := make([]string, 0, len(bindings))
+	for i := range bindings {
+		keys = append(keys, bindingKey(&bindings[i]))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestResolverIndexes(t *testing.T) {
+	r := &Resolver{
+		bindings: make(map[string]authv1.UserBinding),
+		cache:    make(map[string]map[string]authv1.UserBinding),
+		gcache:   make(map[string]map[string]authv1.UserBinding),
+	}
+	group := func(name string) authv1.Subject {
+		return authv1.Subject{Kind: authv1.SubjectKindGroup, Name: name}
+	}
+	// the same name in two namespaces
+	r.updateUserBinding(newBinding("team-a", "viewer", map[string]string{"auth.cpaas.io/user.email": "alice"}))
+	r.updateUserBinding(newBinding("team-b", "viewer", map[string]string{"auth.cpaas.io/user.email": "alice"}))
+	r.updateUserBinding(newBinding("team-a", "devs", map[string]string{"auth.cpaas.io/group.name": "devs"}, group("devs"), group("ops")))
+
+	tests := []struct {
+		name string
+		got  func() []authv1.UserBinding
+		want []string
+	}{
+		{
+			name: "all bindings",
+			got:  r.List,
+			want: []string{"team-a/devs", "team-a/viewer", "team-b/viewer"},
+		},
+		{
+			name: "bindings of a user in several namespaces",
+			got:  func() []authv1.UserBinding { return r.GetUserBindings("alice") },
+			want: []string{"team-a/viewer", "team-b/viewer"},
+		},
+		{
+			name: "bindings of groups are returned once",
+			got:  func() []authv1.UserBinding { return r.GetUserBindingsByGroups([]string{"devs", "ops", "others"}) },
+			want: []string{"team-a/devs"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := bindingKeys(test.got()); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got bindings %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	// removing a binding keeps the binding with the same name in another namespace
+	r.removeUserBinding(newBinding("team-a", "viewer", nil))
+	if got, want := bindingKeys(r.GetUserBindings("alice")), []string{"team-b/viewer"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got bindings %v after removing team-a/viewer, want %v", got, want)
+	}
+	// changed subjects are indexed again
+	r.updateUserBinding(newBinding("team-a", "devs", nil, group("ops")))
+	if got := bindingKeys(r.GetUserBindingsByGroups([]string{"devs"})); len(got) != 0 {
+		t.Errorf("got bindings %v of the removed group, want none", got)
+	}
+	if got, want := bindingKeys(r.GetUserBindingsByGroups([]string{"ops"})), []string{"team-a/devs"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got bindings %v, want %v", got, want)
+	}
+}
@@ -19,7 +19,11 @@ package certwatcher
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
 	"sync"
+	"time"
 
 	"gomod.alauda.cn/log"
 
@@ -129,6 +133,32 @@ func (cw *CertWatcher) ReadCertificate() error {
 	return nil
 }
 
+// Check verifies the current certificate is loaded and valid at the moment.
+// Can be used as a health check
+func (cw *CertWatcher) Check(_ *http.Request) error {
+	cw.RLock()
+	cert := cw.currentCert
+	cw.RUnlock()
+	if cert == nil || len(cert.Certificate) == 0 {
+		return fmt.Errorf("no certificate loaded from %s", cw.certPath)
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return fmt.Errorf("failed to parse certificate %s: %v", cw.certPath, err)
+		}
+	}
+	now := time.Now()
+	if now.Before(leaf.NotBefore) {
+		return fmt.Errorf("certificate %s is not valid before %s", cw.certPath, leaf.NotBefore)
+	}
+	if now.After(leaf.NotAfter) {
+		return fmt.Errorf("certificate %s expired at %s", cw.certPath, leaf.NotAfter)
+	}
+	return nil
+}
+
 func (cw *CertWatcher) handleEvent(event fsnotify.Event) {
 	// Only care about events which may modify the contents of the file.
 	if !(isWrite(event) || isRemove(event) || isCreate(event)) {
@@ -33,6 +33,12 @@ type Manager interface {
 	GetDynamicClient(config *rest.Config, gvk *schema.GroupVersionKind) (client dynamic.NamespaceableResourceInterface, err error)
 }
 
+// ConfigUpdater updates the configuration of a Manager at runtime
+type ConfigUpdater interface {
+	// UpdateConfig replaces the configuration by a copy modified by update
+	UpdateConfig(update func(*Config))
+}
+
 // GeneratorFunc generates a client given a configuration and a request
 type GeneratorFunc func(cfg *Config, req *restful.Request) (kubernetes.Interface, error)
 
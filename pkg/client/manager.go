@@ -26,7 +26,8 @@ const (
 // DefaultManager default client manager
 type DefaultManager struct {
 	// Config configuration for manager
-	config *Config
+	config     *Config
+	configLock *sync.RWMutex
 
 	// Configuration generation for secure authorized requests
 	ConfigGeneratorFuncs []ConfigGenFunc
@@ -76,6 +77,7 @@ func (client *dynamicClientEntity) IsExpired() bool {
 }
 
 var _ Manager = &DefaultManager{}
+var _ ConfigUpdater = &DefaultManager{}
 
 // NewManager inits a manager
 func NewManager() *DefaultManager {
@@ -87,15 +89,37 @@ func NewManager() *DefaultManager {
 
 		clients:    make(map[string]ClientEntity),
 		clientLock: &sync.RWMutex{},
+		configLock: &sync.RWMutex{},
 	}
 }
 
 // WithConfig sets a configuration to manager
 func (m *DefaultManager) WithConfig(config *Config) *DefaultManager {
+	m.configLock.Lock()
+	defer m.configLock.Unlock()
 	m.config = config
 	return m
 }
 
+// UpdateConfig replaces the manager's configuration by a copy modified by update.
+// Clients generated after the update use the new configuration
+func (m *DefaultManager) UpdateConfig(update func(*Config)) {
+	m.configLock.Lock()
+	defer m.configLock.Unlock()
+	config := Config{}
+	if m.config != nil {
+		config = *m.config
+	}
+	update(&config)
+	m.config = &config
+}
+
+func (m *DefaultManager) getConfig() *Config {
+	m.configLock.RLock()
+	defer m.configLock.RUnlock()
+	return m.config
+}
+
 // With adds client configuration generator
 func (m *DefaultManager) With(gen ...ConfigGenFunc) *DefaultManager {
 	m.ConfigGeneratorFuncs = append(m.ConfigGeneratorFuncs, gen...)
@@ -111,37 +135,39 @@ func (m *DefaultManager) WithInsecure(gen ...ConfigGenFunc) *DefaultManager {
 // InsecureClient returns InCluster configuration client
 // using pod's service account or according to kubeconfig during init
 func (m *DefaultManager) InsecureClient() (client kubernetes.Interface, err error) {
-	if m.config == nil || len(m.InsecureConfigGeneratorFuncs) == 0 {
+	cfg := m.getConfig()
+	if cfg == nil || len(m.InsecureConfigGeneratorFuncs) == 0 {
 		err = errors.NewUnauthorized("No client configuration provided")
 		return
 	}
 	config, err := m.genConfig(nil, m.InsecureConfigGeneratorFuncs...)
 	if err != nil {
-		m.config.Log.Error("insecure client generation config failed", log.Err(err))
+		cfg.Log.Error("insecure client generation config failed", log.Err(err))
 		return
 	}
 	client, err = m.genClient(config)
 	if err != nil {
-		m.config.Log.Error("insecure client generation failed", log.Err(err))
+		cfg.Log.Error("insecure client generation failed", log.Err(err))
 	}
 	return
 }
 
 // Client returns a client given a request authorization options
 func (m *DefaultManager) Client(req *restful.Request) (client kubernetes.Interface, err error) {
-	if m.config == nil || len(m.ConfigGeneratorFuncs) == 0 {
+	cfg := m.getConfig()
+	if cfg == nil || len(m.ConfigGeneratorFuncs) == 0 {
 		err = errors.NewUnauthorized("No client configuration provided")
 		return
 	}
 
 	config, err := m.genConfig(req)
 	if err != nil {
-		m.config.Log.Error("secure client generation config failed", log.Err(err))
+		cfg.Log.Error("secure client generation config failed", log.Err(err))
 		return
 	}
 	client, err = m.GetClient(config)
 	if err != nil {
-		m.config.Log.Error("secure client generation failed", log.Err(err))
+		cfg.Log.Error("secure client generation failed", log.Err(err))
 	}
 	return
 }
@@ -155,10 +181,11 @@ func (m *DefaultManager) genConfig(req *restful.Request, genFuncs ...ConfigGenFu
 	if len(genFuncs) == 0 {
 		genFuncs = m.ConfigGeneratorFuncs
 	}
+	cfg := m.getConfig()
 	for _, gen := range genFuncs {
-		config, err = gen(m.config, req)
+		config, err = gen(cfg, req)
 		if err == nil && config != nil {
-			m.config.setupConfig(config, err)
+			cfg.setupConfig(config, err)
 			return
 		}
 	}
@@ -167,26 +194,27 @@ func (m *DefaultManager) genConfig(req *restful.Request, genFuncs ...ConfigGenFu
 		// no genconfigfunc successed
 		err = errors.NewUnauthorized("config generation failed")
 
-		m.config.Log.Error("no genFuncs triggered", log.Err(err))
+		cfg.Log.Error("no genFuncs triggered", log.Err(err))
 	}
 	return
 }
 
 // DynamicClient genreates a dynamic client instance
 func (m *DefaultManager) DynamicClient(req *restful.Request, gvk *schema.GroupVersionKind) (client dynamic.NamespaceableResourceInterface, err error) {
-	if m.config == nil || len(m.ConfigGeneratorFuncs) == 0 {
+	cfg := m.getConfig()
+	if cfg == nil || len(m.ConfigGeneratorFuncs) == 0 {
 		err = errors.NewUnauthorized("No client configuration provided")
 		return
 	}
 
 	config, err := m.genConfig(req)
 	if err != nil {
-		m.config.Log.Error("dynamic client generation config failed", log.Err(err))
+		cfg.Log.Error("dynamic client generation config failed", log.Err(err))
 		return
 	}
 	client, err = m.GetDynamicClient(config, gvk)
 	if err != nil {
-		m.config.Log.Error("dynamic client generation failed", log.Err(err))
+		cfg.Log.Error("dynamic client generation failed", log.Err(err))
 	}
 	return
 }
@@ -219,7 +247,7 @@ func (m *DefaultManager) genDynamicClient(gvk *schema.GroupVersionKind, config *
 
 // ManagerConfig returns a clone of manager's configuration.
 func (m *DefaultManager) ManagerConfig() Config {
-	return *m.config
+	return *m.getConfig()
 }
 
 // Hash return a hash key for client base on config and gvk
@@ -5,6 +5,7 @@ import (
 
 	"go.uber.org/zap"
 	"gomod.alauda.cn/alauda-backend/pkg/dataselect"
+	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
@@ -16,6 +17,8 @@ var (
 	dynamicClientKey    = contextKey{Name: "dynamic.NamespaceableResourceInterface"}
 	loggerKey           = contextKey{Name: "zap.Logger"}
 	dataselectQueryKey  = contextKey{Name: "dataselect.Query"}
+	userKey             = contextKey{Name: "user.Info"}
+	resourceFilterKey   = contextKey{Name: "dataselect.ResourceFilter"}
 )
 
 // WithClient inserts a client into the context
@@ -77,3 +80,33 @@ func Query(ctx context.Context) *dataselect.Query {
 	}
 	return nil
 }
+
+// WithUser inserts the authenticated user into the context
+func WithUser(ctx context.Context, info user.Info) context.Context {
+	return context.WithValue(ctx, userKey, info)
+}
+
+// User fetches the authenticated user from a context if existing.
+// will return nil if the request was not authenticated
+func User(ctx context.Context) user.Info {
+	val := ctx.Value(userKey)
+	if val != nil {
+		return val.(user.Info)
+	}
+	return nil
+}
+
+// WithResourceFilter inserts the items a list request is limited to by authorization into the context
+func WithResourceFilter(ctx context.Context, filter *dataselect.ResourceFilter) context.Context {
+	return context.WithValue(ctx, resourceFilterKey, filter)
+}
+
+// ResourceFilter fetches the items a list request is limited to from a context if existing.
+// will return nil if the request is not limited
+func ResourceFilter(ctx context.Context) *dataselect.ResourceFilter {
+	val := ctx.Value(resourceFilterKey)
+	if val != nil {
+		return val.(*dataselect.ResourceFilter)
+	}
+	return nil
+}
@@ -17,6 +17,8 @@ package dataselect
 import (
 	"sort"
 	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // DataCell describes the interface of the data cell that contains all the necessary methods needed to perform
@@ -103,6 +105,22 @@ func (d *DataSelector) Filter() *DataSelector {
 	return d
 }
 
+// FilterResources removes the data the user is not authorized for as instructed by Query.ResourceFilter
+// and returns itself to allow method chaining. Data cells which are not objects are removed as well
+func (d *DataSelector) FilterResources() *DataSelector {
+	if d.Query.ResourceFilter == nil {
+		return d
+	}
+	filteredList := []DataCell{}
+	for _, c := range d.GenericDataList {
+		if obj, ok := c.(metav1.Object); ok && d.Query.ResourceFilter.Matches(obj) {
+			filteredList = append(filteredList, c)
+		}
+	}
+	d.GenericDataList = filteredList
+	return d
+}
+
 // Paginate the data inside as instructed by Query and returns itself to allow method chaining.
 func (d *DataSelector) Paginate() *DataSelector {
 	pQuery := d.Query.PaginationQuery
@@ -129,7 +147,7 @@ func GenericDataSelect(dataList []DataCell, dsQuery *Query) []DataCell {
 		GenericDataList: dataList,
 		Query:           dsQuery,
 	}
-	return SelectableData.Sort().Paginate().GenericDataList
+	return SelectableData.FilterResources().Sort().Paginate().GenericDataList
 }
 
 // GenericDataSelectWithFilter takes a list of GenericDataCells and Query and returns selected data as instructed by dsQuery.
@@ -138,8 +156,8 @@ func GenericDataSelectWithFilter(dataList []DataCell, dsQuery *Query) ([]DataCel
 		GenericDataList: dataList,
 		Query:           dsQuery,
 	}
-	// Pipeline is Filter -> Sort -> CollectMetrics -> Paginate
-	filtered := SelectableData.Filter()
+	// Pipeline is FilterResources -> Filter -> Sort -> CollectMetrics -> Paginate
+	filtered := SelectableData.FilterResources().Filter()
 	filteredTotal := len(filtered.GenericDataList)
 	processed := filtered.Sort().Paginate()
 	return processed.GenericDataList, filteredTotal
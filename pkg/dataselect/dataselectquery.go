@@ -39,6 +39,8 @@ type Query struct {
 	PaginationQuery *PaginationQuery
 	SortQuery       *SortQuery
 	FilterQuery     *FilterQuery
+	// ResourceFilter limits the items to the ones the user is authorized for, nil if not limited
+	ResourceFilter *ResourceFilter
 }
 
 // SortQuery holds options for sort functionality of data select.
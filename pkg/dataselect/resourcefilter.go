@@ -0,0 +1,40 @@
+package dataselect
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ResourceFilter items a list request is limited to by authorization,
+// i.e. the user may only see some objects by name or label selector.
+// An item is allowed if its name is one of Names or its labels match one of LabelSelectors
+type ResourceFilter struct {
+	Names          []string `json:"names,omitempty"`
+	LabelSelectors []string `json:"labelSelectors,omitempty"`
+}
+
+// Matches returns true if the object is allowed by the filter,
+// invalid label selectors do not match any object
+func (f *ResourceFilter) Matches(obj metav1.Object) bool {
+	if f == nil {
+		return true
+	}
+	if obj == nil {
+		return false
+	}
+	for _, name := range f.Names {
+		if name == obj.GetName() {
+			return true
+		}
+	}
+	for _, val := range f.LabelSelectors {
+		selector, err := labels.Parse(val)
+		if err != nil {
+			continue
+		}
+		if selector.Matches(labels.Set(obj.GetLabels())) {
+			return true
+		}
+	}
+	return false
+}
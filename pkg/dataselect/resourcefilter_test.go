@@ -0,0 +1,33 @@
+package dataselect
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResourceFilterMatches(t *testing.T) {
+	obj := &metav1.ObjectMeta{Name: "nginx", Labels: map[string]string{"team": "a", "env": "dev"}}
+	tests := []struct {
+		name   string
+		filter *ResourceFilter
+		obj    metav1.Object
+		want   bool
+	}{
+		{name: "no filter", obj: obj, want: true},
+		{name: "no object", filter: &ResourceFilter{Names: []string{"nginx"}}},
+		{name: "name", filter: &ResourceFilter{Names: []string{"redis", "nginx"}}, obj: obj, want: true},
+		{name: "other names", filter: &ResourceFilter{Names: []string{"redis"}}, obj: obj},
+		{name: "label selector", filter: &ResourceFilter{LabelSelectors: []string{"team=a,env in (dev,test)"}}, obj: obj, want: true},
+		{name: "other label selector", filter: &ResourceFilter{LabelSelectors: []string{"team=b"}}, obj: obj},
+		{name: "invalid label selector", filter: &ResourceFilter{LabelSelectors: []string{"team=="}}, obj: obj},
+		{name: "empty filter", filter: &ResourceFilter{}, obj: obj},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.filter.Matches(test.obj); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
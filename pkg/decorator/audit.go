@@ -2,7 +2,9 @@ package decorator
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
+	"net/http"
 	"time"
 
 	restful "github.com/emicklei/go-restful/v3"
@@ -10,6 +12,7 @@ import (
 	"gomod.alauda.cn/alauda-backend/pkg/httputil"
 	"gomod.alauda.cn/alauda-backend/pkg/server"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
 )
 
 // Audit audit decorator. Used to generate, process and record audit logs from request and response
@@ -22,22 +25,84 @@ func NewAudit(srv server.Server) Audit {
 	return Audit{Server: srv}
 }
 
-// DefaultFilter filter to record audit logs according to policy file
+// DefaultFilter filter to record audit logs according to policy file.
+// Besides ResponseComplete, events are generated for the stages the matched policy rule opts into:
+// RequestReceived before the request is handled, ResponseStarted when a long-running response
+// is flushed for the first time and Panic if the handler panics.
+// Stage jobs are only enqueued if the request matches a rule with the stage before it is handled,
+// the policy is matched again for each event as rules may match the response status code
 func (a Audit) DefaultFilter(req *restful.Request, res *restful.Response, chain *restful.FilterChain) {
 	mgr := a.GetAuditManager()
 	requestReceivedTimestamp := metav1.NewMicroTime(time.Now())
-	res.ResponseWriter = httputil.NewRespRecorderWriter(res.ResponseWriter)
+	recorder := httputil.NewRespRecorderWriter(res.ResponseWriter)
+	res.ResponseWriter = recorder
 	reqBody, _ := ioutil.ReadAll(req.Request.Body)
 	req.Request.Body = ioutil.NopCloser(bytes.NewBuffer(reqBody))
+
+	newJob := func(req *restful.Request, stage auditinternal.Stage) *DefaultAuditJob {
+		return &DefaultAuditJob{
+			mgr:                      mgr,
+			req:                      req,
+			res:                      res,
+			reqBody:                  &reqBody,
+			requestReceivedTimestamp: requestReceivedTimestamp,
+			stage:                    stage,
+		}
+	}
+	// events of stages before ResponseComplete are generated by the audit workers as well,
+	// thus their jobs use a copy of the request and a snapshot of the response,
+	// the handler may still read the original request and write the response
+	newStageJob := func(stage auditinternal.Stage) *DefaultAuditJob {
+		job := newJob(copyRequest(req, reqBody), stage)
+		job.snapshot = &responseSnapshot{
+			timestamp: metav1.NewMicroTime(time.Now()),
+		}
+		if stage != auditinternal.StageRequestReceived {
+			job.snapshot.statusCode = res.StatusCode()
+			job.snapshot.body = append([]byte(nil), recorder.Body.Bytes()...)
+		}
+		return job
+	}
+
+	// rules matching status codes do not match before the request is handled,
+	// their ResponseComplete events are matched by the audit workers
+	matched, rule := mgr.CheckIfRequestMatch(req.Request)
+	hasStage := func(stage auditinternal.Stage) bool {
+		return matched && rule.HasStage(stage)
+	}
+	if hasStage(auditinternal.StageRequestReceived) {
+		a.EnqueueAuditJob(newStageJob(auditinternal.StageRequestReceived))
+	}
+	if hasStage(auditinternal.StageResponseStarted) {
+		recorder.OnStreamStart(func() {
+			a.EnqueueAuditJob(newStageJob(auditinternal.StageResponseStarted))
+		})
+	}
+	if hasStage(auditinternal.StagePanic) {
+		defer func() {
+			if r := recover(); r != nil {
+				job := newStageJob(auditinternal.StagePanic)
+				job.responseStatus = &metav1.Status{
+					Status:  metav1.StatusFailure,
+					Code:    http.StatusInternalServerError,
+					Message: fmt.Sprintf("APIServer panic'd: %v", r),
+				}
+				a.EnqueueAuditJob(job)
+				panic(r)
+			}
+		}()
+	}
+
 	chain.ProcessFilter(req, res)
-	a.EnqueueAuditJob(&DefaultAuditJob{
-		mgr:                      mgr,
-		req:                      req,
-		res:                      res,
-		reqBody:                  &reqBody,
-		requestReceivedTimestamp: requestReceivedTimestamp,
-		handler:                  nil,
-	})
+	a.EnqueueAuditJob(newJob(req, auditinternal.StageResponseComplete))
+}
+
+// copyRequest copies a request with a new body reader, restful parameters are kept
+func copyRequest(req *restful.Request, body []byte) *restful.Request {
+	copied := *req
+	copied.Request = req.Request.Clone(req.Request.Context())
+	copied.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+	return &copied
 }
 
 // AuditHandler user defined handler used to fullfill audit event's fields
@@ -82,7 +147,8 @@ func (a Audit) NewBatchCustomFilter(generater AuditJobGenerater) restful.FilterF
 	}
 }
 
-// DefaultAuditJob default server.AuditJob implementation
+// DefaultAuditJob default server.AuditJob implementation,
+// it can be spilled to disk when the audit queue is full
 type DefaultAuditJob struct {
 	mgr                      audit.Manager
 	req                      *restful.Request
@@ -90,30 +156,97 @@ type DefaultAuditJob struct {
 	reqBody                  *[]byte
 	requestReceivedTimestamp metav1.MicroTime
 	handler                  interface{}
+
+	// stage of the event, ResponseComplete if empty
+	stage auditinternal.Stage
+	// snapshot of the response taken when the stage was reached, nil for ResponseComplete
+	snapshot *responseSnapshot
+	// responseStatus overrides the status of the response, e.g. for panics
+	responseStatus *metav1.Status
 }
 
-// Execute generate and record audit event
-func (aj *DefaultAuditJob) Execute() {
+// responseSnapshot the response of a request at a stage before ResponseComplete
+type responseSnapshot struct {
+	timestamp  metav1.MicroTime
+	statusCode int
+	body       []byte
+}
+
+var _ server.SpillableAuditJob = &DefaultAuditJob{}
+
+// Event generates the audit event of the job, nil if the request does not match the audit policy
+// or the matched rule omits the stage of the job
+func (aj *DefaultAuditJob) Event() *audit.Event {
+	handlerFunc, isCustomHandler := aj.handler.(AuditHandler)
+	var rule audit.PolicyRule
+	if !isCustomHandler {
+		var matched bool
+		matched, rule = aj.mgr.MatchRequest(aj.req.Request, aj.statusCode())
+		stage := aj.stage
+		if stage == "" {
+			stage = auditinternal.StageResponseComplete
+		}
+		if !matched || !rule.HasStage(stage) {
+			return nil
+		}
+	}
+
 	aj.req.Request.Body = ioutil.NopCloser(bytes.NewBuffer(*aj.reqBody))
-	recorder, ok := aj.res.ResponseWriter.(*httputil.ResponseRecorderWriter)
 	var resBodyBytes []byte
-	if ok {
-		resBodyBytes, _ = ioutil.ReadAll(recorder.Body)
-		recorder.Body = bytes.NewBuffer(resBodyBytes)
+	statusCode := 0
+	if aj.snapshot != nil {
+		resBodyBytes, statusCode = aj.snapshot.body, aj.snapshot.statusCode
+	} else {
+		if recorder, ok := aj.res.ResponseWriter.(*httputil.ResponseRecorderWriter); ok {
+			resBodyBytes, _ = ioutil.ReadAll(recorder.Body)
+			recorder.Body = bytes.NewBuffer(resBodyBytes)
+		}
+		statusCode = aj.res.StatusCode()
+	}
+	ae := aj.mgr.NewAuditEvent(aj.requestReceivedTimestamp, aj.req.Request, statusCode, bytes.NewBuffer(resBodyBytes))
+	if aj.snapshot != nil {
+		ae.StageTimestamp = aj.snapshot.timestamp
 	}
-	ae := aj.mgr.NewAuditEvent(aj.requestReceivedTimestamp, aj.req.Request, aj.res.StatusCode(), bytes.NewBuffer(resBodyBytes))
 	aj.mgr.ProcessUserInfo(ae, aj.req.Request)
+	switch aj.stage {
+	case "", auditinternal.StageResponseComplete:
+	case auditinternal.StageRequestReceived:
+		// the request was not handled yet
+		emptyResponse := make(map[string]interface{})
+		ae.Stage = aj.stage
+		ae.ResponseStatus = nil
+		ae.ResponseObject = &emptyResponse
+	default:
+		ae.Stage = aj.stage
+	}
+	if aj.responseStatus != nil {
+		ae.ResponseStatus = aj.responseStatus
+	}
 
-	handlerFunc, isCustomHandler := aj.handler.(AuditHandler)
 	if isCustomHandler {
 		handlerFunc(ae, aj.req, aj.res)
 	} else {
-		matched, rule := aj.mgr.CheckIfRequestMatch(aj.req.Request)
-		if !matched {
-			return
-		}
 		aj.mgr.ExecutePolicyRule(ae, rule, aj.req.Request)
 	}
+	return ae
+}
 
-	aj.mgr.Record(ae)
+// statusCode returns the response status code known at the stage of the job
+func (aj *DefaultAuditJob) statusCode() int {
+	switch {
+	case aj.stage == auditinternal.StageRequestReceived:
+		return 0
+	case aj.responseStatus != nil:
+		return int(aj.responseStatus.Code)
+	case aj.snapshot != nil:
+		return aj.snapshot.statusCode
+	}
+	return aj.res.StatusCode()
+}
+
+// Execute generate and record audit event
+func (aj *DefaultAuditJob) Execute() {
+	if ae := aj.Event(); ae != nil {
+		aj.mgr.Record(ae)
+	}
 }
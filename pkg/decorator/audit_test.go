@@ -0,0 +1,188 @@
+package decorator
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/go-restful/v3"
+	"gomod.alauda.cn/alauda-backend/pkg/audit"
+	"gomod.alauda.cn/alauda-backend/pkg/server"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+)
+
+// auditServer collects the enqueued audit jobs instead of executing them
+type auditServer struct {
+	server.Server
+	mgr  audit.Manager
+	jobs []server.AuditJob
+}
+
+func (s *auditServer) GetAuditManager() audit.Manager {
+	return s.mgr
+}
+
+func (s *auditServer) EnqueueAuditJob(job server.AuditJob) {
+	s.jobs = append(s.jobs, job)
+}
+
+// runAuditFilter runs the filter for the request and the handler, returns true if the handler panicked
+func runAuditFilter(filter restful.FilterFunction, req *http.Request, handler restful.RouteFunction) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+		}
+	}()
+	chain := &restful.FilterChain{Filters: []restful.FilterFunction{filter}, Target: handler}
+	chain.ProcessFilter(restful.NewRequest(req), restful.NewResponse(httptest.NewRecorder()))
+	return false
+}
+
+func TestAuditDefaultFilterStages(t *testing.T) {
+	respond := func(req *restful.Request, res *restful.Response) {
+		// the handler consumes the request body, events of all stages still include it
+		ioutil.ReadAll(req.Request.Body)
+		res.WriteHeaderAndJson(http.StatusCreated, map[string]interface{}{"name": "created"}, restful.MIME_JSON)
+	}
+	stream := func(req *restful.Request, res *restful.Response) {
+		res.WriteHeaderAndJson(http.StatusOK, map[string]interface{}{"name": "first"}, restful.MIME_JSON)
+		res.Flush()
+		res.Write([]byte(`{"name":"second"}`))
+	}
+	panics := func(req *restful.Request, res *restful.Response) {
+		panic("broken handler")
+	}
+
+	tests := []struct {
+		name        string
+		rule        audit.PolicyRule
+		handler     restful.RouteFunction
+		wantPanic   bool
+		wantJobs    int
+		wantStages  []auditinternal.Stage
+		wantCodes   []int32
+		wantObjects []map[string]interface{}
+	}{
+		{
+			name:        "response complete by default",
+			handler:     respond,
+			wantJobs:    1,
+			wantStages:  []auditinternal.Stage{auditinternal.StageResponseComplete},
+			wantCodes:   []int32{http.StatusCreated},
+			wantObjects: []map[string]interface{}{{"name": "created"}},
+		},
+		{
+			name:        "request received",
+			rule:        audit.PolicyRule{Stages: []auditinternal.Stage{auditinternal.StageRequestReceived}},
+			handler:     respond,
+			wantJobs:    2,
+			wantStages:  []auditinternal.Stage{auditinternal.StageRequestReceived, auditinternal.StageResponseComplete},
+			wantCodes:   []int32{0, http.StatusCreated},
+			wantObjects: []map[string]interface{}{{}, {"name": "created"}},
+		},
+		{
+			name:        "response started",
+			handler:     stream,
+			wantJobs:    2,
+			wantStages:  []auditinternal.Stage{auditinternal.StageResponseStarted, auditinternal.StageResponseComplete},
+			wantCodes:   []int32{http.StatusOK, http.StatusOK},
+			wantObjects: []map[string]interface{}{{"name": "first"}, {"name": "first"}},
+		},
+		{
+			name:        "omitted stage",
+			rule:        audit.PolicyRule{OmitStages: []auditinternal.Stage{auditinternal.StageResponseStarted}},
+			handler:     stream,
+			wantJobs:    1,
+			wantStages:  []auditinternal.Stage{auditinternal.StageResponseComplete},
+			wantCodes:   []int32{http.StatusOK},
+			wantObjects: []map[string]interface{}{{"name": "first"}},
+		},
+		{
+			name:        "panic",
+			rule:        audit.PolicyRule{Stages: []auditinternal.Stage{auditinternal.StagePanic}},
+			handler:     panics,
+			wantPanic:   true,
+			wantJobs:    1,
+			wantStages:  []auditinternal.Stage{auditinternal.StagePanic},
+			wantCodes:   []int32{http.StatusInternalServerError},
+			wantObjects: []map[string]interface{}{{}},
+		},
+		{
+			name:      "panic not opted into",
+			handler:   panics,
+			wantPanic: true,
+		},
+		{
+			name:        "status code matched after the response",
+			rule:        audit.PolicyRule{Stages: []auditinternal.Stage{auditinternal.StageRequestReceived}, Match: audit.RequestMatch{StatusCodes: []string{"2xx"}}},
+			handler:     respond,
+			wantJobs:    1,
+			wantStages:  []auditinternal.Stage{auditinternal.StageResponseComplete},
+			wantCodes:   []int32{http.StatusCreated},
+			wantObjects: []map[string]interface{}{{"name": "created"}},
+		},
+		{
+			name:     "not matched",
+			rule:     audit.PolicyRule{Stages: []auditinternal.Stage{auditinternal.StageRequestReceived}, Match: audit.RequestMatch{Path: "^/apis/v1/users$"}},
+			handler:  stream,
+			wantJobs: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule := test.rule
+			rule.Level = auditinternal.LevelRequestResponse
+			rule.Match.Methods = []string{"post"}
+			if rule.Match.Path == "" {
+				rule.Match.Path = "^/apis/v1/items$"
+			}
+			mgr := &audit.DefaultManager{}
+			mgr.SetPolicy(&audit.Policy{Rules: []audit.PolicyRule{rule}})
+			srv := &auditServer{Server: server.New("test"), mgr: mgr}
+
+			req := httptest.NewRequest("POST", "/apis/v1/items", strings.NewReader(`{"name":"requested"}`))
+			if panicked := runAuditFilter(NewAudit(srv).DefaultFilter, req, test.handler); panicked != test.wantPanic {
+				t.Fatalf("got panic %v, want %v", panicked, test.wantPanic)
+			}
+
+			// no jobs are enqueued for stages the request does not match
+			if len(srv.jobs) != test.wantJobs {
+				t.Errorf("got %d jobs, want %d", len(srv.jobs), test.wantJobs)
+			}
+			// events are generated once the handler returned, like by the audit workers
+			var (
+				stages  []auditinternal.Stage
+				codes   []int32
+				objects []map[string]interface{}
+			)
+			for _, job := range srv.jobs {
+				ev := job.(*DefaultAuditJob).Event()
+				if ev == nil {
+					continue
+				}
+				stages = append(stages, ev.Stage)
+				var code int32
+				if ev.ResponseStatus != nil {
+					code = ev.ResponseStatus.Code
+				}
+				codes = append(codes, code)
+				objects = append(objects, *ev.ResponseObject)
+				if want := map[string]interface{}{"name": "requested"}; !reflect.DeepEqual(*ev.RequestObject, want) {
+					t.Errorf("got request object %v of stage %s, want %v", *ev.RequestObject, ev.Stage, want)
+				}
+			}
+			if !reflect.DeepEqual(stages, test.wantStages) {
+				t.Fatalf("got stages %v, want %v", stages, test.wantStages)
+			}
+			if !reflect.DeepEqual(codes, test.wantCodes) {
+				t.Errorf("got status codes %v, want %v", codes, test.wantCodes)
+			}
+			if !reflect.DeepEqual(objects, test.wantObjects) {
+				t.Errorf("got response objects %v, want %v", objects, test.wantObjects)
+			}
+		})
+	}
+}
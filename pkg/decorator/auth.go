@@ -6,6 +6,7 @@ import (
 
 	"github.com/emicklei/go-restful/v3"
 	"gomod.alauda.cn/alauda-backend/pkg/auth"
+	"gomod.alauda.cn/alauda-backend/pkg/context"
 	"gomod.alauda.cn/alauda-backend/pkg/server"
 	"k8s.io/apimachinery/pkg/api/errors"
 )
@@ -18,38 +19,48 @@ func NewAuth(srv server.Server) Auth {
 	return Auth{Server: srv}
 }
 
+// AuthenticationFilter authenticates the request and inserts the authenticated user into the request context
 func (a Auth) AuthenticationFilter(req *restful.Request, res *restful.Response, chain *restful.FilterChain) {
-	err := a.GetAuthManager().Authenticate(req.Request.Context(), req.Request)
-	if err != nil {
-		switch t := err.(type) {
-		case errors.APIStatus:
-			code := int(t.Status().Code)
-			if code == 0 {
-				code = http.StatusInternalServerError
-			}
-			res.WriteHeader(code)
-			res.WriteAsJson(t)
-		default:
-			res.WriteError(http.StatusInternalServerError, err)
-		}
+	if err := a.authenticate(req); err != nil {
+		writeStatusError(res, err)
 		return
 	}
 	chain.ProcessFilter(req, res)
 }
 
+// authenticate resolves the user of the request once and inserts it into the request context,
+// requests already authenticated by a previous filter are not authenticated again
+func (a Auth) authenticate(req *restful.Request) error {
+	if context.User(req.Request.Context()) != nil {
+		return nil
+	}
+	info, err := a.GetAuthManager().Authenticate(req.Request.Context(), req.Request)
+	if err != nil {
+		return err
+	}
+	req.Request = req.Request.WithContext(context.WithUser(req.Request.Context(), info))
+	return nil
+}
+
+// AuthorizationFilter authorizes the authenticated user of the request, AuthenticationFilter must run before.
+// Requests which were not authenticated are unauthorized
 func (a Auth) AuthorizationFilter(opts ...auth.FilterOption) restful.FilterFunction {
 	return func(req *restful.Request, res *restful.Response, chain *restful.FilterChain) {
+		if context.User(req.Request.Context()) == nil {
+			res.WriteError(http.StatusUnauthorized, errors.NewUnauthorized("request is not authenticated"))
+			return
+		}
 		var opt *auth.FilterOption
 		if len(opts) > 0 {
 			opt = &opts[0]
 		}
-		verify, err := a.GetAuthManager().Authorize(req.Request.Context(), req.Request, opt)
+		verify, reason, err := a.authorize(req, opt)
 		if err != nil {
-			res.WriteError(http.StatusInternalServerError, err)
+			writeStatusError(res, err)
 			return
 		}
 		if !verify {
-			res.WriteError(http.StatusForbidden, fmt.Errorf("no permissions."))
+			res.WriteError(http.StatusForbidden, forbiddenError(reason))
 			return
 		}
 		chain.ProcessFilter(req, res)
@@ -58,8 +69,7 @@ func (a Auth) AuthorizationFilter(opts ...auth.FilterOption) restful.FilterFunct
 
 func (a Auth) AuthFilter(opts ...auth.FilterOption) restful.FilterFunction {
 	return func(req *restful.Request, res *restful.Response, chain *restful.FilterChain) {
-		err := a.GetAuthManager().Authenticate(req.Request.Context(), req.Request)
-		if err != nil {
+		if err := a.authenticate(req); err != nil {
 			res.WriteError(http.StatusUnauthorized, err)
 			return
 		}
@@ -67,15 +77,82 @@ func (a Auth) AuthFilter(opts ...auth.FilterOption) restful.FilterFunction {
 		if len(opts) > 0 {
 			opt = &opts[0]
 		}
-		verify, err := a.GetAuthManager().Authorize(req.Request.Context(), req.Request, opt)
+		verify, reason, err := a.authorize(req, opt)
 		if err != nil {
-			res.WriteError(http.StatusInternalServerError, err)
+			writeStatusError(res, err)
 			return
 		}
 		if !verify {
-			res.WriteError(http.StatusForbidden, fmt.Errorf("no permissions."))
+			res.WriteError(http.StatusForbidden, forbiddenError(reason))
 			return
 		}
 		chain.ProcessFilter(req, res)
 	}
 }
+
+// HandlerFilter authenticates and authorizes requests to plain http handlers, i.e. operational
+// endpoints like /metrics or /debug/pprof/ registered using Container().Handle.
+// Non-resource URLs are authorized using the nonResourceURLs rules of ClusterRoles
+func (a Auth) HandlerFilter(handler http.Handler, opts ...auth.FilterOption) http.Handler {
+	filter := a.AuthFilter(opts...)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := restful.NewRequest(r)
+		res := restful.NewResponse(w)
+		chain := &restful.FilterChain{
+			Filters: []restful.FilterFunction{filter},
+			Target: func(req *restful.Request, res *restful.Response) {
+				handler.ServeHTTP(res.ResponseWriter, req.Request)
+			},
+		}
+		chain.ProcessFilter(req, res)
+	})
+}
+
+// authorize asks the auth manager if the request is allowed,
+// including the reason of the decision if the manager is able to explain it.
+// The items allowed list requests are limited to on routes with FilterOption.FilteredList
+// are inserted into the request context for the Query filter, see context.ResourceFilter.
+// A query inserted by a Query filter running before is limited as well
+func (a Auth) authorize(req *restful.Request, opt *auth.FilterOption) (bool, string, error) {
+	mgr := a.GetAuthManager()
+	if authz, ok := mgr.(auth.FilteringAuthorizer); ok {
+		allowed, reason, filter, err := authz.AuthorizeWithFilter(req.Request.Context(), req.Request, opt)
+		if allowed && filter != nil {
+			ctx := context.WithResourceFilter(req.Request.Context(), filter)
+			if query := context.Query(ctx); query != nil {
+				scoped := *query
+				scoped.ResourceFilter = filter
+				ctx = context.WithQuery(ctx, &scoped)
+			}
+			req.Request = req.Request.WithContext(ctx)
+		}
+		return allowed, reason, err
+	}
+	if authz, ok := mgr.(auth.ReasonAuthorizer); ok {
+		return authz.AuthorizeWithReason(req.Request.Context(), req.Request, opt)
+	}
+	verify, err := mgr.Authorize(req.Request.Context(), req.Request, opt)
+	return verify, "", err
+}
+
+func forbiddenError(reason string) error {
+	if reason == "" {
+		return fmt.Errorf("no permissions.")
+	}
+	return fmt.Errorf("no permissions: %s", reason)
+}
+
+// writeStatusError writes api status errors using their status code, other errors as internal errors
+func writeStatusError(res *restful.Response, err error) {
+	switch t := err.(type) {
+	case errors.APIStatus:
+		code := int(t.Status().Code)
+		if code == 0 {
+			code = http.StatusInternalServerError
+		}
+		res.WriteHeader(code)
+		res.WriteAsJson(t)
+	default:
+		res.WriteError(http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,158 @@
+package decorator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/go-restful/v3"
+	"gomod.alauda.cn/alauda-backend/pkg/auth"
+	abcontext "gomod.alauda.cn/alauda-backend/pkg/context"
+	"gomod.alauda.cn/alauda-backend/pkg/dataselect"
+	"gomod.alauda.cn/alauda-backend/pkg/server"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// fakeAuthManager authenticates all requests as user and returns the configured decision
+type fakeAuthManager struct {
+	user           user.Info
+	authnErr       error
+	allowed        bool
+	reason         string
+	filter         *dataselect.ResourceFilter
+	authenticated  int
+	authorizedUser user.Info
+}
+
+var _ auth.FilteringAuthorizer = &fakeAuthManager{}
+
+func (m *fakeAuthManager) Authenticate(ctx context.Context, req *http.Request) (user.Info, error) {
+	m.authenticated++
+	return m.user, m.authnErr
+}
+
+func (m *fakeAuthManager) Authorize(ctx context.Context, req *http.Request, opt *auth.FilterOption) (bool, error) {
+	allowed, _, _, err := m.AuthorizeWithFilter(ctx, req, opt)
+	return allowed, err
+}
+
+func (m *fakeAuthManager) AuthorizeWithFilter(ctx context.Context, req *http.Request, opt *auth.FilterOption) (bool, string, *dataselect.ResourceFilter, error) {
+	m.authorizedUser = abcontext.User(req.Context())
+	return m.allowed, m.reason, m.filter, nil
+}
+
+// newAuthServer returns a server using the auth manager
+func newAuthServer(mgr auth.Manager) server.Server {
+	srv := server.New("test")
+	srv.SetAuthManager(mgr)
+	return srv
+}
+
+// runFilters runs the filters for the request and returns the response
+// and the request passed to the target, nil if the target was not reached
+func runFilters(req *http.Request, filters ...restful.FilterFunction) (*httptest.ResponseRecorder, *restful.Request) {
+	rec := httptest.NewRecorder()
+	var target *restful.Request
+	chain := &restful.FilterChain{
+		Filters: filters,
+		Target: func(req *restful.Request, res *restful.Response) {
+			target = req
+		},
+	}
+	chain.ProcessFilter(restful.NewRequest(req), restful.NewResponse(rec))
+	return rec, target
+}
+
+func TestAuthFilters(t *testing.T) {
+	alice := &user.DefaultInfo{Name: "alice@example.com", Groups: []string{"devs"}}
+	tests := []struct {
+		name     string
+		mgr      *fakeAuthManager
+		filters  func(a Auth) []restful.FilterFunction
+		ctxUser  user.Info
+		wantCode int
+		wantBody string
+	}{
+		{
+			name: "authenticated and authorized",
+			mgr:  &fakeAuthManager{user: alice, allowed: true},
+			filters: func(a Auth) []restful.FilterFunction {
+				return []restful.FilterFunction{a.AuthenticationFilter, a.AuthorizationFilter()}
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "authentication failure",
+			mgr:  &fakeAuthManager{authnErr: errors.NewUnauthorized("invalid bearer token"), allowed: true},
+			filters: func(a Auth) []restful.FilterFunction {
+				return []restful.FilterFunction{a.AuthenticationFilter, a.AuthorizationFilter()}
+			},
+			wantCode: http.StatusUnauthorized,
+			wantBody: "invalid bearer token",
+		},
+		{
+			name: "authorization without authentication",
+			mgr:  &fakeAuthManager{user: alice, allowed: true},
+			filters: func(a Auth) []restful.FilterFunction {
+				return []restful.FilterFunction{a.AuthorizationFilter()}
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "forbidden with reason",
+			mgr:  &fakeAuthManager{user: alice, reason: "no userbinding matched"},
+			filters: func(a Auth) []restful.FilterFunction {
+				return []restful.FilterFunction{a.AuthFilter()}
+			},
+			wantCode: http.StatusForbidden,
+			wantBody: "no permissions: no userbinding matched",
+		},
+		{
+			name: "already authenticated",
+			mgr:  &fakeAuthManager{authnErr: fmt.Errorf("must not authenticate again"), allowed: true},
+			filters: func(a Auth) []restful.FilterFunction {
+				return []restful.FilterFunction{a.AuthFilter()}
+			},
+			ctxUser:  alice,
+			wantCode: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := NewAuth(newAuthServer(test.mgr))
+			req := httptest.NewRequest("GET", "/apis/v1/users", nil)
+			if test.ctxUser != nil {
+				req = req.WithContext(abcontext.WithUser(req.Context(), test.ctxUser))
+			}
+			rec, target := runFilters(req, test.filters(a)...)
+			if rec.Code != test.wantCode {
+				t.Fatalf("got status %d with body %q, want %d", rec.Code, rec.Body.String(), test.wantCode)
+			}
+			if !strings.Contains(rec.Body.String(), test.wantBody) {
+				t.Errorf("got body %q, want it to contain %q", rec.Body.String(), test.wantBody)
+			}
+			if test.wantCode != http.StatusOK {
+				if target != nil {
+					t.Errorf("expected the request not to reach the target")
+				}
+				return
+			}
+			if target == nil {
+				t.Fatalf("expected the request to reach the target")
+			}
+			if got := abcontext.User(target.Request.Context()); got == nil || got.GetName() != alice.Name {
+				t.Errorf("got user %v in the request context, want %v", got, alice)
+			}
+			if test.mgr.authorizedUser == nil || test.mgr.authorizedUser.GetName() != alice.Name {
+				t.Errorf("got authorized user %v, want %v", test.mgr.authorizedUser, alice)
+			}
+			if test.ctxUser != nil && test.mgr.authenticated > 0 {
+				t.Errorf("expected the request not to be authenticated again")
+			}
+		})
+	}
+}
@@ -97,6 +97,14 @@ func (q Query) Filter(req *restful.Request, res *restful.Response, chain *restfu
 		// preventing the context to be empty with a standard NoFilter
 		query = dataselect.NoDataSelect
 	}
+	// limit the items to the ones the user is authorized for,
+	// authorization filters must run before this filter.
+	// The query is copied as it may be shared, e.g. dataselect.NoDataSelect
+	if filter := context.ResourceFilter(req.Request.Context()); filter != nil {
+		scoped := *query
+		scoped.ResourceFilter = filter
+		query = &scoped
+	}
 	req.Request = req.Request.WithContext(context.WithQuery(req.Request.Context(), query))
 	chain.ProcessFilter(req, res)
 }
@@ -0,0 +1,113 @@
+package decorator
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/emicklei/go-restful/v3"
+	"gomod.alauda.cn/alauda-backend/pkg/auth"
+	abcontext "gomod.alauda.cn/alauda-backend/pkg/context"
+	"gomod.alauda.cn/alauda-backend/pkg/dataselect"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// sharedQuery inserts dataselect.NoDataSelect into the request context like handlers
+// sharing a query do before the authorization filter runs
+func sharedQuery(req *restful.Request, res *restful.Response, chain *restful.FilterChain) {
+	req.Request = req.Request.WithContext(abcontext.WithQuery(req.Request.Context(), dataselect.NoDataSelect))
+	chain.ProcessFilter(req, res)
+}
+
+func TestQueryResourceFilter(t *testing.T) {
+	alice := &user.DefaultInfo{Name: "alice@example.com"}
+	limited := &dataselect.ResourceFilter{Names: []string{"a", "c"}}
+	items := []corev1.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "c"}},
+	}
+	q := NewQuery()
+	tests := []struct {
+		name       string
+		url        string
+		filter     *dataselect.ResourceFilter
+		filters    func(a Auth) []restful.FilterFunction
+		wantFilter *dataselect.ResourceFilter
+		wantItems  []string
+	}{
+		{
+			name:   "query after authorization",
+			url:    "/api/v1/configmaps",
+			filter: limited,
+			filters: func(a Auth) []restful.FilterFunction {
+				return []restful.FilterFunction{a.AuthFilter(auth.FilterOption{FilteredList: true}), q.Filter}
+			},
+			wantFilter: limited,
+			wantItems:  []string{"a", "c"},
+		},
+		{
+			name:   "query with pagination after authorization",
+			url:    "/api/v1/configmaps?itemsPerPage=1&page=2",
+			filter: limited,
+			filters: func(a Auth) []restful.FilterFunction {
+				return []restful.FilterFunction{a.AuthFilter(auth.FilterOption{FilteredList: true}), q.Filter}
+			},
+			wantFilter: limited,
+			wantItems:  []string{"c"},
+		},
+		{
+			name:   "shared query before authorization",
+			url:    "/api/v1/configmaps",
+			filter: limited,
+			filters: func(a Auth) []restful.FilterFunction {
+				return []restful.FilterFunction{sharedQuery, a.AuthFilter(auth.FilterOption{FilteredList: true})}
+			},
+			wantFilter: limited,
+			wantItems:  []string{"a", "c"},
+		},
+		{
+			name: "unlimited list",
+			url:  "/api/v1/configmaps",
+			filters: func(a Auth) []restful.FilterFunction {
+				return []restful.FilterFunction{sharedQuery, a.AuthFilter(auth.FilterOption{FilteredList: true}), q.Filter}
+			},
+			wantItems: []string{"a", "b", "c"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := NewAuth(newAuthServer(&fakeAuthManager{user: alice, allowed: true, filter: test.filter}))
+			rec, target := runFilters(httptest.NewRequest("GET", test.url, nil), test.filters(a)...)
+			if target == nil {
+				t.Fatalf("expected the request to reach the target, got status %d with body %q", rec.Code, rec.Body.String())
+			}
+			// regression: the shared query must never be limited to the items of a single request
+			if dataselect.NoDataSelect.ResourceFilter != nil {
+				dataselect.NoDataSelect.ResourceFilter = nil
+				t.Fatalf("the resource filter was set on the shared dataselect.NoDataSelect")
+			}
+
+			query := abcontext.Query(target.Request.Context())
+			if query == nil {
+				t.Fatalf("expected a query in the request context")
+			}
+			if query.ResourceFilter != test.wantFilter {
+				t.Errorf("got resource filter %+v, want %+v", query.ResourceFilter, test.wantFilter)
+			}
+			if got := abcontext.ResourceFilter(target.Request.Context()); got != test.wantFilter {
+				t.Errorf("got resource filter %+v in the context, want %+v", got, test.wantFilter)
+			}
+			result, _ := q.QueryItems(items, query)
+			names := []string{}
+			for _, obj := range result {
+				names = append(names, obj.GetName())
+			}
+			if !reflect.DeepEqual(names, test.wantItems) {
+				t.Errorf("got items %v, want %v", names, test.wantItems)
+			}
+		})
+	}
+}
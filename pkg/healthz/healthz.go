@@ -0,0 +1,164 @@
+package healthz
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// HealthChecker is a named health check
+type HealthChecker interface {
+	Name() string
+	Check(req *http.Request) error
+}
+
+// PingHealthz returns true automatically when checked
+var PingHealthz HealthChecker = ping{}
+
+// ping implements the simplest possible healthz checker.
+type ping struct{}
+
+func (ping) Name() string {
+	return "ping"
+}
+
+// Check is a health check that returns true.
+func (ping) Check(_ *http.Request) error {
+	return nil
+}
+
+// NamedCheck returns a healthz checker for the given name and function.
+func NamedCheck(name string, check func(r *http.Request) error) HealthChecker {
+	return &healthzCheck{name, check}
+}
+
+type healthzCheck struct {
+	name  string
+	check func(r *http.Request) error
+}
+
+func (c *healthzCheck) Name() string {
+	return c.name
+}
+
+func (c *healthzCheck) Check(r *http.Request) error {
+	return c.check(r)
+}
+
+// Mux is an interface describing the methods InstallPathHandler requires.
+type Mux interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// InstallPathHandler registers handlers for health checking on a specific path
+// and on a path for each check, i.e /healthz and /healthz/ping.
+// The checks are fetched on every request, so checks added after installation are also verified.
+func InstallPathHandler(mux Mux, path string, checks func() []HealthChecker) {
+	handler := NewHandler(path, checks)
+	mux.Handle(path, handler)
+	mux.Handle(path+"/", handler)
+}
+
+// NewHandler returns an http.Handler verifying all checks on the given path
+// and each single check on path/{name}.
+// The query parameter "verbose" prints the result of every check
+// and "exclude" can be used multiple times to skip checks by name
+func NewHandler(path string, checks func() []HealthChecker) http.Handler {
+	path = strings.TrimSuffix(path, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Trim(strings.TrimPrefix(r.URL.Path, path), "/")
+		if name != "" {
+			handleSingleCheck(w, r, name, checks())
+			return
+		}
+		handleRootCheck(w, r, path, checks())
+	})
+}
+
+func handleSingleCheck(w http.ResponseWriter, r *http.Request, name string, checks []HealthChecker) {
+	for _, check := range checks {
+		if check.Name() != name {
+			continue
+		}
+		if err := check.Check(r); err != nil {
+			http.Error(w, fmt.Sprintf("internal server error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writeOK(w)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func handleRootCheck(w http.ResponseWriter, r *http.Request, path string, checks []HealthChecker) {
+	excluded := sets.NewString()
+	for _, exclude := range r.URL.Query()["exclude"] {
+		excluded.Insert(strings.TrimSpace(exclude))
+	}
+
+	var (
+		failed  bool
+		verbose bytes.Buffer
+	)
+	for _, check := range checks {
+		if excluded.Has(check.Name()) {
+			excluded.Delete(check.Name())
+			fmt.Fprintf(&verbose, "[+]%s excluded: ok\n", check.Name())
+			continue
+		}
+		if err := check.Check(r); err != nil {
+			// don't include the error since this endpoint is public. If someone wants more detail
+			// they should have explicit permission to the detailed checks.
+			fmt.Fprintf(&verbose, "[-]%s failed: reason withheld\n", check.Name())
+			failed = true
+		} else {
+			fmt.Fprintf(&verbose, "[+]%s ok\n", check.Name())
+		}
+	}
+	if excluded.Len() > 0 {
+		fmt.Fprintf(&verbose, "warn: some health checks cannot be excluded: no matches for %s\n", formatQuoted(excluded.List()...))
+	}
+
+	if failed {
+		http.Error(w, fmt.Sprintf("%s%s check failed", verbose.String(), path), http.StatusInternalServerError)
+		return
+	}
+
+	if _, found := r.URL.Query()["verbose"]; !found {
+		writeOK(w)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	verbose.WriteTo(w)
+	fmt.Fprintf(w, "%s check passed\n", path)
+}
+
+func writeOK(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	fmt.Fprint(w, "ok")
+}
+
+// formatQuoted returns a formatted string of the health check names,
+// preserving the order passed in.
+func formatQuoted(names ...string) string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, fmt.Sprintf("%q", name))
+	}
+	return strings.Join(quoted, ",")
+}
+
+// InformerSyncCheck returns a healthz checker which fails until the informer has synced
+func InformerSyncCheck(name string, hasSynced func() bool) HealthChecker {
+	return NamedCheck(name, func(_ *http.Request) error {
+		if !hasSynced() {
+			return fmt.Errorf("informer %s not synced", name)
+		}
+		return nil
+	})
+}
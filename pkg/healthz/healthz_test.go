@@ -0,0 +1,107 @@
+package healthz
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	checks := func() []HealthChecker {
+		return []HealthChecker{
+			PingHealthz,
+			NamedCheck("failing", func(_ *http.Request) error { return fmt.Errorf("secret reason") }),
+		}
+	}
+	passing := func() []HealthChecker {
+		return []HealthChecker{PingHealthz}
+	}
+
+	tests := []struct {
+		name       string
+		checks     func() []HealthChecker
+		url        string
+		wantCode   int
+		wantBody   []string
+		unwantBody []string
+	}{
+		{
+			name:     "all checks pass",
+			checks:   passing,
+			url:      "/readyz",
+			wantCode: http.StatusOK,
+			wantBody: []string{"ok"},
+		},
+		{
+			name:       "failing check withholds the reason",
+			checks:     checks,
+			url:        "/readyz",
+			wantCode:   http.StatusInternalServerError,
+			wantBody:   []string{"[+]ping ok", "[-]failing failed: reason withheld", "/readyz check failed"},
+			unwantBody: []string{"secret reason"},
+		},
+		{
+			name:     "excluded check",
+			checks:   checks,
+			url:      "/readyz?exclude=failing&exclude=unknown&verbose",
+			wantCode: http.StatusOK,
+			wantBody: []string{"[+]failing excluded: ok", `no matches for "unknown"`, "/readyz check passed"},
+		},
+		{
+			name:     "single check",
+			checks:   checks,
+			url:      "/readyz/ping",
+			wantCode: http.StatusOK,
+			wantBody: []string{"ok"},
+		},
+		{
+			name:     "single failing check",
+			checks:   checks,
+			url:      "/readyz/failing",
+			wantCode: http.StatusInternalServerError,
+			wantBody: []string{"secret reason"},
+		},
+		{
+			name:     "unknown single check",
+			checks:   checks,
+			url:      "/readyz/unknown",
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			InstallPathHandler(mux, "/readyz", test.checks)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest("GET", test.url, nil))
+
+			if rec.Code != test.wantCode {
+				t.Errorf("got status %d, want %d", rec.Code, test.wantCode)
+			}
+			for _, want := range test.wantBody {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("got body %q, want it to contain %q", rec.Body.String(), want)
+				}
+			}
+			for _, unwant := range test.unwantBody {
+				if strings.Contains(rec.Body.String(), unwant) {
+					t.Errorf("got body %q, want it not to contain %q", rec.Body.String(), unwant)
+				}
+			}
+		})
+	}
+}
+
+func TestInformerSyncCheck(t *testing.T) {
+	synced := false
+	check := InformerSyncCheck("users", func() bool { return synced })
+	if err := check.Check(nil); err == nil {
+		t.Errorf("expected an error before the informer synced")
+	}
+	synced = true
+	if err := check.Check(nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -1,8 +1,12 @@
 package httputil
 
 import (
+	"bufio"
 	"bytes"
+	"fmt"
+	"net"
 	"net/http"
+	"sync"
 )
 
 // ResponseRecorderWriter is an implementation of http.ResponseWriter that
@@ -10,6 +14,9 @@ import (
 type ResponseRecorderWriter struct {
 	writer http.ResponseWriter
 	Body   *bytes.Buffer
+
+	onStreamStart     func()
+	streamStartedOnce sync.Once
 }
 
 // NewRespRecorderWriter returns an initialized ResponseRecorderWriter
@@ -37,3 +44,34 @@ func (w *ResponseRecorderWriter) Write(bytes []byte) (int, error) {
 func (w *ResponseRecorderWriter) WriteHeader(i int) {
 	w.writer.WriteHeader(i)
 }
+
+// OnStreamStart sets a function called once when the response is flushed or hijacked,
+// i.e. when a long-running response like a watch started streaming
+func (w *ResponseRecorderWriter) OnStreamStart(fn func()) {
+	w.onStreamStart = fn
+}
+
+// Flush implements http.Flusher if the real ResponseWriter does
+func (w *ResponseRecorderWriter) Flush() {
+	w.streamStarted()
+	if flusher, ok := w.writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the real ResponseWriter does
+func (w *ResponseRecorderWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.writer.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	w.streamStarted()
+	return hijacker.Hijack()
+}
+
+func (w *ResponseRecorderWriter) streamStarted() {
+	if w.onStreamStart == nil {
+		return
+	}
+	w.streamStartedOnce.Do(w.onStreamStart)
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gomod.alauda.cn/alauda-backend/pkg/audit"
+)
+
+const (
+	spillFilePrefix = "audit-spill-"
+	spillFileSuffix = ".json"
+)
+
+// SpillableAuditJob an audit job which can be spilled to disk when the audit queue is full
+// and the spill overflow policy is used. Jobs which are not spillable are dropped
+type SpillableAuditJob interface {
+	AuditJob
+	// Event returns the audit event the job would record, nil if no event is recorded
+	Event() *audit.Event
+}
+
+// recordAuditJob records an event restored from the spill files
+type recordAuditJob struct {
+	mgr   audit.Manager
+	event *audit.Event
+}
+
+// Execute records the event
+func (j *recordAuditJob) Execute() {
+	j.mgr.Record(j.event)
+}
+
+// auditSpill stores audit events in JSON lines files in a directory.
+// Events are appended to the current segment, segments are replayed oldest first
+// and removed once all their events are enqueued again.
+// Segments left by a previous process are replayed after start
+type auditSpill struct {
+	dir     string
+	maxSize int64
+
+	lock sync.Mutex
+	file *os.File
+	seq  int
+	size int64
+}
+
+// newAuditSpill creates the spill directory and accounts the segments already in it
+func newAuditSpill(dir string, maxSize int64) (*auditSpill, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit spill dir: %v", err)
+	}
+	sp := &auditSpill{dir: dir, maxSize: maxSize}
+	segments, err := sp.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range segments {
+		info, err := os.Stat(segment)
+		if err != nil {
+			return nil, err
+		}
+		sp.size += info.Size()
+		var seq int
+		fmt.Sscanf(strings.TrimPrefix(filepath.Base(segment), spillFilePrefix), "%d", &seq)
+		if seq >= sp.seq {
+			sp.seq = seq + 1
+		}
+	}
+	auditSpillBytes.Set(float64(sp.size))
+	return sp, nil
+}
+
+// Write appends the event to the current segment,
+// returns errSpillFull if the spill files exceed the max size
+func (sp *auditSpill) Write(ev *audit.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+	if sp.maxSize > 0 && sp.size+int64(len(data)) > sp.maxSize {
+		return errSpillFull
+	}
+	if sp.file == nil {
+		name := filepath.Join(sp.dir, fmt.Sprintf("%s%010d%s", spillFilePrefix, sp.seq, spillFileSuffix))
+		sp.file, err = os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+	}
+	n, err := sp.file.Write(data)
+	sp.size += int64(n)
+	auditSpillBytes.Set(float64(sp.size))
+	return err
+}
+
+// Pending returns true if events are waiting in the spill files
+func (sp *auditSpill) Pending() bool {
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+	return sp.size > 0
+}
+
+// Rotate closes the current segment so that it can be replayed,
+// returns all segments oldest first
+func (sp *auditSpill) Rotate() ([]string, error) {
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+	if sp.file != nil {
+		sp.file.Close()
+		sp.file = nil
+		sp.seq++
+	}
+	return sp.segments()
+}
+
+// Replay calls enqueue for each event of a closed segment and removes it.
+// If enqueue returns false replaying stops and the events not enqueued are kept in the segment
+func (sp *auditSpill) Replay(segment string, enqueue func(*audit.Event) bool) error {
+	file, err := os.Open(segment)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			ev := &audit.Event{}
+			if decodeErr := json.Unmarshal(line, ev); decodeErr == nil && !enqueue(ev) {
+				rest, _ := ioutil.ReadAll(reader)
+				return sp.truncate(segment, append(line, rest...))
+			}
+			sp.consumed(int64(len(line)))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return os.Remove(segment)
+}
+
+// Close closes the current segment, spilled events are kept for the next start
+func (sp *auditSpill) Close() error {
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+	if sp.file == nil {
+		return nil
+	}
+	err := sp.file.Close()
+	sp.file = nil
+	return err
+}
+
+// truncate replaces the content of a segment with the events not replayed
+func (sp *auditSpill) truncate(segment string, rest []byte) error {
+	tmp := segment + ".tmp"
+	if err := ioutil.WriteFile(tmp, rest, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, segment)
+}
+
+func (sp *auditSpill) consumed(size int64) {
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+	sp.size -= size
+	auditSpillBytes.Set(float64(sp.size))
+}
+
+// segments returns the closed segments oldest first, the current segment is excluded.
+// The caller must hold the lock
+func (sp *auditSpill) segments() ([]string, error) {
+	segments, err := filepath.Glob(filepath.Join(sp.dir, spillFilePrefix+"*"+spillFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	if sp.file != nil {
+		for i, segment := range segments {
+			if segment == sp.file.Name() {
+				segments = append(segments[:i], segments[i+1:]...)
+				break
+			}
+		}
+	}
+	sort.Strings(segments)
+	return segments, nil
+}
+
+var errSpillFull = fmt.Errorf("audit spill files exceed the max size")
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gomod.alauda.cn/alauda-backend/pkg/audit"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestAuditSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-spill")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sp, err := newAuditSpill(filepath.Join(dir, "spill"), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sp.Pending() {
+		t.Fatalf("expected no pending events in a new spill dir")
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		if err := sp.Write(&audit.Event{AuditID: types.UID(id)}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if !sp.Pending() {
+		t.Fatalf("expected pending events")
+	}
+	segments, err := sp.Rotate()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("got segments %v, want one", segments)
+	}
+	// events written after rotating go to a new segment which is not replayed yet
+	if err := sp.Write(&audit.Event{AuditID: "4"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// replaying stops once enqueueing fails, the rest is kept in the segment
+	var replayed []string
+	enqueue := func(limit int) func(*audit.Event) bool {
+		return func(ev *audit.Event) bool {
+			if len(replayed) >= limit {
+				return false
+			}
+			replayed = append(replayed, string(ev.AuditID))
+			return true
+		}
+	}
+	if err := sp.Replay(segments[0], enqueue(2)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"1", "2"}; !reflect.DeepEqual(replayed, want) {
+		t.Errorf("got replayed events %v, want %v", replayed, want)
+	}
+	if _, err := os.Stat(segments[0]); err != nil {
+		t.Errorf("expected the partially replayed segment to be kept: %v", err)
+	}
+
+	// segments left by a previous process are replayed after a restart
+	if err := sp.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sp, err = newAuditSpill(filepath.Join(dir, "spill"), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !sp.Pending() {
+		t.Fatalf("expected the events of the previous process to be pending")
+	}
+	segments, err = sp.Rotate()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("got segments %v, want two", segments)
+	}
+	replayed = nil
+	for _, segment := range segments {
+		if err := sp.Replay(segment, enqueue(10)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := os.Stat(segment); !os.IsNotExist(err) {
+			t.Errorf("expected the replayed segment %s to be removed", segment)
+		}
+	}
+	if want := []string{"3", "4"}; !reflect.DeepEqual(replayed, want) {
+		t.Errorf("got replayed events %v, want %v", replayed, want)
+	}
+	if sp.Pending() {
+		t.Errorf("expected no pending events after replaying all segments")
+	}
+}
+
+func TestAuditSpillMaxSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-spill")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ev := &audit.Event{AuditID: "event"}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// room for two JSON lines and a half
+	maxSize := int64(len(data)+1) * 5 / 2
+	sp, err := newAuditSpill(dir, maxSize)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sp.Close()
+	var written int
+	for i := 0; i < 10; i++ {
+		err := sp.Write(ev)
+		if err == errSpillFull {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		written++
+	}
+	if written != 2 {
+		t.Errorf("got %d events written, want 2", written)
+	}
+	if sp.size > maxSize {
+		t.Errorf("got %d bytes spilled, want at most %d", sp.size, maxSize)
+	}
+}
@@ -1,22 +1,32 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
+	"os"
 	"sync"
+	"time"
 
 	"gomod.alauda.cn/alauda-backend/pkg/auth"
 
 	"github.com/emicklei/go-restful/v3"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"gomod.alauda.cn/alauda-backend/pkg/audit"
 	"gomod.alauda.cn/alauda-backend/pkg/client"
+	"gomod.alauda.cn/alauda-backend/pkg/healthz"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
 const (
-	defaultWorkerNum = 15
-	defaultQueueSize = 1000
+	defaultWorkerNum       = 15
+	defaultQueueSize       = 1000
+	defaultShutdownTimeout = 30 * time.Second
+	// auditSpillReplayInterval interval of checking for spilled audit events to enqueue again
+	auditSpillReplayInterval = time.Second
 )
 
 // AuditJob interface for generating and recording audit event
@@ -24,6 +34,37 @@ type AuditJob interface {
 	Execute()
 }
 
+// AuditOverflowPolicy decides what happens to audit jobs when the audit queue is full
+type AuditOverflowPolicy string
+
+const (
+	// AuditOverflowBlock blocks the request until the queue has room for the job
+	AuditOverflowBlock AuditOverflowPolicy = "block"
+	// AuditOverflowDropNewest drops the job being enqueued
+	AuditOverflowDropNewest AuditOverflowPolicy = "drop-newest"
+	// AuditOverflowDropOldest drops the oldest queued job to make room for the job being enqueued
+	AuditOverflowDropOldest AuditOverflowPolicy = "drop-oldest"
+	// AuditOverflowSpill writes the event of the job to the spill dir on the background,
+	// spilled events are enqueued again once the queue has room.
+	// Jobs are dropped if spilling falls behind by more jobs than the queue size
+	AuditOverflowSpill AuditOverflowPolicy = "spill"
+)
+
+// Valid returns true if the overflow policy is known
+func (p AuditOverflowPolicy) Valid() bool {
+	switch p {
+	case AuditOverflowBlock, AuditOverflowDropNewest, AuditOverflowDropOldest, AuditOverflowSpill:
+		return true
+	}
+	return false
+}
+
+// queuedAuditJob an audit job and the time it was enqueued
+type queuedAuditJob struct {
+	job      AuditJob
+	enqueued time.Time
+}
+
 // DefaultServer default implementation for server
 type DefaultServer struct {
 	container        *restful.Container
@@ -39,7 +80,19 @@ type DefaultServer struct {
 	auditWorkerNum   int
 	auditQueueSize   int
 	auditLock        *sync.RWMutex
-	auditQueue       chan AuditJob
+	auditQueue       chan queuedAuditJob
+	auditClosed      bool
+	auditClosing     chan struct{}
+	auditSending     sync.WaitGroup
+	auditWorkers     sync.WaitGroup
+	auditOverflow    AuditOverflowPolicy
+	auditSpillDir    string
+	auditSpillSize   int64
+	auditSpill       *auditSpill
+	auditSpillJobs   chan SpillableAuditJob
+	auditSpillWriter chan struct{}
+	auditSpillStop   chan struct{}
+	auditSpillDone   chan struct{}
 	authManager      auth.Manager
 	authLock         *sync.RWMutex
 
@@ -47,10 +100,41 @@ type DefaultServer struct {
 
 	store     map[string]interface{}
 	storeLock *sync.RWMutex
+
+	httpServers     []*http.Server
+	httpConfig      HTTPServerConfig
+	shutdownTimeout time.Duration
+	shutdownOnce    sync.Once
+	shutdownErr     error
+	shutdownDone    chan struct{}
+	unhealthy       error
+	shuttingDown    bool
+
+	preStartHooks    []namedHook
+	postStartHooks   []namedHook
+	preShutdownHooks []namedHook
+	lifecycleLock    *sync.RWMutex
+
+	healthzChecks []healthz.HealthChecker
+	livezChecks   []healthz.HealthChecker
+	readyzChecks  []healthz.HealthChecker
+	healthLock    *sync.RWMutex
+}
+
+// namedHook a lifecycle hook with a name used for logging
+type namedHook struct {
+	name string
+	hook HookFunc
 }
 
 var _ Server = &DefaultServer{}
 
+var _ Lifecycle = &DefaultServer{}
+
+var _ HealthChecks = &DefaultServer{}
+
+var _ HealthChecker = &DefaultServer{}
+
 // New initializes a new  default server
 func New(name string) Server {
 	logger, _ := zap.NewProduction()
@@ -69,7 +153,21 @@ func New(name string) Server {
 
 		store:     map[string]interface{}{},
 		storeLock: &sync.RWMutex{},
+
+		shutdownTimeout: defaultShutdownTimeout,
+		shutdownDone:    make(chan struct{}),
+		lifecycleLock:   &sync.RWMutex{},
+
+		healthLock: &sync.RWMutex{},
 	}
+	server.AddHealthChecks(
+		healthz.PingHealthz,
+		healthz.NamedCheck("server", func(_ *http.Request) error { return server.Healthy() }),
+	)
+	server.AddReadyzChecks(
+		healthz.NamedCheck("shutdown", server.checkShutdown),
+		healthz.NamedCheck("audit-queue", server.checkAuditQueue),
+	)
 	return server
 }
 
@@ -96,43 +194,362 @@ func (s *DefaultServer) Container() *restful.Container {
 	return s.container
 }
 
-// Start starts server
+// Start starts server and blocks until a SIGTERM or SIGINT is received,
+// then gracefully shuts the server down.
+// If the server fails to start or any listener stops with an error
+// the process exits with a non-zero code
 func (s *DefaultServer) Start() {
-	// start audit workers on the background
+	if err := s.Run(SetupSignalContext()); err != nil {
+		s.L().Error("server stopped with error", zap.Error(err))
+		os.Exit(1)
+	}
+}
+
+// Run starts the server and blocks until the given context is done, until any listener fails serving
+// or until Shutdown is called. In the first two cases the server is gracefully shutdown.
+// Returns the first fatal serve error if any
+func (s *DefaultServer) Run(ctx context.Context) error {
+	if err := s.runHooks(ctx, "pre-start", s.getHooks(&s.preStartHooks)); err != nil {
+		return err
+	}
+
+	if err := s.startAuditWorkers(); err != nil {
+		return err
+	}
+	serveErrCh, err := s.startHTTPServers()
+	if err != nil {
+		s.setUnhealthy(err)
+		s.shutdownWithTimeout()
+		return err
+	}
+
+	if err := s.runHooks(ctx, "post-start", s.getHooks(&s.postStartHooks)); err != nil {
+		s.setUnhealthy(err)
+		s.shutdownWithTimeout()
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		s.L().Info("shutting down server")
+		return s.shutdownWithTimeout()
+	case <-s.shutdownDone:
+		return s.shutdownErr
+	case err := <-serveErrCh:
+		s.setUnhealthy(err)
+		s.L().Error("http server failed, shutting down server", zap.Error(err))
+		if shutdownErr := s.shutdownWithTimeout(); shutdownErr != nil {
+			s.L().Error("failed to shutdown server", zap.Error(shutdownErr))
+		}
+		return err
+	}
+}
+
+// Healthy returns an error if the server is not able to serve requests
+func (s *DefaultServer) Healthy() error {
+	s.lifecycleLock.RLock()
+	defer s.lifecycleLock.RUnlock()
+	return s.unhealthy
+}
+
+// setUnhealthy marks the server as unhealthy keeping the first error
+func (s *DefaultServer) setUnhealthy(err error) {
+	s.lifecycleLock.Lock()
+	defer s.lifecycleLock.Unlock()
+	if s.unhealthy == nil {
+		s.unhealthy = err
+	}
+}
+
+// Shutdown gracefully shuts down the server. Pre-shutdown hooks are executed first,
+// then all listeners stop accepting new connections and in-flight requests are drained.
+// At last the audit queue is closed, pending audit jobs are finished and the audit backends are flushed.
+// Calling Shutdown more than once has no effect and returns the result of the first call
+func (s *DefaultServer) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		s.lifecycleLock.Lock()
+		s.shuttingDown = true
+		s.lifecycleLock.Unlock()
+
+		var errs []error
+		// all pre-shutdown hooks are executed even if some of them fail
+		for _, h := range s.getHooks(&s.preShutdownHooks) {
+			if err := s.runHooks(ctx, "pre-shutdown", []namedHook{h}); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		s.listenerLock.RLock()
+		servers := s.httpServers
+		s.listenerLock.RUnlock()
+		for _, srv := range servers {
+			if err := srv.Shutdown(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("failed to shutdown http server %q: %v", srv.Addr, err))
+			}
+		}
+
+		if err := s.stopAuditWorkers(ctx); err != nil {
+			errs = append(errs, err)
+		}
+		if mgr, ok := s.GetAuditManager().(audit.BackendManager); ok {
+			if err := mgr.Shutdown(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("failed to flush audit backends: %v", err))
+			}
+		}
+		s.shutdownErr = utilerrors.NewAggregate(errs)
+		close(s.shutdownDone)
+	})
+	return s.shutdownErr
+}
+
+func (s *DefaultServer) shutdownWithTimeout() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.GetShutdownTimeout())
+	defer cancel()
+	return s.Shutdown(ctx)
+}
+
+// startAuditWorkers start audit workers on the background,
+// with the spill overflow policy events are spilled and replayed on the background as well
+func (s *DefaultServer) startAuditWorkers() error {
+	s.auditLock.Lock()
+	defer s.auditLock.Unlock()
 	if s.auditWorkerNum <= 0 {
 		s.auditWorkerNum = defaultWorkerNum
 	}
 	if s.auditQueueSize <= 0 {
 		s.auditQueueSize = defaultQueueSize
 	}
-	queue := make(chan AuditJob, s.auditQueueSize)
+	if !s.auditOverflow.Valid() {
+		s.auditOverflow = AuditOverflowBlock
+	}
+	if s.auditOverflow == AuditOverflowSpill {
+		if s.auditSpillDir == "" {
+			return fmt.Errorf("audit spill dir is required by the spill overflow policy")
+		}
+		spill, err := newAuditSpill(s.auditSpillDir, s.auditSpillSize)
+		if err != nil {
+			return err
+		}
+		s.auditSpill = spill
+	}
+
+	queue := make(chan queuedAuditJob, s.auditQueueSize)
+	auditQueueCapacity.Set(float64(s.auditQueueSize))
+	auditWorkerCount.Set(float64(s.auditWorkerNum))
 	for i := 0; i < s.auditWorkerNum; i++ {
+		s.auditWorkers.Add(1)
 		go func() {
-			for {
-				job, ok := <-queue
-				// if queue is closed, stop the worker
-				if !ok {
-					return
-				}
-				job.Execute()
+			defer s.auditWorkers.Done()
+			// if queue is closed, stop the worker
+			for item := range queue {
+				auditQueueLength.Set(float64(len(queue)))
+				auditQueueWait.Observe(time.Since(item.enqueued).Seconds())
+				s.executeAuditJob(item.job)
 			}
 		}()
 	}
 	s.auditQueue = queue
+	s.auditClosing = make(chan struct{})
+
+	if s.auditSpill != nil {
+		s.auditSpillJobs = make(chan SpillableAuditJob, s.auditQueueSize)
+		s.auditSpillWriter = make(chan struct{})
+		go s.writeAuditSpill(s.auditSpillJobs, s.auditSpill, s.auditSpillWriter)
+		s.auditSpillStop = make(chan struct{})
+		s.auditSpillDone = make(chan struct{})
+		go s.replayAuditSpill(queue, s.auditSpill, s.auditSpillStop, s.auditSpillDone)
+	}
+	return nil
+}
+
+// executeAuditJob executes a job, a panicking job does not stop the worker
+func (s *DefaultServer) executeAuditJob(job AuditJob) {
+	auditWorkersBusy.Inc()
+	start := time.Now()
+	defer func() {
+		auditJobDuration.Observe(time.Since(start).Seconds())
+		auditWorkersBusy.Dec()
+		if r := recover(); r != nil {
+			s.L().Error("audit job panicked", zap.Any("panic", r))
+		}
+	}()
+	job.Execute()
+}
+
+// writeAuditSpill spills the jobs which overflowed the audit queue until jobs is closed,
+// their events are generated here instead of on the goroutines enqueuing the jobs
+func (s *DefaultServer) writeAuditSpill(jobs <-chan SpillableAuditJob, spill *auditSpill, done chan<- struct{}) {
+	defer close(done)
+	for job := range jobs {
+		s.spillAuditJob(job, spill)
+	}
+}
+
+// replayAuditSpill enqueues spilled events again until stop is closed
+func (s *DefaultServer) replayAuditSpill(queue chan<- queuedAuditJob, spill *auditSpill, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(auditSpillReplayInterval)
+	defer ticker.Stop()
+
+	enqueue := func(ev *audit.Event) bool {
+		mgr := s.GetAuditManager()
+		if mgr == nil {
+			return true
+		}
+		select {
+		case queue <- queuedAuditJob{job: &recordAuditJob{mgr: mgr, event: ev}, enqueued: time.Now()}:
+			auditQueueLength.Set(float64(len(queue)))
+			return true
+		case <-stop:
+			return false
+		}
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if !spill.Pending() {
+			continue
+		}
+		segments, err := spill.Rotate()
+		if err != nil {
+			s.L().Error("failed to list audit spill files", zap.Error(err))
+			continue
+		}
+		for _, segment := range segments {
+			if err := spill.Replay(segment, enqueue); err != nil {
+				s.L().Error("failed to replay audit spill file", zap.String("file", segment), zap.Error(err))
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// stopAuditWorkers stops replaying spilled events, closes the audit queue and waits for pending jobs
+// to be executed or for the context to be done. Jobs blocked on a full queue are discarded,
+// spilled events not replayed yet are kept on disk
+func (s *DefaultServer) stopAuditWorkers(ctx context.Context) error {
+	s.auditLock.Lock()
+	if s.auditQueue == nil || s.auditClosed {
+		s.auditLock.Unlock()
+		return nil
+	}
+	// jobs enqueued from now on are discarded
+	s.auditClosed = true
+	close(s.auditClosing)
+	queue, spillJobs := s.auditQueue, s.auditSpillJobs
+	stop, replayDone, spillWriterDone := s.auditSpillStop, s.auditSpillDone, s.auditSpillWriter
+	s.auditLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		if stop != nil {
+			close(stop)
+			<-replayDone
+		}
+		// the queue is closed once no job is being enqueued anymore
+		s.auditSending.Wait()
+		close(queue)
+		if spillJobs != nil {
+			close(spillJobs)
+		}
+		s.auditWorkers.Wait()
+		if spillWriterDone != nil {
+			<-spillWriterDone
+		}
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("audit workers did not finish %d pending jobs: %v", len(queue), ctx.Err())
+	}
+	if s.auditSpill != nil {
+		if closeErr := s.auditSpill.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close audit spill file: %v", closeErr)
+		}
+	}
+	return err
+}
+
+// startHTTPServers builds one http.Server for each listener and starts serving.
+// Listeners which were not provided are created before serving, thus errors like port conflicts
+// are returned directly. Errors returned while serving are sent to the returned channel
+func (s *DefaultServer) startHTTPServers() (<-chan error, error) {
+	s.listenerLock.Lock()
+	defer s.listenerLock.Unlock()
 
+	listeners := map[int]net.Listener{}
 	for port, listener := range s.listener {
 		if port <= 0 {
 			continue
 		}
-		if listener != nil {
-			// TODO: give options to enable a more complex server
-			// instead of using the default one
-			go http.Serve(listener, s.Container())
-		} else {
-			go http.ListenAndServe(fmt.Sprintf(":%d", port), s.Container())
+		if listener == nil {
+			var err error
+			if listener, err = net.Listen("tcp", fmt.Sprintf(":%d", port)); err != nil {
+				for _, ln := range listeners {
+					ln.Close()
+				}
+				return nil, fmt.Errorf("failed to listen on port %d: %v", port, err)
+			}
 		}
+		listeners[port] = listener
+	}
+
+	errCh := make(chan error, len(listeners))
+	for port, listener := range listeners {
+		srv := s.newHTTPServer(fmt.Sprintf(":%d", port))
+		s.httpServers = append(s.httpServers, srv)
+		go func(srv *http.Server, listener net.Listener) {
+			if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+				errCh <- fmt.Errorf("http server on %q stopped: %v", srv.Addr, err)
+			}
+		}(srv, listener)
 	}
-	select {}
+	return errCh, nil
+}
+
+// newHTTPServer builds a http.Server applying the HTTPServerConfig
+func (s *DefaultServer) newHTTPServer(addr string) *http.Server {
+	cfg := s.GetHTTPServerConfig()
+	var handler http.Handler = s.Container()
+	if cfg.EnableH2C {
+		handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: cfg.IdleTimeout})
+	}
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+	srv.SetKeepAlivesEnabled(!cfg.DisableKeepAlives)
+	return srv
+}
+
+var _ HTTPServerConfigSetter = &DefaultServer{}
+
+// SetHTTPServerConfig sets the configuration applied to every http.Server
+func (s *DefaultServer) SetHTTPServerConfig(cfg HTTPServerConfig) {
+	s.lifecycleLock.Lock()
+	defer s.lifecycleLock.Unlock()
+	s.httpConfig = cfg
+}
+
+// GetHTTPServerConfig gets the configuration applied to every http.Server
+func (s *DefaultServer) GetHTTPServerConfig() HTTPServerConfig {
+	s.lifecycleLock.RLock()
+	defer s.lifecycleLock.RUnlock()
+	return s.httpConfig
 }
 
 var _ ListenerSetter = &DefaultServer{}
@@ -232,9 +649,108 @@ func (s *DefaultServer) GetAuditWorkerNum() int {
 	return s.auditWorkerNum
 }
 
-// EnqueueAuditJob send an audit job into audit queue. if queue is full, this operation will block.
+// EnqueueAuditJob sends an audit job into the audit queue. If the queue is full the overflow policy applies,
+// only the block policy blocks the caller until the queue has room or the server is shutdown.
+// Jobs enqueued before the server started or after it is shutdown are discarded
 func (s *DefaultServer) EnqueueAuditJob(job AuditJob) {
-	s.auditQueue <- job
+	s.auditLock.RLock()
+	queue, closing, spillJobs, overflow := s.auditQueue, s.auditClosing, s.auditSpillJobs, s.auditOverflow
+	if queue == nil {
+		s.auditLock.RUnlock()
+		auditJobsDropped.WithLabelValues(dropReasonNotStarted).Inc()
+		s.L().Warn("audit queue is not started, discarding audit job")
+		return
+	}
+	if s.auditClosed {
+		s.auditLock.RUnlock()
+		auditJobsDropped.WithLabelValues(dropReasonClosed).Inc()
+		s.L().Warn("audit queue is closed, discarding audit job")
+		return
+	}
+	// the queue is not closed while jobs are being enqueued,
+	// the lock is not held while waiting for the queue thus shutdown is not blocked
+	s.auditSending.Add(1)
+	s.auditLock.RUnlock()
+	defer s.auditSending.Done()
+	defer func() {
+		auditQueueLength.Set(float64(len(queue)))
+	}()
+
+	item := queuedAuditJob{job: job, enqueued: time.Now()}
+	switch overflow {
+	case AuditOverflowDropNewest:
+		select {
+		case queue <- item:
+		default:
+			auditJobsDropped.WithLabelValues(dropReasonFull).Inc()
+		}
+	case AuditOverflowDropOldest:
+		for {
+			select {
+			case queue <- item:
+				return
+			case <-closing:
+				auditJobsDropped.WithLabelValues(dropReasonClosed).Inc()
+				return
+			default:
+			}
+			select {
+			case <-queue:
+				auditJobsDropped.WithLabelValues(dropReasonFull).Inc()
+			default:
+			}
+		}
+	case AuditOverflowSpill:
+		select {
+		case queue <- item:
+			return
+		default:
+		}
+		spillable, ok := job.(SpillableAuditJob)
+		if !ok {
+			auditJobsDropped.WithLabelValues(dropReasonUnspillable).Inc()
+			return
+		}
+		// the spill writer generates the event, thus the request is not delayed by it
+		select {
+		case spillJobs <- spillable:
+		default:
+			auditJobsDropped.WithLabelValues(dropReasonSpillBusy).Inc()
+		}
+	default:
+		select {
+		case queue <- item:
+		case <-closing:
+			auditJobsDropped.WithLabelValues(dropReasonClosed).Inc()
+			s.L().Warn("audit queue is closed, discarding audit job")
+		}
+	}
+}
+
+// spillAuditJob writes the event of a job to the spill files, a panicking job does not stop the spill writer
+func (s *DefaultServer) spillAuditJob(job SpillableAuditJob, spill *auditSpill) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.L().Error("audit job panicked", zap.Any("panic", r))
+		}
+	}()
+	ev := job.Event()
+	if ev == nil {
+		return
+	}
+	if redactor, ok := s.GetAuditManager().(audit.Redactor); ok {
+		redactor.Redact(ev)
+	}
+	if err := spill.Write(ev); err != nil {
+		if err == errSpillFull {
+			auditJobsDropped.WithLabelValues(dropReasonSpillFull).Inc()
+			return
+		}
+		auditJobsDropped.WithLabelValues(dropReasonSpillError).Inc()
+		s.L().Error("failed to spill audit event", zap.Error(err))
+		return
+	}
+	auditJobsSpilled.Inc()
 }
 
 // SetAuditQueueSize sets the capacity of audit queue on the server
@@ -251,6 +767,36 @@ func (s *DefaultServer) GetAuditQueueSize() int {
 	return s.auditQueueSize
 }
 
+// SetAuditOverflowPolicy sets the policy applied when the audit queue is full, block by default
+func (s *DefaultServer) SetAuditOverflowPolicy(policy AuditOverflowPolicy) {
+	s.auditLock.Lock()
+	defer s.auditLock.Unlock()
+	s.auditOverflow = policy
+}
+
+// GetAuditOverflowPolicy gets the policy applied when the audit queue is full
+func (s *DefaultServer) GetAuditOverflowPolicy() AuditOverflowPolicy {
+	s.auditLock.RLock()
+	defer s.auditLock.RUnlock()
+	return s.auditOverflow
+}
+
+// SetAuditSpill sets the directory audit events are spilled to with the spill overflow policy
+// and the maximum size of the spilled events in bytes, zero means unlimited
+func (s *DefaultServer) SetAuditSpill(dir string, maxSize int64) {
+	s.auditLock.Lock()
+	defer s.auditLock.Unlock()
+	s.auditSpillDir = dir
+	s.auditSpillSize = maxSize
+}
+
+// GetAuditSpill gets the audit spill directory and maximum size
+func (s *DefaultServer) GetAuditSpill() (string, int64) {
+	s.auditLock.RLock()
+	defer s.auditLock.RUnlock()
+	return s.auditSpillDir, s.auditSpillSize
+}
+
 // SetAuthManager sets a auth manager on the server
 func (s *DefaultServer) SetAuthManager(mgr auth.Manager) {
 	s.authLock.Lock()
@@ -264,3 +810,133 @@ func (s *DefaultServer) GetAuthManager() auth.Manager {
 	defer s.authLock.RUnlock()
 	return s.authManager
 }
+
+var _ ShutdownTimeoutSetter = &DefaultServer{}
+
+// SetShutdownTimeout sets the maximum duration to wait for the server to shutdown
+func (s *DefaultServer) SetShutdownTimeout(timeout time.Duration) {
+	s.lifecycleLock.Lock()
+	defer s.lifecycleLock.Unlock()
+	s.shutdownTimeout = timeout
+}
+
+// GetShutdownTimeout gets the maximum duration to wait for the server to shutdown
+func (s *DefaultServer) GetShutdownTimeout() time.Duration {
+	s.lifecycleLock.RLock()
+	defer s.lifecycleLock.RUnlock()
+	if s.shutdownTimeout <= 0 {
+		return defaultShutdownTimeout
+	}
+	return s.shutdownTimeout
+}
+
+// AddPreStartHook adds a hook executed before the server starts serving.
+// If any hook returns an error the server will not start
+func (s *DefaultServer) AddPreStartHook(name string, hook HookFunc) {
+	s.addHook(&s.preStartHooks, name, hook)
+}
+
+// AddPostStartHook adds a hook executed after the server started serving.
+// If any hook returns an error the server will be shutdown
+func (s *DefaultServer) AddPostStartHook(name string, hook HookFunc) {
+	s.addHook(&s.postStartHooks, name, hook)
+}
+
+// AddPreShutdownHook adds a hook executed before the server stops serving
+func (s *DefaultServer) AddPreShutdownHook(name string, hook HookFunc) {
+	s.addHook(&s.preShutdownHooks, name, hook)
+}
+
+func (s *DefaultServer) addHook(hooks *[]namedHook, name string, hook HookFunc) {
+	if hook == nil {
+		return
+	}
+	s.lifecycleLock.Lock()
+	defer s.lifecycleLock.Unlock()
+	*hooks = append(*hooks, namedHook{name: name, hook: hook})
+}
+
+func (s *DefaultServer) getHooks(hooks *[]namedHook) []namedHook {
+	s.lifecycleLock.RLock()
+	defer s.lifecycleLock.RUnlock()
+	return append([]namedHook{}, *hooks...)
+}
+
+// runHooks executes all hooks in the registration order
+// and returns on the first error
+func (s *DefaultServer) runHooks(ctx context.Context, phase string, hooks []namedHook) error {
+	for _, h := range hooks {
+		s.L().Debug("running lifecycle hook", zap.String("phase", phase), zap.String("hook", h.name))
+		if err := h.hook(ctx); err != nil {
+			return fmt.Errorf("%s hook %q failed: %v", phase, h.name, err)
+		}
+	}
+	return nil
+}
+
+// AddHealthChecks adds checks to /healthz, /livez and /readyz
+func (s *DefaultServer) AddHealthChecks(checks ...healthz.HealthChecker) {
+	s.healthLock.Lock()
+	defer s.healthLock.Unlock()
+	s.healthzChecks = append(s.healthzChecks, checks...)
+	s.livezChecks = append(s.livezChecks, checks...)
+	s.readyzChecks = append(s.readyzChecks, checks...)
+}
+
+// AddLivezChecks adds checks to /livez only
+func (s *DefaultServer) AddLivezChecks(checks ...healthz.HealthChecker) {
+	s.healthLock.Lock()
+	defer s.healthLock.Unlock()
+	s.livezChecks = append(s.livezChecks, checks...)
+}
+
+// AddReadyzChecks adds checks to /readyz only
+func (s *DefaultServer) AddReadyzChecks(checks ...healthz.HealthChecker) {
+	s.healthLock.Lock()
+	defer s.healthLock.Unlock()
+	s.readyzChecks = append(s.readyzChecks, checks...)
+}
+
+// HealthzChecks returns all checks for /healthz
+func (s *DefaultServer) HealthzChecks() []healthz.HealthChecker {
+	s.healthLock.RLock()
+	defer s.healthLock.RUnlock()
+	return append([]healthz.HealthChecker{}, s.healthzChecks...)
+}
+
+// LivezChecks returns all checks for /livez
+func (s *DefaultServer) LivezChecks() []healthz.HealthChecker {
+	s.healthLock.RLock()
+	defer s.healthLock.RUnlock()
+	return append([]healthz.HealthChecker{}, s.livezChecks...)
+}
+
+// ReadyzChecks returns all checks for /readyz
+func (s *DefaultServer) ReadyzChecks() []healthz.HealthChecker {
+	s.healthLock.RLock()
+	defer s.healthLock.RUnlock()
+	return append([]healthz.HealthChecker{}, s.readyzChecks...)
+}
+
+// checkShutdown fails once the server started shutting down
+func (s *DefaultServer) checkShutdown(_ *http.Request) error {
+	s.lifecycleLock.RLock()
+	defer s.lifecycleLock.RUnlock()
+	if s.shuttingDown {
+		return fmt.Errorf("server is shutting down")
+	}
+	return nil
+}
+
+// checkAuditQueue fails when the audit queue is saturated and requests are blocked by it
+func (s *DefaultServer) checkAuditQueue(_ *http.Request) error {
+	s.auditLock.RLock()
+	defer s.auditLock.RUnlock()
+	if s.auditOverflow != AuditOverflowBlock {
+		return nil
+	}
+	if s.auditQueue != nil && !s.auditClosed && len(s.auditQueue) >= cap(s.auditQueue) {
+		return fmt.Errorf("audit queue is full: %d/%d", len(s.auditQueue), cap(s.auditQueue))
+	}
+	return nil
+}
@@ -0,0 +1,477 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gomod.alauda.cn/alauda-backend/pkg/audit"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// newTestServer returns a DefaultServer serving on a random local port
+func newTestServer(t *testing.T) *DefaultServer {
+	s := New("test").(*DefaultServer)
+	s.SetLogger(zap.NewNop())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s.SetListener(listener, listener.Addr().(*net.TCPAddr).Port)
+	return s
+}
+
+// hookRecorder records the names of the executed hooks
+type hookRecorder struct {
+	lock  sync.Mutex
+	calls []string
+}
+
+func (r *hookRecorder) hook(name string, err error) HookFunc {
+	return func(ctx context.Context) error {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.calls = append(r.calls, name)
+		return err
+	}
+}
+
+func (r *hookRecorder) called() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string{}, r.calls...)
+}
+
+func TestRunHooks(t *testing.T) {
+	tests := []struct {
+		name         string
+		preStartErr  error
+		postStartErr error
+		wantErr      bool
+		wantCalls    []string
+	}{
+		{
+			name:      "hooks run in order until the context is done",
+			wantCalls: []string{"pre-start-1", "pre-start-2", "post-start", "pre-shutdown-1", "pre-shutdown-2"},
+		},
+		{
+			name:        "failing pre-start hook stops the start",
+			preStartErr: fmt.Errorf("failed"),
+			wantErr:     true,
+			wantCalls:   []string{"pre-start-1"},
+		},
+		{
+			name:         "failing post-start hook shuts the server down",
+			postStartErr: fmt.Errorf("failed"),
+			wantErr:      true,
+			wantCalls:    []string{"pre-start-1", "pre-start-2", "post-start", "pre-shutdown-1", "pre-shutdown-2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestServer(t)
+			recorder := &hookRecorder{}
+			s.AddPreStartHook("pre-start-1", recorder.hook("pre-start-1", test.preStartErr))
+			s.AddPreStartHook("pre-start-2", recorder.hook("pre-start-2", nil))
+			s.AddPostStartHook("post-start", recorder.hook("post-start", test.postStartErr))
+			s.AddPreShutdownHook("pre-shutdown-1", recorder.hook("pre-shutdown-1", nil))
+			s.AddPreShutdownHook("pre-shutdown-2", recorder.hook("pre-shutdown-2", nil))
+			s.AddPreShutdownHook("nil", nil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			err := s.Run(ctx)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %v", err, test.wantErr)
+			}
+			if got := recorder.called(); !reflect.DeepEqual(got, test.wantCalls) {
+				t.Errorf("got hook calls %v, want %v", got, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestShutdownOnce(t *testing.T) {
+	s := newTestServer(t)
+	recorder := &hookRecorder{}
+	// all pre-shutdown hooks run even if some of them fail
+	s.AddPreShutdownHook("pre-shutdown-1", recorder.hook("pre-shutdown-1", fmt.Errorf("failed")))
+	s.AddPreShutdownHook("pre-shutdown-2", recorder.hook("pre-shutdown-2", nil))
+	if err := s.startAuditWorkers(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	first := s.Shutdown(context.Background())
+	if first == nil {
+		t.Fatalf("expected the error of the pre-shutdown hook")
+	}
+	if second := s.Shutdown(context.Background()); second == nil || second.Error() != first.Error() {
+		t.Errorf("got error %v shutting down twice, want %v", second, first)
+	}
+	if got, want := recorder.called(), []string{"pre-shutdown-1", "pre-shutdown-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got hook calls %v, want %v", got, want)
+	}
+	if err := s.checkShutdown(nil); err == nil {
+		t.Errorf("expected the shutdown readiness check to fail")
+	}
+}
+
+// TestRunReturnsOnShutdown checks Run returns once another caller shut the server down
+func TestRunReturnsOnShutdown(t *testing.T) {
+	s := newTestServer(t)
+	started := make(chan struct{})
+	s.AddPostStartHook("started", func(ctx context.Context) error {
+		close(started)
+		return nil
+	})
+	done := make(chan error)
+	go func() {
+		done <- s.Run(context.Background())
+	}()
+	<-started
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run did not return after Shutdown")
+	}
+}
+
+// failingListener fails to accept connections
+type failingListener struct {
+	net.Listener
+}
+
+func (l failingListener) Accept() (net.Conn, error) {
+	return nil, fmt.Errorf("accept failed")
+}
+
+func TestRunServeErrors(t *testing.T) {
+	inUse, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer inUse.Close()
+
+	tests := []struct {
+		name  string
+		setup func(s *DefaultServer)
+	}{
+		{
+			name: "port in use",
+			setup: func(s *DefaultServer) {
+				WithPort(s, inUse.Addr().(*net.TCPAddr).Port)
+			},
+		},
+		{
+			name: "listener fails serving",
+			setup: func(s *DefaultServer) {
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatalf("failed to listen: %v", err)
+				}
+				s.SetListener(failingListener{Listener: listener}, listener.Addr().(*net.TCPAddr).Port)
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := New("test").(*DefaultServer)
+			s.SetLogger(zap.NewNop())
+			test.setup(s)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := s.Run(ctx); err == nil {
+				t.Errorf("expected an error")
+			}
+			if ctx.Err() != nil {
+				t.Errorf("Run returned only once the context was done")
+			}
+			if err := s.Healthy(); err == nil {
+				t.Errorf("expected the server to be unhealthy")
+			}
+		})
+	}
+}
+
+func TestNewHTTPServer(t *testing.T) {
+	s := New("test").(*DefaultServer)
+	s.SetHTTPServerConfig(HTTPServerConfig{
+		ReadTimeout:       time.Second,
+		ReadHeaderTimeout: 2 * time.Second,
+		WriteTimeout:      3 * time.Second,
+		IdleTimeout:       4 * time.Second,
+		MaxHeaderBytes:    1024,
+		EnableH2C:         true,
+	})
+	srv := s.newHTTPServer(":8080")
+	if srv.Addr != ":8080" || srv.ReadTimeout != time.Second || srv.ReadHeaderTimeout != 2*time.Second ||
+		srv.WriteTimeout != 3*time.Second || srv.IdleTimeout != 4*time.Second || srv.MaxHeaderBytes != 1024 {
+		t.Errorf("config was not applied to the http server: %+v", srv)
+	}
+	if srv.Handler == http.Handler(s.Container()) {
+		t.Errorf("expected the container to be wrapped by the h2c handler")
+	}
+}
+
+// jobRecorder records the IDs of the executed audit jobs and recorded events
+type jobRecorder struct {
+	lock sync.Mutex
+	ids  []string
+}
+
+func (r *jobRecorder) add(id string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.ids = append(r.ids, id)
+}
+
+func (r *jobRecorder) recorded() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	ids := append([]string{}, r.ids...)
+	sort.Strings(ids)
+	return ids
+}
+
+// testAuditJob a spillable audit job, execution blocks until release is closed
+type testAuditJob struct {
+	id       string
+	recorder *jobRecorder
+	started  chan struct{}
+	release  <-chan struct{}
+}
+
+func (j *testAuditJob) Execute() {
+	if j.started != nil {
+		close(j.started)
+	}
+	if j.release != nil {
+		<-j.release
+	}
+	j.recorder.add(j.id)
+}
+
+func (j *testAuditJob) Event() *audit.Event {
+	return &audit.Event{AuditID: types.UID(j.id)}
+}
+
+// recordingAuditManager records the IDs of the events replayed from the spill files
+type recordingAuditManager struct {
+	audit.Manager
+	recorder *jobRecorder
+}
+
+func (m *recordingAuditManager) Record(ev *audit.Event) error {
+	m.recorder.add(string(ev.AuditID))
+	return nil
+}
+
+func TestEnqueueAuditJobOverflow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-spill")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name        string
+		policy      AuditOverflowPolicy
+		unspillable bool
+		want        []string
+		wantBlocked bool
+	}{
+		{name: "block", policy: AuditOverflowBlock, want: []string{"1", "2", "3"}, wantBlocked: true},
+		{name: "unknown policy blocks", policy: "unknown", want: []string{"1", "2", "3"}, wantBlocked: true},
+		{name: "drop newest", policy: AuditOverflowDropNewest, want: []string{"1", "2"}},
+		{name: "drop oldest", policy: AuditOverflowDropOldest, want: []string{"1", "3"}},
+		{name: "spill", policy: AuditOverflowSpill, want: []string{"1", "2", "3"}},
+		{name: "unspillable job is dropped", policy: AuditOverflowSpill, unspillable: true, want: []string{"1", "2"}},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := &jobRecorder{}
+			s := New("test").(*DefaultServer)
+			s.SetLogger(zap.NewNop())
+			s.SetAuditManager(&recordingAuditManager{recorder: recorder})
+			s.SetAuditWorkerNum(1)
+			s.SetAuditQueueSize(1)
+			s.SetAuditOverflowPolicy(test.policy)
+			s.SetAuditSpill(filepath.Join(dir, fmt.Sprint(i)), 0)
+			if err := s.startAuditWorkers(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer s.stopAuditWorkers(context.Background())
+
+			// the first job keeps the only worker busy and the second one fills the queue
+			release := make(chan struct{})
+			started := make(chan struct{})
+			s.EnqueueAuditJob(&testAuditJob{id: "1", recorder: recorder, started: started, release: release})
+			select {
+			case <-started:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("the first job was not executed")
+			}
+			s.EnqueueAuditJob(&testAuditJob{id: "2", recorder: recorder})
+
+			var overflow AuditJob = &testAuditJob{id: "3", recorder: recorder}
+			if test.unspillable {
+				overflow = struct{ AuditJob }{overflow}
+			}
+			enqueued := make(chan struct{})
+			go func() {
+				defer close(enqueued)
+				s.EnqueueAuditJob(overflow)
+			}()
+			select {
+			case <-enqueued:
+				if test.wantBlocked {
+					t.Errorf("expected enqueueing to block while the queue is full")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if !test.wantBlocked {
+					t.Errorf("expected enqueueing not to block")
+				}
+				if err := s.checkAuditQueue(nil); err == nil {
+					t.Errorf("expected the readiness check to fail while requests are blocked")
+				}
+			}
+			close(release)
+			<-enqueued
+
+			// spilled events are replayed on the background
+			deadline := time.After(5 * time.Second)
+			for !reflect.DeepEqual(recorder.recorded(), test.want) {
+				select {
+				case <-deadline:
+					t.Fatalf("got jobs %v, want %v", recorder.recorded(), test.want)
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+		})
+	}
+
+	t.Run("spill dir required", func(t *testing.T) {
+		s := New("test").(*DefaultServer)
+		s.SetLogger(zap.NewNop())
+		s.SetAuditOverflowPolicy(AuditOverflowSpill)
+		if err := s.startAuditWorkers(); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+}
+
+// eventAuditJob a spillable job of a prepared event
+type eventAuditJob struct {
+	event *audit.Event
+}
+
+func (j *eventAuditJob) Execute() {}
+
+func (j *eventAuditJob) Event() *audit.Event {
+	return j.event
+}
+
+func TestSpillAuditJobRedacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-spill")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	spill, err := newAuditSpill(dir, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer spill.Close()
+
+	s := New("test").(*DefaultServer)
+	s.SetLogger(zap.NewNop())
+	s.SetAuditManager(&audit.DefaultManager{})
+	requestObject := map[string]interface{}{"username": "alice", "password": "secret"}
+	s.spillAuditJob(&eventAuditJob{event: &audit.Event{AuditID: "1", RequestObject: &requestObject}}, spill)
+
+	segments, err := spill.Rotate()
+	if err != nil || len(segments) != 1 {
+		t.Fatalf("got segments %v and error %v, want one segment", segments, err)
+	}
+	data, err := ioutil.ReadFile(segments[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// events are redacted before they are written to disk
+	if strings.Contains(string(data), "secret") || !strings.Contains(string(data), "alice") {
+		t.Errorf("got spilled event %s, want the password to be masked", data)
+	}
+}
+
+// TestShutdownWithBlockedAuditJobs checks jobs blocked on a full queue do not delay shutdown past its context
+func TestShutdownWithBlockedAuditJobs(t *testing.T) {
+	recorder := &jobRecorder{}
+	s := New("test").(*DefaultServer)
+	s.SetLogger(zap.NewNop())
+	s.SetAuditWorkerNum(1)
+	s.SetAuditQueueSize(1)
+	if err := s.startAuditWorkers(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the only worker is busy until the end of the test and the queue is full
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	s.EnqueueAuditJob(&testAuditJob{id: "1", recorder: recorder, started: started, release: release})
+	<-started
+	s.EnqueueAuditJob(&testAuditJob{id: "2", recorder: recorder})
+	enqueued := make(chan struct{})
+	go func() {
+		defer close(enqueued)
+		s.EnqueueAuditJob(&testAuditJob{id: "3", recorder: recorder})
+	}()
+	select {
+	case <-enqueued:
+		t.Fatalf("expected enqueueing to block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- s.Shutdown(ctx)
+	}()
+	select {
+	case err := <-shutdown:
+		if err == nil {
+			t.Errorf("expected an error for the pending audit jobs")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("shutdown did not return once its context was done")
+	}
+	select {
+	case <-enqueued:
+	case <-time.After(time.Second):
+		t.Fatalf("the blocked job was not discarded by shutdown")
+	}
+	// the readiness check and the audit manager are not blocked by the pending jobs
+	if err := s.checkAuditQueue(nil); err != nil {
+		t.Errorf("unexpected readiness error after shutdown: %v", err)
+	}
+}
@@ -1,7 +1,9 @@
 package server
 
 import (
+	"context"
 	"net"
+	"time"
 
 	"gomod.alauda.cn/alauda-backend/pkg/auth"
 
@@ -9,6 +11,7 @@ import (
 	"go.uber.org/zap"
 	"gomod.alauda.cn/alauda-backend/pkg/audit"
 	"gomod.alauda.cn/alauda-backend/pkg/client"
+	"gomod.alauda.cn/alauda-backend/pkg/healthz"
 )
 
 // Server interface for the server of this framework
@@ -30,6 +33,78 @@ type ListenerSetter interface {
 	SetListener(net.Listener, int)
 }
 
+// HTTPServerConfigSetter sets the configuration applied to every http.Server
+type HTTPServerConfigSetter interface {
+	SetHTTPServerConfig(HTTPServerConfig)
+}
+
+// HTTPServerConfig tuning parameters applied to every http.Server
+// started for the registered listeners
+type HTTPServerConfig struct {
+	// ReadTimeout is the maximum duration for reading the entire request, including the body.
+	// Zero means no timeout
+	ReadTimeout time.Duration
+	// ReadHeaderTimeout is the amount of time allowed to read request headers.
+	// If zero, the value of ReadTimeout is used
+	ReadHeaderTimeout time.Duration
+	// WriteTimeout is the maximum duration before timing out writes of the response.
+	// Zero means no timeout
+	WriteTimeout time.Duration
+	// IdleTimeout is the maximum amount of time to wait for the next request when keep-alives are enabled.
+	// If zero, the value of ReadTimeout is used
+	IdleTimeout time.Duration
+	// MaxHeaderBytes controls the maximum number of bytes the server will read parsing the request header.
+	// If zero, http.DefaultMaxHeaderBytes is used
+	MaxHeaderBytes int
+	// DisableKeepAlives disables HTTP keep-alives
+	DisableKeepAlives bool
+	// EnableH2C enables HTTP/2 over cleartext TCP
+	EnableH2C bool
+}
+
+// ShutdownTimeoutSetter sets the maximum duration to wait for a graceful shutdown
+type ShutdownTimeoutSetter interface {
+	SetShutdownTimeout(time.Duration)
+}
+
+// Lifecycle interface to run and gracefully stop the server,
+// optional for implementations of Server, i.e. implemented by DefaultServer
+type Lifecycle interface {
+	Run(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+	LifecycleHooks
+}
+
+// LifecycleHooks interface to register hooks executed during the server lifecycle
+type LifecycleHooks interface {
+	AddPreStartHook(name string, hook HookFunc)
+	AddPostStartHook(name string, hook HookFunc)
+	AddPreShutdownHook(name string, hook HookFunc)
+}
+
+// HealthChecker interface to check if the server is healthy
+type HealthChecker interface {
+	Healthy() error
+}
+
+// HealthChecks interface to register health checks exposed on the /healthz, /livez and /readyz endpoints,
+// optional for implementations of Server, i.e. implemented by DefaultServer
+type HealthChecks interface {
+	// AddHealthChecks adds checks to /healthz, /livez and /readyz
+	AddHealthChecks(checks ...healthz.HealthChecker)
+	// AddLivezChecks adds checks to /livez only
+	AddLivezChecks(checks ...healthz.HealthChecker)
+	// AddReadyzChecks adds checks to /readyz only
+	AddReadyzChecks(checks ...healthz.HealthChecker)
+
+	HealthzChecks() []healthz.HealthChecker
+	LivezChecks() []healthz.HealthChecker
+	ReadyzChecks() []healthz.HealthChecker
+}
+
+// HookFunc function executed during the server lifecycle
+type HookFunc func(ctx context.Context) error
+
 // PathPrefixSetter sets a path prefix
 type PathPrefixSetter interface {
 	SetPathPrefix(string)
@@ -100,6 +175,10 @@ type AuditWorker interface {
 	GetAuditWorkerNum() int
 	SetAuditQueueSize(int)
 	GetAuditQueueSize() int
+	SetAuditOverflowPolicy(AuditOverflowPolicy)
+	GetAuditOverflowPolicy() AuditOverflowPolicy
+	SetAuditSpill(dir string, maxSize int64)
+	GetAuditSpill() (string, int64)
 	EnqueueAuditJob(AuditJob)
 }
 
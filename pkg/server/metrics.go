@@ -0,0 +1,88 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// reasons audit jobs are dropped
+	dropReasonFull        = "full"
+	dropReasonClosed      = "closed"
+	dropReasonNotStarted  = "not_started"
+	dropReasonUnspillable = "unspillable"
+	dropReasonSpillFull   = "spill_full"
+	dropReasonSpillBusy   = "spill_busy"
+	dropReasonSpillError  = "spill_error"
+)
+
+var (
+	auditQueueLength = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "audit_queue_length",
+			Help: "Number of audit jobs waiting in the audit queue.",
+		},
+	)
+	auditQueueCapacity = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "audit_queue_capacity",
+			Help: "Capacity of the audit queue.",
+		},
+	)
+	auditJobsDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "audit_jobs_dropped_total",
+			Help: "Counter of audit jobs dropped broken out for each reason.",
+		},
+		[]string{"reason"},
+	)
+	auditJobsSpilled = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "audit_jobs_spilled_total",
+			Help: "Counter of audit events spilled to disk because the audit queue was full.",
+		},
+	)
+	auditSpillBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "audit_spill_bytes",
+			Help: "Size of the audit events spilled to disk waiting to be recorded.",
+		},
+	)
+	auditQueueWait = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "audit_queue_wait_duration_seconds",
+			Help:    "Time audit jobs waited in the audit queue.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+		},
+	)
+	auditJobDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "audit_job_duration_seconds",
+			Help:    "Time audit workers spent executing audit jobs.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+		},
+	)
+	auditWorkerCount = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "audit_workers",
+			Help: "Number of audit workers.",
+		},
+	)
+	auditWorkersBusy = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "audit_workers_busy",
+			Help: "Number of audit workers executing an audit job.",
+		},
+	)
+
+	registerMetricsOnce sync.Once
+)
+
+// RegisterMetrics registers audit queue metrics on the default prometheus registry
+func RegisterMetrics() {
+	registerMetricsOnce.Do(func() {
+		prometheus.MustRegister(auditQueueLength, auditQueueCapacity, auditJobsDropped, auditJobsSpilled,
+			auditSpillBytes, auditQueueWait, auditJobDuration, auditWorkerCount, auditWorkersBusy)
+	})
+}
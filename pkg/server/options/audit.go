@@ -2,12 +2,16 @@ package options
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"gomod.alauda.cn/alauda-backend/pkg/audit"
+	"gomod.alauda.cn/alauda-backend/pkg/auth/request"
 	"gomod.alauda.cn/alauda-backend/pkg/server"
+	"gomod.alauda.cn/log"
 )
 
 const (
@@ -17,6 +21,22 @@ const (
 	flagAuditPolicyFile   = "audit-policy-file"
 	flagAuditWorkerNum    = "audit-worker-num"
 	flagAuditQueueSize    = "audit-queue-size"
+
+	flagAuditQueueOverflowPolicy = "audit-queue-overflow-policy"
+	flagAuditSpillDir            = "audit-spill-dir"
+	flagAuditSpillMaxSize        = "audit-spill-maxsize"
+
+	flagAuditLogBufferSize = "audit-log-buffer-size"
+	flagAuditLogDropPolicy = "audit-log-drop-policy"
+
+	flagAuditWebhookURL            = "audit-webhook-url"
+	flagAuditWebhookTimeout        = "audit-webhook-timeout"
+	flagAuditWebhookMaxRetries     = "audit-webhook-max-retries"
+	flagAuditWebhookInitialBackoff = "audit-webhook-initial-backoff"
+	flagAuditWebhookBatchMaxSize   = "audit-webhook-batch-max-size"
+	flagAuditWebhookBatchMaxWait   = "audit-webhook-batch-max-wait"
+	flagAuditWebhookBufferSize     = "audit-webhook-buffer-size"
+	flagAuditWebhookDropPolicy     = "audit-webhook-drop-policy"
 )
 
 const (
@@ -26,6 +46,22 @@ const (
 	configAuditPolicyFile   = "audit.policy_file"
 	configAuditWorkerNum    = "audit.worker_num"
 	configAuditQueueSize    = "audit.queue_size"
+
+	configAuditQueueOverflowPolicy = "audit.queue_overflow_policy"
+	configAuditSpillDir            = "audit.spill_dir"
+	configAuditSpillMaxSize        = "audit.spill_maxsize"
+
+	configAuditLogBufferSize = "audit.log_buffer_size"
+	configAuditLogDropPolicy = "audit.log_drop_policy"
+
+	configAuditWebhookURL            = "audit.webhook_url"
+	configAuditWebhookTimeout        = "audit.webhook_timeout"
+	configAuditWebhookMaxRetries     = "audit.webhook_max_retries"
+	configAuditWebhookInitialBackoff = "audit.webhook_initial_backoff"
+	configAuditWebhookBatchMaxSize   = "audit.webhook_batch_max_size"
+	configAuditWebhookBatchMaxWait   = "audit.webhook_batch_max_wait"
+	configAuditWebhookBufferSize     = "audit.webhook_buffer_size"
+	configAuditWebhookDropPolicy     = "audit.webhook_drop_policy"
 )
 
 // AuditOptions holds the options for audit configuration.
@@ -43,9 +79,32 @@ type AuditOptions struct {
 	WorkerNum int
 	// The size of audit queue(cache)
 	QueueSize int
+	// What happens to audit jobs when the audit queue is full: block, drop-newest, drop-oldest or spill.
+	QueueOverflowPolicy string
+	// Directory audit events are spilled to with the spill overflow policy.
+	SpillDir string
+	// The maximum size in megabytes of the spilled audit events, 0 means unlimited.
+	SpillMaxSize int
+	// LogBuffer buffer and drop policy of the audit log
+	LogBuffer audit.BufferConfig
+
+	// If set, audit events are also posted in batches to this URL.
+	WebhookURL string
+	// Webhook request timeout, retries and backoff
+	Webhook audit.WebhookConfig
+	// WebhookBuffer buffer, batching and drop policy of the webhook
+	WebhookBuffer audit.BufferConfig
+
+	// Backends additional audit backends events are sent to, e.g. an audit.StreamBackend
+	// sending events to Kafka. Backends which are not an audit.BufferedBackend are buffered with the defaults
+	Backends []audit.Backend
+	// RequestInfoResolver resolves the request info matched by verbs, resources and scopes of audit policy rules,
+	// audit.DefaultRequestInfoResolver if nil
+	RequestInfoResolver request.RequestInfoResolver
 }
 
 var _ Optioner = &ClientOptions{}
+var _ Reloadable = &AuditOptions{}
 
 // NewAuditOptions creates the default AuditOptions object.
 func NewAuditOptions() *AuditOptions {
@@ -55,6 +114,24 @@ func NewAuditOptions() *AuditOptions {
 		PolicyFile:   "/etc/audit/policy.yaml",
 		WorkerNum:    15,
 		QueueSize:    1000,
+
+		QueueOverflowPolicy: string(server.AuditOverflowBlock),
+		SpillMaxSize:        100,
+		LogBuffer: audit.BufferConfig{
+			BufferSize: audit.DefaultBufferSize,
+			DropPolicy: audit.DropPolicyBlock,
+		},
+		Webhook: audit.WebhookConfig{
+			Timeout:        audit.DefaultWebhookTimeout,
+			MaxRetries:     3,
+			InitialBackoff: audit.DefaultWebhookInitialBackoff,
+		},
+		WebhookBuffer: audit.BufferConfig{
+			BufferSize:   10000,
+			MaxBatchSize: 400,
+			MaxBatchWait: 30 * time.Second,
+			DropPolicy:   audit.DropPolicyDropNewest,
+		},
 	}
 }
 
@@ -67,27 +144,81 @@ func (o *AuditOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.String(flagAuditLogPath, o.LogPath,
 		"If set, all requests coming to the apiserver will be "+
 			"logged to this file. '-' means standard out.")
-	_ = viper.BindPFlag(configAuditLogPath, fs.Lookup(flagAuditLogPath))
+	bindFlag(fs, configAuditLogPath, flagAuditLogPath)
 
 	fs.Int(flagAuditLogMaxSize, o.LogMaxSize,
 		"The maximum size in megabytes of the audit log file before it gets rotated.")
-	_ = viper.BindPFlag(configAuditLogMaxSize, fs.Lookup(flagAuditLogMaxSize))
+	bindFlag(fs, configAuditLogMaxSize, flagAuditLogMaxSize)
 
 	fs.Int(flagAuditLogMaxBackup, o.LogMaxBackup,
 		"The maximum number of old audit log files to retain.")
-	_ = viper.BindPFlag(configAuditLogMaxBackup, fs.Lookup(flagAuditLogMaxBackup))
+	bindFlag(fs, configAuditLogMaxBackup, flagAuditLogMaxBackup)
 
 	fs.String(flagAuditPolicyFile, o.PolicyFile,
 		"Path to the file that defines the audit policy configuration.")
-	_ = viper.BindPFlag(configAuditPolicyFile, fs.Lookup(flagAuditPolicyFile))
+	bindFlag(fs, configAuditPolicyFile, flagAuditPolicyFile)
 
 	fs.Int(flagAuditWorkerNum, o.WorkerNum,
 		"The number of audit workers to record audit events.")
-	_ = viper.BindPFlag(configAuditWorkerNum, fs.Lookup(flagAuditWorkerNum))
+	bindFlag(fs, configAuditWorkerNum, flagAuditWorkerNum)
 
 	fs.Int(flagAuditQueueSize, o.QueueSize,
 		"The size of audit job queue.")
-	_ = viper.BindPFlag(configAuditQueueSize, fs.Lookup(flagAuditQueueSize))
+	bindFlag(fs, configAuditQueueSize, flagAuditQueueSize)
+
+	fs.String(flagAuditQueueOverflowPolicy, o.QueueOverflowPolicy,
+		"What happens to audit jobs when the audit job queue is full: block, drop-newest, drop-oldest or spill. "+
+			"block delays the response of requests until the queue has room, "+
+			"spill writes the audit events to "+flagAuditSpillDir+" and records them once the queue has room.")
+	bindFlag(fs, configAuditQueueOverflowPolicy, flagAuditQueueOverflowPolicy)
+
+	fs.String(flagAuditSpillDir, o.SpillDir,
+		"Directory audit events are spilled to when the audit job queue is full. Required by the spill overflow policy.")
+	bindFlag(fs, configAuditSpillDir, flagAuditSpillDir)
+
+	fs.Int(flagAuditSpillMaxSize, o.SpillMaxSize,
+		"The maximum size in megabytes of the spilled audit events, further events are dropped. 0 means unlimited.")
+	bindFlag(fs, configAuditSpillMaxSize, flagAuditSpillMaxSize)
+
+	fs.Int(flagAuditLogBufferSize, o.LogBuffer.BufferSize,
+		"The number of audit events buffered before writing them to the audit log.")
+	bindFlag(fs, configAuditLogBufferSize, flagAuditLogBufferSize)
+
+	fs.String(flagAuditLogDropPolicy, string(o.LogBuffer.DropPolicy),
+		"What happens to audit events when the audit log buffer is full: block, drop-newest or drop-oldest.")
+	bindFlag(fs, configAuditLogDropPolicy, flagAuditLogDropPolicy)
+
+	fs.String(flagAuditWebhookURL, o.WebhookURL,
+		"If set, audit events are also posted in batches to this URL.")
+	bindFlag(fs, configAuditWebhookURL, flagAuditWebhookURL)
+
+	fs.Duration(flagAuditWebhookTimeout, o.Webhook.Timeout,
+		"The timeout of audit webhook requests.")
+	bindFlag(fs, configAuditWebhookTimeout, flagAuditWebhookTimeout)
+
+	fs.Int(flagAuditWebhookMaxRetries, o.Webhook.MaxRetries,
+		"The number of retries of failed audit webhook requests.")
+	bindFlag(fs, configAuditWebhookMaxRetries, flagAuditWebhookMaxRetries)
+
+	fs.Duration(flagAuditWebhookInitialBackoff, o.Webhook.InitialBackoff,
+		"The time waited before retrying a failed audit webhook request, doubled after each retry.")
+	bindFlag(fs, configAuditWebhookInitialBackoff, flagAuditWebhookInitialBackoff)
+
+	fs.Int(flagAuditWebhookBatchMaxSize, o.WebhookBuffer.MaxBatchSize,
+		"The maximum number of audit events posted to the webhook at once.")
+	bindFlag(fs, configAuditWebhookBatchMaxSize, flagAuditWebhookBatchMaxSize)
+
+	fs.Duration(flagAuditWebhookBatchMaxWait, o.WebhookBuffer.MaxBatchWait,
+		"The time waited for a batch of audit events to fill up before posting it to the webhook.")
+	bindFlag(fs, configAuditWebhookBatchMaxWait, flagAuditWebhookBatchMaxWait)
+
+	fs.Int(flagAuditWebhookBufferSize, o.WebhookBuffer.BufferSize,
+		"The number of audit events buffered before posting them to the webhook.")
+	bindFlag(fs, configAuditWebhookBufferSize, flagAuditWebhookBufferSize)
+
+	fs.String(flagAuditWebhookDropPolicy, string(o.WebhookBuffer.DropPolicy),
+		"What happens to audit events when the audit webhook buffer is full: block, drop-newest or drop-oldest.")
+	bindFlag(fs, configAuditWebhookDropPolicy, flagAuditWebhookDropPolicy)
 }
 
 // ApplyFlags parsing parameters from the command line or configuration file
@@ -101,33 +232,145 @@ func (o *AuditOptions) ApplyFlags() []error {
 	o.PolicyFile = viper.GetString(configAuditPolicyFile)
 	o.WorkerNum = viper.GetInt(configAuditWorkerNum)
 	o.QueueSize = viper.GetInt(configAuditQueueSize)
+	o.QueueOverflowPolicy = viper.GetString(configAuditQueueOverflowPolicy)
+	o.SpillDir = viper.GetString(configAuditSpillDir)
+	o.SpillMaxSize = viper.GetInt(configAuditSpillMaxSize)
+	o.LogBuffer.BufferSize = viper.GetInt(configAuditLogBufferSize)
+	o.LogBuffer.DropPolicy = audit.DropPolicy(viper.GetString(configAuditLogDropPolicy))
+	o.WebhookURL = viper.GetString(configAuditWebhookURL)
+	o.Webhook.Timeout = viper.GetDuration(configAuditWebhookTimeout)
+	o.Webhook.MaxRetries = viper.GetInt(configAuditWebhookMaxRetries)
+	o.Webhook.InitialBackoff = viper.GetDuration(configAuditWebhookInitialBackoff)
+	o.WebhookBuffer.MaxBatchSize = viper.GetInt(configAuditWebhookBatchMaxSize)
+	o.WebhookBuffer.MaxBatchWait = viper.GetDuration(configAuditWebhookBatchMaxWait)
+	o.WebhookBuffer.BufferSize = viper.GetInt(configAuditWebhookBufferSize)
+	o.WebhookBuffer.DropPolicy = audit.DropPolicy(viper.GetString(configAuditWebhookDropPolicy))
 
 	if _, err := audit.LoadPolicyFromFile(o.PolicyFile); err != nil {
 		errs = append(errs, fmt.Errorf("audit policy file invalid: %v", err.Error()))
 	}
+	if !server.AuditOverflowPolicy(o.QueueOverflowPolicy).Valid() {
+		errs = append(errs, fmt.Errorf(flagAuditQueueOverflowPolicy+" must be block, drop-newest, drop-oldest or spill"))
+	}
+	if o.QueueOverflowPolicy == string(server.AuditOverflowSpill) && o.SpillDir == "" {
+		errs = append(errs, fmt.Errorf(flagAuditSpillDir+" must be set when the spill overflow policy is used"))
+	}
+	if o.SpillMaxSize < 0 {
+		errs = append(errs, fmt.Errorf(flagAuditSpillMaxSize+" must not be negative"))
+	}
+	if o.LogBuffer.BufferSize <= 0 {
+		errs = append(errs, fmt.Errorf(flagAuditLogBufferSize+" must be greater than 0"))
+	}
+	if !o.LogBuffer.DropPolicy.Valid() {
+		errs = append(errs, fmt.Errorf(flagAuditLogDropPolicy+" must be block, drop-newest or drop-oldest"))
+	}
+	if o.WebhookURL != "" {
+		if u, err := url.Parse(o.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			errs = append(errs, fmt.Errorf(flagAuditWebhookURL+" must be a http or https URL"))
+		}
+		if o.Webhook.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf(flagAuditWebhookTimeout+" must be greater than 0"))
+		}
+		if o.Webhook.MaxRetries < 0 {
+			errs = append(errs, fmt.Errorf(flagAuditWebhookMaxRetries+" must not be negative"))
+		}
+		if o.Webhook.InitialBackoff <= 0 {
+			errs = append(errs, fmt.Errorf(flagAuditWebhookInitialBackoff+" must be greater than 0"))
+		}
+		if o.WebhookBuffer.MaxBatchSize <= 0 {
+			errs = append(errs, fmt.Errorf(flagAuditWebhookBatchMaxSize+" must be greater than 0"))
+		}
+		if o.WebhookBuffer.MaxBatchWait < 0 {
+			errs = append(errs, fmt.Errorf(flagAuditWebhookBatchMaxWait+" must not be negative"))
+		}
+		if o.WebhookBuffer.BufferSize <= 0 {
+			errs = append(errs, fmt.Errorf(flagAuditWebhookBufferSize+" must be greater than 0"))
+		}
+		if !o.WebhookBuffer.DropPolicy.Valid() {
+			errs = append(errs, fmt.Errorf(flagAuditWebhookDropPolicy+" must be block, drop-newest or drop-oldest"))
+		}
+	}
 
 	return errs
 }
 
+// ApplyReloadFlags applies the audit policy file from the configuration.
+// Workers, queue and backends keep the values applied on start
+func (o *AuditOptions) ApplyReloadFlags(config *viper.Viper) []error {
+	if o == nil {
+		return nil
+	}
+	o.PolicyFile = config.GetString(configAuditPolicyFile)
+	if _, err := audit.LoadPolicyFromFile(o.PolicyFile); err != nil {
+		return []error{fmt.Errorf("audit policy file invalid: %v", err.Error())}
+	}
+	return nil
+}
+
 // ApplyToServer apply options to server
-func (o *AuditOptions) ApplyToServer(server server.Server) (err error) {
+func (o *AuditOptions) ApplyToServer(sv server.Server) (err error) {
 	if o == nil {
 		return
 	}
+	backends := append([]audit.Backend{}, o.Backends...)
+	if o.WebhookURL != "" {
+		webhook := o.Webhook
+		webhook.URL = o.WebhookURL
+		backend, err := audit.NewWebhookBackend(webhook)
+		if err != nil {
+			return err
+		}
+		backends = append(backends, audit.NewBufferedBackend(backend, o.WebhookBuffer))
+	}
+	audit.RegisterMetrics()
+	server.RegisterMetrics()
+
 	mgr := audit.NewManager(&audit.Config{
 		PolicyPath:    o.PolicyFile,
 		LogPath:       o.LogPath,
 		LogMaxSize:    o.LogMaxSize,
 		LogMaxBackups: o.LogMaxBackup,
+		LogBuffer:     o.LogBuffer,
+		Backends:      backends,
+
+		RequestInfoResolver: o.RequestInfoResolver,
 	})
 
-	server.SetAuditManager(mgr)
-	server.SetAuditWorkerNum(o.WorkerNum)
-	server.SetAuditQueueSize(o.QueueSize)
+	sv.SetAuditManager(mgr)
+	sv.SetAuditWorkerNum(o.WorkerNum)
+	sv.SetAuditQueueSize(o.QueueSize)
+	sv.SetAuditOverflowPolicy(server.AuditOverflowPolicy(o.QueueOverflowPolicy))
+	sv.SetAuditSpill(o.SpillDir, int64(o.SpillMaxSize)*1024*1024)
 
 	return
 }
 
+// WatchFiles returns the audit policy file
+func (o *AuditOptions) WatchFiles() []string {
+	if o == nil {
+		return nil
+	}
+	return []string{o.PolicyFile}
+}
+
+// Reload loads the audit policy file again and replaces the policy of the server's audit manager
+func (o *AuditOptions) Reload(server server.Server) (err error) {
+	if o == nil {
+		return
+	}
+	setter, ok := server.GetAuditManager().(audit.PolicySetter)
+	if !ok {
+		return
+	}
+	policy, err := audit.LoadPolicyFromFile(o.PolicyFile)
+	if err != nil {
+		return fmt.Errorf("audit policy file invalid: %v", err.Error())
+	}
+	setter.SetPolicy(policy)
+	server.L().Info("audit policy reloaded", log.String("file", o.PolicyFile), log.Int("rules", len(policy.Rules)))
+	return
+}
+
 func fileExists(filename string) bool {
 	info, err := os.Stat(filename)
 	if os.IsNotExist(err) {
@@ -1,48 +1,505 @@
 package options
 
 import (
-	"os"
-	"os/signal"
-	"syscall"
+	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"gomod.alauda.cn/alauda-backend/pkg/auth"
 	"gomod.alauda.cn/alauda-backend/pkg/auth/clusterrole"
+	"gomod.alauda.cn/alauda-backend/pkg/auth/project"
 	"gomod.alauda.cn/alauda-backend/pkg/auth/request"
+	"gomod.alauda.cn/alauda-backend/pkg/auth/review"
 	"gomod.alauda.cn/alauda-backend/pkg/auth/user"
 	"gomod.alauda.cn/alauda-backend/pkg/auth/userbinding"
+	"gomod.alauda.cn/alauda-backend/pkg/healthz"
 	"gomod.alauda.cn/alauda-backend/pkg/server"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
+const (
+	flagAuthenticationModes  = "authentication-modes"
+	flagOIDCIssuerURL        = "oidc-issuer-url"
+	flagOIDCClientID         = "oidc-client-id"
+	flagOIDCJWKSURL          = "oidc-jwks-url"
+	flagOIDCCAFile           = "oidc-ca-file"
+	flagOIDCUsernameClaim    = "oidc-username-claim"
+	flagOIDCGroupsClaim      = "oidc-groups-claim"
+	flagTokenReviewAudience  = "token-review-audiences"
+	flagErebusURL            = "erebus-url"
+	flagAuthnCacheTTL        = "authentication-cache-ttl"
+	flagAuthorizationModes   = "authorization-modes"
+	flagAuthorizationNoMatch = "authorization-no-match"
+	flagEnableAuthzDebug     = "enable-authz-debug"
+	flagAPIPrefixes          = "api-prefixes"
+	flagGrouplessAPIPrefixes = "groupless-api-prefixes"
+	flagRouteTemplates       = "route-templates"
+	flagAuthzCacheTTL        = "authorization-cache-ttl"
+	flagAuthzCacheSize       = "authorization-cache-size"
+	flagAuthKubeconfig       = "auth-kubeconfig"
+	flagUserBindingResync    = "userbinding-resync-period"
+	flagClusterRoleResync    = "clusterrole-resync-period"
+	flagUserResync           = "user-resync-period"
+	flagAuthClusterName      = "auth-cluster-name"
+	flagNamespaceResync      = "namespace-resync-period"
+	flagEnableAccessReview   = "enable-access-review"
+)
+
+const (
+	configAuthenticationModes  = "auth.authentication_modes"
+	configOIDCIssuerURL        = "auth.oidc_issuer_url"
+	configOIDCClientID         = "auth.oidc_client_id"
+	configOIDCJWKSURL          = "auth.oidc_jwks_url"
+	configOIDCCAFile           = "auth.oidc_ca_file"
+	configOIDCUsernameClaim    = "auth.oidc_username_claim"
+	configOIDCGroupsClaim      = "auth.oidc_groups_claim"
+	configTokenReviewAudience  = "auth.token_review_audiences"
+	configErebusURL            = "auth.erebus_url"
+	configAuthnCacheTTL        = "auth.authentication_cache_ttl"
+	configAuthorizationModes   = "auth.authorization_modes"
+	configAuthorizationNoMatch = "auth.authorization_no_match"
+	configEnableAuthzDebug     = "auth.enable_authz_debug"
+	configAPIPrefixes          = "auth.api_prefixes"
+	configGrouplessAPIPrefixes = "auth.groupless_api_prefixes"
+	configRouteTemplates       = "auth.route_templates"
+	configAuthzCacheTTL        = "auth.cache_ttl"
+	configAuthzCacheSize       = "auth.cache_size"
+	configAuthKubeconfig       = "auth.kubeconfig"
+	configUserBindingResync    = "auth.userbinding_resync_period"
+	configClusterRoleResync    = "auth.clusterrole_resync_period"
+	configUserResync           = "auth.user_resync_period"
+	configAuthClusterName      = "auth.cluster_name"
+	configNamespaceResync      = "auth.namespace_resync_period"
+	configEnableAccessReview   = "auth.enable_access_review"
+)
+
+const (
+	// AuthenticationModeOIDC verifies OIDC tokens using the issuer's keys
+	AuthenticationModeOIDC = "oidc"
+	// AuthenticationModeTokenReview verifies tokens using kubernetes TokenReview
+	AuthenticationModeTokenReview = "tokenreview"
+	// AuthenticationModeErebus verifies tokens probing the erebus proxy
+	AuthenticationModeErebus = "erebus"
+)
+
+var authenticationModes = sets.NewString(AuthenticationModeOIDC, AuthenticationModeTokenReview, AuthenticationModeErebus)
+
+const (
+	// AuthorizationModeUserBinding authorizes requests using UserBindings and ClusterRoles
+	AuthorizationModeUserBinding = "userbinding"
+	// AuthorizationModeSubjectAccessReview authorizes requests using kubernetes SubjectAccessReview
+	AuthorizationModeSubjectAccessReview = "subjectaccessreview"
+)
+
+var authorizationModes = sets.NewString(AuthorizationModeUserBinding, AuthorizationModeSubjectAccessReview)
+
 type AuthOptions struct {
+	// UserCacheExpire time authorization decisions are cached, zero disables the cache
 	UserCacheExpire time.Duration
-	APIPrefixes     []string
+	// CacheSize maximum number of cached authorization decisions
+	CacheSize int
+	// APIPrefixes first path segments of resource requests, e.g. platform
+	APIPrefixes []string
+	// GrouplessAPIPrefixes first path segments of resource requests for the core group
+	GrouplessAPIPrefixes []string
+	// RouteTemplates route templates scoping resource requests as level:template,
+	// e.g. namespace:projects/{project}/clusters/{cluster}/namespaces/{namespace}.
+	// request.DefaultRouteTemplates are used if not set
+	RouteTemplates  []string
 	SystemNamespace string
-	ErebusService   string //
+
+	// Kubeconfig kubeconfig file used to watch users, userbindings and clusterroles,
+	// the in-cluster configuration is used if not set
+	Kubeconfig string
+	// UserBindingResyncPeriod resync period of the userbindings informer
+	UserBindingResyncPeriod time.Duration
+	// ClusterRoleResyncPeriod resync period of the clusterroles informer
+	ClusterRoleResyncPeriod time.Duration
+	// UserResyncPeriod resync period of the users informer
+	UserResyncPeriod time.Duration
+	// ClusterName name of the cluster of the kubeconfig, the projects of its namespaces
+	// are resolved for project permissions and SubjectAccessReviews authorize requests to it.
+	// Empty disables resolving projects, it requires permission to list and watch namespaces
+	ClusterName string
+	// NamespaceResyncPeriod resync period of the namespaces informer
+	NamespaceResyncPeriod time.Duration
+
+	// RESTConfig configuration used instead of Kubeconfig if set, i.e. for envtest
+	RESTConfig *rest.Config
+	// DynamicClient client used by the resolvers if set instead of creating one
+	DynamicClient dynamic.Interface
+	// KubeClient client used by the tokenreview and subjectaccessreview modes if set instead of creating one
+	KubeClient kubernetes.Interface
+
+	// AuthenticationModes authenticators tried in order to authenticate requests
+	AuthenticationModes []string
+	// OIDC configuration for the oidc authentication mode
+	OIDC auth.OIDCConfig
+	// TokenReviewAudiences audiences tokens must be issued for in the tokenreview authentication mode
+	TokenReviewAudiences []string
+	// ErebusURL address of the erebus proxy for the erebus authentication mode
+	ErebusURL string
+	// AuthnCacheTTL time results of the tokenreview and erebus authentication modes are cached,
+	// zero disables the cache
+	AuthnCacheTTL time.Duration
+
+	// AuthorizationModes authorizers asked in order to authorize requests
+	AuthorizationModes []string
+	// AuthorizationNoMatch decision of an authorizer not allowing a request,
+	// no-opinion lets the next authorizer decide, deny stops the chain
+	AuthorizationNoMatch string
+	// EnableAuthzDebug serves /debug/authz explaining authorization decisions
+	EnableAuthzDebug bool
+	// EnableAccessReview serves the access review API under /auth/v1
+	EnableAccessReview bool
 }
 
 var _ Optioner = &AuthOptions{}
 
 func NewAuthOptions() *AuthOptions {
-	return &AuthOptions{}
+	return &AuthOptions{
+		AuthenticationModes: []string{AuthenticationModeErebus},
+		OIDC: auth.OIDCConfig{
+			UsernameClaim: auth.DefaultOIDCUsernameClaim,
+			GroupsClaim:   auth.DefaultOIDCGroupsClaim,
+		},
+		ErebusURL:            auth.DefaultErebusURL,
+		AuthnCacheTTL:        10 * time.Second,
+		AuthorizationModes:   []string{AuthorizationModeUserBinding},
+		AuthorizationNoMatch: auth.DecisionNoOpinion.String(),
+
+		UserCacheExpire:         time.Minute,
+		CacheSize:               auth.DefaultCacheSize,
+		APIPrefixes:             []string{"platform"},
+		UserBindingResyncPeriod: userbinding.DefaultResyncPeriod,
+		ClusterRoleResyncPeriod: clusterrole.DefaultResyncPeriod,
+		UserResyncPeriod:        user.DefaultResyncPeriod,
+		NamespaceResyncPeriod:   project.DefaultResyncPeriod,
+	}
 }
 
 // AddFlags adds flags related to audit for controller manager to the specified FlagSet.
 func (o *AuthOptions) AddFlags(fs *pflag.FlagSet) {
+	if o == nil {
+		return
+	}
+
+	fs.StringSlice(flagAuthenticationModes, o.AuthenticationModes,
+		"Ordered list of authenticators used to authenticate requests, the first succeeding wins. "+
+			"Supported: "+strings.Join(authenticationModes.List(), ", "))
+	bindFlag(fs, configAuthenticationModes, flagAuthenticationModes)
+
+	fs.String(flagOIDCIssuerURL, o.OIDC.IssuerURL,
+		"URL of the OIDC issuer, tokens must be issued by it. Required by the oidc authentication mode.")
+	bindFlag(fs, configOIDCIssuerURL, flagOIDCIssuerURL)
+
+	fs.String(flagOIDCClientID, o.OIDC.ClientID,
+		"Client id tokens must be issued for. Required by the oidc authentication mode.")
+	bindFlag(fs, configOIDCClientID, flagOIDCClientID)
+
+	fs.String(flagOIDCJWKSURL, o.OIDC.JWKSURL,
+		"URL of the OIDC issuer's JSON Web Key Set. If not set, the issuer's discovery document is used.")
+	bindFlag(fs, configOIDCJWKSURL, flagOIDCJWKSURL)
+
+	fs.String(flagOIDCCAFile, o.OIDC.CAFile,
+		"Certificate authority used to connect to the OIDC issuer. If not set, system certificates are used.")
+	bindFlag(fs, configOIDCCAFile, flagOIDCCAFile)
 
+	fs.String(flagOIDCUsernameClaim, o.OIDC.UsernameClaim,
+		"OIDC claim used as user name.")
+	bindFlag(fs, configOIDCUsernameClaim, flagOIDCUsernameClaim)
+
+	fs.String(flagOIDCGroupsClaim, o.OIDC.GroupsClaim,
+		"OIDC claim used as user groups.")
+	bindFlag(fs, configOIDCGroupsClaim, flagOIDCGroupsClaim)
+
+	fs.StringSlice(flagTokenReviewAudience, o.TokenReviewAudiences,
+		"Audiences tokens must be issued for in the tokenreview authentication mode. If not set, the apiserver's audiences are used.")
+	bindFlag(fs, configTokenReviewAudience, flagTokenReviewAudience)
+
+	fs.String(flagErebusURL, o.ErebusURL,
+		"Address of the erebus proxy used by the erebus authentication mode.")
+	bindFlag(fs, configErebusURL, flagErebusURL)
+
+	fs.Duration(flagAuthnCacheTTL, o.AuthnCacheTTL,
+		"Time results of the tokenreview and erebus authentication modes are cached by token. Zero disables the cache.")
+	bindFlag(fs, configAuthnCacheTTL, flagAuthnCacheTTL)
+
+	fs.StringSlice(flagAuthorizationModes, o.AuthorizationModes,
+		"Ordered list of authorizers used to authorize requests, the first allowing or denying decides. "+
+			"Service accounts are only authorized by the subjectaccessreview mode. "+
+			"Supported: "+strings.Join(authorizationModes.List(), ", "))
+	bindFlag(fs, configAuthorizationModes, flagAuthorizationModes)
+
+	fs.String(flagAuthorizationNoMatch, o.AuthorizationNoMatch,
+		"Decision of an authorizer which does not allow a request: no-opinion asks the next authorizer, deny rejects the request. "+
+			"Requests are rejected if no authorizer has an opinion.")
+	bindFlag(fs, configAuthorizationNoMatch, flagAuthorizationNoMatch)
+
+	fs.Bool(flagEnableAuthzDebug, o.EnableAuthzDebug,
+		"Enable explaining authorization decisions via web interface host:port/debug/authz?user=&verb=&resource=&project=&cluster=&namespace=")
+	bindFlag(fs, configEnableAuthzDebug, flagEnableAuthzDebug)
+
+	fs.Bool(flagEnableAccessReview, o.EnableAccessReview,
+		"Enable the access review API: POST /auth/v1/selfsubjectaccessreviews returns the verbs the caller may perform on resources, "+
+			"POST /auth/v1/resourceaccessreviews returns the users and groups allowed to perform a verb for platform administrators.")
+	bindFlag(fs, configEnableAccessReview, flagEnableAccessReview)
+
+	fs.StringSlice(flagAPIPrefixes, o.APIPrefixes,
+		"First path segments of resource requests, i.e. /{prefix}/{group}/{version}/... Other paths are non-resource requests.")
+	bindFlag(fs, configAPIPrefixes, flagAPIPrefixes)
+
+	fs.StringSlice(flagGrouplessAPIPrefixes, o.GrouplessAPIPrefixes,
+		"First path segments of resource requests for the core group, i.e. /{prefix}/{version}/...")
+	bindFlag(fs, configGrouplessAPIPrefixes, flagGrouplessAPIPrefixes)
+
+	fs.StringSlice(flagRouteTemplates, o.RouteTemplates,
+		"Route templates scoping resource requests tried in order as level:template, "+
+			"e.g. namespace:projects/{project}/clusters/{cluster}/namespaces/{namespace}. "+
+			"Supported variables: {project}, {cluster}, {namespace}. If not set, the default project, cluster and namespace routes are used.")
+	bindFlag(fs, configRouteTemplates, flagRouteTemplates)
+
+	fs.Duration(flagAuthzCacheTTL, o.UserCacheExpire,
+		"Time authorization decisions are cached. Zero disables the cache.")
+	bindFlag(fs, configAuthzCacheTTL, flagAuthzCacheTTL)
+
+	fs.Int(flagAuthzCacheSize, o.CacheSize,
+		"Maximum number of cached authorization decisions.")
+	bindFlag(fs, configAuthzCacheSize, flagAuthzCacheSize)
+
+	fs.String(flagAuthKubeconfig, o.Kubeconfig,
+		"Kubeconfig file used to watch users, userbindings and clusterroles and to review tokens and subject access. "+
+			"If not set, the in-cluster configuration is used.")
+	bindFlag(fs, configAuthKubeconfig, flagAuthKubeconfig)
+
+	fs.Duration(flagUserBindingResync, o.UserBindingResyncPeriod,
+		"Resync period of the userbindings informer.")
+	bindFlag(fs, configUserBindingResync, flagUserBindingResync)
+
+	fs.Duration(flagClusterRoleResync, o.ClusterRoleResyncPeriod,
+		"Resync period of the clusterroles informer.")
+	bindFlag(fs, configClusterRoleResync, flagClusterRoleResync)
+
+	fs.Duration(flagUserResync, o.UserResyncPeriod,
+		"Resync period of the users informer.")
+	bindFlag(fs, configUserResync, flagUserResync)
+
+	fs.String(flagAuthClusterName, o.ClusterName,
+		"Name of the cluster of the auth kubeconfig. Project permissions apply to the namespaces of the project in this cluster "+
+			"even if the project is not part of the route, and SubjectAccessReviews authorize requests routed to this cluster. "+
+			"Resolving projects requires permission to list and watch namespaces in this cluster. "+
+			"If empty, projects of namespaces are not resolved and SubjectAccessReviews only authorize requests without a cluster.")
+	bindFlag(fs, configAuthClusterName, flagAuthClusterName)
+
+	fs.Duration(flagNamespaceResync, o.NamespaceResyncPeriod,
+		"Resync period of the namespaces informer resolving projects.")
+	bindFlag(fs, configNamespaceResync, flagNamespaceResync)
 }
 
 // ApplyFlags parsing parameters from the command line or configuration file
 // to the options instance.
 func (o *AuthOptions) ApplyFlags() []error {
-	o.ErebusService = viper.GetString("KUBERNETES_SERVICE_HOST")
+	var errs []error
 
-	return nil
+	o.AuthenticationModes = viper.GetStringSlice(configAuthenticationModes)
+	o.OIDC.IssuerURL = viper.GetString(configOIDCIssuerURL)
+	o.OIDC.ClientID = viper.GetString(configOIDCClientID)
+	o.OIDC.JWKSURL = viper.GetString(configOIDCJWKSURL)
+	o.OIDC.CAFile = viper.GetString(configOIDCCAFile)
+	o.OIDC.UsernameClaim = viper.GetString(configOIDCUsernameClaim)
+	o.OIDC.GroupsClaim = viper.GetString(configOIDCGroupsClaim)
+	o.TokenReviewAudiences = viper.GetStringSlice(configTokenReviewAudience)
+	o.ErebusURL = viper.GetString(configErebusURL)
+	o.AuthnCacheTTL = viper.GetDuration(configAuthnCacheTTL)
+	o.AuthorizationModes = viper.GetStringSlice(configAuthorizationModes)
+	o.AuthorizationNoMatch = viper.GetString(configAuthorizationNoMatch)
+	o.EnableAuthzDebug = viper.GetBool(configEnableAuthzDebug)
+	o.EnableAccessReview = viper.GetBool(configEnableAccessReview)
+	o.APIPrefixes = viper.GetStringSlice(configAPIPrefixes)
+	o.GrouplessAPIPrefixes = viper.GetStringSlice(configGrouplessAPIPrefixes)
+	o.RouteTemplates = viper.GetStringSlice(configRouteTemplates)
+	o.UserCacheExpire = viper.GetDuration(configAuthzCacheTTL)
+	o.CacheSize = viper.GetInt(configAuthzCacheSize)
+	o.Kubeconfig = viper.GetString(configAuthKubeconfig)
+	o.UserBindingResyncPeriod = viper.GetDuration(configUserBindingResync)
+	o.ClusterRoleResyncPeriod = viper.GetDuration(configClusterRoleResync)
+	o.UserResyncPeriod = viper.GetDuration(configUserResync)
+	o.ClusterName = viper.GetString(configAuthClusterName)
+	o.NamespaceResyncPeriod = viper.GetDuration(configNamespaceResync)
+
+	if len(o.AuthenticationModes) == 0 {
+		errs = append(errs, fmt.Errorf(flagAuthenticationModes+" must not be empty"))
+	}
+	for _, mode := range o.AuthenticationModes {
+		if !authenticationModes.Has(mode) {
+			errs = append(errs, fmt.Errorf("unknown authentication mode %q, supported: %s", mode, strings.Join(authenticationModes.List(), ", ")))
+		}
+	}
+	if sets.NewString(o.AuthenticationModes...).Has(AuthenticationModeOIDC) {
+		if o.OIDC.IssuerURL == "" {
+			errs = append(errs, fmt.Errorf(flagOIDCIssuerURL+" must be set when the oidc authentication mode is enabled"))
+		}
+		if o.OIDC.ClientID == "" {
+			errs = append(errs, fmt.Errorf(flagOIDCClientID+" must be set when the oidc authentication mode is enabled"))
+		}
+	}
+
+	if o.AuthnCacheTTL < 0 {
+		errs = append(errs, fmt.Errorf(flagAuthnCacheTTL+" must not be negative"))
+	}
+
+	if len(o.AuthorizationModes) == 0 {
+		errs = append(errs, fmt.Errorf(flagAuthorizationModes+" must not be empty"))
+	}
+	for _, mode := range o.AuthorizationModes {
+		if !authorizationModes.Has(mode) {
+			errs = append(errs, fmt.Errorf("unknown authorization mode %q, supported: %s", mode, strings.Join(authorizationModes.List(), ", ")))
+		}
+	}
+	if decision, err := auth.ParseDecision(o.AuthorizationNoMatch); err != nil {
+		errs = append(errs, fmt.Errorf("invalid %s: %v", flagAuthorizationNoMatch, err))
+	} else if decision == auth.DecisionAllow {
+		errs = append(errs, fmt.Errorf(flagAuthorizationNoMatch+" must be no-opinion or deny"))
+	}
+
+	if len(o.APIPrefixes) == 0 && len(o.GrouplessAPIPrefixes) == 0 {
+		errs = append(errs, fmt.Errorf(flagAPIPrefixes+" or "+flagGrouplessAPIPrefixes+" must not be empty"))
+	}
+	if _, err := o.routeTemplates(); err != nil {
+		errs = append(errs, err)
+	}
+	if o.UserCacheExpire < 0 {
+		errs = append(errs, fmt.Errorf(flagAuthzCacheTTL+" must not be negative"))
+	}
+	if o.CacheSize <= 0 {
+		errs = append(errs, fmt.Errorf(flagAuthzCacheSize+" must be greater than zero"))
+	}
+	if o.UserBindingResyncPeriod <= 0 {
+		errs = append(errs, fmt.Errorf(flagUserBindingResync+" must be greater than zero"))
+	}
+	if o.ClusterRoleResyncPeriod <= 0 {
+		errs = append(errs, fmt.Errorf(flagClusterRoleResync+" must be greater than zero"))
+	}
+	if o.UserResyncPeriod <= 0 {
+		errs = append(errs, fmt.Errorf(flagUserResync+" must be greater than zero"))
+	}
+	if o.ClusterName != "" && o.NamespaceResyncPeriod <= 0 {
+		errs = append(errs, fmt.Errorf(flagNamespaceResync+" must be greater than zero"))
+	}
+	return errs
+}
+
+// routeTemplates parses the route templates, nil means the default templates
+func (o *AuthOptions) routeTemplates() ([]request.RouteTemplate, error) {
+	if len(o.RouteTemplates) == 0 {
+		return nil, nil
+	}
+	templates := make([]request.RouteTemplate, 0, len(o.RouteTemplates))
+	for _, val := range o.RouteTemplates {
+		items := strings.SplitN(val, ":", 2)
+		if len(items) != 2 || items[0] == "" {
+			return nil, fmt.Errorf("invalid %s %q, expected level:template", flagRouteTemplates, val)
+		}
+		template, err := request.NewRouteTemplate(items[0], items[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", flagRouteTemplates, err)
+		}
+		templates = append(templates, template)
+	}
+	return templates, nil
+}
+
+// clients returns the injected clients or creates them using the injected config,
+// the kubeconfig file or the in-cluster configuration
+func (o *AuthOptions) clients() (dynamic.Interface, kubernetes.Interface, error) {
+	if o.DynamicClient != nil && o.KubeClient != nil {
+		return o.DynamicClient, o.KubeClient, nil
+	}
+
+	config := o.RESTConfig
+	if config == nil {
+		var err error
+		if o.Kubeconfig != "" {
+			config, err = clientcmd.BuildConfigFromFlags("", o.Kubeconfig)
+		} else {
+			config, err = rest.InClusterConfig()
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load kubernetes config for auth: %v", err)
+		}
+	}
+
+	dynamicClient, kubeClient := o.DynamicClient, o.KubeClient
+	if dynamicClient == nil {
+		client, err := dynamic.NewForConfig(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		dynamicClient = client
+	}
+	if kubeClient == nil {
+		client, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		kubeClient = client
+	}
+	return dynamicClient, kubeClient, nil
+}
+
+// authorizer creates the authorizer chain according to the authorization modes
+func (o *AuthOptions) authorizer(mgr *auth.AuthManager, client kubernetes.Interface, requestInfoResolver request.RequestInfoResolver) (auth.Authorizer, error) {
+	noMatch, err := auth.ParseDecision(o.AuthorizationNoMatch)
+	if err != nil {
+		return nil, err
+	}
+	authorizers := make([]auth.Authorizer, 0, len(o.AuthorizationModes))
+	for _, mode := range o.AuthorizationModes {
+		switch mode {
+		case AuthorizationModeUserBinding:
+			authorizers = append(authorizers, mgr.UserBindingAuthorizer(noMatch))
+		case AuthorizationModeSubjectAccessReview:
+			authorizers = append(authorizers, auth.NewSubjectAccessReviewAuthorizer(client, requestInfoResolver, o.ClusterName, noMatch))
+		default:
+			return nil, fmt.Errorf("unknown authorization mode %q", mode)
+		}
+	}
+	return auth.NewAuthorizerChain(authorizers...), nil
+}
+
+// authenticator creates the authenticator chain according to the authentication modes
+func (o *AuthOptions) authenticator(client kubernetes.Interface) (authenticator.Request, error) {
+	authenticators := make([]authenticator.Request, 0, len(o.AuthenticationModes))
+	for _, mode := range o.AuthenticationModes {
+		switch mode {
+		case AuthenticationModeOIDC:
+			authn, err := auth.NewOIDCAuthenticator(o.OIDC)
+			if err != nil {
+				return nil, err
+			}
+			authenticators = append(authenticators, authn)
+		case AuthenticationModeTokenReview:
+			authn := auth.NewTokenReviewAuthenticator(client, o.TokenReviewAudiences)
+			authenticators = append(authenticators, auth.NewCachedTokenAuthenticator(authn, o.AuthnCacheTTL))
+		case AuthenticationModeErebus:
+			authn, err := auth.NewErebusAuthenticator(o.ErebusURL)
+			if err != nil {
+				return nil, err
+			}
+			authenticators = append(authenticators, auth.NewCachedTokenAuthenticator(authn, o.AuthnCacheTTL))
+		default:
+			return nil, fmt.Errorf("unknown authentication mode %q", mode)
+		}
+	}
+	return auth.NewAuthenticatorChain(authenticators...), nil
 }
 
 // ApplyToServer apply options to server
@@ -51,37 +508,68 @@ func (o *AuthOptions) ApplyToServer(server server.Server) (err error) {
 		return
 	}
 
-	// creates the in-cluster config
-	config, err := rest.InClusterConfig()
+	dynamicClient, kubeClient, err := o.clients()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	clientset, err := dynamic.NewForConfig(config)
+	authn, err := o.authenticator(kubeClient)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	cache := auth.NewCache(1 * time.Minute)
-
+	routeTemplates, err := o.routeTemplates()
+	if err != nil {
+		return err
+	}
 	requestInfoResolver := &request.RequestInfoFactory{
-		APIPrefixes: sets.NewString("platform", ""),
+		APIPrefixes:          sets.NewString(o.APIPrefixes...),
+		GrouplessAPIPrefixes: sets.NewString(o.GrouplessAPIPrefixes...),
+		RouteTemplates:       routeTemplates,
+	}
+
+	var cache auth.Cache
+	if o.UserCacheExpire > 0 {
+		cache = auth.NewCache(o.UserCacheExpire, o.CacheSize)
 	}
+	auth.RegisterMetrics()
 
 	stopCh := make(chan struct{})
-	userbindingResolver := userbinding.NewResolver(clientset, stopCh)
-	clusterroleResolver := clusterrole.NewResolver(clientset, stopCh)
-	userResolver := user.NewResolver(stopCh)
+	userbindingResolver := userbinding.NewResolver(dynamicClient, o.UserBindingResyncPeriod, stopCh)
+	clusterroleResolver := clusterrole.NewResolver(dynamicClient, o.ClusterRoleResyncPeriod, stopCh)
+	userResolver := user.NewResolver(dynamicClient, o.UserResyncPeriod, stopCh)
 
-	mgr := auth.NewManager(cache, o.ErebusService, userbindingResolver, clusterroleResolver, requestInfoResolver, userResolver)
-	server.SetAuthManager(mgr)
+	mgr := auth.NewManager(cache, authn, userbindingResolver, clusterroleResolver, requestInfoResolver, userResolver)
+	authz, err := o.authorizer(mgr, kubeClient, requestInfoResolver)
+	if err != nil {
+		close(stopCh)
+		return err
+	}
+	// only ready to serve requests once all the authorization caches are synced
+	checks := []healthz.HealthChecker{
+		healthz.InformerSyncCheck("userbinding-informer-sync", userbindingResolver.HasSynced),
+		healthz.InformerSyncCheck("clusterrole-informer-sync", clusterroleResolver.HasSynced),
+		healthz.InformerSyncCheck("user-informer-sync", userResolver.HasSynced),
+	}
+	if o.ClusterName != "" {
+		projectResolver := project.NewResolver(dynamicClient, o.ClusterName, o.NamespaceResyncPeriod, stopCh)
+		mgr.WithProjectResolver(projectResolver)
+		checks = append(checks, healthz.InformerSyncCheck("namespace-informer-sync", projectResolver.HasSynced))
+	}
 
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	server.SetAuthManager(mgr.WithAuthorizer(authz))
+	if o.EnableAuthzDebug {
+		server.Container().Handle("/debug/authz", mgr.DebugHandler())
+	}
+	if o.EnableAccessReview {
+		server.Container().Add(review.NewWebService(server, mgr))
+	}
+	addReadyzChecks(server, checks...)
 
-	go func() {
-		<-sigCh
+	// stop informers when the server shuts down
+	addPreShutdownHook(server, "auth-informers", func(ctx context.Context) error {
 		close(stopCh)
-	}()
+		return nil
+	})
 	return nil
 }
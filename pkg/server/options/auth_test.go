@@ -0,0 +1,270 @@
+package options
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"gomod.alauda.cn/alauda-backend/pkg/auth"
+	authv1 "gomod.alauda.cn/alauda-backend/pkg/auth/apis/v1"
+	"gomod.alauda.cn/alauda-backend/pkg/server"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAuthOptions(t *testing.T) {
+	tests := []struct {
+		name                    string
+		args                    []string
+		wantErrs                int
+		wantAuthenticationModes []string
+		wantAuthorizationModes  []string
+		wantNoMatch             string
+		wantRouteTemplates      []string
+	}{
+		{
+			name:                    "defaults",
+			wantAuthenticationModes: []string{AuthenticationModeErebus},
+			wantAuthorizationModes:  []string{AuthorizationModeUserBinding},
+			wantNoMatch:             auth.DecisionNoOpinion.String(),
+		},
+		{
+			name: "flags",
+			args: []string{
+				"--authentication-modes=oidc,tokenreview", "--oidc-issuer-url=https://issuer.example.com", "--oidc-client-id=backend",
+				"--authorization-modes=userbinding,subjectaccessreview", "--authorization-no-match=deny",
+				"--route-templates=namespace:ns/{namespace},cluster:c/{cluster}", "--authorization-cache-ttl=0",
+			},
+			wantAuthenticationModes: []string{AuthenticationModeOIDC, AuthenticationModeTokenReview},
+			wantAuthorizationModes:  []string{AuthorizationModeUserBinding, AuthorizationModeSubjectAccessReview},
+			wantNoMatch:             auth.DecisionDeny.String(),
+			wantRouteTemplates:      []string{"namespace:ns/{namespace}", "cluster:c/{cluster}"},
+		},
+		{
+			name:     "unknown modes",
+			args:     []string{"--authentication-modes=basic", "--authorization-modes=abac"},
+			wantErrs: 2,
+		},
+		{
+			name:     "empty modes",
+			args:     []string{"--authentication-modes=", "--authorization-modes="},
+			wantErrs: 2,
+		},
+		{
+			name:     "oidc without issuer and client",
+			args:     []string{"--authentication-modes=oidc"},
+			wantErrs: 2,
+		},
+		{
+			name:     "allow if no authorizer matches",
+			args:     []string{"--authorization-no-match=allow"},
+			wantErrs: 1,
+		},
+		{
+			name:     "invalid no-match decision",
+			args:     []string{"--authorization-no-match=maybe"},
+			wantErrs: 1,
+		},
+		{
+			name:     "route template without level",
+			args:     []string{"--route-templates=ns/{namespace}"},
+			wantErrs: 1,
+		},
+		{
+			name:     "route template with unknown variable",
+			args:     []string{"--route-templates=namespace:tenants/{tenant}"},
+			wantErrs: 1,
+		},
+		{
+			name:     "no api prefixes",
+			args:     []string{"--api-prefixes=", "--groupless-api-prefixes="},
+			wantErrs: 1,
+		},
+		{
+			name: "invalid cache and resync periods",
+			args: []string{
+				"--authorization-cache-ttl=-1s", "--authorization-cache-size=0", "--userbinding-resync-period=0",
+				"--clusterrole-resync-period=0", "--user-resync-period=0", "--auth-cluster-name=global", "--namespace-resync-period=0",
+			},
+			wantErrs: 6,
+		},
+		{
+			name: "namespace resync period is ignored without a cluster",
+			args: []string{"--namespace-resync-period=0"},
+			// defaults of the remaining options
+			wantAuthenticationModes: []string{AuthenticationModeErebus},
+			wantAuthorizationModes:  []string{AuthorizationModeUserBinding},
+			wantNoMatch:             auth.DecisionNoOpinion.String(),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := NewAuthOptions()
+			parseFlags(t, opts, test.args...)
+			errs := opts.ApplyFlags()
+			if len(errs) != test.wantErrs {
+				t.Fatalf("got errors %v, want %d errors", errs, test.wantErrs)
+			}
+			if test.wantErrs > 0 {
+				return
+			}
+			if !reflect.DeepEqual(opts.AuthenticationModes, test.wantAuthenticationModes) {
+				t.Errorf("got authentication modes %v, want %v", opts.AuthenticationModes, test.wantAuthenticationModes)
+			}
+			if !reflect.DeepEqual(opts.AuthorizationModes, test.wantAuthorizationModes) {
+				t.Errorf("got authorization modes %v, want %v", opts.AuthorizationModes, test.wantAuthorizationModes)
+			}
+			if opts.AuthorizationNoMatch != test.wantNoMatch {
+				t.Errorf("got no-match decision %q, want %q", opts.AuthorizationNoMatch, test.wantNoMatch)
+			}
+			if len(opts.RouteTemplates) > 0 || len(test.wantRouteTemplates) > 0 {
+				if !reflect.DeepEqual(opts.RouteTemplates, test.wantRouteTemplates) {
+					t.Errorf("got route templates %v, want %v", opts.RouteTemplates, test.wantRouteTemplates)
+				}
+			}
+		})
+	}
+}
+
+// newFakeAuthClients injects fake clients serving the resources watched by the auth informers
+func newFakeAuthClients(opts *AuthOptions) {
+	opts.DynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		authv1.SchemeGroupVersion.WithResource("userbindings"): "UserBindingList",
+		authv1.SchemeGroupVersion.WithResource("users"):        "UserList",
+		rbacv1.SchemeGroupVersion.WithResource("clusterroles"): "ClusterRoleList",
+		corev1.SchemeGroupVersion.WithResource("namespaces"):   "NamespaceList",
+	})
+	opts.KubeClient = kubefake.NewSimpleClientset()
+}
+
+func TestAuthApplyToServer(t *testing.T) {
+	tests := []struct {
+		name            string
+		modify          func(o *AuthOptions)
+		wantErr         bool
+		wantReadyz      []string
+		wantDebug       bool
+		wantAccessCheck bool
+	}{
+		{
+			name: "injected clients",
+			modify: func(o *AuthOptions) {
+				newFakeAuthClients(o)
+				o.ClusterName = "global"
+				o.EnableAuthzDebug = true
+				o.EnableAccessReview = true
+			},
+			wantReadyz:      []string{"userbinding-informer-sync", "clusterrole-informer-sync", "user-informer-sync", "namespace-informer-sync"},
+			wantDebug:       true,
+			wantAccessCheck: true,
+		},
+		{
+			name: "without projects of namespaces",
+			modify: func(o *AuthOptions) {
+				newFakeAuthClients(o)
+				o.AuthenticationModes = []string{AuthenticationModeTokenReview}
+				o.AuthorizationModes = []string{AuthorizationModeSubjectAccessReview, AuthorizationModeUserBinding}
+				o.UserCacheExpire = 0
+			},
+			wantReadyz: []string{"userbinding-informer-sync", "clusterrole-informer-sync", "user-informer-sync"},
+		},
+		{
+			name: "missing kubeconfig",
+			modify: func(o *AuthOptions) {
+				o.Kubeconfig = "/nonexistent/kubeconfig"
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing oidc ca file",
+			modify: func(o *AuthOptions) {
+				newFakeAuthClients(o)
+				o.AuthenticationModes = []string{AuthenticationModeOIDC}
+				o.OIDC.IssuerURL = "https://issuer.example.com"
+				o.OIDC.ClientID = "backend"
+				o.OIDC.CAFile = "/nonexistent/ca.crt"
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid route templates",
+			modify: func(o *AuthOptions) {
+				newFakeAuthClients(o)
+				o.RouteTemplates = []string{"namespace:tenants/{tenant}"}
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown authorization mode",
+			modify: func(o *AuthOptions) {
+				newFakeAuthClients(o)
+				o.AuthorizationModes = []string{"abac"}
+			},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := NewAuthOptions()
+			test.modify(opts)
+			srv := server.New("test").(*server.DefaultServer)
+			defaultChecks := len(srv.ReadyzChecks())
+			err := opts.ApplyToServer(srv)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				if srv.GetAuthManager() != nil {
+					t.Errorf("expected no auth manager after a failure")
+				}
+				return
+			}
+			// stops the informers
+			t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+			if srv.GetAuthManager() == nil {
+				t.Fatalf("expected an auth manager")
+			}
+
+			checks := srv.ReadyzChecks()[defaultChecks:]
+			names := []string{}
+			for _, check := range checks {
+				names = append(names, check.Name())
+			}
+			if !reflect.DeepEqual(names, test.wantReadyz) {
+				t.Errorf("got readyz checks %v, want %v", names, test.wantReadyz)
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for _, check := range checks {
+				for check.Check(httptest.NewRequest("GET", "/readyz", nil)) != nil {
+					if time.Now().After(deadline) {
+						t.Fatalf("check %s never got ready", check.Name())
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+
+			rec := httptest.NewRecorder()
+			srv.Container().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/authz?verb=get&resource=pods", nil))
+			if got := rec.Code != http.StatusNotFound; got != test.wantDebug {
+				t.Errorf("got debug endpoint registered %v (status %d), want %v", got, rec.Code, test.wantDebug)
+			}
+			accessReview := false
+			for _, ws := range srv.Container().RegisteredWebServices() {
+				if ws.RootPath() == "/auth/v1" {
+					accessReview = true
+				}
+			}
+			if accessReview != test.wantAccessCheck {
+				t.Errorf("got access review registered %v, want %v", accessReview, test.wantAccessCheck)
+			}
+		})
+	}
+}
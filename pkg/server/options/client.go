@@ -3,12 +3,14 @@ package options
 import (
 	"flag"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"gomod.alauda.cn/alauda-backend/pkg/client"
+	"gomod.alauda.cn/alauda-backend/pkg/healthz"
 	"gomod.alauda.cn/alauda-backend/pkg/server"
 )
 
@@ -28,6 +30,7 @@ const (
 	flagMultiClusterProxyHost     = "multi-cluster-host"
 	flagMultiClusterParameterName = "cluster-param-name"
 	flagEnableQueryToken          = "enable-query-token"
+	flagAPIServerHealthCheck      = "apiserver-health-check"
 )
 
 const (
@@ -42,6 +45,7 @@ const (
 	configMultiClusterHost          = "client.multi_cluster_host"
 	configMultiClusterParameterName = "client.cluster_param_name"
 	configEnableQueryToken          = "client.enable-query-token"
+	configAPIServerHealthCheck      = "client.apiserver_health_check"
 )
 
 // ClientOptions holds the options for client configuration.
@@ -97,9 +101,14 @@ type ClientOptions struct {
 	// EnableQueryToken allows users to provide authorization information with path query parameter
 	// default query parameter name "token"
 	EnableQueryToken bool
+
+	// APIServerHealthCheck adds a readiness check verifying the kubernetes apiserver
+	// is reachable using the insecure client
+	APIServerHealthCheck bool
 }
 
 var _ Optioner = &ClientOptions{}
+var _ Reloadable = &ClientOptions{}
 
 // NewClientOptions creates the default ClientOptions object.
 func NewClientOptions() *ClientOptions {
@@ -126,7 +135,7 @@ func (o *ClientOptions) AddFlags(fs *pflag.FlagSet) {
 			"to connect to in the format of protocol://address:port, e.g., "+
 			"http://localhost:8080. If not specified, the assumption is that the binary runs inside a "+
 			"Kubernetes cluster and local discovery is attempted.")
-	_ = viper.BindPFlag(configAPIServerHost, fs.Lookup(flagAPIServerHost))
+	bindFlag(fs, configAPIServerHost, flagAPIServerHost)
 
 	// "sigs.k8s.io/controller-runtime" will register "kubeconfig" flag automately in https://github.com/kubernetes-sigs/controller-runtime/blob/v0.8.3/pkg/client/config/config.go
 	// if any import the package  "sigs.k8s.io/controller-runtime", will caused "kubeconfig" flag redefined.
@@ -135,44 +144,48 @@ func (o *ClientOptions) AddFlags(fs *pflag.FlagSet) {
 		fs.String(flagKubeConfigPath, o.KubeConfigPath,
 			"Path to kubeconfig file with authorization and master location information.")
 	}
-	_ = viper.BindPFlag(configKubeConfigPath, fs.Lookup(flagKubeConfigPath))
+	bindFlag(fs, configKubeConfigPath, flagKubeConfigPath)
 
 	fs.String(flagUserAgent, o.UserAgent,
 		"User agent used by the client")
-	_ = viper.BindPFlag(configUserAgent, fs.Lookup(flagUserAgent))
+	bindFlag(fs, configUserAgent, flagUserAgent)
 
 	fs.Bool(flagEnableAnonymous, o.EnableAnonymous,
 		"When enabled this settings will use the kubeconfig auth info or service account info instead of user login")
-	_ = viper.BindPFlag(configEnableAnonymous, fs.Lookup(flagEnableAnonymous))
+	bindFlag(fs, configEnableAnonymous, flagEnableAnonymous)
 
 	fs.Float32(flagQPS, o.QPS,
 		"QPS used by the client")
-	_ = viper.BindPFlag(configQPS, fs.Lookup(flagQPS))
+	bindFlag(fs, configQPS, flagQPS)
 
 	fs.Int(flagBurst, o.Burst,
 		"Burst used by the client")
-	_ = viper.BindPFlag(configBurst, fs.Lookup(flagBurst))
+	bindFlag(fs, configBurst, flagBurst)
 
 	fs.Duration(flagClientTimeout, o.Timeout,
 		"Timeout set on client")
-	_ = viper.BindPFlag(configClientTimeout, fs.Lookup(flagClientTimeout))
+	bindFlag(fs, configClientTimeout, flagClientTimeout)
 
 	fs.Bool(flagEnableMultiCluster, o.EnableMultiCluster,
 		"Enable multi-cluster client using request's cluster parameter name or query string. If true must set "+
 			flagMultiClusterProxyHost+" as a full fledged hostname.")
-	_ = viper.BindPFlag(configEnableMultiCluster, fs.Lookup(flagEnableMultiCluster))
+	bindFlag(fs, configEnableMultiCluster, flagEnableMultiCluster)
 
 	fs.String(flagMultiClusterProxyHost, o.MultiClusterHost,
 		"Multi cluster host full fledged address.")
-	_ = viper.BindPFlag(configMultiClusterHost, fs.Lookup(flagMultiClusterProxyHost))
+	bindFlag(fs, configMultiClusterHost, flagMultiClusterProxyHost)
 
 	fs.String(flagMultiClusterParameterName, o.MultiClusterParameterName,
 		"Multi cluster parameter name from request.")
-	_ = viper.BindPFlag(configMultiClusterParameterName, fs.Lookup(flagMultiClusterParameterName))
+	bindFlag(fs, configMultiClusterParameterName, flagMultiClusterParameterName)
 
 	fs.Bool(flagEnableQueryToken, o.EnableQueryToken,
 		"Enable query token client using request's token parameter name or query string.")
-	_ = viper.BindPFlag(configEnableQueryToken, fs.Lookup(flagEnableQueryToken))
+	bindFlag(fs, configEnableQueryToken, flagEnableQueryToken)
+
+	fs.Bool(flagAPIServerHealthCheck, o.APIServerHealthCheck,
+		"Adds a check on /readyz verifying the kubernetes apiserver is reachable.")
+	bindFlag(fs, configAPIServerHealthCheck, flagAPIServerHealthCheck)
 }
 
 // ApplyFlags parsing parameters from the command line or configuration file
@@ -198,6 +211,7 @@ func (o *ClientOptions) ApplyFlags() []error {
 	o.MultiClusterParameterName = viper.GetString(configMultiClusterParameterName)
 
 	o.EnableQueryToken = viper.GetBool(configEnableQueryToken)
+	o.APIServerHealthCheck = viper.GetBool(configAPIServerHealthCheck)
 
 	if o.EnableMultiCluster {
 		if strings.TrimSpace(o.MultiClusterHost) == "" {
@@ -211,6 +225,16 @@ func (o *ClientOptions) ApplyFlags() []error {
 	return errs
 }
 
+// ApplyReloadFlags applies qps and burst from the configuration
+func (o *ClientOptions) ApplyReloadFlags(config *viper.Viper) []error {
+	if o == nil {
+		return nil
+	}
+	o.QPS = float32(config.GetFloat64(configQPS))
+	o.Burst = config.GetInt(configBurst)
+	return nil
+}
+
 // ApplyToServer apply options to server
 func (o *ClientOptions) ApplyToServer(server server.Server) (err error) {
 	if o == nil {
@@ -250,5 +274,43 @@ func (o *ClientOptions) ApplyToServer(server server.Server) (err error) {
 
 	server.SetManager(mgr)
 
+	if o.APIServerHealthCheck {
+		addReadyzChecks(server, apiServerHealthCheck(server))
+	}
+
 	return
 }
+
+// WatchFiles no files are watched for client options
+func (o *ClientOptions) WatchFiles() []string {
+	return nil
+}
+
+// Reload applies qps and burst to the server's client manager.
+// Clients generated after reloading use the new values
+func (o *ClientOptions) Reload(server server.Server) (err error) {
+	if o == nil {
+		return
+	}
+	updater, ok := server.GetManager().(client.ConfigUpdater)
+	if !ok {
+		return
+	}
+	updater.UpdateConfig(func(cfg *client.Config) {
+		cfg.QPS = o.QPS
+		cfg.Burst = o.Burst
+	})
+	return
+}
+
+// apiServerHealthCheck checks if the kubernetes apiserver is reachable
+// using the insecure client of the server's client manager
+func apiServerHealthCheck(srv server.Server) healthz.HealthChecker {
+	return healthz.NamedCheck("apiserver", func(req *http.Request) error {
+		client, err := srv.GetManager().InsecureClient()
+		if err != nil {
+			return err
+		}
+		return client.Discovery().RESTClient().Get().AbsPath("/version").Do(req.Context()).Error()
+	})
+}
@@ -0,0 +1,284 @@
+package options
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	flagConfigFile = "config"
+)
+
+var (
+	// configFlags maps configuration keys to the flags bound to them
+	configFlags     = map[string]*pflag.Flag{}
+	configFlagsLock sync.RWMutex
+)
+
+// bindFlag binds a flag to a configuration key and records the binding
+// which is used to validate configuration files and to generate the configuration schema
+func bindFlag(fs *pflag.FlagSet, key, name string) {
+	flag := fs.Lookup(name)
+	if flag == nil {
+		return
+	}
+	_ = viper.BindPFlag(key, flag)
+
+	configFlagsLock.Lock()
+	defer configFlagsLock.Unlock()
+	configFlags[key] = flag
+}
+
+func configFlag(key string) *pflag.Flag {
+	configFlagsLock.RLock()
+	defer configFlagsLock.RUnlock()
+	return configFlags[key]
+}
+
+// addConfigFlags adds flags for configuration file and records the known configuration keys
+func (o *Options) addConfigFlags(fs *pflag.FlagSet) {
+	if fs.Lookup(flagConfigFile) == nil {
+		fs.StringVar(&o.ConfigFile, flagConfigFile, o.ConfigFile,
+			"Path to a YAML or JSON configuration file. Keys are the same used by all flags, i.e client.qps, audit.log_path. "+
+				"Flags given on the command line take precedence over the configuration file.")
+	}
+}
+
+// loadConfig enables environment variables and loads the configuration file
+// into the configuration. All keys and values in the file are validated
+func (o *Options) loadConfig() []error {
+	data, errs := o.readConfigFile()
+	if len(errs) > 0 {
+		return errs
+	}
+	return o.setConfig(viper.GetViper(), data)
+}
+
+// newConfig returns a configuration separate from the global one
+// with the same flags bound, used to validate a configuration before loading it
+func (o *Options) newConfig() *viper.Viper {
+	config := viper.New()
+	configFlagsLock.RLock()
+	defer configFlagsLock.RUnlock()
+	for key, flag := range configFlags {
+		_ = config.BindPFlag(key, flag)
+	}
+	return config
+}
+
+// readConfigFile reads the configuration file and validates all its keys and values
+func (o *Options) readConfigFile() ([]byte, []error) {
+	if o.ConfigFile == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(o.ConfigFile)
+	if err != nil {
+		return nil, []error{fmt.Errorf("failed to read configuration file %q: %v", o.ConfigFile, err)}
+	}
+
+	file := viper.New()
+	file.SetConfigType(o.configFileType())
+	if err := file.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, []error{fmt.Errorf("failed to read configuration file %q: %v", o.ConfigFile, err)}
+	}
+	if errs := o.validateConfig(file); len(errs) > 0 {
+		return nil, errs
+	}
+	return data, nil
+}
+
+// setConfig enables environment variables and loads the configuration file data into config
+func (o *Options) setConfig(config *viper.Viper, data []byte) []error {
+	if o.EnvPrefix != "" {
+		config.SetEnvPrefix(o.EnvPrefix)
+		config.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+		config.AutomaticEnv()
+	}
+	if o.ConfigFile == "" {
+		return nil
+	}
+	// replaces the previously loaded file, keys removed from the file
+	// fallback to flags and defaults when reloading
+	config.SetConfigType(o.configFileType())
+	if err := config.ReadConfig(bytes.NewReader(data)); err != nil {
+		return []error{fmt.Errorf("failed to load configuration file %q: %v", o.ConfigFile, err)}
+	}
+	return nil
+}
+
+func (o *Options) configFileType() string {
+	return strings.TrimPrefix(filepath.Ext(o.ConfigFile), ".")
+}
+
+// validateConfig verifies all keys of the configuration file are known
+// and have valid values according to the bound flags
+func (o *Options) validateConfig(file *viper.Viper) []error {
+	var errs []error
+	known := o.knownKeys()
+	keys := file.AllKeys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		knownKey, ok := matchKnownKey(known, key)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown configuration key %q", o.ConfigFile, key))
+			continue
+		}
+
+		typ := configType(knownKey)
+		if err := validateConfigValue(typ, file.Get(key)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid value for configuration key %q: %v", o.ConfigFile, key, err))
+		}
+	}
+	return errs
+}
+
+// knownKeys returns all the configuration keys bound to flags or with default values
+func (o *Options) knownKeys() sets.String {
+	if o.keys == nil {
+		return sets.NewString(viper.AllKeys()...)
+	}
+	return o.keys
+}
+
+// matchKnownKey returns the known key matching key directly
+// or one of its parents, i.e. map values
+func matchKnownKey(known sets.String, key string) (string, bool) {
+	for k := key; k != ""; {
+		if known.Has(k) {
+			return k, true
+		}
+		idx := strings.LastIndex(k, ".")
+		if idx < 0 {
+			break
+		}
+		k = k[:idx]
+	}
+	return "", false
+}
+
+// configType returns the type of a configuration key
+// using the bound flag's type or the current value as fallback
+func configType(key string) string {
+	if flag := configFlag(key); flag != nil {
+		return flag.Value.Type()
+	}
+	switch viper.Get(key).(type) {
+	case bool:
+		return "bool"
+	case int, int32, int64:
+		return "int"
+	case float32, float64:
+		return "float64"
+	case []string:
+		return "stringSlice"
+	case map[string]string:
+		return "stringToString"
+	}
+	return "string"
+}
+
+func validateConfigValue(typ string, value interface{}) (err error) {
+	switch typ {
+	case "bool":
+		_, err = cast.ToBoolE(value)
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "count":
+		_, err = cast.ToInt64E(value)
+	case "float32", "float64":
+		_, err = cast.ToFloat64E(value)
+	case "duration":
+		_, err = cast.ToDurationE(value)
+	case "stringSlice", "stringArray":
+		_, err = cast.ToStringSliceE(value)
+	case "stringToString":
+		_, err = cast.ToStringMapStringE(value)
+	default:
+		_, err = cast.ToStringE(value)
+	}
+	if err != nil {
+		err = fmt.Errorf("expected %s, got %v", typ, value)
+	}
+	return
+}
+
+// ConfigSchema generates a JSON schema describing the configuration file
+// for all options. Must be called after AddFlags
+func (o *Options) ConfigSchema() ([]byte, error) {
+	root := newSchemaObject()
+	keys := o.knownKeys().List()
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts := strings.Split(key, ".")
+		parent := root
+		for _, part := range parts[:len(parts)-1] {
+			props := parent["properties"].(map[string]interface{})
+			child, ok := props[part].(map[string]interface{})
+			if !ok || child["type"] != "object" {
+				child = newSchemaObject()
+				props[part] = child
+			}
+			parent = child
+		}
+		parent["properties"].(map[string]interface{})[parts[len(parts)-1]] = schemaProperty(key)
+	}
+	root["$schema"] = "http://json-schema.org/draft-07/schema#"
+	return json.MarshalIndent(root, "", "  ")
+}
+
+func newSchemaObject() map[string]interface{} {
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           map[string]interface{}{},
+		"additionalProperties": false,
+	}
+}
+
+func schemaProperty(key string) map[string]interface{} {
+	prop := map[string]interface{}{}
+	flag := configFlag(key)
+	if flag != nil {
+		prop["description"] = flag.Usage
+		prop["default"] = flag.DefValue
+	}
+	switch typ := configType(key); typ {
+	case "bool":
+		prop["type"] = "boolean"
+		if flag != nil {
+			prop["default"] = cast.ToBool(flag.DefValue)
+		}
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "count":
+		prop["type"] = "integer"
+		if flag != nil {
+			prop["default"] = cast.ToInt64(flag.DefValue)
+		}
+	case "float32", "float64":
+		prop["type"] = "number"
+		if flag != nil {
+			prop["default"] = cast.ToFloat64(flag.DefValue)
+		}
+	case "duration":
+		prop["type"] = "string"
+		prop["format"] = "duration"
+	case "stringSlice", "stringArray":
+		prop["type"] = "array"
+		prop["items"] = map[string]interface{}{"type": "string"}
+		delete(prop, "default")
+	case "stringToString":
+		prop["type"] = "object"
+		prop["additionalProperties"] = map[string]interface{}{"type": "string"}
+		delete(prop, "default")
+	default:
+		prop["type"] = "string"
+	}
+	return prop
+}
@@ -0,0 +1,171 @@
+package options
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a configuration file with the given name and contents to a temporary directory
+func writeConfig(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("failed to write configuration file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		data      string
+		args      []string
+		env       map[string]string
+		wantErrs  []string
+		wantRead  time.Duration
+		wantBytes int
+	}{
+		{
+			name:      "yaml file",
+			file:      "config.yaml",
+			data:      "server:\n  read_timeout: 5s\n  max_header_bytes: 2048\n",
+			wantRead:  5 * time.Second,
+			wantBytes: 2048,
+		},
+		{
+			name:      "json file",
+			file:      "config.json",
+			data:      `{"server":{"read_timeout":"6s"}}`,
+			wantRead:  6 * time.Second,
+			wantBytes: 1 << 20,
+		},
+		{
+			name:      "flags take precedence over the file",
+			file:      "config.yaml",
+			data:      "server:\n  read_timeout: 5s\n  max_header_bytes: 2048\n",
+			args:      []string{"--read-timeout=7s"},
+			wantRead:  7 * time.Second,
+			wantBytes: 2048,
+		},
+		{
+			name:      "environment variables",
+			env:       map[string]string{"TEST_SERVER_READ_TIMEOUT": "8s"},
+			wantRead:  8 * time.Second,
+			wantBytes: 1 << 20,
+		},
+		{
+			name:     "unknown keys",
+			file:     "config.yaml",
+			data:     "server:\n  read_timeout: 5s\n  raed_timeout: 5s\nclient:\n  qps: 5\n",
+			wantErrs: []string{`unknown configuration key "client.qps"`, `unknown configuration key "server.raed_timeout"`},
+		},
+		{
+			name:     "invalid values",
+			file:     "config.yaml",
+			data:     "server:\n  read_timeout: soon\n  keep_alive: maybe\n",
+			wantErrs: []string{`invalid value for configuration key "server.keep_alive"`, `invalid value for configuration key "server.read_timeout"`},
+		},
+		{
+			name:     "invalid syntax",
+			file:     "config.yaml",
+			data:     "server: [",
+			wantErrs: []string{"failed to read configuration file"},
+		},
+		{
+			name:     "missing file",
+			file:     "missing.yaml",
+			wantErrs: []string{"failed to read configuration file"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+			args := test.args
+			if test.file != "" {
+				path := filepath.Join(t.TempDir(), test.file)
+				if test.data != "" {
+					path = writeConfig(t, test.file, test.data)
+				}
+				args = append(args, "--config="+path)
+			}
+			serving := NewServingOptions()
+			opts := With(serving).WithEnvPrefix("TEST")
+			parseFlags(t, opts, args...)
+
+			errs := opts.ApplyFlags()
+			if len(errs) != len(test.wantErrs) {
+				t.Fatalf("got errors %v, want %v", errs, test.wantErrs)
+			}
+			for i, want := range test.wantErrs {
+				if !strings.Contains(errs[i].Error(), want) {
+					t.Errorf("got error %q, want it to contain %q", errs[i], want)
+				}
+			}
+			if len(test.wantErrs) > 0 {
+				return
+			}
+			if serving.ReadTimeout != test.wantRead {
+				t.Errorf("got read timeout %v, want %v", serving.ReadTimeout, test.wantRead)
+			}
+			if serving.MaxHeaderBytes != test.wantBytes {
+				t.Errorf("got max header bytes %d, want %d", serving.MaxHeaderBytes, test.wantBytes)
+			}
+		})
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	opts := With(NewServingOptions())
+	parseFlags(t, opts)
+
+	data, err := opts.ConfigSchema()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	schema := map[string]interface{}{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("invalid schema %s: %v", data, err)
+	}
+	server, ok := schema["properties"].(map[string]interface{})["server"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("schema %s has no server object", data)
+	}
+	if server["additionalProperties"] != false {
+		t.Errorf("expected additional properties to be disallowed")
+	}
+
+	props := server["properties"].(map[string]interface{})
+	tests := []struct {
+		key         string
+		wantType    string
+		wantDefault interface{}
+	}{
+		{key: "read_timeout", wantType: "string", wantDefault: "0s"},
+		{key: "max_header_bytes", wantType: "integer", wantDefault: float64(1 << 20)},
+		{key: "keep_alive", wantType: "boolean", wantDefault: true},
+	}
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			prop, ok := props[test.key].(map[string]interface{})
+			if !ok {
+				t.Fatalf("schema has no property %q", test.key)
+			}
+			if prop["type"] != test.wantType {
+				t.Errorf("got type %v, want %v", prop["type"], test.wantType)
+			}
+			if prop["default"] != test.wantDefault {
+				t.Errorf("got default %v, want %v", prop["default"], test.wantDefault)
+			}
+			if prop["description"] == "" {
+				t.Errorf("expected a description")
+			}
+		})
+	}
+}
@@ -42,10 +42,10 @@ func (o *DebugOptions) AddFlags(fs *pflag.FlagSet) {
 
 	fs.Bool(flagDebugProfiling, o.EnableProfiling,
 		"Enable profiling via web interface host:port/debug/pprof/")
-	_ = viper.BindPFlag(configDebugProfiling, fs.Lookup(flagDebugProfiling))
+	bindFlag(fs, configDebugProfiling, flagDebugProfiling)
 	fs.Bool(flagDebugContentionProfiling, o.EnableContentionProfiling,
 		"Enable lock contention profiling, if profiling is enabled")
-	_ = viper.BindPFlag(configDebugContentionProfiling, fs.Lookup(flagDebugContentionProfiling))
+	bindFlag(fs, configDebugContentionProfiling, flagDebugContentionProfiling)
 }
 
 // ApplyFlags parsing parameters from the command line or configuration file
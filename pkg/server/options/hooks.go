@@ -0,0 +1,23 @@
+package options
+
+import (
+	"gomod.alauda.cn/alauda-backend/pkg/healthz"
+	"gomod.alauda.cn/alauda-backend/pkg/server"
+)
+
+// addPreShutdownHook adds a pre shutdown hook if the server supports lifecycle hooks,
+// returns false if the hook was not added
+func addPreShutdownHook(sv server.Server, name string, hook server.HookFunc) bool {
+	hooks, ok := sv.(server.LifecycleHooks)
+	if ok {
+		hooks.AddPreShutdownHook(name, hook)
+	}
+	return ok
+}
+
+// addReadyzChecks adds checks to /readyz if the server exposes health checks
+func addReadyzChecks(sv server.Server, checks ...healthz.HealthChecker) {
+	if hc, ok := sv.(server.HealthChecks); ok {
+		hc.AddReadyzChecks(checks...)
+	}
+}
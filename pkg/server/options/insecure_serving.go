@@ -18,14 +18,13 @@ package options
 
 import (
 	"fmt"
-	"io"
 	"net"
-	"net/http"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
 	"gomod.alauda.cn/alauda-backend/pkg/decorator"
+	"gomod.alauda.cn/alauda-backend/pkg/healthz"
 	"gomod.alauda.cn/alauda-backend/pkg/server"
 )
 
@@ -90,19 +89,19 @@ func (s *InsecureServingOptions) AddFlags(fs *pflag.FlagSet) {
 
 	fs.IP(flagBindAddress, s.BindAddress, ""+
 		"The IP address on which to serve the --insecure-port (set to 0.0.0.0 for all IPv4 interfaces and :: for all IPv6 interfaces).")
-	_ = viper.BindPFlag(configBindAddress, fs.Lookup(flagBindAddress))
+	bindFlag(fs, configBindAddress, flagBindAddress)
 
 	fs.Int(flagBindPort, s.BindPort, ""+
 		"The port on which to serve unsecured, unauthenticated access.")
-	_ = viper.BindPFlag(configBindPort, fs.Lookup(flagBindPort))
+	bindFlag(fs, configBindPort, flagBindPort)
 
 	fs.Bool(flagHealthCheck, s.HealthCheck, ""+
-		"Enables health check endpoint /healthz on server.")
-	_ = viper.BindPFlag(configHealthCheck, fs.Lookup(flagHealthCheck))
+		"Enables health check endpoints /healthz, /livez and /readyz on server.")
+	bindFlag(fs, configHealthCheck, flagHealthCheck)
 
 	fs.String(flagPathPrefix, s.PathPrefix, ""+
 		"Sets a path prefix as instruction for other services")
-	_ = viper.BindPFlag(configPathPrefix, fs.Lookup(flagPathPrefix))
+	bindFlag(fs, configPathPrefix, flagPathPrefix)
 }
 
 // ApplyFlags apply flags
@@ -143,10 +142,16 @@ func (s *InsecureServingOptions) ApplyToServer(svr server.Server) error {
 	if setter := svr.(server.ListenerSetter); setter != nil {
 		setter.SetListener(s.Listener, s.BindPort)
 	}
-	if s.HealthCheck {
-		svr.Container().Handle("/healthz", healthz{})
-		svr.Container().Handle("/_ping/", healthz{})
-		svr.Container().Handle("/_ping", healthz{})
+	if hc, ok := svr.(server.HealthChecks); ok && s.HealthCheck {
+		healthz.InstallPathHandler(svr.Container(), "/healthz", hc.HealthzChecks)
+		healthz.InstallPathHandler(svr.Container(), "/livez", hc.LivezChecks)
+		healthz.InstallPathHandler(svr.Container(), "/readyz", hc.ReadyzChecks)
+		healthz.InstallPathHandler(svr.Container(), "/_ping", hc.HealthzChecks)
+	} else if s.HealthCheck {
+		// servers without health checks are healthy as long as they answer
+		ping := func() []healthz.HealthChecker { return []healthz.HealthChecker{healthz.PingHealthz} }
+		healthz.InstallPathHandler(svr.Container(), "/healthz", ping)
+		healthz.InstallPathHandler(svr.Container(), "/_ping", ping)
 	}
 	if s.PathPrefix != "" {
 		svr.Container().Router(decorator.NewRewriteRouter(s.PathPrefix, svr.L()))
@@ -173,9 +178,3 @@ func CreateListener(network, addr string) (net.Listener, int, error) {
 
 	return ln, tcpAddr.Port, nil
 }
-
-type healthz struct{}
-
-func (healthz) ServeHTTP(rw http.ResponseWriter, httpRequest *http.Request) {
-	io.WriteString(rw, "ok")
-}
@@ -2,6 +2,7 @@ package options
 
 import (
 	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
 	"gomod.alauda.cn/alauda-backend/pkg/server"
 )
 
@@ -11,3 +12,16 @@ type Optioner interface {
 	ApplyFlags() []error
 	ApplyToServer(server.Server) error
 }
+
+// Reloadable is implemented by options which can be applied again
+// to a running server when the configuration changes
+type Reloadable interface {
+	// WatchFiles returns files, besides the configuration file,
+	// which trigger a reload when changed
+	WatchFiles() []string
+	// ApplyReloadFlags applies the options which can be changed without restart
+	// from the configuration, other options keep the values applied on start
+	ApplyReloadFlags(config *viper.Viper) []error
+	// Reload applies the options to a running server
+	Reload(server.Server) error
+}
@@ -1,6 +1,8 @@
 package options
 
 import (
+	"sync/atomic"
+
 	restful "github.com/emicklei/go-restful/v3"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -20,9 +22,13 @@ const (
 type LogOptions struct {
 	*log.Options
 	RequestLog bool
+
+	// requestLog is RequestLog applied to the server, changed when reloading
+	requestLog int32
 }
 
 var _ Optioner = &LogOptions{}
+var _ Reloadable = &LogOptions{}
 
 // NewLogOptions constructs log options
 func NewLogOptions() *LogOptions {
@@ -41,7 +47,7 @@ func (o *LogOptions) AddFlags(fs *pflag.FlagSet) {
 
 	fs.Bool(flagRequestLog, o.RequestLog,
 		"Enable request logs as debug")
-	_ = viper.BindPFlag(configRequestLog, fs.Lookup(flagRequestLog))
+	bindFlag(fs, configRequestLog, flagRequestLog)
 }
 
 // ApplyFlags apply flags to this option
@@ -54,18 +60,53 @@ func (o *LogOptions) ApplyFlags() []error {
 	return errs
 }
 
+// ApplyReloadFlags applies the log level and request logging from the configuration.
+// The embedded log options read the global configuration
+// which is only replaced once the reloaded configuration is valid
+func (o *LogOptions) ApplyReloadFlags(config *viper.Viper) []error {
+	var errs []error
+
+	errs = append(errs, o.Options.ApplyFlags()...)
+	o.RequestLog = config.GetBool(configRequestLog)
+
+	return errs
+}
+
 // ApplyToServer apply to server
 func (o *LogOptions) ApplyToServer(svr server.Server) (err error) {
+	o.applyLogger(svr)
+	svr.Container().Filter(func(req *restful.Request, res *restful.Response, chain *restful.FilterChain) {
+		if atomic.LoadInt32(&o.requestLog) == 0 {
+			chain.ProcessFilter(req, res)
+			return
+		}
+		svr.L().Debug("==> request received", log.String("url", req.Request.RequestURI), log.Any("header", req.Request.Header))
+		chain.ProcessFilter(req, res)
+		svr.L().Debug("<== request resolved", log.String("url", req.Request.RequestURI), log.Int("status", res.StatusCode()), log.Any("header", req.Request.Header))
+	})
+	return
+}
+
+// WatchFiles no files are watched for log options
+func (o *LogOptions) WatchFiles() []string {
+	return nil
+}
+
+// Reload initializes the logger again with the current level
+// and enables or disables request logs
+func (o *LogOptions) Reload(svr server.Server) (err error) {
+	o.applyLogger(svr)
+	return
+}
+
+func (o *LogOptions) applyLogger(svr server.Server) {
 	log.InitLogger(o.Options)
-	if logSetter := svr.(server.LoggerSetter); logSetter != nil {
+	if logSetter, ok := svr.(server.LoggerSetter); ok {
 		logSetter.SetLogger(log.ZapLogger())
 	}
+	var requestLog int32
 	if o.RequestLog {
-		svr.Container().Filter(func(req *restful.Request, res *restful.Response, chain *restful.FilterChain) {
-			svr.L().Debug("==> request received", log.String("url", req.Request.RequestURI), log.Any("header", req.Request.Header))
-			chain.ProcessFilter(req, res)
-			svr.L().Debug("<== request resolved", log.String("url", req.Request.RequestURI), log.Int("status", res.StatusCode()), log.Any("header", req.Request.Header))
-		})
+		requestLog = 1
 	}
-	return
+	atomic.StoreInt32(&o.requestLog, requestLog)
 }
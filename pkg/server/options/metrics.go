@@ -46,7 +46,7 @@ func (o *MetricsOptions) AddFlags(fs *pflag.FlagSet) {
 
 	fs.Bool(flagEnableMetrics, o.EnableMetrics,
 		"Enable metrics for prometheus web interface host:port/metrics")
-	_ = viper.BindPFlag(configEnableMetrics, fs.Lookup(flagEnableMetrics))
+	bindFlag(fs, configEnableMetrics, flagEnableMetrics)
 }
 
 // ApplyFlags parsing parameters from the command line or configuration file
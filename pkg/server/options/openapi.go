@@ -53,10 +53,10 @@ func (o *OpenAPIOptions) AddFlags(fs *pflag.FlagSet) {
 
 	fs.Bool(flagOpenAPISwagger, o.EnableSwagger,
 		"Enable swagger api docs on /swagger.json")
-	_ = viper.BindPFlag(configOpenAPISwagger, fs.Lookup(flagOpenAPISwagger))
+	bindFlag(fs, configOpenAPISwagger, flagOpenAPISwagger)
 	fs.Bool(flagOpenAPISwaggerUI, o.EnableSwaggerUI,
 		"Enable swagger ui on /swagger-ui if swagger api docs is enabled")
-	_ = viper.BindPFlag(configOpenAPISwaggerUI, fs.Lookup(flagOpenAPISwaggerUI))
+	bindFlag(fs, configOpenAPISwaggerUI, flagOpenAPISwaggerUI)
 }
 
 // ApplyFlags parsing parameters from the command line or configuration file
@@ -1,13 +1,36 @@
 package options
 
 import (
+	"context"
+	"fmt"
+	"sync"
+
 	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
 	"gomod.alauda.cn/alauda-backend/pkg/server"
+	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 // Options multiple options aggregator
 type Options struct {
 	Options []Optioner
+
+	// ConfigFile path to a YAML or JSON configuration file
+	// loaded before applying flags
+	ConfigFile string
+
+	// EnvPrefix if set, enables configuration using environment variables
+	// prefixed with EnvPrefix, i.e. PREFIX_CLIENT_QPS for client.qps
+	EnvPrefix string
+
+	// EnableReload if set, the configuration file and files watched by Reloadable
+	// options are reloaded when changed or when the process receives SIGHUP
+	EnableReload bool
+
+	reloadLock sync.Mutex
+
+	// keys all known configuration keys after adding flags
+	keys sets.String
 }
 
 // With create a multiple options handler
@@ -29,15 +52,28 @@ func (o *Options) Add(opts ...Optioner) *Options {
 	return o
 }
 
+// WithEnvPrefix enables configuration using environment variables with the given prefix
+func (o *Options) WithEnvPrefix(prefix string) *Options {
+	o.EnvPrefix = prefix
+	return o
+}
+
 // AddFlags add flags for all recommended options
 func (o *Options) AddFlags(pf *pflag.FlagSet) {
+	o.addConfigFlags(pf)
+	o.addReloadFlags(pf)
 	for _, opts := range o.Options {
 		opts.AddFlags(pf)
 	}
+	o.keys = sets.NewString(viper.AllKeys()...)
 }
 
-// ApplyFlags apply flags as configuration and return errors if any
+// ApplyFlags loads the configuration file and environment variables if enabled,
+// apply flags as configuration and return errors if any
 func (o *Options) ApplyFlags() []error {
+	if errs := o.loadConfig(); len(errs) > 0 {
+		return errs
+	}
 	var errs []error
 	for _, opts := range o.Options {
 		errs = append(errs, opts.ApplyFlags()...)
@@ -46,6 +82,7 @@ func (o *Options) ApplyFlags() []error {
 }
 
 // ApplyToServer apply configuration to server instance
+// and starts the configuration reloader after the server starts if enabled
 func (o *Options) ApplyToServer(sv server.Server) (err error) {
 	for _, opts := range o.Options {
 		err = opts.ApplyToServer(sv)
@@ -53,5 +90,15 @@ func (o *Options) ApplyToServer(sv server.Server) (err error) {
 			return
 		}
 	}
+	if o.EnableReload {
+		hooks, ok := sv.(server.LifecycleHooks)
+		if !ok {
+			return fmt.Errorf("reloading the configuration requires a server supporting lifecycle hooks")
+		}
+		registerReloadMetrics()
+		hooks.AddPostStartHook("config-reloader", func(ctx context.Context) error {
+			return o.startReloader(ctx, sv)
+		})
+	}
 	return
 }
@@ -12,6 +12,7 @@ func NewRecommendedOptions() *RecommendedOptions {
 			NewLogOptions(),
 			NewKlogOptions(),
 			NewInsecureServingOptions(),
+			NewServingOptions(),
 			NewClientOptions(),
 			NewDebugOptions(),
 			NewMetricsOptions(),
@@ -0,0 +1,312 @@
+package options
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gomod.alauda.cn/alauda-backend/pkg/server"
+	"gomod.alauda.cn/log"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	flagEnableReload = "enable-reload"
+)
+
+const (
+	// reloadDebounce time waited after a file event before reloading,
+	// editors and kubernetes configmap updates trigger multiple events for one change
+	reloadDebounce = time.Second
+	// configMapDataDir name of the symlink kubernetes swaps when updating mounted configmaps
+	configMapDataDir = "..data"
+
+	reloadSuccess = "success"
+	reloadFailure = "failure"
+)
+
+var (
+	configReloadsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "config_reloads_total",
+			Help: "Counter of configuration reloads broken out for each result.",
+		},
+		[]string{"result"},
+	)
+	configLastReloadTimestamp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "config_last_reload_timestamp_seconds",
+			Help: "Timestamp of the last configuration reload broken out for each result.",
+		},
+		[]string{"result"},
+	)
+
+	registerReloadMetricsOnce sync.Once
+)
+
+// registerReloadMetrics registers the reload metrics on the default prometheus registry,
+// independently of the metrics options as the reloader may be enabled without serving metrics
+func registerReloadMetrics() {
+	registerReloadMetricsOnce.Do(func() {
+		prometheus.MustRegister(configReloadsTotal, configLastReloadTimestamp)
+	})
+}
+
+// addReloadFlags adds flags for configuration reload
+func (o *Options) addReloadFlags(fs *pflag.FlagSet) {
+	if fs.Lookup(flagEnableReload) == nil {
+		fs.BoolVar(&o.EnableReload, flagEnableReload, o.EnableReload,
+			"Reload the configuration file and watched files, i.e. the audit policy, when changed or when receiving SIGHUP. "+
+				"Only the audit policy, log level, request logging and client qps and burst are applied without restart.")
+	}
+}
+
+// Reload loads the configuration file again and applies all Reloadable options to the server.
+// The configuration is loaded into a separate instance and validated on copies of the options first,
+// the configuration is only replaced and the options changed and applied if it is valid,
+// otherwise the current one is kept. Only the options which can be reloaded are changed
+func (o *Options) Reload(sv server.Server) (err error) {
+	o.reloadLock.Lock()
+	defer o.reloadLock.Unlock()
+	registerReloadMetrics()
+
+	defer func() {
+		result := reloadSuccess
+		if err != nil {
+			result = reloadFailure
+			sv.L().Error("configuration reload failed, keeping current configuration", log.Err(err))
+		} else {
+			sv.L().Info("configuration reloaded", log.String("config", o.ConfigFile))
+		}
+		configReloadsTotal.WithLabelValues(result).Inc()
+		configLastReloadTimestamp.WithLabelValues(result).SetToCurrentTime()
+	}()
+
+	data, errs := o.readConfigFile()
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	config := o.newConfig()
+	if errs := o.setConfig(config, data); len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	for _, opts := range o.Options {
+		if cp, ok := copyOptions(opts).(Reloadable); ok {
+			errs = append(errs, cp.ApplyReloadFlags(config)...)
+		}
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	if errs := o.setConfig(viper.GetViper(), data); len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	for _, opts := range o.reloadables() {
+		errs = append(errs, opts.ApplyReloadFlags(viper.GetViper())...)
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	for _, opts := range o.reloadables() {
+		if err := opts.Reload(sv); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// copyOptions returns a copy of options which are a pointer to a struct, nil otherwise.
+// Pointers to structs in exported fields are copied as well, i.e. embedded options,
+// thus applying flags to the copy leaves the options unchanged
+func copyOptions(opts Optioner) Optioner {
+	val := reflect.ValueOf(opts)
+	if val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	cp, _ := copyStruct(val).Interface().(Optioner)
+	return cp
+}
+
+// copyStruct copies the struct a pointer points to and the structs its exported fields point to
+func copyStruct(val reflect.Value) reflect.Value {
+	cp := reflect.New(val.Elem().Type())
+	cp.Elem().Set(val.Elem())
+	for i := 0; i < cp.Elem().NumField(); i++ {
+		field := cp.Elem().Field(i)
+		if field.CanSet() && field.Kind() == reflect.Ptr && !field.IsNil() && field.Elem().Kind() == reflect.Struct {
+			field.Set(copyStruct(field))
+		}
+	}
+	return cp
+}
+
+func (o *Options) reloadables() []Reloadable {
+	var reloadables []Reloadable
+	for _, opts := range o.Options {
+		if r, ok := opts.(Reloadable); ok {
+			reloadables = append(reloadables, r)
+		}
+	}
+	return reloadables
+}
+
+// watchFiles returns the configuration file and all files watched by Reloadable options
+func (o *Options) watchFiles() sets.String {
+	files := sets.NewString()
+	if o.ConfigFile != "" {
+		files.Insert(filepath.Clean(o.ConfigFile))
+	}
+	for _, opts := range o.reloadables() {
+		for _, f := range opts.WatchFiles() {
+			if f != "" {
+				files.Insert(filepath.Clean(f))
+			}
+		}
+	}
+	return files
+}
+
+// configReloader reloads options when watched files change or SIGHUP is received
+type configReloader struct {
+	options *Options
+	server  server.Server
+	watcher *fsnotify.Watcher
+
+	lock  sync.Mutex
+	files sets.String
+	dirs  sets.String
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// startReloader starts a reloader in the background
+// which is stopped when ctx is done or before the server shuts down
+func (o *Options) startReloader(ctx context.Context, sv server.Server) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	r := &configReloader{
+		options: o,
+		server:  sv,
+		watcher: watcher,
+		files:   sets.NewString(),
+		dirs:    sets.NewString(),
+		stopCh:  make(chan struct{}),
+	}
+	if err := r.syncWatches(); err != nil {
+		watcher.Close()
+		return err
+	}
+	addPreShutdownHook(sv, "config-reloader", func(context.Context) error {
+		r.stop()
+		return nil
+	})
+
+	go r.run(ctx)
+
+	sv.L().Info("Starting configuration reloader", log.Strings("files", r.files.List()))
+	return nil
+}
+
+// syncWatches watches the directories of all watched files. Directories are watched
+// instead of files to survive files being replaced, i.e. kubernetes configmaps
+func (r *configReloader) syncWatches() error {
+	files := r.options.watchFiles()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.files = files
+	for _, f := range files.List() {
+		dir := filepath.Dir(f)
+		if r.dirs.Has(dir) {
+			continue
+		}
+		if err := r.watcher.Add(dir); err != nil {
+			return err
+		}
+		r.dirs.Insert(dir)
+	}
+	return nil
+}
+
+func (r *configReloader) run(ctx context.Context) {
+	defer r.watcher.Close()
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.stopCh:
+			return
+		case <-sighup:
+			r.server.L().Info("received SIGHUP, reloading configuration")
+			r.reload()
+		case event, ok := <-r.watcher.Events:
+			// Channel is closed.
+			if !ok {
+				return
+			}
+			if r.isWatched(event) {
+				r.server.L().Debug("configuration event, " + event.String())
+				debounce.Reset(reloadDebounce)
+			}
+		case <-debounce.C:
+			r.reload()
+		case err, ok := <-r.watcher.Errors:
+			// Channel is closed.
+			if !ok {
+				return
+			}
+			r.server.L().Error("configuration watch error, " + err.Error())
+		}
+	}
+}
+
+func (r *configReloader) reload() {
+	if err := r.options.Reload(r.server); err != nil {
+		return
+	}
+	// watched files may change with the configuration
+	if err := r.syncWatches(); err != nil {
+		r.server.L().Error("configuration watch error, " + err.Error())
+	}
+}
+
+func (r *configReloader) stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+	})
+}
+
+// isWatched returns true if the event may modify the contents of a watched file
+func (r *configReloader) isWatched(event fsnotify.Event) bool {
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+		return false
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	name := filepath.Clean(event.Name)
+	return r.files.Has(name) ||
+		(filepath.Base(name) == configMapDataDir && r.dirs.Has(filepath.Dir(name)))
+}
@@ -0,0 +1,172 @@
+package options
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"gomod.alauda.cn/alauda-backend/pkg/client"
+	"gomod.alauda.cn/alauda-backend/pkg/server"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestReload(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		wantErr   bool
+		wantQPS   float32
+		wantBurst int
+	}{
+		{
+			name:      "valid configuration is applied",
+			data:      "client:\n  qps: 20\n  burst: 30\n",
+			wantQPS:   20,
+			wantBurst: 30,
+		},
+		{
+			name:      "removed keys fallback to the defaults",
+			data:      "client:\n  burst: 30\n",
+			wantQPS:   1e6,
+			wantBurst: 30,
+		},
+		{
+			name:      "invalid value keeps the configuration",
+			data:      "client:\n  qps: fast\n  burst: 30\n",
+			wantErr:   true,
+			wantQPS:   5,
+			wantBurst: 10,
+		},
+		{
+			name:      "unknown key keeps the configuration",
+			data:      "client:\n  qps: 20\n  unknown: 1\n",
+			wantErr:   true,
+			wantQPS:   5,
+			wantBurst: 10,
+		},
+		{
+			name:      "options which cannot be reloaded are not applied",
+			data:      "client:\n  qps: 20\n  burst: 30\n  enable_multi_cluster: true\n",
+			wantQPS:   20,
+			wantBurst: 30,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeConfig(t, "config.yaml", "client:\n  qps: 5\n  burst: 10\n")
+			clientOpts := NewClientOptions()
+			opts := With(clientOpts)
+			parseFlags(t, opts, "--config="+path)
+			if errs := opts.ApplyFlags(); len(errs) > 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			srv := server.New("test")
+			srv.(*server.DefaultServer).SetLogger(zap.NewNop())
+			if err := opts.ApplyToServer(srv); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := ioutil.WriteFile(path, []byte(test.data), 0o600); err != nil {
+				t.Fatalf("failed to write configuration file: %v", err)
+			}
+			if err := opts.Reload(srv); (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if clientOpts.QPS != test.wantQPS || clientOpts.Burst != test.wantBurst {
+				t.Errorf("got qps %v and burst %d, want %v and %d", clientOpts.QPS, clientOpts.Burst, test.wantQPS, test.wantBurst)
+			}
+			if clientOpts.EnableMultiCluster {
+				t.Errorf("expected the multi cluster configuration not to be applied")
+			}
+			// rejected configurations are not loaded
+			if got := float32(viper.GetFloat64(configQPS)); got != test.wantQPS {
+				t.Errorf("got configured qps %v, want %v", got, test.wantQPS)
+			}
+			cfg := srv.GetManager().(*client.DefaultManager).ManagerConfig()
+			if cfg.QPS != test.wantQPS || cfg.Burst != test.wantBurst {
+				t.Errorf("got client qps %v and burst %d, want %v and %d", cfg.QPS, cfg.Burst, test.wantQPS, test.wantBurst)
+			}
+		})
+	}
+}
+
+func TestAuditApplyReloadFlags(t *testing.T) {
+	policy := writeConfig(t, "policy.yaml", "rules:\n- level: Metadata\n  match:\n    methods: [post]\n")
+	invalid := writeConfig(t, "invalid.yaml", "rules: [\n")
+
+	tests := []struct {
+		name       string
+		policyFile string
+		wantErr    bool
+	}{
+		{name: "valid policy", policyFile: policy},
+		{name: "invalid policy", policyFile: invalid, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := NewAuditOptions()
+			config := viper.New()
+			config.Set(configAuditPolicyFile, test.policyFile)
+			config.Set(configAuditWorkerNum, 3)
+			config.Set(configAuditQueueSize, 10)
+
+			if errs := opts.ApplyReloadFlags(config); (len(errs) > 0) != test.wantErr {
+				t.Fatalf("got errors %v, want error %v", errs, test.wantErr)
+			}
+			if opts.PolicyFile != test.policyFile {
+				t.Errorf("got policy file %q, want %q", opts.PolicyFile, test.policyFile)
+			}
+			// workers and the queue are only applied on start
+			if opts.WorkerNum != 15 || opts.QueueSize != 1000 {
+				t.Errorf("got %d workers and queue size %d, want the values applied on start", opts.WorkerNum, opts.QueueSize)
+			}
+		})
+	}
+}
+
+func TestCopyOptions(t *testing.T) {
+	orig := NewLogOptions()
+	cp, ok := copyOptions(orig).(*LogOptions)
+	if !ok {
+		t.Fatalf("expected a copy of the log options")
+	}
+	if cp == orig || cp.Options == orig.Options {
+		t.Errorf("expected the options and the embedded options to be copied")
+	}
+	cp.RequestLog = false
+	if !orig.RequestLog {
+		t.Errorf("changing the copy changed the options")
+	}
+
+	if copyOptions(Optioner(nil)) != nil {
+		t.Errorf("expected no copy of nil options")
+	}
+}
+
+func TestReloaderIsWatched(t *testing.T) {
+	r := &configReloader{
+		files: sets.NewString("/etc/app/config.yaml", "/etc/audit/policy.yaml"),
+		dirs:  sets.NewString("/etc/app", "/etc/audit"),
+	}
+	tests := []struct {
+		event fsnotify.Event
+		want  bool
+	}{
+		{event: fsnotify.Event{Name: "/etc/app/config.yaml", Op: fsnotify.Write}, want: true},
+		{event: fsnotify.Event{Name: "/etc/app/./config.yaml", Op: fsnotify.Create}, want: true},
+		{event: fsnotify.Event{Name: "/etc/audit/policy.yaml", Op: fsnotify.Remove}, want: true},
+		{event: fsnotify.Event{Name: "/etc/app/..data", Op: fsnotify.Create}, want: true},
+		{event: fsnotify.Event{Name: "/etc/other/..data", Op: fsnotify.Create}, want: false},
+		{event: fsnotify.Event{Name: "/etc/app/config.yaml", Op: fsnotify.Chmod}, want: false},
+		{event: fsnotify.Event{Name: "/etc/app/other.yaml", Op: fsnotify.Write}, want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.event.String(), func(t *testing.T) {
+			if got := r.isWatched(test.event); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
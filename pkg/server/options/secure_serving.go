@@ -27,6 +27,7 @@ import (
 	"strings"
 
 	"gomod.alauda.cn/alauda-backend/pkg/certwatcher"
+	"gomod.alauda.cn/alauda-backend/pkg/healthz"
 	"gomod.alauda.cn/alauda-backend/pkg/server"
 	"gomod.alauda.cn/log"
 
@@ -148,6 +149,7 @@ func (s *SecureServingOptions) ApplyToServer(srv server.Server) (err error) {
 				log.Error("certificate watcher error, " + err.Error())
 			}
 		}()
+		addReadyzChecks(srv, healthz.NamedCheck("tls-certificate", cw.Check))
 
 		cfg := &tls.Config{ //nolint:gosec
 			NextProtos:     []string{"h2"},
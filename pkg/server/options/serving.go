@@ -0,0 +1,159 @@
+package options
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gomod.alauda.cn/alauda-backend/pkg/server"
+)
+
+const (
+	flagServingReadTimeout       = "read-timeout"
+	flagServingReadHeaderTimeout = "read-header-timeout"
+	flagServingWriteTimeout      = "write-timeout"
+	flagServingIdleTimeout       = "idle-timeout"
+	flagServingMaxHeaderBytes    = "max-header-bytes"
+	flagServingKeepAlive         = "keep-alive"
+	flagServingH2C               = "enable-h2c"
+	flagServingShutdownTimeout   = "shutdown-timeout"
+)
+
+const (
+	configServingReadTimeout       = "server.read_timeout"
+	configServingReadHeaderTimeout = "server.read_header_timeout"
+	configServingWriteTimeout      = "server.write_timeout"
+	configServingIdleTimeout       = "server.idle_timeout"
+	configServingMaxHeaderBytes    = "server.max_header_bytes"
+	configServingKeepAlive         = "server.keep_alive"
+	configServingH2C               = "server.enable_h2c"
+	configServingShutdownTimeout   = "server.shutdown_timeout"
+)
+
+// ServingOptions holds the options to tune the http servers
+// started for every listener of the server
+type ServingOptions struct {
+	// ReadTimeout is the maximum duration for reading the entire request, including the body.
+	ReadTimeout time.Duration
+	// ReadHeaderTimeout is the amount of time allowed to read request headers.
+	ReadHeaderTimeout time.Duration
+	// WriteTimeout is the maximum duration before timing out writes of the response.
+	WriteTimeout time.Duration
+	// IdleTimeout is the maximum amount of time to wait for the next request when keep-alives are enabled.
+	IdleTimeout time.Duration
+	// MaxHeaderBytes controls the maximum number of bytes the server will read parsing the request header.
+	MaxHeaderBytes int
+	// KeepAlive enables HTTP keep-alives
+	KeepAlive bool
+	// EnableH2C enables HTTP/2 over cleartext TCP
+	EnableH2C bool
+	// ShutdownTimeout is the maximum duration to wait for in-flight requests during shutdown
+	ShutdownTimeout time.Duration
+}
+
+var _ Optioner = &ServingOptions{}
+
+// NewServingOptions creates the default ServingOptions object.
+func NewServingOptions() *ServingOptions {
+	return &ServingOptions{
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       90 * time.Second,
+		MaxHeaderBytes:    1 << 20,
+		KeepAlive:         true,
+		ShutdownTimeout:   30 * time.Second,
+	}
+}
+
+// AddFlags adds flags related to http serving to the specified FlagSet.
+func (o *ServingOptions) AddFlags(fs *pflag.FlagSet) {
+	if o == nil {
+		return
+	}
+
+	fs.Duration(flagServingReadTimeout, o.ReadTimeout,
+		"The maximum duration for reading the entire request, including the body. 0 means no timeout.")
+	bindFlag(fs, configServingReadTimeout, flagServingReadTimeout)
+
+	fs.Duration(flagServingReadHeaderTimeout, o.ReadHeaderTimeout,
+		"The amount of time allowed to read request headers. If 0, --"+flagServingReadTimeout+" is used.")
+	bindFlag(fs, configServingReadHeaderTimeout, flagServingReadHeaderTimeout)
+
+	fs.Duration(flagServingWriteTimeout, o.WriteTimeout,
+		"The maximum duration before timing out writes of the response. 0 means no timeout.")
+	bindFlag(fs, configServingWriteTimeout, flagServingWriteTimeout)
+
+	fs.Duration(flagServingIdleTimeout, o.IdleTimeout,
+		"The maximum amount of time to wait for the next request when keep-alives are enabled. If 0, --"+flagServingReadTimeout+" is used.")
+	bindFlag(fs, configServingIdleTimeout, flagServingIdleTimeout)
+
+	fs.Int(flagServingMaxHeaderBytes, o.MaxHeaderBytes,
+		"The maximum number of bytes the server will read parsing the request header.")
+	bindFlag(fs, configServingMaxHeaderBytes, flagServingMaxHeaderBytes)
+
+	fs.Bool(flagServingKeepAlive, o.KeepAlive,
+		"Enables HTTP keep-alives.")
+	bindFlag(fs, configServingKeepAlive, flagServingKeepAlive)
+
+	fs.Bool(flagServingH2C, o.EnableH2C,
+		"Enables HTTP/2 over cleartext TCP (h2c).")
+	bindFlag(fs, configServingH2C, flagServingH2C)
+
+	fs.Duration(flagServingShutdownTimeout, o.ShutdownTimeout,
+		"The maximum duration to wait for in-flight requests and audit jobs during graceful shutdown.")
+	bindFlag(fs, configServingShutdownTimeout, flagServingShutdownTimeout)
+}
+
+// ApplyFlags parsing parameters from the command line or configuration file
+// to the options instance.
+func (o *ServingOptions) ApplyFlags() []error {
+	var errs []error
+
+	o.ReadTimeout = viper.GetDuration(configServingReadTimeout)
+	o.ReadHeaderTimeout = viper.GetDuration(configServingReadHeaderTimeout)
+	o.WriteTimeout = viper.GetDuration(configServingWriteTimeout)
+	o.IdleTimeout = viper.GetDuration(configServingIdleTimeout)
+	o.MaxHeaderBytes = viper.GetInt(configServingMaxHeaderBytes)
+	o.KeepAlive = viper.GetBool(configServingKeepAlive)
+	o.EnableH2C = viper.GetBool(configServingH2C)
+	o.ShutdownTimeout = viper.GetDuration(configServingShutdownTimeout)
+
+	for flag, value := range map[string]time.Duration{
+		flagServingReadTimeout:       o.ReadTimeout,
+		flagServingReadHeaderTimeout: o.ReadHeaderTimeout,
+		flagServingWriteTimeout:      o.WriteTimeout,
+		flagServingIdleTimeout:       o.IdleTimeout,
+		flagServingShutdownTimeout:   o.ShutdownTimeout,
+	} {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %v", flag, value))
+		}
+	}
+	if o.MaxHeaderBytes < 0 {
+		errs = append(errs, fmt.Errorf("%s must not be negative, got %d", flagServingMaxHeaderBytes, o.MaxHeaderBytes))
+	}
+
+	return errs
+}
+
+// ApplyToServer apply options to server
+func (o *ServingOptions) ApplyToServer(srv server.Server) error {
+	if o == nil {
+		return nil
+	}
+	if setter, ok := srv.(server.HTTPServerConfigSetter); ok {
+		setter.SetHTTPServerConfig(server.HTTPServerConfig{
+			ReadTimeout:       o.ReadTimeout,
+			ReadHeaderTimeout: o.ReadHeaderTimeout,
+			WriteTimeout:      o.WriteTimeout,
+			IdleTimeout:       o.IdleTimeout,
+			MaxHeaderBytes:    o.MaxHeaderBytes,
+			DisableKeepAlives: !o.KeepAlive,
+			EnableH2C:         o.EnableH2C,
+		})
+	}
+	if setter, ok := srv.(server.ShutdownTimeoutSetter); ok {
+		setter.SetShutdownTimeout(o.ShutdownTimeout)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package options
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gomod.alauda.cn/alauda-backend/pkg/server"
+)
+
+// parseFlags resets the configuration, adds the flags of the optioner and parses the arguments
+func parseFlags(t *testing.T, opt Optioner, args ...string) {
+	viper.Reset()
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	opt.AddFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("failed to parse flags %v: %v", args, err)
+	}
+}
+
+func TestServingOptions(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		wantErrs     int
+		wantConfig   server.HTTPServerConfig
+		wantShutdown time.Duration
+	}{
+		{
+			name: "defaults",
+			wantConfig: server.HTTPServerConfig{
+				ReadHeaderTimeout: 10 * time.Second,
+				IdleTimeout:       90 * time.Second,
+				MaxHeaderBytes:    1 << 20,
+			},
+			wantShutdown: 30 * time.Second,
+		},
+		{
+			name: "flags",
+			args: []string{
+				"--read-timeout=1s", "--read-header-timeout=2s", "--write-timeout=3s", "--idle-timeout=4s",
+				"--max-header-bytes=1024", "--keep-alive=false", "--enable-h2c", "--shutdown-timeout=5s",
+			},
+			wantConfig: server.HTTPServerConfig{
+				ReadTimeout:       time.Second,
+				ReadHeaderTimeout: 2 * time.Second,
+				WriteTimeout:      3 * time.Second,
+				IdleTimeout:       4 * time.Second,
+				MaxHeaderBytes:    1024,
+				DisableKeepAlives: true,
+				EnableH2C:         true,
+			},
+			wantShutdown: 5 * time.Second,
+		},
+		{
+			name:     "negative values",
+			args:     []string{"--read-timeout=-1s", "--shutdown-timeout=-1s", "--max-header-bytes=-1"},
+			wantErrs: 3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := NewServingOptions()
+			parseFlags(t, opts, test.args...)
+			errs := opts.ApplyFlags()
+			if len(errs) != test.wantErrs {
+				t.Fatalf("got errors %v, want %d errors", errs, test.wantErrs)
+			}
+			if test.wantErrs > 0 {
+				return
+			}
+
+			srv := server.New("test")
+			if err := opts.ApplyToServer(srv); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := srv.(*server.DefaultServer).GetHTTPServerConfig(); got != test.wantConfig {
+				t.Errorf("got config %+v, want %+v", got, test.wantConfig)
+			}
+			if got := srv.(*server.DefaultServer).GetShutdownTimeout(); got != test.wantShutdown {
+				t.Errorf("got shutdown timeout %v, want %v", got, test.wantShutdown)
+			}
+		})
+	}
+}
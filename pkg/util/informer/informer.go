@@ -0,0 +1,54 @@
+package informer
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ChangeHandler is called with the changed object after an object of a cache was added, updated or deleted
+type ChangeHandler func(obj interface{}, deleted bool)
+
+// ChangeNotifier notifies handlers after a cache changed, it is embedded by caches filled by informers
+type ChangeNotifier struct {
+	lock     sync.RWMutex
+	handlers []ChangeHandler
+}
+
+// AddChangeHandler adds a handler called after the cache changed
+func (n *ChangeNotifier) AddChangeHandler(handler func()) {
+	n.AddObjectChangeHandler(func(interface{}, bool) {
+		handler()
+	})
+}
+
+// AddObjectChangeHandler adds a handler called with the changed object after the cache changed
+func (n *ChangeNotifier) AddObjectChangeHandler(handler ChangeHandler) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.handlers = append(n.handlers, handler)
+}
+
+// Notify calls all handlers with the changed object, nil if the change is not about a single object
+func (n *ChangeNotifier) Notify(obj interface{}, deleted bool) {
+	n.lock.RLock()
+	handlers := n.handlers
+	n.lock.RUnlock()
+	for _, handler := range handlers {
+		handler(obj, deleted)
+	}
+}
+
+// IsResync returns true if the update event was caused by an informer resync
+// and the object did not change
+func IsResync(old, new interface{}) bool {
+	oldObj, ok := old.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	newObj, ok := new.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	return oldObj.GetResourceVersion() == newObj.GetResourceVersion()
+}
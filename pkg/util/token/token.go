@@ -8,6 +8,17 @@ import (
 	"strings"
 
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+const (
+	// ExtraIsAdmin user extra key marking platform administrators
+	ExtraIsAdmin = "is_admin"
+	// ExtraConnID user extra key of the connector the user logged in with
+	ExtraConnID = "conn_id"
+
+	serviceAccountGroup       = "system:serviceaccounts"
+	serviceAccountGroupPrefix = "system:serviceaccounts:"
 )
 
 var serviceAccountIssuers []string = []string{
@@ -31,6 +42,11 @@ type JWEToken struct {
 	Ext           jwtTokenExt `json:"ext"`
 	MetadataName  string
 	Sid           string `json:"sid,omitempty"`
+
+	// ServiceAccountUID is the uid of the ServiceAccount this token is bound to
+	ServiceAccountUID string `json:"kubernetes.io/serviceaccount/service-account.uid,omitempty"`
+	// ServiceAccountNamespace is the namespace which the ServiceAccount lives in
+	ServiceAccountNamespace string `json:"kubernetes.io/serviceaccount/namespace,omitempty"`
 }
 
 func (t *JWEToken) IsServiceAccount() bool {
@@ -42,6 +58,34 @@ func (t *JWEToken) IsServiceAccount() bool {
 	return false
 }
 
+// UserInfo returns the user described by the token claims.
+// Service accounts are named by the token subject, other users by their email.
+// The claims are not verified, the user must only be authorized if an authenticator verified the token
+func (t *JWEToken) UserInfo() user.Info {
+	info := &user.DefaultInfo{
+		Name:   t.Email,
+		UID:    t.Subject,
+		Groups: t.Groups,
+		Extra:  map[string][]string{},
+	}
+	if t.IsServiceAccount() {
+		info.Name = t.Subject
+		info.UID = t.ServiceAccountUID
+		info.Groups = []string{serviceAccountGroup}
+		if t.ServiceAccountNamespace != "" {
+			info.Groups = append(info.Groups, serviceAccountGroupPrefix+t.ServiceAccountNamespace)
+		}
+		return info
+	}
+	if t.Ext.IsAdmin {
+		info.Extra[ExtraIsAdmin] = []string{"true"}
+	}
+	if t.Ext.ConnID != "" {
+		info.Extra[ExtraConnID] = []string{t.Ext.ConnID}
+	}
+	return info
+}
+
 type jwtTokenExt struct {
 	IsAdmin bool   `json:"is_admin"`
 	ConnID  string `json:"conn_id"`
@@ -0,0 +1,78 @@
+package token
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func TestUserInfo(t *testing.T) {
+	tests := []struct {
+		name  string
+		token JWEToken
+		want  *user.DefaultInfo
+	}{
+		{
+			name:  "user",
+			token: JWEToken{Issuer: "https://dex", Subject: "alice-id", Email: "alice@example.com", Groups: []string{"devs"}},
+			want:  &user.DefaultInfo{Name: "alice@example.com", UID: "alice-id", Groups: []string{"devs"}, Extra: map[string][]string{}},
+		},
+		{
+			name:  "admin",
+			token: JWEToken{Issuer: "https://dex", Subject: "admin-id", Email: "admin@example.com", Ext: jwtTokenExt{IsAdmin: true, ConnID: "ldap"}},
+			want: &user.DefaultInfo{
+				Name:  "admin@example.com",
+				UID:   "admin-id",
+				Extra: map[string][]string{ExtraIsAdmin: {"true"}, ExtraConnID: {"ldap"}},
+			},
+		},
+		{
+			name: "service account",
+			token: JWEToken{
+				Issuer:                  "kubernetes/serviceaccount",
+				Subject:                 "system:serviceaccount:default:app",
+				ServiceAccountUID:       "app-id",
+				ServiceAccountNamespace: "default",
+				Ext:                     jwtTokenExt{IsAdmin: true},
+			},
+			want: &user.DefaultInfo{
+				Name:   "system:serviceaccount:default:app",
+				UID:    "app-id",
+				Groups: []string{"system:serviceaccounts", "system:serviceaccounts:default"},
+				Extra:  map[string][]string{},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.token.UserInfo(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseRawToken(t *testing.T) {
+	tests := []struct {
+		authorization string
+		want          string
+		wantErr       bool
+	}{
+		{authorization: "Bearer abc", want: " abc"},
+		{authorization: "bearer abc", want: " abc"},
+		{authorization: "Basic abc", want: ""},
+		{authorization: "", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.authorization, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", test.authorization)
+			got, err := ParseRawToken(req)
+			if (err != nil) != test.wantErr || got != test.want {
+				t.Errorf("got %q and error %v, want %q and error %v", got, err, test.want, test.wantErr)
+			}
+		})
+	}
+}